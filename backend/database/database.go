@@ -7,8 +7,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/steve/pman/shared/auth"
 	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/permissions"
 	_ "modernc.org/sqlite"
 )
 
@@ -26,7 +29,10 @@ func Initialize() (*DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// SQLite only enforces foreign keys (e.g. group_members) when asked to,
+	// on every connection. Writers wait for each other rather than failing,
+	// since webhook deliveries are recorded in the background.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -38,9 +44,14 @@ func Initialize() (*DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	if err := dbWrapper.createDefaultAdmin(); err != nil {
+	if err := dbWrapper.migrate(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create default admin: %w", err)
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if err := dbWrapper.flagDefaultAdminPassword(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return dbWrapper, nil
@@ -74,31 +85,270 @@ func (db *DB) createTables() error {
 	return nil
 }
 
-func (db *DB) createDefaultAdmin() error {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", "admin@pman.system").Scan(&count)
+// migrate brings databases created by older versions up to the current schema.
+// CREATE TABLE IF NOT EXISTS in schema.sql does not add new columns to existing tables.
+func (db *DB) migrate() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"groups", "cache_max_age_hours", "INTEGER NOT NULL DEFAULT 0"},
+		{"passwords", "requires_approval", "BOOLEAN NOT NULL DEFAULT false"},
+		{"passwords", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"tokens", "token_type", "TEXT NOT NULL DEFAULT 'access'"},
+		{"tokens", "session_id", "TEXT NOT NULL DEFAULT ''"},
+		{"tokens", "used", "BOOLEAN NOT NULL DEFAULT false"},
+		{"tokens", "used_at", "DATETIME"},
+		{"users", "mfa_enabled", "BOOLEAN NOT NULL DEFAULT false"},
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "auth_source", "TEXT NOT NULL DEFAULT 'local'"},
+		{"users", "password_changed_at", "DATETIME"},
+		{"users", "must_change_password", "BOOLEAN NOT NULL DEFAULT false"},
+		{"webhook_deliveries", "next_attempt_at", "DATETIME"},
+	}
+
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Indexes on migrated columns can only be created once the columns exist
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_tokens_session_id ON tokens(session_id)",
+		"CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)",
+	}
+
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	if err := db.migrateUserGroups(); err != nil {
+		return err
+	}
+
+	if err := db.registerRoles(); err != nil {
+		return err
+	}
+
+	return db.registerExistingGroups()
+}
+
+// registerRoles writes the current definitions of the built-in roles and adds
+// the free-form roles of older versions as roles without capabilities, so
+// every users.role names a role
+func (db *DB) registerRoles() error {
+	for _, role := range auth.BuiltinRoles {
+		_, err := db.Exec(`
+			INSERT INTO roles (name, description, capabilities, builtin) VALUES (?, ?, ?, true)
+			ON CONFLICT(name) DO UPDATE SET description = excluded.description,
+				capabilities = excluded.capabilities, builtin = true
+		`, role.Name, role.Description, strings.Join(role.Capabilities, ","))
+		if err != nil {
+			return fmt.Errorf("failed to register role %s: %w", role.Name, err)
+		}
+	}
+
+	// SQLite needs the WHERE clause to parse ON CONFLICT after a SELECT
+	_, err := db.Exec(`
+		INSERT INTO roles (name) SELECT DISTINCT role FROM users WHERE true
+		ON CONFLICT(name) DO NOTHING
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to check for default admin: %w", err)
+		return fmt.Errorf("failed to register roles of users: %w", err)
 	}
 
-	if count > 0 {
-		return nil
+	return nil
+}
+
+// migrateUserGroups moves the "group:permission" lists that older versions
+// kept in users.groups to the group_members table and drops the column
+func (db *DB) migrateUserGroups() error {
+	exists, err := db.hasColumn("users", "groups")
+	if err != nil || !exists {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	hashedPassword, err := crypto.HashPassword("DefaultPassword")
+	type assignment struct {
+		userID    int64
+		email     string
+		groupsStr string
+	}
+
+	rows, err := tx.Query("SELECT id, email, groups FROM users")
 	if err != nil {
-		return fmt.Errorf("failed to hash default admin password: %w", err)
+		return fmt.Errorf("failed to read group assignments: %w", err)
+	}
+	var assignments []assignment
+	for rows.Next() {
+		var a assignment
+		if err := rows.Scan(&a.userID, &a.email, &a.groupsStr); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read group assignments: %w", err)
+		}
+		assignments = append(assignments, a)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read group assignments: %w", err)
+	}
+
+	for _, a := range assignments {
+		// An unparsable list never granted access, so nothing is lost
+		groups, err := permissions.ParseGroups(a.groupsStr)
+		if err != nil {
+			log.Printf("Dropping invalid groups %q of user %s: %v", a.groupsStr, a.email, err)
+			continue
+		}
+
+		for _, group := range groups {
+			if _, err := tx.Exec("INSERT INTO groups (name) VALUES (?) ON CONFLICT(name) DO NOTHING", group.GroupName); err != nil {
+				return fmt.Errorf("failed to register group %s: %w", group.GroupName, err)
+			}
+			// The first entry for a group decided access, so later duplicates are ignored
+			_, err := tx.Exec(`
+				INSERT INTO group_members (user_id, group_name, permission) VALUES (?, ?, ?)
+				ON CONFLICT(user_id, group_name) DO NOTHING
+			`, a.userID, group.GroupName, group.Permission)
+			if err != nil {
+				return fmt.Errorf("failed to migrate groups of %s: %w", a.email, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec("ALTER TABLE users DROP COLUMN groups"); err != nil {
+		return fmt.Errorf("failed to drop users.groups: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
+	log.Printf("Moved the groups of %d user(s) to the group_members table", len(assignments))
+	return nil
+}
+
+// registerExistingGroups adds the groups that older versions only knew as
+// names in service_accounts.groups and passwords.group_name to the groups
+// table, which group assignments are now checked against
+func (db *DB) registerExistingGroups() error {
+	names := make(map[string]bool)
+
+	rows, err := db.Query("SELECT groups FROM service_accounts")
+	if err != nil {
+		return fmt.Errorf("failed to read group assignments: %w", err)
+	}
+	for rows.Next() {
+		var groupsStr string
+		if err := rows.Scan(&groupsStr); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read group assignments: %w", err)
+		}
+		for _, name := range permissions.GetUserGroups(groupsStr) {
+			names[name] = true
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read group assignments: %w", err)
+	}
+
+	for name := range names {
+		if _, err := db.Exec("INSERT INTO groups (name) VALUES (?) ON CONFLICT(name) DO NOTHING", name); err != nil {
+			return fmt.Errorf("failed to register group %s: %w", name, err)
+		}
+	}
+
+	// SQLite needs the WHERE clause to parse ON CONFLICT after a SELECT
 	_, err = db.Exec(`
-		INSERT INTO users (email, password_hash, role, groups, enabled) 
-		VALUES (?, ?, 'admin', 'team1:rw,team2:rw', true)
-	`, "admin@pman.system", hashedPassword)
+		INSERT INTO groups (name) SELECT DISTINCT group_name FROM passwords WHERE true
+		ON CONFLICT(name) DO NOTHING
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to register groups of passwords: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	exists, err := db.hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
 
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
-		return fmt.Errorf("failed to create default admin: %w", err)
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	return nil
+}
+
+func (db *DB) hasColumn(table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+
+	return false, nil
+}
+
+// flagDefaultAdminPassword makes the admin of databases created by older
+// versions change the well-known default password at the next login. New
+// databases get their first admin from the bootstrap instead.
+func (db *DB) flagDefaultAdminPassword() error {
+	var passwordHash string
+	var mustChange bool
+	err := db.QueryRow(`
+		SELECT password_hash, must_change_password FROM users WHERE email = ?
+	`, "admin@pman.system").Scan(&passwordHash, &mustChange)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check for default admin: %w", err)
+	}
+
+	if !mustChange && crypto.CheckPasswordHash("DefaultPassword", passwordHash) {
+		if _, err := db.Exec("UPDATE users SET must_change_password = true WHERE email = ?", "admin@pman.system"); err != nil {
+			return fmt.Errorf("failed to flag default admin password: %w", err)
+		}
+		log.Println("Default admin still uses the default password: it must be changed at the next login")
 	}
 
-	log.Println("Created default admin user: admin@pman.system / DefaultPassword")
 	return nil
 }
@@ -1,16 +1,28 @@
 -- Users table
+-- totp_secret: encrypted TOTP secret, set during MFA enrolment (mfa_enabled once confirmed)
+-- totp_last_step: time step of the last accepted TOTP code, so a code cannot be replayed
+-- auth_source: 'local' (password), 'ldap' (password checked against the directory) or 'oidc' (single sign-on)
+-- password_changed_at: when the password was last set (NULL: at creation), for the maximum password age
+-- must_change_password: the password was generated or set by an admin; the user must replace it before doing anything else
 CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     email TEXT UNIQUE NOT NULL,
     password_hash TEXT NOT NULL,
-    role TEXT NOT NULL DEFAULT 'user',
-    groups TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT 'user', -- a name from the roles table
     enabled BOOLEAN NOT NULL DEFAULT true,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    mfa_enabled BOOLEAN NOT NULL DEFAULT false,
+    totp_secret TEXT NOT NULL DEFAULT '',
+    totp_last_step INTEGER NOT NULL DEFAULT 0,
+    auth_source TEXT NOT NULL DEFAULT 'local',
+    password_changed_at DATETIME,
+    must_change_password BOOLEAN NOT NULL DEFAULT false
 );
 
 -- Passwords table
+-- requires_approval: reading the value needs an approved access request (access_requests)
+-- version: starts at 1 and grows with every change; earlier values are in password_versions
 CREATE TABLE IF NOT EXISTS passwords (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     path TEXT NOT NULL,
@@ -20,28 +32,326 @@ CREATE TABLE IF NOT EXISTS passwords (
     updated_by TEXT NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    requires_approval BOOLEAN NOT NULL DEFAULT false,
+    version INTEGER NOT NULL DEFAULT 1,
     UNIQUE(path, group_name)
 );
 
--- Groups table (for metadata, actual permissions stored in users.groups)
+-- Earlier values of passwords, the latest 10 of each kept
+CREATE TABLE IF NOT EXISTS password_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    encrypted_value TEXT NOT NULL,
+    updated_by TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    UNIQUE(group_name, path, version)
+);
+
+-- Rotators bound to passwords, run every interval_minutes (0: only on demand)
+-- rotator: 'postgres', 'mysql' or 'command'
+-- config: the rotator's settings as JSON (never credentials: the password itself is the credential)
+-- last_status: '', 'succeeded' or 'failed'
+CREATE TABLE IF NOT EXISTS rotations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    rotator TEXT NOT NULL,
+    config TEXT NOT NULL,
+    interval_minutes INTEGER NOT NULL DEFAULT 0,
+    next_run_at DATETIME,
+    last_run_at DATETIME,
+    last_status TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(group_name, path)
+);
+
+-- Requests for time-boxed access to secrets that require approval, kept with
+-- their decision as a record
+-- status: 'pending', 'approved' or 'denied'; approved access ends at expires_at
+CREATE TABLE IF NOT EXISTS access_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    requester TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    duration_minutes INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    decided_by TEXT NOT NULL DEFAULT '',
+    decision_note TEXT NOT NULL DEFAULT '',
+    decided_at DATETIME,
+    expires_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_requests_path ON access_requests(group_name, path);
+
+-- Temporary access to single secrets for users outside the group permission,
+-- given by group writers
+-- permission: 'ro', 'rw' or verbs joined with '+' (no admin or approve)
+-- Grants stop applying at expires_at and expired rows are purged
+CREATE TABLE IF NOT EXISTS grants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    grantee TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(group_name, path, grantee)
+);
+
+-- One-time copies of secrets for people without an account, read with a link
+-- token_hash: SHA-256 of the link token; the token itself is not stored
+-- encrypted_value: encrypted with a key derived from the token, not the server key
+-- Rows are deleted with their last view or once they have expired
+CREATE TABLE IF NOT EXISTS shares (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT UNIQUE NOT NULL,
+    group_name TEXT NOT NULL,
+    path TEXT NOT NULL,
+    encrypted_value TEXT NOT NULL,
+    views_left INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Outbound webhooks, called when secrets or users change
+-- secret: HMAC-SHA256 signing key, encrypted with the server key
+-- events: comma-separated event types; '*' for all, 'password.*' for a family
+-- group_name, path_prefix: only events of that group and under that prefix ('' for all)
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '*',
+    group_name TEXT NOT NULL DEFAULT '',
+    path_prefix TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deliveries of events to webhooks, the latest 100 of each kept for 'pman webhook log'
+-- status: 'pending', 'delivered' or 'failed' (after every retry)
+-- next_attempt_at: when the delivery worker next tries a pending delivery (NULL for
+-- tests, which are attempted once while the admin waits)
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    next_attempt_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id);
+
+-- Roles assignable to users (users.role), with the capabilities they grant on
+-- the /admin endpoints
+-- capabilities: comma-separated, e.g. 'users:read,groups:read'; '*' for all
+-- builtin: kept up to date by the server (admin, user, auditor, ...) and cannot be changed
+CREATE TABLE IF NOT EXISTS roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    capabilities TEXT NOT NULL DEFAULT '',
+    builtin BOOLEAN NOT NULL DEFAULT false,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Groups table (for metadata, permissions are stored in group_members and
+-- service_accounts.groups, which may only name groups listed here)
+-- cache_max_age_hours: how long clients may keep secrets in their offline cache (0 = not allowed)
 CREATE TABLE IF NOT EXISTS groups (
     name TEXT PRIMARY KEY,
-    description TEXT DEFAULT ''
+    description TEXT DEFAULT '',
+    cache_max_age_hours INTEGER NOT NULL DEFAULT 0
+);
+
+-- Group membership of users, one row per group (older versions kept a
+-- "group:permission" list in users.groups instead)
+-- permission: 'ro', 'rw', 'owner' (read-write, and may manage the group's members)
+-- or verbs joined with '+' from list, read, write, delete and admin
+CREATE TABLE IF NOT EXISTS group_members (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_name TEXT NOT NULL REFERENCES groups(name),
+    permission TEXT NOT NULL,
+    PRIMARY KEY (user_id, group_name)
+);
+
+-- Path ACLs narrowing access below a path prefix of a group (longest prefix wins)
+-- path_prefix: '' for the whole group; subject: a user's email or '*' for everyone
+-- permission: 'none', 'ro', 'rw' or verbs; a rule never grants more than the group permission
+CREATE TABLE IF NOT EXISTS path_acls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_name TEXT NOT NULL REFERENCES groups(name) ON DELETE CASCADE,
+    path_prefix TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    permission TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(group_name, path_prefix, subject)
 );
 
 -- Tokens table (for token blacklisting/tracking)
+-- token_type: 'access' (short-lived JWT) or 'refresh' (opaque, single use)
+-- session_id: groups the access and refresh tokens issued from one login
+-- used: set once a refresh token has been exchanged; presenting it again revokes the session,
+-- unless within 30 seconds of used_at (processes sharing a login refreshing together)
 CREATE TABLE IF NOT EXISTS tokens (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     token_hash TEXT UNIQUE NOT NULL,
     user_email TEXT NOT NULL,
     expires_at DATETIME NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    revoked BOOLEAN DEFAULT false,
+    token_type TEXT NOT NULL DEFAULT 'access',
+    session_id TEXT NOT NULL DEFAULT '',
+    used BOOLEAN NOT NULL DEFAULT false,
+    used_at DATETIME
+);
+
+-- Login sessions (one per login, kept alive by refresh tokens in the tokens table)
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_email TEXT NOT NULL,
+    client_hostname TEXT NOT NULL DEFAULT '',
+    client_ip TEXT NOT NULL DEFAULT '',
+    expires_at DATETIME NOT NULL,
+    last_seen_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    revoked BOOLEAN NOT NULL DEFAULT false
+);
+
+-- Service accounts (non-human principals authenticated by API keys)
+-- groups is a "group:permission" list (e.g. "team1:ro"); path_prefixes is a comma-separated
+-- list of path prefixes the account is restricted to (empty = whole group)
+CREATE TABLE IF NOT EXISTS service_accounts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    groups TEXT NOT NULL DEFAULT '',
+    path_prefixes TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_by TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API keys for service accounts (only the hash is stored, like tokens.token_hash)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_hash TEXT UNIQUE NOT NULL,
+    key_prefix TEXT NOT NULL,
+    service_account_id INTEGER NOT NULL REFERENCES service_accounts(id) ON DELETE CASCADE,
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     revoked BOOLEAN DEFAULT false
 );
 
+-- MFA recovery codes (only the bcrypt hash is stored; each code works once)
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_email TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Pending second-step login challenges, issued after a correct password for MFA users
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    token_hash TEXT PRIMARY KEY,
+    user_email TEXT NOT NULL,
+    expire_days INTEGER NOT NULL DEFAULT 0,
+    client_hostname TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- WebAuthn (FIDO2) security keys registered as a second factor
+-- credential_id is base64url encoded; public_key is the COSE key from registration
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_email TEXT NOT NULL,
+    credential_id TEXT UNIQUE NOT NULL,
+    public_key BLOB NOT NULL,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME
+);
+
+-- Outstanding WebAuthn challenges. Registration challenges are keyed by user,
+-- login challenges by the MFA challenge token (mfa_token_hash) they belong to.
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_email TEXT NOT NULL,
+    ceremony TEXT NOT NULL,
+    challenge TEXT NOT NULL,
+    mfa_token_hash TEXT NOT NULL DEFAULT '',
+    expires_at DATETIME NOT NULL
+);
+
+-- Previous password hashes, so the password policy can refuse their reuse
+CREATE TABLE IF NOT EXISTS password_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_email TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Failed password logins, counted per account (kind 'account', subject = email)
+-- and per client address (kind 'ip'). Account rows are cleared by a successful
+-- login; failures older than the lockout duration are forgotten.
+CREATE TABLE IF NOT EXISTS login_failures (
+    kind TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME,
+    PRIMARY KEY (kind, subject)
+);
+
+-- Lockouts and admin unlocks, shown to admins by 'pman lockouts'
+-- event: 'locked' or 'unlocked'; actor is the admin who unlocked
+CREATE TABLE IF NOT EXISTS lockout_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    event TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    client_ip TEXT NOT NULL DEFAULT '',
+    locked_until DATETIME,
+    actor TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Server-wide settings managed by admins (e.g. the MFA policy)
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL DEFAULT ''
+);
+
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_passwords_path ON passwords(path);
 CREATE INDEX IF NOT EXISTS idx_passwords_group ON passwords(group_name);
 CREATE INDEX IF NOT EXISTS idx_passwords_created_by ON passwords(created_by);
+CREATE INDEX IF NOT EXISTS idx_group_members_group_name ON group_members(group_name);
 CREATE INDEX IF NOT EXISTS idx_tokens_user_email ON tokens(user_email);
-CREATE INDEX IF NOT EXISTS idx_tokens_expires_at ON tokens(expires_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_tokens_expires_at ON tokens(expires_at);
+CREATE INDEX IF NOT EXISTS idx_api_keys_service_account ON api_keys(service_account_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_email ON sessions(user_email);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_email ON mfa_recovery_codes(user_email);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_email ON webauthn_credentials(user_email);
+CREATE INDEX IF NOT EXISTS idx_password_history_user_email ON password_history(user_email);
\ No newline at end of file
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+// Path ACLs are managed by admins and the owners of the group
+
+func (h *Handlers) ListPathACLs(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["group"]
+	if _, ok := h.authorizeGroupOwner(w, r, groupName, auth.CapabilityGroupsRead); !ok {
+		return
+	}
+
+	rules, err := h.aclService.ListRules(groupName)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"acls": rules})
+}
+
+func (h *Handlers) SetPathACL(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["group"]
+	claims, ok := h.authorizeGroupOwner(w, r, groupName, auth.CapabilityGroupsWrite)
+	if !ok {
+		return
+	}
+
+	var req models.PathACLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Subject == "" {
+		writeError(w, "Subject is required (a user's email or '*')", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.aclService.SetRule(groupName, req, claims.Email); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	log.Printf("Group %s: %s set path ACL %q for %s to %s", groupName, claims.Email, req.Path, req.Subject, req.Permission)
+	writeJSON(w, map[string]string{"message": "Path ACL updated successfully"})
+}
+
+func (h *Handlers) DeletePathACL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims, ok := h.authorizeGroupOwner(w, r, vars["group"], auth.CapabilityGroupsWrite)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid path ACL ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.aclService.DeleteRule(vars["group"], id); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	log.Printf("Group %s: %s deleted path ACL %d", vars["group"], claims.Email, id)
+	writeJSON(w, map[string]string{"message": "Path ACL deleted successfully"})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+// SetApprovalRequired marks a secret as requiring approval before it can be
+// read, or lifts the requirement. Admins and owners of the group may do this.
+func (h *Handlers) SetApprovalRequired(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupName := vars["group"]
+	path := vars["path"]
+
+	claims, ok := h.authorizeGroupOwner(w, r, groupName, auth.CapabilityGroupsWrite)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Required bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.approvalService.SetRequired(groupName, path, req.Required); err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+
+	log.Printf("Secret %s:%s approval required = %v, set by %s", groupName, path, req.Required, claims.Email)
+	writeJSON(w, map[string]string{"message": "Approval requirement updated successfully"})
+}
+
+func (h *Handlers) CreateAccessRequest(w http.ResponseWriter, r *http.Request) {
+	claims, userGroups, ok := h.approvalCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AccessRequestCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.approvalService.CreateRequest(req, claims.Email, userGroups)
+	if err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+
+	log.Printf("Access request %d: %s asked for %s:%s (%q)", id, claims.Email, req.Group, req.Path, req.Reason)
+	writeJSON(w, map[string]interface{}{"message": "Access request created", "id": id})
+}
+
+func (h *Handlers) ListAccessRequests(w http.ResponseWriter, r *http.Request) {
+	claims, userGroups, ok := h.approvalCaller(w, r)
+	if !ok {
+		return
+	}
+
+	requests, err := h.approvalService.ListRequests(claims.Email, userGroups, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"requests": requests})
+}
+
+func (h *Handlers) ApproveAccessRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideAccessRequest(w, r, true)
+}
+
+func (h *Handlers) DenyAccessRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideAccessRequest(w, r, false)
+}
+
+func (h *Handlers) decideAccessRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	claims, userGroups, ok := h.approvalCaller(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, "Invalid access request ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AccessDecisionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	request, err := h.approvalService.Decide(id, claims.Email, userGroups, approve, req.Note)
+	if err != nil {
+		writeApprovalError(w, err)
+		return
+	}
+
+	log.Printf("Access request %d for %s:%s by %s %s by %s", id, request.Group, request.Path, request.Requester, request.Status, claims.Email)
+	writeJSON(w, request)
+}
+
+// approvalCaller returns the user and their groups. Access requests are for
+// people, so service accounts cannot make or decide them.
+func (h *Handlers) approvalCaller(w http.ResponseWriter, r *http.Request) (*auth.Claims, string, bool) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, "", false
+	}
+	if claims.ServiceAccount {
+		writeError(w, "Service accounts cannot use access requests", http.StatusForbidden)
+		return nil, "", false
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "User not found", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	return claims, userGroups, true
+}
+
+func writeApprovalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrPasswordNotFound), errors.Is(err, services.ErrAccessRequestNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrAccessRequestPending), errors.Is(err, services.ErrAccessRequestDecided),
+		errors.Is(err, services.ErrApprovalRotation):
+		writeError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidAccessRequest), errors.Is(err, services.ErrApprovalNotRequired):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	default:
+		// Missing permissions, including ErrNotApprover and ErrSelfApproval
+		writeError(w, err.Error(), http.StatusForbidden)
+	}
+}
+
+// cacheMaxAge is the group's offline cache policy, except that secrets
+// requiring approval must never be cached
+func (h *Handlers) cacheMaxAge(groupName, path string) (int, error) {
+	required, err := h.approvalService.RequiresApproval(groupName, path)
+	if err != nil || required {
+		return 0, err
+	}
+	return h.groupService.GetCacheMaxAge(groupName)
+}
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
 	"github.com/steve/pman/shared/auth"
 	"github.com/steve/pman/shared/config"
 	"github.com/steve/pman/shared/models"
@@ -18,44 +22,323 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Email == "" || req.Password == "" {
-		writeError(w, "Email and password are required", http.StatusBadRequest)
-		return
+	var user *models.User
+	var err error
+	expireDays := req.ExpireDays
+	clientHostname := req.ClientHostname
+	ip := h.loginIP(r)
+
+	if req.MFAToken != "" {
+		// Second step of an MFA login; the password was checked when the challenge was issued
+		challenge, err := h.mfaService.GetChallenge(req.MFAToken)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if !h.checkLoginThrottle(w, challenge.UserEmail, ip) {
+			return
+		}
+
+		if req.WebAuthn != nil {
+			err = h.webauthnService.FinishLogin(challenge.UserEmail, req.MFAToken, req.WebAuthn)
+			if err != nil {
+				h.mfaService.FailChallenge(req.MFAToken)
+				if errors.Is(err, services.ErrWebAuthnFailed) {
+					h.recordLoginFailure(challenge.UserEmail, ip)
+				}
+				writeWebAuthnError(w, err, http.StatusUnauthorized)
+				return
+			}
+		} else {
+			if req.MFACode == "" {
+				writeError(w, "Authentication code is required", http.StatusBadRequest)
+				return
+			}
+
+			if err := h.mfaService.Verify(challenge.UserEmail, req.MFACode); err != nil {
+				h.mfaService.FailChallenge(req.MFAToken)
+				if err == services.ErrInvalidMFACode {
+					h.recordLoginFailure(challenge.UserEmail, ip)
+				}
+				writeMFAError(w, err, http.StatusUnauthorized)
+				return
+			}
+		}
+		h.mfaService.DeleteChallenge(req.MFAToken)
+
+		user, err = h.userService.GetUserByEmail(challenge.UserEmail)
+		if err != nil || !user.Enabled {
+			writeError(w, "user account is disabled", http.StatusUnauthorized)
+			return
+		}
+
+		expireDays = challenge.ExpireDays
+		clientHostname = challenge.ClientHostname
+	} else {
+		if req.Email == "" || req.Password == "" {
+			writeError(w, "Email and password are required", http.StatusBadRequest)
+			return
+		}
+
+		if !h.checkLoginThrottle(w, req.Email, ip) {
+			return
+		}
+
+		user, err = h.userService.ValidateLogin(req.Email, req.Password)
+		if err != nil {
+			if err == services.ErrInvalidCredentials {
+				h.recordLoginFailure(req.Email, ip)
+			}
+			writeError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		methods, err := h.mfaMethods(user)
+		if err != nil {
+			writeError(w, "Failed to check MFA", http.StatusInternalServerError)
+			return
+		}
+
+		if len(methods) > 0 {
+			if req.MFACode == "" {
+				mfaToken, err := h.mfaService.CreateChallenge(user.Email, req.ExpireDays, req.ClientHostname)
+				if err != nil {
+					writeError(w, "Failed to create MFA challenge", http.StatusInternalServerError)
+					return
+				}
+
+				writeJSON(w, map[string]interface{}{"mfa_required": true, "mfa_token": mfaToken, "mfa_methods": methods})
+				return
+			}
+
+			if err := h.mfaService.Verify(user.Email, req.MFACode); err != nil {
+				if err == services.ErrInvalidMFACode {
+					h.recordLoginFailure(user.Email, ip)
+				}
+				writeMFAError(w, err, http.StatusUnauthorized)
+				return
+			}
+		}
 	}
 
-	user, err := h.userService.ValidateLogin(req.Email, req.Password)
-	if err != nil {
-		writeError(w, err.Error(), http.StatusUnauthorized)
-		return
+	if err := h.lockoutService.ClearAccount(user.Email); err != nil {
+		log.Printf("Failed to clear failed logins for %s: %v", user.Email, err)
 	}
 
-	expireDays := req.ExpireDays
+	h.startSession(w, r, user, expireDays, clientHostname)
+}
+
+// startSession issues the session, refresh token and first access token once
+// a user has been authenticated
+func (h *Handlers) startSession(w http.ResponseWriter, r *http.Request, user *models.User, expireDays int, clientHostname string) {
 	if expireDays <= 0 {
 		envConfig := config.GetEnvConfig()
 		expireDays = envConfig.DefaultExpireDays
 	}
 
-	token, err := auth.GenerateToken(user.Email, user.Role, expireDays)
+	sessionID, err := services.NewSessionID()
 	if err != nil {
 		writeError(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Store the token in the database for tracking/revocation
-	expiresAt := time.Now().Add(time.Duration(expireDays) * 24 * time.Hour)
-	if err := h.tokenService.StoreToken(token, user.Email, expiresAt); err != nil {
+	// The session (and its refresh tokens) lasts expireDays; access tokens are short-lived
+	sessionExpiresAt := time.Now().Add(time.Duration(expireDays) * 24 * time.Hour)
+	if err := h.tokenService.CreateSession(sessionID, user.Email, clientHostname, clientIP(r), sessionExpiresAt); err != nil {
+		writeError(w, "Failed to store session", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := h.tokenService.CreateRefreshToken(user.Email, sessionID, sessionExpiresAt)
+	if err != nil {
 		writeError(w, "Failed to store token", http.StatusInternalServerError)
 		return
 	}
 
+	scope, err := h.tokenScope(user)
+	if err != nil {
+		writeError(w, "Failed to check account policy", http.StatusInternalServerError)
+		return
+	}
+
+	token, expiresAt, err := h.issueAccessToken(user.Email, user.Role, sessionID, scope)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	response := models.LoginResponse{
-		Token: token,
-		User:  *user,
+		Token:                 token,
+		RefreshToken:          refreshToken,
+		ExpiresAt:             expiresAt,
+		User:                  *user,
+		MFAEnrollmentRequired: scope == auth.ScopeMFAEnrollment,
+
+		PasswordChangeRequired: scope == auth.ScopePasswordChange,
 	}
 
 	writeJSON(w, response)
 }
 
+// tokenScope restricts users whose password has expired to changing it, and
+// users who must use MFA by policy but have not enrolled yet to the enrolment
+// endpoints. It is re-evaluated on every refresh, so the restriction lifts as
+// soon as the password is changed or enrolment is confirmed.
+func (h *Handlers) tokenScope(user *models.User) (string, error) {
+	// Generated and admin-set passwords are known to someone else
+	if user.AuthSource == services.AuthSourceLocal && user.MustChangePassword {
+		return auth.ScopePasswordChange, nil
+	}
+
+	expired, err := h.userService.PasswordExpired(user)
+	if err != nil {
+		return "", err
+	}
+	if expired {
+		return auth.ScopePasswordChange, nil
+	}
+
+	// The identity provider is responsible for MFA of single sign-on users
+	if user.AuthSource == services.AuthSourceOIDC {
+		return "", nil
+	}
+
+	methods, err := h.mfaMethods(user)
+	if err != nil {
+		return "", err
+	}
+	if len(methods) > 0 {
+		return "", nil
+	}
+
+	required, err := h.mfaService.IsRequired(user)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		return auth.ScopeMFAEnrollment, nil
+	}
+
+	return "", nil
+}
+
+// mfaMethods lists the second factors the user has set up
+func (h *Handlers) mfaMethods(user *models.User) ([]string, error) {
+	var methods []string
+	if user.MFAEnabled {
+		methods = append(methods, services.MFAMethodTOTP)
+	}
+
+	keys, err := h.webauthnService.CountCredentials(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if keys > 0 {
+		methods = append(methods, services.MFAMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// issueAccessToken creates an access token and stores it for tracking/revocation
+func (h *Handlers) issueAccessToken(email, role, sessionID, scope string) (string, time.Time, error) {
+	envConfig := config.GetEnvConfig()
+	ttl := time.Duration(envConfig.AccessTokenMinutes) * time.Minute
+
+	token, expiresAt, err := auth.GenerateToken(email, role, sessionID, scope, ttl)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Failed to generate token")
+	}
+
+	if err := h.tokenService.StoreToken(token, services.TokenTypeAccess, email, sessionID, expiresAt); err != nil {
+		return "", time.Time{}, fmt.Errorf("Failed to store token")
+	}
+
+	return token, expiresAt, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token can be used only once.
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		writeError(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.tokenService.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if err == services.ErrRefreshTokenReused {
+			log.Printf("Refresh token reuse detected from %s, session revoked", r.RemoteAddr)
+		}
+		writeError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userService.GetUserByEmail(session.UserEmail)
+	if err != nil || !user.Enabled {
+		h.tokenService.RevokeSession(session.SessionID)
+		writeError(w, "user account is disabled", http.StatusUnauthorized)
+		return
+	}
+
+	scope, err := h.tokenScope(user)
+	if err != nil {
+		writeError(w, "Failed to check account policy", http.StatusInternalServerError)
+		return
+	}
+
+	token, expiresAt, err := h.issueAccessToken(user.Email, user.Role, session.SessionID, scope)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, models.LoginResponse{
+		Token:                 token,
+		RefreshToken:          session.RefreshToken,
+		ExpiresAt:             expiresAt,
+		User:                  *user,
+		MFAEnrollmentRequired: scope == auth.ScopeMFAEnrollment,
+
+		PasswordChangeRequired: scope == auth.ScopePasswordChange,
+	})
+}
+
+// Logout revokes the caller's session on the server so its tokens stop working
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// API keys have no session; they end by being revoked
+	if claims.ServiceAccount {
+		writeError(w, "API keys cannot log out; an admin revokes them with 'pman svckeyrevoke'", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if claims.Session != "" {
+		err = h.tokenService.RevokeSession(claims.Session)
+	} else {
+		err = h.tokenService.RevokeToken(bearerToken(r))
+	}
+	if err != nil {
+		writeError(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Logged out successfully"})
+}
+
 func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	claims, ok := auth.GetUserFromContext(r.Context())
 	if !ok {
@@ -79,12 +362,24 @@ func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, err := h.userService.ValidateLogin(claims.Email, req.CurrentPassword)
+	if err == services.ErrSSOAccount {
+		writeError(w, "Single sign-on accounts have no pman password", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		writeError(w, "Current password is incorrect", http.StatusUnauthorized)
 		return
 	}
 
-	if err := h.userService.ChangePassword(claims.Email, req.NewPassword); err != nil {
+	if err := h.userService.ChangePassword(claims.Email, req.NewPassword, false); err != nil {
+		if err == services.ErrExternalPassword {
+			writeError(w, "Your password is managed by your directory, change it there", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrPasswordPolicy) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		writeError(w, "Failed to change password", http.StatusInternalServerError)
 		return
 	}
@@ -96,6 +391,10 @@ func (h *Handlers) AdminChangePassword(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	email := vars["email"]
 
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
 	var req struct {
 		NewPassword string `json:"new_password"`
 	}
@@ -110,10 +409,39 @@ func (h *Handlers) AdminChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userService.ChangePassword(email, req.NewPassword); err != nil {
+	if err := h.userService.ChangePassword(email, req.NewPassword, true); err != nil {
+		if err == services.ErrExternalPassword || errors.Is(err, services.ErrPasswordPolicy) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		writeError(w, "Failed to change password", http.StatusInternalServerError)
 		return
 	}
 
 	writeJSON(w, map[string]string{"message": "Password changed successfully"})
-}
\ No newline at end of file
+}
+
+func (h *Handlers) GetPasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.userService.GetPasswordPolicy()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, policy)
+}
+
+func (h *Handlers) SetPasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.PasswordPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.SetPasswordPolicy(&policy); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, policy)
+}
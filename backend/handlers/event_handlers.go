@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/permissions"
+)
+
+// eventHeartbeat is how often an idle stream is written to, so proxies keep
+// it open and dead clients are noticed
+const eventHeartbeat = 30 * time.Second
+
+// eventRevalidate is how often a stream checks the caller's credentials, as
+// API keys do not expire on their own and sessions can be revoked
+const eventRevalidate = time.Minute
+
+// StreamEvents sends the changes to secrets the caller can read as
+// server-sent events, optionally only those of one group and path prefix.
+// The stream ends when the caller's access token expires, or soon after
+// their API key or session is revoked or they are disabled; clients
+// reconnect with fresh credentials.
+func (h *Handlers) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	groupName := r.URL.Query().Get("group")
+	var prefixes []string
+	if prefix := permissions.NormalizePathPrefix(r.URL.Query().Get("prefix")); prefix != "" {
+		prefixes = []string{prefix}
+	}
+
+	if _, err := h.getCallerGroups(claims); err != nil {
+		writeError(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.passwordService.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, ": connected\n\n")
+	flusher.Flush()
+
+	var expired <-chan time.Time
+	if claims.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	revalidate := time.NewTicker(eventRevalidate)
+	defer revalidate.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			return
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": ping\n\n")
+			flusher.Flush()
+		case <-revalidate.C:
+			if claims, ok = h.revalidateStream(r, claims); !ok {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				log.Printf("Event stream of %s dropped: client too slow", claims.Email)
+				return
+			}
+			if (groupName != "" && event.Group != groupName) || !permissions.HasPathAccess(prefixes, event.Path) ||
+				!permissions.HasPathAccess(claims.PathPrefixes, event.Path) {
+				continue
+			}
+
+			// Permissions are checked for every event, so changes to them apply at once
+			userGroups, err := h.getCallerGroups(claims)
+			if err != nil {
+				return
+			}
+			if !h.passwordService.CanReadEvent(event, claims.Email, userGroups) {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// revalidateStream returns the current claims of a stream's caller, or false
+// once the API key or access token it was opened with has been revoked or the
+// user disabled. A service account's groups and paths are looked up again,
+// as getCallerGroups takes them from the claims.
+func (h *Handlers) revalidateStream(r *http.Request, claims *auth.Claims) (*auth.Claims, bool) {
+	token := bearerToken(r)
+	if claims.ServiceAccount {
+		current, err := h.serviceAccounts.ValidateAPIKey(token)
+		if err != nil {
+			return nil, false
+		}
+		return current, true
+	}
+
+	if revoked, err := h.tokenService.IsTokenRevoked(token); err != nil || revoked {
+		return nil, false
+	}
+	user, err := h.userService.GetUserByEmail(claims.Email)
+	if err != nil || !user.Enabled {
+		return nil, false
+	}
+	return claims, true
+}
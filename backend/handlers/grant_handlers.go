@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+// Temporary grants are made by the group's writers, who can also list and
+// revoke them, as can admins with the groups capabilities
+
+func (h *Handlers) CreateGrant(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["group"]
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.GrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !permissions.HasPathAccess(claims.PathPrefixes, req.Path) {
+		writeError(w, pathNotAllowedMessage(req.Path), http.StatusForbidden)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	grant, err := h.grantService.CreateGrant(groupName, req, claims.Email, userGroups)
+	if err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	log.Printf("Group %s: %s granted %s on %q to %s until %s", groupName, claims.Email, grant.Permission, grant.Path, grant.Grantee, grant.ExpiresAt.Format("2006-01-02 15:04"))
+	writeJSON(w, grant)
+}
+
+func (h *Handlers) ListGrants(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["group"]
+	if _, ok := h.authorizeGroupWriter(w, r, groupName, auth.CapabilityGroupsRead); !ok {
+		return
+	}
+
+	grants, err := h.grantService.ListGrants(groupName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"grants": grants})
+}
+
+func (h *Handlers) RevokeGrant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims, ok := h.authorizeGroupWriter(w, r, vars["group"], auth.CapabilityGroupsWrite)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.grantService.RevokeGrant(vars["group"], id); err != nil {
+		writeGrantError(w, err)
+		return
+	}
+
+	log.Printf("Group %s: %s revoked grant %d", vars["group"], claims.Email, id)
+	writeJSON(w, map[string]string{"message": "Grant revoked successfully"})
+}
+
+// authorizeGroupWriter lets the caller through if they may write to the
+// group, or their role has capability for every group
+func (h *Handlers) authorizeGroupWriter(w http.ResponseWriter, r *http.Request, groupName, capability string) (*auth.Claims, bool) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if allowed, err := h.hasCapability(claims, capability); err != nil {
+		writeError(w, "Failed to get role", http.StatusInternalServerError)
+		return nil, false
+	} else if allowed {
+		return claims, true
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "Failed to get user groups", http.StatusInternalServerError)
+		return nil, false
+	}
+	if permissions.HasGroupVerb(userGroups, groupName, permissions.VerbWrite) {
+		return claims, true
+	}
+
+	writeError(w, "Admin or group writer access required", http.StatusForbidden)
+	return nil, false
+}
+
+func writeGrantError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrGrantNotFound), errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrPasswordNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidGrant):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	default:
+		// Missing permissions, including ErrNotGroupWriter
+		writeError(w, err.Error(), http.StatusForbidden)
+	}
+}
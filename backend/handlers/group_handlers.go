@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+func (h *Handlers) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groupService.ListGroups()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"groups": groups})
+}
+
+func (h *Handlers) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req models.GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, "Group name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.groupService.CreateGroup(req.Name, req.Description); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Group created successfully"})
+}
+
+func (h *Handlers) GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.groupService.GetGroup(mux.Vars(r)["group"])
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, group)
+}
+
+func (h *Handlers) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var req models.GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.groupService.UpdateGroup(mux.Vars(r)["group"], req.Description); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Group updated successfully"})
+}
+
+func (h *Handlers) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.groupService.DeleteGroup(mux.Vars(r)["group"]); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Group deleted successfully"})
+}
+
+// The member endpoints are open to admins and to the owners of the group
+
+func (h *Handlers) ListGroupMembers(w http.ResponseWriter, r *http.Request) {
+	groupName := mux.Vars(r)["group"]
+	if _, ok := h.authorizeGroupOwner(w, r, groupName, auth.CapabilityGroupsRead); !ok {
+		return
+	}
+
+	group, err := h.groupService.GetGroup(groupName)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"members": group.Members})
+}
+
+func (h *Handlers) SetGroupMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims, ok := h.authorizeGroupOwner(w, r, vars["group"], auth.CapabilityGroupsWrite)
+	if !ok {
+		return
+	}
+
+	var req models.GroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.authorizeMemberChange(w, r, claims, req.Permission) {
+		return
+	}
+
+	if err := h.groupService.SetMember(vars["group"], vars["email"], req.Permission); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	log.Printf("Group %s: %s set %s to %s", vars["group"], claims.Email, vars["email"], req.Permission)
+	writeJSON(w, map[string]string{"message": "Group member updated successfully"})
+}
+
+func (h *Handlers) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims, ok := h.authorizeGroupOwner(w, r, vars["group"], auth.CapabilityGroupsWrite)
+	if !ok || !h.authorizeMemberChange(w, r, claims, "") {
+		return
+	}
+
+	if err := h.groupService.RemoveMember(vars["group"], vars["email"]); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	log.Printf("Group %s: %s removed %s", vars["group"], claims.Email, vars["email"])
+	writeJSON(w, map[string]string{"message": "Group member removed successfully"})
+}
+
+// authorizeMemberChange lets a caller authorized by authorizeGroupOwner set
+// a member to permission, or remove them for "". Owners cannot make, change
+// or remove other owners, so a group always keeps the owner an admin gave it
+// until another admin says otherwise.
+func (h *Handlers) authorizeMemberChange(w http.ResponseWriter, r *http.Request, claims *auth.Claims, permission string) bool {
+	if admin, err := h.hasCapability(claims, auth.CapabilityGroupsWrite); err != nil {
+		writeError(w, "Failed to get role", http.StatusInternalServerError)
+		return false
+	} else if admin {
+		return true
+	}
+
+	vars := mux.Vars(r)
+	if err := h.groupService.CheckOwnerChange(vars["group"], vars["email"], permission); err != nil {
+		writeGroupError(w, err)
+		return false
+	}
+	return true
+}
+
+// authorizeGroupAssignment lets the caller give a user the groups in
+// groupsStr through the user endpoints. Every group added, changed or removed
+// needs groups:write, or the caller to own the group and the change to be one
+// authorizeMemberChange lets owners make.
+func (h *Handlers) authorizeGroupAssignment(w http.ResponseWriter, r *http.Request, email, groupsStr string) bool {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	if admin, err := h.hasCapability(claims, auth.CapabilityGroupsWrite); err != nil {
+		writeError(w, "Failed to get role", http.StatusInternalServerError)
+		return false
+	} else if admin {
+		return true
+	}
+
+	groups, err := permissions.ParseGroups(groupsStr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	changes := make(map[string]string)
+	for _, group := range groups {
+		changes[group.GroupName] = group.Permission
+	}
+
+	if user, err := h.userService.GetUserByEmail(email); err == nil {
+		current, _ := permissions.ParseGroups(user.Groups)
+		for _, group := range current {
+			if permission, ok := changes[group.GroupName]; !ok {
+				changes[group.GroupName] = ""
+			} else if permission == group.Permission {
+				delete(changes, group.GroupName)
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return true
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "Failed to get user groups", http.StatusInternalServerError)
+		return false
+	}
+
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !permissions.IsGroupOwner(userGroups, name) {
+			writeError(w, "Changing the members of group '"+name+"' needs groups:write or ownership of the group", http.StatusForbidden)
+			return false
+		}
+		if err := h.groupService.CheckOwnerChange(name, email, changes[name]); err != nil {
+			writeGroupError(w, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorizeGroupOwner lets owners of the group through, and users whose role
+// has capability for every group. Nobody changes their own membership here.
+func (h *Handlers) authorizeGroupOwner(w http.ResponseWriter, r *http.Request, groupName, capability string) (*auth.Claims, bool) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if email := mux.Vars(r)["email"]; email != "" && strings.EqualFold(email, claims.Email) {
+		writeError(w, "You cannot change your own group membership", http.StatusForbidden)
+		return nil, false
+	}
+
+	if allowed, err := h.hasCapability(claims, capability); err != nil {
+		writeError(w, "Failed to get role", http.StatusInternalServerError)
+		return nil, false
+	} else if allowed {
+		return claims, true
+	}
+
+	if !claims.ServiceAccount {
+		userGroups, err := h.getCallerGroups(claims)
+		if err != nil {
+			writeError(w, "Failed to get user groups", http.StatusInternalServerError)
+			return nil, false
+		}
+		if permissions.IsGroupOwner(userGroups, groupName) {
+			return claims, true
+		}
+	}
+
+	writeError(w, "Admin or group owner access required", http.StatusForbidden)
+	return nil, false
+}
+
+func (h *Handlers) SetGroupCachePolicy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	groupName := vars["group"]
+
+	var req struct {
+		MaxAgeHours int `json:"max_age_hours"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.groupService.SetCacheMaxAge(groupName, req.MaxAgeHours); err != nil {
+		writeGroupError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Group cache policy updated successfully"})
+}
+
+func writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound), errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrNotGroupMember), errors.Is(err, services.ErrPathACLNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrGroupExists), errors.Is(err, services.ErrGroupInUse):
+		writeError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrOwnerChange):
+		writeError(w, err.Error(), http.StatusForbidden)
+	default:
+		writeError(w, err.Error(), http.StatusBadRequest)
+	}
+}
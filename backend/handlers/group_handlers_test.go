@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/models"
+)
+
+func TestGroupOwnerMemberChanges(t *testing.T) {
+	server, db := newTestServer(t)
+
+	if err := services.NewGroupService(db).CreateGroup("ops", ""); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	users := services.NewUserService(db)
+	for email, groups := range map[string]string{
+		"owner@example.com":  "ops:owner",
+		"second@example.com": "ops:owner",
+		"alice@example.com":  "ops:rw",
+	} {
+		if _, err := users.CreateUser(email, "user", groups, "admin@example.com"); err != nil {
+			t.Fatalf("CreateUser(%s) error = %v", email, err)
+		}
+	}
+	if _, err := users.CreateUser("admin@example.com", "admin", "", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser(admin) error = %v", err)
+	}
+
+	const owner = "owner@example.com"
+	for _, tc := range []struct {
+		name, caller, method, path string
+		body                       interface{}
+		want                       int
+	}{
+		{"owner changes a member", owner, "PUT", "/groups/ops/members/alice@example.com", models.GroupMemberRequest{Permission: "ro"}, http.StatusOK},
+		{"owner makes an owner", owner, "PUT", "/groups/ops/members/alice@example.com", models.GroupMemberRequest{Permission: "owner"}, http.StatusForbidden},
+		{"owner gives the admin verb", owner, "PUT", "/groups/ops/members/alice@example.com", models.GroupMemberRequest{Permission: "read+admin"}, http.StatusForbidden},
+		{"owner downgrades an owner", owner, "PUT", "/groups/ops/members/second@example.com", models.GroupMemberRequest{Permission: "ro"}, http.StatusForbidden},
+		{"owner removes an owner", owner, "DELETE", "/groups/ops/members/second@example.com", nil, http.StatusForbidden},
+		{"owner removes a member", owner, "DELETE", "/groups/ops/members/alice@example.com", nil, http.StatusOK},
+		{"admin makes an owner", "admin@example.com", "PUT", "/groups/ops/members/alice@example.com", models.GroupMemberRequest{Permission: "owner"}, http.StatusOK},
+		{"admin removes an owner", "admin@example.com", "DELETE", "/groups/ops/members/second@example.com", nil, http.StatusOK},
+	} {
+		if got := call(t, server, tc.caller, tc.method, tc.path, tc.body); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	user, err := users.GetUserByEmail("alice@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error = %v", err)
+	}
+	if user.Groups != "ops:owner" {
+		t.Errorf("groups of alice = %q, want %q", user.Groups, "ops:owner")
+	}
+}
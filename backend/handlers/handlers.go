@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/steve/pman/backend/database"
@@ -14,6 +16,19 @@ type Handlers struct {
 	userService     *services.UserService
 	passwordService *services.PasswordService
 	tokenService    *services.TokenService
+	groupService    *services.GroupService
+	aclService      *services.ACLService
+	serviceAccounts *services.ServiceAccountService
+	mfaService      *services.MFAService
+	webauthnService *services.WebAuthnService
+	oidcService     *services.OIDCService
+	lockoutService  *services.LockoutService
+	roleService     *services.RoleService
+	approvalService *services.ApprovalService
+	shareService    *services.ShareService
+	grantService    *services.GrantService
+	webhookService  *services.WebhookService
+	rotationService *services.RotationService
 }
 
 func SetupRoutes(r *mux.Router, db *database.DB) {
@@ -21,33 +36,127 @@ func SetupRoutes(r *mux.Router, db *database.DB) {
 		userService:     services.NewUserService(db),
 		passwordService: services.NewPasswordService(db),
 		tokenService:    services.NewTokenService(db),
+		groupService:    services.NewGroupService(db),
+		aclService:      services.NewACLService(db),
+		serviceAccounts: services.NewServiceAccountService(db),
+		mfaService:      services.NewMFAService(db),
+		webauthnService: services.NewWebAuthnService(db),
+		oidcService:     services.NewOIDCService(db),
+		lockoutService:  services.NewLockoutService(db),
+		roleService:     services.NewRoleService(db),
+		approvalService: services.NewApprovalService(db),
+		shareService:    services.NewShareService(db),
+		grantService:    services.NewGrantService(db),
+		webhookService:  services.NewWebhookService(db),
+		rotationService: services.NewRotationService(db),
 	}
 
 	r.HandleFunc("/auth/login", h.Login).Methods("POST")
+	r.HandleFunc("/auth/refresh", h.RefreshToken).Methods("POST")
+	r.HandleFunc("/auth/webauthn/login/begin", h.BeginWebAuthnLogin).Methods("POST")
+	r.HandleFunc("/auth/oidc/config", h.GetOIDCConfig).Methods("GET")
+	r.HandleFunc("/auth/oidc/login", h.OIDCLogin).Methods("POST")
+	r.HandleFunc("/setup", h.Setup).Methods("POST")
 	r.HandleFunc("/health", h.Health).Methods("GET")
+	r.HandleFunc("/share/{token}", h.GetShare).Methods("GET")
 
 	protected := r.PathPrefix("").Subrouter()
-	protected.Use(auth.AuthMiddlewareWithTokenService(h.tokenService))
+	protected.Use(auth.AuthMiddlewareWithTokenService(h.tokenService, h.serviceAccounts))
 
 	protected.HandleFunc("/passwords", h.CreatePassword).Methods("POST")
 	protected.HandleFunc("/passwords/{group}/{path:.*}/info", h.GetPasswordInfo).Methods("GET")
+	protected.HandleFunc("/passwords/{group}/{path:.*}/approval", h.SetApprovalRequired).Methods("PUT")
+	protected.HandleFunc("/passwords/{group}/{path:.*}/rotate", h.RotatePassword).Methods("POST")
 	protected.HandleFunc("/passwords/{group}/{path:.*}", h.GetPassword).Methods("GET")
 	protected.HandleFunc("/passwords/{group}/{path:.*}", h.UpdatePassword).Methods("PUT")
 	protected.HandleFunc("/passwords/{group}/{path:.*}", h.DeletePassword).Methods("DELETE")
 	protected.HandleFunc("/passwords/{group}", h.ListPasswords).Methods("GET")
 
+	protected.HandleFunc("/shares", h.CreateShare).Methods("POST")
+	protected.HandleFunc("/events", h.StreamEvents).Methods("GET")
+
+	protected.HandleFunc("/access-requests", h.CreateAccessRequest).Methods("POST")
+	protected.HandleFunc("/access-requests", h.ListAccessRequests).Methods("GET")
+	protected.HandleFunc("/access-requests/{id}/approve", h.ApproveAccessRequest).Methods("POST")
+	protected.HandleFunc("/access-requests/{id}/deny", h.DenyAccessRequest).Methods("POST")
+
+	// Admin endpoints need a role with the capability named for each route
 	admin := protected.PathPrefix("/admin").Subrouter()
-	admin.Use(auth.AdminRequired)
+	can := func(capability string, handler http.HandlerFunc) http.Handler {
+		return auth.CapabilityRequired(h.roleService, capability)(handler)
+	}
 
-	admin.HandleFunc("/users", h.CreateUser).Methods("POST")
-	admin.HandleFunc("/users", h.ListUsers).Methods("GET")
-	admin.HandleFunc("/users/{email}", h.UpdateUser).Methods("PUT")
-	admin.HandleFunc("/users/{email}", h.DeleteUser).Methods("DELETE")
-	admin.HandleFunc("/users/{email}/enable", h.EnableUser).Methods("POST")
-	admin.HandleFunc("/users/{email}/disable", h.DisableUser).Methods("POST")
+	admin.Handle("/users", can(auth.CapabilityUsersWrite, h.CreateUser)).Methods("POST")
+	admin.Handle("/users", can(auth.CapabilityUsersRead, h.ListUsers)).Methods("GET")
+	admin.Handle("/users/{email}", can(auth.CapabilityUsersWrite, h.UpdateUser)).Methods("PUT")
+	admin.Handle("/users/{email}", can(auth.CapabilityUsersWrite, h.DeleteUser)).Methods("DELETE")
+	admin.Handle("/users/{email}/enable", can(auth.CapabilityUsersWrite, h.EnableUser)).Methods("POST")
+	admin.Handle("/users/{email}/disable", can(auth.CapabilityUsersWrite, h.DisableUser)).Methods("POST")
+	admin.Handle("/users/{email}/unlock", can(auth.CapabilityUsersWrite, h.UnlockUser)).Methods("POST")
+	admin.Handle("/lockouts", can(auth.CapabilityUsersRead, h.ListLockouts)).Methods("GET")
+	admin.Handle("/lockouts/ip/{ip}/unlock", can(auth.CapabilityUsersWrite, h.UnlockIP)).Methods("POST")
 
 	protected.HandleFunc("/auth/passwd", h.ChangePassword).Methods("POST")
-	admin.HandleFunc("/users/{email}/passwd", h.AdminChangePassword).Methods("POST")
+	protected.HandleFunc("/auth/passwd/policy", h.GetPasswordPolicy).Methods("GET")
+	protected.HandleFunc("/auth/logout", h.Logout).Methods("POST")
+	protected.HandleFunc("/auth/sessions", h.ListSessions).Methods("GET")
+	protected.HandleFunc("/auth/sessions/{id}", h.RevokeSession).Methods("DELETE")
+	protected.HandleFunc("/auth/mfa", h.GetMFAStatus).Methods("GET")
+	protected.HandleFunc("/auth/mfa/enroll", h.EnrollMFA).Methods("POST")
+	protected.HandleFunc("/auth/mfa/confirm", h.ConfirmMFA).Methods("POST")
+	protected.HandleFunc("/auth/mfa/disable", h.DisableMFA).Methods("POST")
+	protected.HandleFunc("/auth/mfa/recovery-codes", h.RegenerateRecoveryCodes).Methods("POST")
+	protected.HandleFunc("/auth/webauthn/register/begin", h.BeginWebAuthnRegistration).Methods("POST")
+	protected.HandleFunc("/auth/webauthn/register/finish", h.FinishWebAuthnRegistration).Methods("POST")
+	protected.HandleFunc("/auth/webauthn/credentials", h.ListWebAuthnCredentials).Methods("GET")
+	protected.HandleFunc("/auth/webauthn/credentials/{id}", h.DeleteWebAuthnCredential).Methods("DELETE")
+	protected.HandleFunc("/groups/{group}/members", h.ListGroupMembers).Methods("GET")
+	protected.HandleFunc("/groups/{group}/members/{email}", h.SetGroupMember).Methods("PUT")
+	protected.HandleFunc("/groups/{group}/members/{email}", h.RemoveGroupMember).Methods("DELETE")
+	protected.HandleFunc("/groups/{group}/acls", h.ListPathACLs).Methods("GET")
+	protected.HandleFunc("/groups/{group}/acls", h.SetPathACL).Methods("PUT")
+	protected.HandleFunc("/groups/{group}/acls/{id}", h.DeletePathACL).Methods("DELETE")
+	protected.HandleFunc("/groups/{group}/grants", h.ListGrants).Methods("GET")
+	protected.HandleFunc("/groups/{group}/grants", h.CreateGrant).Methods("POST")
+	protected.HandleFunc("/groups/{group}/grants/{id}", h.RevokeGrant).Methods("DELETE")
+	admin.Handle("/users/{email}/passwd", can(auth.CapabilityUsersWrite, h.AdminChangePassword)).Methods("POST")
+	admin.Handle("/users/{email}/sessions", can(auth.CapabilityUsersRead, h.AdminListSessions)).Methods("GET")
+	admin.Handle("/users/{email}/sessions", can(auth.CapabilityUsersWrite, h.AdminRevokeAllSessions)).Methods("DELETE")
+	admin.Handle("/users/{email}/sessions/{id}", can(auth.CapabilityUsersWrite, h.AdminRevokeSession)).Methods("DELETE")
+	admin.Handle("/users/{email}/mfa", can(auth.CapabilityUsersWrite, h.AdminResetMFA)).Methods("DELETE")
+	admin.Handle("/mfa/policy", can(auth.CapabilityPoliciesRead, h.GetMFAPolicy)).Methods("GET")
+	admin.Handle("/mfa/policy", can(auth.CapabilityPoliciesWrite, h.SetMFAPolicy)).Methods("PUT")
+	admin.Handle("/password/policy", can(auth.CapabilityPoliciesRead, h.GetPasswordPolicy)).Methods("GET")
+	admin.Handle("/password/policy", can(auth.CapabilityPoliciesWrite, h.SetPasswordPolicy)).Methods("PUT")
+
+	admin.Handle("/groups", can(auth.CapabilityGroupsRead, h.ListGroups)).Methods("GET")
+	admin.Handle("/groups", can(auth.CapabilityGroupsWrite, h.CreateGroup)).Methods("POST")
+	admin.Handle("/groups/{group}", can(auth.CapabilityGroupsRead, h.GetGroup)).Methods("GET")
+	admin.Handle("/groups/{group}", can(auth.CapabilityGroupsWrite, h.UpdateGroup)).Methods("PUT")
+	admin.Handle("/groups/{group}", can(auth.CapabilityGroupsWrite, h.DeleteGroup)).Methods("DELETE")
+	admin.Handle("/groups/{group}/cache", can(auth.CapabilityGroupsWrite, h.SetGroupCachePolicy)).Methods("PUT")
+
+	admin.Handle("/service-accounts", can(auth.CapabilityServiceAccountsWrite, h.CreateServiceAccount)).Methods("POST")
+	admin.Handle("/service-accounts", can(auth.CapabilityServiceAccountsRead, h.ListServiceAccounts)).Methods("GET")
+	admin.Handle("/service-accounts/{name}", can(auth.CapabilityServiceAccountsWrite, h.DeleteServiceAccount)).Methods("DELETE")
+	admin.Handle("/service-accounts/{name}/keys", can(auth.CapabilityServiceAccountsWrite, h.CreateAPIKey)).Methods("POST")
+	admin.Handle("/service-accounts/{name}/keys", can(auth.CapabilityServiceAccountsRead, h.ListAPIKeys)).Methods("GET")
+	admin.Handle("/service-accounts/{name}/keys/{id}", can(auth.CapabilityServiceAccountsWrite, h.RevokeAPIKey)).Methods("DELETE")
+
+	admin.Handle("/roles", can(auth.CapabilityUsersRead, h.ListRoles)).Methods("GET")
+	admin.Handle("/roles", can(auth.CapabilityRolesWrite, h.CreateRole)).Methods("POST")
+	admin.Handle("/roles/{name}", can(auth.CapabilityRolesWrite, h.UpdateRole)).Methods("PUT")
+	admin.Handle("/roles/{name}", can(auth.CapabilityRolesWrite, h.DeleteRole)).Methods("DELETE")
+
+	admin.Handle("/webhooks", can(auth.CapabilityWebhooksRead, h.ListWebhooks)).Methods("GET")
+	admin.Handle("/webhooks", can(auth.CapabilityWebhooksWrite, h.CreateWebhook)).Methods("POST")
+	admin.Handle("/webhooks/{id}", can(auth.CapabilityWebhooksWrite, h.DeleteWebhook)).Methods("DELETE")
+	admin.Handle("/webhooks/{id}/test", can(auth.CapabilityWebhooksWrite, h.TestWebhook)).Methods("POST")
+	admin.Handle("/webhooks/{id}/deliveries", can(auth.CapabilityWebhooksRead, h.ListWebhookDeliveries)).Methods("GET")
+
+	admin.Handle("/rotations", can(auth.CapabilityRotationsRead, h.ListRotations)).Methods("GET")
+	admin.Handle("/rotations/{group}/{path:.*}", can(auth.CapabilityRotationsWrite, h.SetRotation)).Methods("PUT")
+	admin.Handle("/rotations/{group}/{path:.*}", can(auth.CapabilityRotationsWrite, h.DeleteRotation)).Methods("DELETE")
 }
 
 func writeJSON(w http.ResponseWriter, data interface{}) {
@@ -61,6 +170,26 @@ func writeError(w http.ResponseWriter, message string, code int) {
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
 
+// clientIP returns the address of the client, preferring the address reported by
+// a reverse proxy. It is informational only (shown in session listings and logs).
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
 func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]string{
 		"status": "healthy",
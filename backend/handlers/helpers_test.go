@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/auth"
+)
+
+// newTestServer returns the API routes on a new database in a temporary
+// directory, closed when the test ends
+func newTestServer(t *testing.T) (http.Handler, *database.DB) {
+	t.Helper()
+	t.Setenv("PMAN_DB_PATH", filepath.Join(t.TempDir(), "pman.db"))
+	t.Setenv("PMAN_LDAP_URL", "")
+	t.Setenv("PMAN_ENCRYPTION_KEY", "testkey-testkey-testkey-testkey1")
+	t.Setenv("PMAN_DOMAIN_NAME", "localhost")
+
+	db, err := database.Initialize()
+	if err != nil {
+		t.Fatalf("database.Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := mux.NewRouter()
+	SetupRoutes(r, db)
+	return r, db
+}
+
+// call makes a request to the API as email and returns the response status
+func call(t *testing.T, server http.Handler, email, method, path string, body interface{}) int {
+	t.Helper()
+	token, _, err := auth.GenerateToken(email, "", "", "", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec.Code
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+)
+
+// checkLoginThrottle rejects a login attempt with 429 while the account or the
+// client address is backing off or locked out
+func (h *Handlers) checkLoginThrottle(w http.ResponseWriter, email, ip string) bool {
+	throttle, err := h.lockoutService.Check(email, ip)
+	if err != nil {
+		writeError(w, "Failed to check login attempts", http.StatusInternalServerError)
+		return false
+	}
+	if throttle == nil {
+		return true
+	}
+
+	seconds := int(math.Ceil(throttle.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	wait := (time.Duration(seconds) * time.Second).String()
+	if throttle.Locked {
+		writeError(w, fmt.Sprintf("Too many failed login attempts, login is locked for %s", wait), http.StatusTooManyRequests)
+	} else {
+		writeError(w, fmt.Sprintf("Too many failed login attempts, try again in %s", wait), http.StatusTooManyRequests)
+	}
+	return false
+}
+
+func (h *Handlers) recordLoginFailure(email, ip string) {
+	if err := h.lockoutService.RecordFailure(email, ip); err != nil {
+		log.Printf("Failed to record failed login for %s: %v", email, err)
+	}
+}
+
+// loginIP is the address failed logins are counted against. Unlike clientIP it
+// only believes forwarding headers from PMAN_TRUSTED_PROXIES, as any client
+// could otherwise claim a fresh address for every guess.
+func (h *Handlers) loginIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.lockoutService.IsTrustedProxy(host) {
+		return host
+	}
+
+	// Proxies append to X-Forwarded-For, so the first entry from the right that
+	// is not one of ours is the client; anything further left is client-supplied
+	if forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ","); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop != "" && !h.lockoutService.IsTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	return host
+}
+
+func (h *Handlers) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	status, err := h.lockoutService.Status()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, status)
+}
+
+func (h *Handlers) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !h.authorizeUserChange(w, r, vars["email"]) {
+		return
+	}
+	h.unlock(w, r, services.LockoutKindAccount, vars["email"])
+}
+
+func (h *Handlers) UnlockIP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.unlock(w, r, services.LockoutKindIP, vars["ip"])
+}
+
+func (h *Handlers) unlock(w http.ResponseWriter, r *http.Request, kind, subject string) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.lockoutService.Unlock(kind, subject, claims.Email); err != nil {
+		if err == services.ErrNoLockout {
+			writeError(w, fmt.Sprintf("No failed logins recorded for %s", subject), http.StatusNotFound)
+			return
+		}
+		writeError(w, "Failed to unlock", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Unlocked successfully"})
+}
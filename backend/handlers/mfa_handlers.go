@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+// mfaUser returns the calling user; service accounts authenticate with API keys and have no
+// MFA, and single sign-on users get theirs from the identity provider
+func (h *Handlers) mfaUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if claims.ServiceAccount {
+		writeError(w, "MFA is not available to service accounts", http.StatusForbidden)
+		return nil, false
+	}
+
+	user, err := h.userService.GetUserByEmail(claims.Email)
+	if err != nil {
+		writeError(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if user.AuthSource == services.AuthSourceOIDC {
+		writeError(w, "MFA for single sign-on accounts is managed by the identity provider", http.StatusForbidden)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// writeMFAError reports a failed code check. Authenticated endpoints use 403 for
+// a wrong code, as clients take a 401 to mean their access token has expired.
+func writeMFAError(w http.ResponseWriter, err error, invalidCode int) {
+	if err == services.ErrInvalidMFACode {
+		writeError(w, err.Error(), invalidCode)
+		return
+	}
+	writeError(w, "Failed to verify authentication code", http.StatusInternalServerError)
+}
+
+func (h *Handlers) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.mfaService.Status(user)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status.SecurityKeys, err = h.webauthnService.CountCredentials(user.Email)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, status)
+}
+
+func (h *Handlers) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.mfaService.Enroll(user.Email)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, enrollment)
+}
+
+func (h *Handlers) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Code == "" {
+		writeError(w, "Authentication code is required", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfaService.Confirm(user.Email, req.Code)
+	if err != nil {
+		if err == services.ErrInvalidMFACode {
+			writeError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *Handlers) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !user.MFAEnabled {
+		writeError(w, "MFA is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if !h.canRemoveFactor(w, user, services.MFAMethodTOTP) {
+		return
+	}
+
+	if err := h.mfaService.Verify(user.Email, req.Code); err != nil {
+		writeMFAError(w, err, http.StatusForbidden)
+		return
+	}
+
+	if err := h.mfaService.Disable(user.Email); err != nil {
+		writeError(w, "Failed to disable MFA", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "MFA disabled successfully"})
+}
+
+func (h *Handlers) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !user.MFAEnabled {
+		writeError(w, "MFA is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaService.Verify(user.Email, req.Code); err != nil {
+		writeMFAError(w, err, http.StatusForbidden)
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(user.Email)
+	if err != nil {
+		writeError(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// canRemoveFactor refuses to remove the user's last second factor when policy requires MFA
+func (h *Handlers) canRemoveFactor(w http.ResponseWriter, user *models.User, method string) bool {
+	required, err := h.mfaService.IsRequired(user)
+	if err != nil {
+		writeError(w, "Failed to check MFA policy", http.StatusInternalServerError)
+		return false
+	}
+	if !required {
+		return true
+	}
+
+	if method == services.MFAMethodWebAuthn {
+		keys, err := h.webauthnService.CountCredentials(user.Email)
+		if err != nil {
+			writeError(w, "Failed to check MFA", http.StatusInternalServerError)
+			return false
+		}
+		if user.MFAEnabled || keys > 1 {
+			return true
+		}
+	} else {
+		methods, err := h.mfaMethods(user)
+		if err != nil {
+			writeError(w, "Failed to check MFA", http.StatusInternalServerError)
+			return false
+		}
+		if len(methods) > 1 {
+			return true
+		}
+	}
+
+	writeError(w, "MFA is required for your account by policy", http.StatusForbidden)
+	return false
+}
+
+// AdminResetMFA removes a user's MFA (TOTP and security keys), e.g. after they
+// lost their authenticator. If policy requires MFA they must enrol again at next login.
+func (h *Handlers) AdminResetMFA(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	email := vars["email"]
+
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
+	if _, err := h.userService.GetUserByEmail(email); err != nil {
+		writeError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.mfaService.Disable(email); err != nil {
+		writeError(w, "Failed to reset MFA", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.webauthnService.DeleteAllCredentials(email); err != nil {
+		writeError(w, "Failed to reset MFA", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "MFA reset successfully"})
+}
+
+func (h *Handlers) GetMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.mfaService.GetPolicy()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, policy)
+}
+
+func (h *Handlers) SetMFAPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.MFAPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaService.SetPolicy(&policy); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, policy)
+}
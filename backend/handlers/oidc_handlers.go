@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/oidc"
+)
+
+// GetOIDCConfig tells the CLI where to send users to sign in
+func (h *Handlers) GetOIDCConfig(w http.ResponseWriter, r *http.Request) {
+	if !h.oidcService.Enabled() {
+		writeError(w, "Single sign-on is not configured on this server", http.StatusNotFound)
+		return
+	}
+
+	oidcConfig, err := h.oidcService.ClientConfig()
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		writeError(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, oidcConfig)
+}
+
+// OIDCLogin exchanges an ID token issued by the identity provider for a pman session
+func (h *Handlers) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req models.OIDCLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.IDToken == "" {
+		writeError(w, "ID token is required", http.StatusBadRequest)
+		return
+	}
+
+	// Only the device flow has no nonce to bind the token to the login
+	if req.Nonce == "" && !req.Device {
+		writeError(w, "Nonce is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.oidcService.Authenticate(req.IDToken, req.Nonce)
+	if err != nil {
+		switch {
+		case err == services.ErrSSODisabled:
+			writeError(w, "Single sign-on is not configured on this server", http.StatusNotFound)
+		case errors.Is(err, oidc.ErrInvalidToken):
+			writeError(w, err.Error(), http.StatusUnauthorized)
+		case err == services.ErrLocalUser || err == services.ErrSSODisabledUser || err == services.ErrUnverifiedEmail:
+			writeError(w, err.Error(), http.StatusUnauthorized)
+		default:
+			log.Printf("Single sign-on failed: %v", err)
+			writeError(w, "Single sign-on failed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.startSession(w, r, user, req.ExpireDays, req.ClientHostname)
+}
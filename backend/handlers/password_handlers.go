@@ -2,13 +2,34 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/steve/pman/shared/auth"
 	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
 )
 
+// getCallerGroups returns the group permissions of the authenticated user or service account
+func (h *Handlers) getCallerGroups(claims *auth.Claims) (string, error) {
+	if claims.ServiceAccount {
+		return claims.Groups, nil
+	}
+
+	user, err := h.userService.GetUserByEmail(claims.Email)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Groups, nil
+}
+
+func pathNotAllowedMessage(path string) string {
+	return fmt.Sprintf("access to path '%s' is not allowed for this service account", path)
+}
+
 func (h *Handlers) CreatePassword(w http.ResponseWriter, r *http.Request) {
 	claims, ok := auth.GetUserFromContext(r.Context())
 	if !ok {
@@ -33,13 +54,18 @@ func (h *Handlers) CreatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.GetUserByEmail(claims.Email)
+	if !permissions.HasPathAccess(claims.PathPrefixes, req.Path) {
+		writeError(w, pathNotAllowedMessage(req.Path), http.StatusForbidden)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
 	if err != nil {
 		writeError(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
-	err = h.passwordService.CreatePassword(req.Path, req.Value, groupName, claims.Email, user.Groups)
+	err = h.passwordService.CreatePassword(req.Path, req.Value, groupName, claims.Email, userGroups)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusForbidden)
 		return
@@ -59,19 +85,41 @@ func (h *Handlers) GetPassword(w http.ResponseWriter, r *http.Request) {
 	groupName := vars["group"]
 	path := vars["path"]
 
-	user, err := h.userService.GetUserByEmail(claims.Email)
+	if !permissions.HasPathAccess(claims.PathPrefixes, path) {
+		writeError(w, pathNotAllowedMessage(path), http.StatusForbidden)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
 	if err != nil {
 		writeError(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
-	value, err := h.passwordService.GetPassword(path, groupName, user.Groups)
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			writeError(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	value, err := h.passwordService.GetPasswordVersion(path, groupName, version, claims.Email, userGroups)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	writeJSON(w, map[string]string{"value": value})
+	cacheMaxAge, err := h.cacheMaxAge(groupName, path)
+	if err != nil {
+		writeError(w, "Failed to read group cache policy", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, models.PasswordValue{
+		Value:            value,
+		CacheMaxAgeHours: cacheMaxAge,
+	})
 }
 
 func (h *Handlers) UpdatePassword(w http.ResponseWriter, r *http.Request) {
@@ -85,6 +133,11 @@ func (h *Handlers) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 	groupName := vars["group"]
 	path := vars["path"]
 
+	if !permissions.HasPathAccess(claims.PathPrefixes, path) {
+		writeError(w, pathNotAllowedMessage(path), http.StatusForbidden)
+		return
+	}
+
 	var req models.PasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, "Invalid request body", http.StatusBadRequest)
@@ -96,13 +149,13 @@ func (h *Handlers) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userService.GetUserByEmail(claims.Email)
+	userGroups, err := h.getCallerGroups(claims)
 	if err != nil {
 		writeError(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
-	err = h.passwordService.UpdatePassword(path, req.Value, groupName, claims.Email, user.Groups)
+	err = h.passwordService.UpdatePassword(path, req.Value, groupName, claims.Email, userGroups)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusForbidden)
 		return
@@ -122,23 +175,28 @@ func (h *Handlers) DeletePassword(w http.ResponseWriter, r *http.Request) {
 	groupName := vars["group"]
 	path := vars["path"]
 
+	if !permissions.HasPathAccess(claims.PathPrefixes, path) {
+		writeError(w, pathNotAllowedMessage(path), http.StatusForbidden)
+		return
+	}
+
 	recursive := r.URL.Query().Get("recursive") == "true"
 
-	user, err := h.userService.GetUserByEmail(claims.Email)
+	userGroups, err := h.getCallerGroups(claims)
 	if err != nil {
 		writeError(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
 	if recursive {
-		count, err := h.passwordService.DeletePasswordRecursive(path, groupName, user.Groups)
+		count, err := h.passwordService.DeletePasswordRecursive(path, groupName, claims.Email, userGroups)
 		if err != nil {
 			writeError(w, err.Error(), http.StatusForbidden)
 			return
 		}
 		writeJSON(w, map[string]interface{}{"message": "Passwords deleted successfully", "count": count})
 	} else {
-		err = h.passwordService.DeletePassword(path, groupName, user.Groups)
+		err = h.passwordService.DeletePassword(path, groupName, claims.Email, userGroups)
 		if err != nil {
 			writeError(w, err.Error(), http.StatusForbidden)
 			return
@@ -158,18 +216,28 @@ func (h *Handlers) ListPasswords(w http.ResponseWriter, r *http.Request) {
 	groupName := vars["group"]
 	pathPrefix := r.URL.Query().Get("prefix")
 
-	user, err := h.userService.GetUserByEmail(claims.Email)
+	userGroups, err := h.getCallerGroups(claims)
 	if err != nil {
 		writeError(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
-	paths, err := h.passwordService.ListPasswords(groupName, pathPrefix, user.Groups)
+	paths, err := h.passwordService.ListPasswords(groupName, pathPrefix, claims.Email, userGroups)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
+	if len(claims.PathPrefixes) > 0 {
+		var allowed []string
+		for _, path := range paths {
+			if permissions.HasPathAccess(claims.PathPrefixes, path) {
+				allowed = append(allowed, path)
+			}
+		}
+		paths = allowed
+	}
+
 	writeJSON(w, map[string]interface{}{"paths": paths})
 }
 
@@ -184,13 +252,18 @@ func (h *Handlers) GetPasswordInfo(w http.ResponseWriter, r *http.Request) {
 	groupName := vars["group"]
 	path := vars["path"]
 
-	user, err := h.userService.GetUserByEmail(claims.Email)
+	if !permissions.HasPathAccess(claims.PathPrefixes, path) {
+		writeError(w, pathNotAllowedMessage(path), http.StatusForbidden)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
 	if err != nil {
 		writeError(w, "User not found", http.StatusInternalServerError)
 		return
 	}
 
-	info, err := h.passwordService.GetPasswordInfo(path, groupName, user.Groups)
+	info, err := h.passwordService.GetPasswordInfo(path, groupName, claims.Email, userGroups)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusForbidden)
 		return
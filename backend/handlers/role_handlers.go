@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+func (h *Handlers) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleService.ListRoles()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"roles": roles, "capabilities": auth.Capabilities})
+}
+
+func (h *Handlers) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := h.authorizeCapabilities(w, r, req.Capabilities)
+	if !ok {
+		return
+	}
+
+	if err := h.roleService.CreateRole(req); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	log.Printf("Role %s created by %s with capabilities %v", req.Name, claims.Email, req.Capabilities)
+	writeJSON(w, map[string]string{"message": "Role created successfully"})
+}
+
+func (h *Handlers) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !h.authorizeGrant(w, r, name) {
+		return
+	}
+	claims, ok := h.authorizeCapabilities(w, r, req.Capabilities)
+	if !ok {
+		return
+	}
+
+	if err := h.roleService.UpdateRole(name, req); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	log.Printf("Role %s changed by %s to capabilities %v", name, claims.Email, req.Capabilities)
+	writeJSON(w, map[string]string{"message": "Role updated successfully"})
+}
+
+func (h *Handlers) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if !h.authorizeGrant(w, r, name) {
+		return
+	}
+
+	if err := h.roleService.DeleteRole(name); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Role deleted successfully"})
+}
+
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrRoleExists), errors.Is(err, services.ErrRoleInUse):
+		writeError(w, err.Error(), http.StatusConflict)
+	default:
+		writeError(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// hasCapability reports whether the caller's role grants capability
+func (h *Handlers) hasCapability(claims *auth.Claims, capability string) (bool, error) {
+	if claims.ServiceAccount {
+		return false, nil
+	}
+	capabilities, err := h.roleService.UserCapabilities(claims.Email)
+	if err != nil {
+		return false, err
+	}
+	return auth.HasCapability(capabilities, capability), nil
+}
+
+// authorizeCapabilities lets the caller through if their role has every one
+// of capabilities, so roles cannot be used to gain capabilities
+func (h *Handlers) authorizeCapabilities(w http.ResponseWriter, r *http.Request, capabilities []string) (*auth.Claims, bool) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	own, err := h.roleService.UserCapabilities(claims.Email)
+	if err != nil {
+		writeError(w, "Failed to get role", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !auth.CoversCapabilities(own, capabilities) {
+		writeError(w, "Cannot grant capabilities you do not have", http.StatusForbidden)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// authorizeGrant lets the caller through if their role has every capability
+// of each of roles, e.g. before assigning one of them to a user
+func (h *Handlers) authorizeGrant(w http.ResponseWriter, r *http.Request, roles ...string) bool {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	caller, err := h.userService.GetUserByEmail(claims.Email)
+	if err != nil {
+		writeError(w, "Failed to get role", http.StatusInternalServerError)
+		return false
+	}
+
+	for _, role := range roles {
+		allowed, err := h.roleService.CanGrant(caller.Role, role)
+		if err != nil {
+			writeError(w, "Failed to get role", http.StatusInternalServerError)
+			return false
+		}
+		if !allowed {
+			writeError(w, "Role '"+role+"' has capabilities you do not have", http.StatusForbidden)
+			return false
+		}
+	}
+
+	return true
+}
+
+// authorizeUserChange keeps holders of users:write from changing their own
+// account, users whose role has capabilities they lack, such as admins, and
+// from handing out such roles. Unknown users are let through for the handler
+// to report.
+func (h *Handlers) authorizeUserChange(w http.ResponseWriter, r *http.Request, email string, newRoles ...string) bool {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if strings.EqualFold(email, claims.Email) {
+		writeError(w, "You cannot change your own account through the admin endpoints", http.StatusForbidden)
+		return false
+	}
+
+	roles := newRoles
+	if user, err := h.userService.GetUserByEmail(email); err == nil {
+		roles = append(roles, user.Role)
+	}
+	return h.authorizeGrant(w, r, roles...)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+func (h *Handlers) RotatePassword(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupName := vars["group"]
+	path := vars["path"]
+
+	if !permissions.HasPathAccess(claims.PathPrefixes, path) {
+		writeError(w, pathNotAllowedMessage(path), http.StatusForbidden)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := h.rotationService.RotatePassword(path, groupName, claims.Email, userGroups)
+	if err != nil {
+		log.Printf("Rotation of %s:%s by %s failed: %v", groupName, path, claims.Email, err)
+		writeRotationError(w, err)
+		return
+	}
+
+	log.Printf("Password %s:%s rotated to version %d by %s", groupName, path, result.Version, claims.Email)
+	writeJSON(w, result)
+}
+
+func (h *Handlers) ListRotations(w http.ResponseWriter, r *http.Request) {
+	rotations, err := h.rotationService.ListRotations(r.URL.Query().Get("group"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"rotations": rotations})
+}
+
+func (h *Handlers) SetRotation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupName := vars["group"]
+	path := vars["path"]
+
+	var req models.RotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	rotation, err := h.rotationService.SetRotation(groupName, path, req, claims.Email, userGroups)
+	if err != nil {
+		writeRotationError(w, err)
+		return
+	}
+
+	log.Printf("Password %s:%s bound to the %s rotator (every %d minutes) by %s", groupName, path, rotation.Rotator, rotation.IntervalMinutes, claims.Email)
+	writeJSON(w, rotation)
+}
+
+func (h *Handlers) DeleteRotation(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	groupName := vars["group"]
+	path := vars["path"]
+
+	if err := h.rotationService.DeleteRotation(groupName, path); err != nil {
+		writeRotationError(w, err)
+		return
+	}
+
+	log.Printf("Rotator of %s:%s removed by %s", groupName, path, claims.Email)
+	writeJSON(w, map[string]string{"message": "Rotation removed successfully"})
+}
+
+func writeRotationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrPasswordNotFound), errors.Is(err, services.ErrRotationNotFound):
+		writeError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidRotation):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrRotationRunning):
+		writeError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrRotationFailed):
+		writeError(w, err.Error(), http.StatusBadGateway)
+	default:
+		writeError(w, err.Error(), http.StatusForbidden)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/shared/auth"
+)
+
+func (h *Handlers) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.tokenService.ListSessions(claims.Email)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.Session
+	}
+
+	writeJSON(w, map[string]interface{}{"sessions": sessions})
+}
+
+func (h *Handlers) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	sessionID := vars["id"]
+
+	if err := h.tokenService.RevokeUserSession(claims.Email, sessionID); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Session revoked successfully"})
+}
+
+func (h *Handlers) AdminListSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	email := vars["email"]
+
+	sessions, err := h.tokenService.ListSessions(email)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"sessions": sessions})
+}
+
+func (h *Handlers) AdminRevokeSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	email := vars["email"]
+	sessionID := vars["id"]
+
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
+	if err := h.tokenService.RevokeUserSession(email, sessionID); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Session revoked successfully"})
+}
+
+func (h *Handlers) AdminRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	email := vars["email"]
+
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
+	if err := h.tokenService.RevokeUserTokens(email); err != nil {
+		writeError(w, "Failed to revoke user tokens", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "All sessions revoked successfully"})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/models"
+)
+
+// Setup creates the first admin of a new server. It needs the setup token the
+// server logs at startup while it has no users, and stops working once the
+// admin exists.
+func (h *Handlers) Setup(w http.ResponseWriter, r *http.Request) {
+	var req models.SetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Email == "" || req.Password == "" {
+		writeError(w, "Setup token, email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.userService.CompleteSetup(req.Token, req.Email, req.Password, req.Groups)
+	switch {
+	case err == services.ErrAlreadyInitialized:
+		writeError(w, "This server has already been set up", http.StatusConflict)
+		return
+	case err == services.ErrInvalidSetupToken:
+		log.Printf("Rejected setup attempt with an invalid token from %s", h.loginIP(r))
+		writeError(w, "Invalid setup token", http.StatusUnauthorized)
+		return
+	case errors.Is(err, services.ErrPasswordPolicy):
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeError(w, "Failed to create admin: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Created admin user %s with the setup token", req.Email)
+	writeJSON(w, map[string]string{"message": "Admin user created successfully"})
+}
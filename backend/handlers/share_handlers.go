@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+// CreateShare makes a one-time link to a secret the caller can read
+func (h *Handlers) CreateShare(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !permissions.HasPathAccess(claims.PathPrefixes, req.Path) {
+		writeError(w, pathNotAllowedMessage(req.Path), http.StatusForbidden)
+		return
+	}
+
+	// A link would bypass the approval for whoever it is sent to
+	required, err := h.approvalService.RequiresApproval(req.Group, req.Path)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if required {
+		writeError(w, "Secrets that require approval cannot be shared", http.StatusForbidden)
+		return
+	}
+
+	userGroups, err := h.getCallerGroups(claims)
+	if err != nil {
+		writeError(w, "User not found", http.StatusInternalServerError)
+		return
+	}
+
+	value, err := h.passwordService.GetPassword(req.Path, req.Group, claims.Email, userGroups)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	share, err := h.shareService.CreateShare(req, value, claims.Email)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidShare) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Share link for %s:%s created by %s (%d views, expires %s)", req.Group, req.Path, claims.Email, share.Views, share.ExpiresAt.Format("2006-01-02 15:04"))
+	writeJSON(w, share)
+}
+
+// GetShare shows a shared secret to anyone with the link, using up a view
+func (h *Handlers) GetShare(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	shared, err := h.shareService.OpenShare(mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, services.ErrShareNotFound) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Share link for %s:%s viewed from %s (%d views left)", shared.Group, shared.Path, clientIP(r), shared.ViewsLeft)
+	writeJSON(w, shared)
+}
@@ -2,13 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/auth"
 	"github.com/steve/pman/shared/models"
 )
 
 func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var req models.UserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, "Invalid request body", http.StatusBadRequest)
@@ -20,8 +29,16 @@ func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	password, err := h.userService.CreateUser(req.Email, req.Role, req.Groups)
+	if !h.authorizeGrant(w, r, req.Role) || !h.authorizeGroupAssignment(w, r, req.Email, req.Groups) {
+		return
+	}
+
+	password, err := h.userService.CreateUser(req.Email, req.Role, req.Groups, claims.Email)
 	if err != nil {
+		if errors.Is(err, services.ErrUnknownGroup) || errors.Is(err, services.ErrUnknownRole) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -43,6 +60,12 @@ func (h *Handlers) ListUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	vars := mux.Vars(r)
 	email := vars["email"]
 
@@ -57,8 +80,20 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.userService.UpdateUser(email, req.Role, req.Groups)
+	if !h.authorizeUserChange(w, r, email, req.Role) || !h.authorizeGroupAssignment(w, r, email, req.Groups) {
+		return
+	}
+
+	err := h.userService.UpdateUser(email, req.Role, req.Groups, claims.Email)
 	if err != nil {
+		if errors.Is(err, services.ErrUnknownGroup) || errors.Is(err, services.ErrUnknownRole) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUserNotFound) {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -67,10 +102,20 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	vars := mux.Vars(r)
 	email := vars["email"]
 
-	err := h.userService.DeleteUser(email)
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
+	err := h.userService.DeleteUser(email, claims.Email)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -80,10 +125,20 @@ func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) EnableUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	vars := mux.Vars(r)
 	email := vars["email"]
 
-	err := h.userService.EnableUser(email)
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
+	err := h.userService.EnableUser(email, claims.Email)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -93,10 +148,20 @@ func (h *Handlers) EnableUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) DisableUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserFromContext(r.Context())
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	vars := mux.Vars(r)
 	email := vars["email"]
 
-	err := h.userService.DisableUser(email)
+	if !h.authorizeUserChange(w, r, email) {
+		return
+	}
+
+	err := h.userService.DisableUser(email, claims.Email)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
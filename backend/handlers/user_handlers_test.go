@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/models"
+)
+
+func TestUserManagerGroupChanges(t *testing.T) {
+	server, db := newTestServer(t)
+
+	if err := services.NewGroupService(db).CreateGroup("ops", ""); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	users := services.NewUserService(db)
+	for _, user := range []models.UserRequest{
+		{Email: "admin@example.com", Role: "admin"},
+		{Email: "manager@example.com", Role: "user-manager"},
+		{Email: "lead@example.com", Role: "user-manager", Groups: "ops:owner"},
+		{Email: "alice@example.com", Role: "user", Groups: "ops:ro"},
+	} {
+		if _, err := users.CreateUser(user.Email, user.Role, user.Groups, "admin@example.com"); err != nil {
+			t.Fatalf("CreateUser(%s) error = %v", user.Email, err)
+		}
+	}
+
+	const manager, lead = "manager@example.com", "lead@example.com"
+	for _, tc := range []struct {
+		name, caller, method, path string
+		body                       models.UserRequest
+		want                       int
+	}{
+		{"user-manager edits itself", manager, "PUT", "/admin/users/manager@example.com", models.UserRequest{Role: "user-manager", Groups: "ops:owner"}, http.StatusForbidden},
+		{"owner edits itself", lead, "PUT", "/admin/users/lead@example.com", models.UserRequest{Role: "user-manager", Groups: "ops:owner"}, http.StatusForbidden},
+		{"user-manager changes a group", manager, "PUT", "/admin/users/alice@example.com", models.UserRequest{Role: "user", Groups: "ops:rw"}, http.StatusForbidden},
+		{"user-manager keeps the groups", manager, "PUT", "/admin/users/alice@example.com", models.UserRequest{Role: "user", Groups: "ops:ro"}, http.StatusOK},
+		{"user-manager creates a group member", manager, "POST", "/admin/users", models.UserRequest{Email: "standin@example.com", Role: "user", Groups: "ops:owner"}, http.StatusForbidden},
+		{"owner makes an owner", lead, "PUT", "/admin/users/alice@example.com", models.UserRequest{Role: "user", Groups: "ops:owner"}, http.StatusForbidden},
+		{"owner changes a member", lead, "PUT", "/admin/users/alice@example.com", models.UserRequest{Role: "user", Groups: "ops:rw"}, http.StatusOK},
+		{"owner creates a member", lead, "POST", "/admin/users", models.UserRequest{Email: "bob@example.com", Role: "user", Groups: "ops:ro"}, http.StatusOK},
+		{"admin makes an owner", "admin@example.com", "PUT", "/admin/users/alice@example.com", models.UserRequest{Role: "user", Groups: "ops:owner"}, http.StatusOK},
+		{"owner changes an owner", lead, "PUT", "/admin/users/alice@example.com", models.UserRequest{Role: "user", Groups: "ops:ro"}, http.StatusForbidden},
+	} {
+		if got := call(t, server, tc.caller, tc.method, tc.path, tc.body); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	for email, want := range map[string]string{
+		manager:             "",
+		"alice@example.com": "ops:owner",
+	} {
+		user, err := users.GetUserByEmail(email)
+		if err != nil {
+			t.Fatalf("GetUserByEmail(%s) error = %v", email, err)
+		}
+		if user.Groups != want {
+			t.Errorf("groups of %s = %q, want %q", email, user.Groups, want)
+		}
+	}
+	if _, err := users.GetUserByEmail("standin@example.com"); err == nil {
+		t.Error("user created with groups the caller cannot assign")
+	}
+}
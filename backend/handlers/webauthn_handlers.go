@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/models"
+)
+
+func writeWebAuthnError(w http.ResponseWriter, err error, failed int) {
+	if errors.Is(err, services.ErrWebAuthnFailed) {
+		writeError(w, err.Error(), failed)
+		return
+	}
+	writeError(w, "Failed to verify security key", http.StatusInternalServerError)
+}
+
+func (h *Handlers) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	options, err := h.webauthnService.BeginRegistration(user)
+	if err != nil {
+		writeError(w, "Failed to start security key registration", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"publicKey": options})
+}
+
+func (h *Handlers) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.WebAuthnRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Credential == nil {
+		writeError(w, "Credential is required", http.StatusBadRequest)
+		return
+	}
+
+	cred, err := h.webauthnService.FinishRegistration(user.Email, req.Name, req.Credential)
+	if err != nil {
+		if errors.Is(err, services.ErrWebAuthnFailed) {
+			writeError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, cred)
+}
+
+func (h *Handlers) ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	credentials, err := h.webauthnService.ListCredentials(user.Email)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"credentials": credentials})
+}
+
+func (h *Handlers) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.mfaUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid security key ID", http.StatusBadRequest)
+		return
+	}
+
+	if !h.canRemoveFactor(w, user, services.MFAMethodWebAuthn) {
+		return
+	}
+
+	if err := h.webauthnService.DeleteCredential(user.Email, id); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Security key removed successfully"})
+}
+
+// BeginWebAuthnLogin returns the assertion options for the second step of a
+// login. It is public: the MFA challenge token from the password step authenticates it.
+func (h *Handlers) BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var req models.WebAuthnLoginBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := h.mfaService.GetChallenge(req.MFAToken)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	options, err := h.webauthnService.BeginLogin(challenge.UserEmail, req.MFAToken)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"publicKey": options})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/backend/services"
+	"github.com/steve/pman/shared/config"
+)
+
+// runInit creates the first admin of a new database without starting the
+// server, for provisioning scripts. The password comes from
+// PMAN_ADMIN_PASSWORD or stdin, or is generated, and must be changed at the
+// first login.
+func runInit(args []string) {
+	cfg := config.GetBootstrapConfig()
+
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	email := fs.String("email", cfg.AdminEmail, "Email of the first admin (default PMAN_ADMIN_EMAIL)")
+	groups := fs.String("groups", cfg.AdminGroups, "Groups of the first admin, e.g. team1:rw,team2:rw (default PMAN_ADMIN_GROUPS)")
+	passwordStdin := fs.Bool("password-stdin", false, "Read the initial password from the first line of stdin")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pman-server init --email <email> [--groups <groups>] [--password-stdin]\n\n")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(args)
+
+	if *email == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg.AdminEmail = *email
+	cfg.AdminGroups = *groups
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.AdminPassword = strings.TrimRight(line, "\r\n")
+	}
+
+	db, err := database.Initialize()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: database initialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	password, err := services.NewUserService(db).CreateConfiguredAdmin(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating admin: %v\n", err)
+		db.Close()
+		os.Exit(1)
+	}
+
+	fmt.Printf("Admin user created: %s\n", cfg.AdminEmail)
+	if password != "" {
+		fmt.Printf("Initial password: %s\n", password)
+	}
+	fmt.Println("The password must be changed at the first login")
+}
@@ -4,10 +4,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/steve/pman/backend/database"
 	"github.com/steve/pman/backend/handlers"
+	"github.com/steve/pman/backend/services"
 	"github.com/steve/pman/shared/config"
 )
 
@@ -16,16 +18,44 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runInit(os.Args[2:])
+		return
+	}
+
 	if err := config.ValidateEnvVars(); err != nil {
 		log.Fatalf("Environment validation failed: %v", err)
 	}
 
+	if err := config.ValidateLDAPConfig(); err != nil {
+		log.Fatalf("LDAP configuration invalid: %v", err)
+	}
+
+	if err := config.ValidateOIDCConfig(); err != nil {
+		log.Fatalf("OIDC configuration invalid: %v", err)
+	}
+
+	if err := config.ValidateLockoutConfig(); err != nil {
+		log.Fatalf("Lockout configuration invalid: %v", err)
+	}
+
+	if err := config.ValidateBootstrapConfig(); err != nil {
+		log.Fatalf("Admin bootstrap configuration invalid: %v", err)
+	}
+
 	db, err := database.Initialize()
 	if err != nil {
 		log.Fatalf("Database initialization failed: %v", err)
 	}
 	defer db.Close()
 
+	if err := services.NewUserService(db).Bootstrap(config.GetBootstrapConfig()); err != nil {
+		log.Fatalf("First-run bootstrap failed: %v", err)
+	}
+
+	go services.NewRotationService(db).RunScheduler(time.Minute)
+	go services.NewWebhookService(db).RunDeliveries(5 * time.Second)
+
 	r := mux.NewRouter()
 
 	api := r.PathPrefix("/api/v1").Subrouter()
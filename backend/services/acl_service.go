@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+var ErrPathACLNotFound = errors.New("path ACL not found")
+
+// ACLService manages the path ACLs of groups, which PasswordService applies
+// after the group permission
+type ACLService struct {
+	db *database.DB
+}
+
+func NewACLService(db *database.DB) *ACLService {
+	return &ACLService{db: db}
+}
+
+func (s *ACLService) ListRules(groupName string) ([]models.PathACL, error) {
+	if exists, err := groupExists(s.db, groupName); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrGroupNotFound
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, group_name, path_prefix, subject, permission, created_by, created_at
+		FROM path_acls WHERE group_name = ? ORDER BY path_prefix, subject
+	`, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.PathACL
+	for rows.Next() {
+		var rule models.PathACL
+		err := rows.Scan(&rule.ID, &rule.Group, &rule.Path, &rule.Subject, &rule.Permission, &rule.CreatedBy, &rule.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// SetRule creates the rule for a path prefix and subject, or changes its
+// permission. The subject is a user's email or "*" for everyone.
+func (s *ACLService) SetRule(groupName string, req models.PathACLRequest, createdBy string) error {
+	permission, err := permissions.NormalizePathPermission(req.Permission)
+	if err != nil {
+		return err
+	}
+	if exists, err := groupExists(s.db, groupName); err != nil {
+		return err
+	} else if !exists {
+		return ErrGroupNotFound
+	}
+
+	subject := strings.TrimSpace(req.Subject)
+	if subject != permissions.AnySubject {
+		var exists bool
+		err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)", subject).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO path_acls (group_name, path_prefix, subject, permission, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(group_name, path_prefix, subject) DO UPDATE SET
+			permission = excluded.permission, created_by = excluded.created_by, created_at = excluded.created_at
+	`, groupName, permissions.NormalizePathPrefix(req.Path), subject, permission, createdBy, time.Now().UTC())
+
+	return err
+}
+
+func (s *ACLService) DeleteRule(groupName string, id int) error {
+	result, err := s.db.Exec("DELETE FROM path_acls WHERE id = ? AND group_name = ?", id, groupName)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrPathACLNotFound
+	}
+
+	return nil
+}
+
+// pathRules loads the rules PasswordService checks for a group
+func pathRules(db *database.DB, groupName string) ([]permissions.PathRule, error) {
+	rows, err := db.Query(`
+		SELECT path_prefix, subject, permission FROM path_acls WHERE group_name = ?
+	`, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []permissions.PathRule
+	for rows.Next() {
+		var rule permissions.PathRule
+		if err := rows.Scan(&rule.Prefix, &rule.Subject, &rule.Permission); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestPathACLs(t *testing.T) {
+	db := newTestDB(t)
+
+	acls := &ACLService{db: db}
+	passwords := &PasswordService{db: db}
+	if err := (&GroupService{db: db}).CreateGroup("team1", ""); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	if _, err := (&UserService{db: db}).CreateUser("contractor@example.com", "user", "team1:rw", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	const lead, contractor = "lead@example.com", "contractor@example.com"
+	for _, path := range []string{"dev/api", "prod/db", "prod/payments/key"} {
+		if err := passwords.CreatePassword(path, "secret", "team1", lead, "team1:rw"); err != nil {
+			t.Fatalf("CreatePassword(%s) error = %v", path, err)
+		}
+	}
+
+	rules := []models.PathACLRequest{
+		{Path: "prod/*", Subject: contractor, Permission: "ro"},
+		{Path: "prod/payments", Subject: "*", Permission: "none"},
+	}
+	for _, rule := range rules {
+		if err := acls.SetRule("team1", rule, lead); err != nil {
+			t.Fatalf("SetRule(%+v) error = %v", rule, err)
+		}
+	}
+	if err := acls.SetRule("team1", models.PathACLRequest{Path: "dev", Subject: "nobody@example.com", Permission: "ro"}, lead); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("SetRule(unknown user) error = %v, want ErrUserNotFound", err)
+	}
+
+	if _, err := passwords.GetPassword("prod/db", "team1", contractor, "team1:rw"); err != nil {
+		t.Errorf("GetPassword(read-only path) error = %v", err)
+	}
+	if err := passwords.UpdatePassword("prod/db", "new", "team1", contractor, "team1:rw"); err == nil {
+		t.Error("UpdatePassword(read-only path) error = nil")
+	}
+	if err := passwords.UpdatePassword("dev/api", "new", "team1", contractor, "team1:rw"); err != nil {
+		t.Errorf("UpdatePassword(unrestricted path) error = %v", err)
+	}
+	if _, err := passwords.GetPassword("prod/payments/key", "team1", lead, "team1:rw"); err == nil {
+		t.Error("GetPassword(hidden path) error = nil")
+	}
+	// A rule never grants more than the group permission
+	if err := passwords.UpdatePassword("dev/api", "new", "team1", contractor, "team1:ro"); err == nil {
+		t.Error("UpdatePassword(read-only member) error = nil")
+	}
+
+	paths, err := passwords.ListPasswords("team1", "", contractor, "team1:rw")
+	if err != nil {
+		t.Fatalf("ListPasswords() error = %v", err)
+	}
+	if want := []string{"dev/api", "prod/db"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("ListPasswords() = %v, want %v", paths, want)
+	}
+
+	// Auditors browse the structure without seeing values
+	const auditor = "auditor@example.com"
+	if paths, err := passwords.ListPasswords("team1", "", auditor, "team1:list"); err != nil || len(paths) != 2 {
+		t.Errorf("ListPasswords(list) = %v, %v", paths, err)
+	}
+	if _, err := passwords.GetPasswordInfo("dev/api", "team1", auditor, "team1:list"); err != nil {
+		t.Errorf("GetPasswordInfo(list) error = %v", err)
+	}
+	if _, err := passwords.GetPassword("dev/api", "team1", auditor, "team1:list"); err == nil {
+		t.Error("GetPassword(list) error = nil")
+	}
+	if err := passwords.DeletePassword("dev/api", "team1", auditor, "team1:list+write"); err == nil {
+		t.Error("DeletePassword(without delete) error = nil")
+	}
+
+	if _, err := passwords.DeletePasswordRecursive("prod", "team1", lead, "team1:rw"); err == nil {
+		t.Error("DeletePasswordRecursive(over a hidden path) error = nil")
+	}
+
+	list, err := acls.ListRules("team1")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListRules() = %v, %v", list, err)
+	}
+	if list[0].Path != "prod" || list[1].Path != "prod/payments" {
+		t.Errorf("ListRules() paths = %q, %q", list[0].Path, list[1].Path)
+	}
+	for _, rule := range list {
+		if err := acls.DeleteRule("team1", rule.ID); err != nil {
+			t.Fatalf("DeleteRule() error = %v", err)
+		}
+	}
+	if count, err := passwords.DeletePasswordRecursive("prod", "team1", lead, "team1:rw"); err != nil || count != 2 {
+		t.Errorf("DeletePasswordRecursive() = %d, %v, want 2", count, err)
+	}
+}
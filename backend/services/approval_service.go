@@ -0,0 +1,260 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+var (
+	ErrApprovalRequired      = errors.New("approval required")
+	ErrApprovalNotRequired   = errors.New("secret does not require approval")
+	ErrInvalidAccessRequest  = errors.New("invalid access request")
+	ErrPasswordNotFound      = errors.New("password not found")
+	ErrAccessRequestNotFound = errors.New("access request not found")
+	ErrAccessRequestPending  = errors.New("an access request for this secret is already pending")
+	ErrAccessRequestDecided  = errors.New("access request has already been decided")
+	ErrNotApprover           = errors.New("the approve permission on the group is required")
+	ErrSelfApproval          = errors.New("requesters cannot decide their own access requests")
+	ErrApprovalRotation      = errors.New("secrets bound to a rotator cannot require approval: unbind the rotator first")
+)
+
+// Access windows granted by an approval
+const (
+	DefaultAccessMinutes = 60
+	MaxAccessMinutes     = 24 * 60
+)
+
+// ApprovalService handles secrets that can only be read with an approved,
+// time-boxed access request. Approvers are the members of the group with the
+// approve verb (owners have it); nobody decides their own requests.
+type ApprovalService struct {
+	db *database.DB
+}
+
+func NewApprovalService(db *database.DB) *ApprovalService {
+	return &ApprovalService{db: db}
+}
+
+// SetRequired marks a secret as requiring approval, or lifts the requirement.
+// Secrets bound to a rotator are refused, since the rotator is handed the
+// value without an approval. Grants on the secret are kept, but grantees need
+// an approved request to read it like everybody else.
+func (s *ApprovalService) SetRequired(groupName, path string, required bool) error {
+	result, err := s.db.Exec(`
+		UPDATE passwords SET requires_approval = ? WHERE path = ? AND group_name = ?
+		AND (? = false OR NOT EXISTS (
+			SELECT 1 FROM rotations r WHERE r.group_name = passwords.group_name AND r.path = passwords.path))
+	`, required, path, groupName, required)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+
+	var rotated bool
+	err = s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM rotations WHERE group_name = ? AND path = ?)
+	`, groupName, path).Scan(&rotated)
+	if err != nil {
+		return err
+	}
+	if rotated {
+		return ErrApprovalRotation
+	}
+	return ErrPasswordNotFound
+}
+
+// RequiresApproval reports whether a secret requires approval; unknown
+// secrets do not
+func (s *ApprovalService) RequiresApproval(groupName, path string) (bool, error) {
+	var required bool
+	err := s.db.QueryRow(`
+		SELECT requires_approval FROM passwords WHERE path = ? AND group_name = ?
+	`, path, groupName).Scan(&required)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return required, err
+}
+
+// CreateRequest asks for access to a secret that requires approval. The
+// requester must be allowed to read the secret apart from the approval.
+func (s *ApprovalService) CreateRequest(req models.AccessRequestCreate, requester, userGroups string) (int64, error) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return 0, fmt.Errorf("%w: a reason is required", ErrInvalidAccessRequest)
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = DefaultAccessMinutes
+	}
+	if req.DurationMinutes < 0 || req.DurationMinutes > MaxAccessMinutes {
+		return 0, fmt.Errorf("%w: access can be requested for up to %d hours", ErrInvalidAccessRequest, MaxAccessMinutes/60)
+	}
+
+	if err := checkAccess(s.db, req.Group, req.Path, requester, userGroups, permissions.VerbRead); err != nil {
+		return 0, err
+	}
+
+	var required bool
+	err := s.db.QueryRow(`
+		SELECT requires_approval FROM passwords WHERE path = ? AND group_name = ?
+	`, req.Path, req.Group).Scan(&required)
+	if err == sql.ErrNoRows {
+		return 0, ErrPasswordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !required {
+		return 0, ErrApprovalNotRequired
+	}
+
+	var pending bool
+	err = s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM access_requests
+		WHERE group_name = ? AND path = ? AND requester = ? AND status = ?)
+	`, req.Group, req.Path, requester, models.AccessRequestPending).Scan(&pending)
+	if err != nil {
+		return 0, err
+	}
+	if pending {
+		return 0, ErrAccessRequestPending
+	}
+
+	var id int64
+	err = s.db.QueryRow(`
+		INSERT INTO access_requests (group_name, path, requester, reason, duration_minutes, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`, req.Group, req.Path, requester, req.Reason, req.DurationMinutes, models.AccessRequestPending, time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+// ListRequests returns the user's own requests and those they may decide,
+// newest first. Only pending requests are returned unless all is set.
+func (s *ApprovalService) ListRequests(userEmail, userGroups string, all bool) ([]models.AccessRequest, error) {
+	query := `SELECT ` + accessRequestColumns + ` FROM access_requests`
+	var args []interface{}
+	if !all {
+		query += ` WHERE status = ?`
+		args = append(args, models.AccessRequestPending)
+	}
+	query += ` ORDER BY id DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.AccessRequest
+	for rows.Next() {
+		request, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(request.Requester, userEmail) ||
+			permissions.HasGroupVerb(userGroups, request.Group, permissions.VerbApprove) {
+			requests = append(requests, *request)
+		}
+	}
+
+	return requests, rows.Err()
+}
+
+// Decide approves or denies a pending request. Approved access starts now and
+// lasts for the requested duration.
+func (s *ApprovalService) Decide(id int64, approver, userGroups string, approve bool, note string) (*models.AccessRequest, error) {
+	request, err := scanAccessRequest(s.db.QueryRow(`SELECT `+accessRequestColumns+` FROM access_requests WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAccessRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !permissions.HasGroupVerb(userGroups, request.Group, permissions.VerbApprove) {
+		return nil, ErrNotApprover
+	}
+	if strings.EqualFold(request.Requester, approver) {
+		return nil, ErrSelfApproval
+	}
+
+	now := time.Now().UTC()
+	status := models.AccessRequestDenied
+	var expiresAt *time.Time
+	if approve {
+		status = models.AccessRequestApproved
+		end := now.Add(time.Duration(request.DurationMinutes) * time.Minute)
+		expiresAt = &end
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE access_requests SET status = ?, decided_by = ?, decision_note = ?, decided_at = ?, expires_at = ?
+		WHERE id = ? AND status = ?
+	`, status, approver, strings.TrimSpace(note), now, expiresAt, id, models.AccessRequestPending)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrAccessRequestDecided
+	}
+
+	request.Status = status
+	request.DecidedBy = approver
+	request.DecisionNote = strings.TrimSpace(note)
+	request.DecidedAt = &now
+	request.ExpiresAt = expiresAt
+	return request, nil
+}
+
+// hasApprovedAccess reports whether the user holds an approved access window
+// for a secret that has not ended yet
+func hasApprovedAccess(db *database.DB, groupName, path, userEmail string) (bool, error) {
+	var approved bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM access_requests
+		WHERE group_name = ? AND path = ? AND requester = ? AND status = ? AND expires_at > ?)
+	`, groupName, path, userEmail, models.AccessRequestApproved, time.Now().UTC()).Scan(&approved)
+	return approved, err
+}
+
+const accessRequestColumns = `id, group_name, path, requester, reason, duration_minutes, status,
+	decided_by, decision_note, decided_at, expires_at, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccessRequest(row rowScanner) (*models.AccessRequest, error) {
+	var request models.AccessRequest
+	var decidedAt, expiresAt sql.NullTime
+	err := row.Scan(&request.ID, &request.Group, &request.Path, &request.Requester, &request.Reason,
+		&request.DurationMinutes, &request.Status, &request.DecidedBy, &request.DecisionNote,
+		&decidedAt, &expiresAt, &request.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if decidedAt.Valid {
+		request.DecidedAt = &decidedAt.Time
+	}
+	if expiresAt.Valid {
+		request.ExpiresAt = &expiresAt.Time
+		if request.Status == models.AccessRequestApproved && time.Now().After(expiresAt.Time) {
+			request.Status = models.AccessRequestExpired
+		}
+	}
+	return &request, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestApprovals(t *testing.T) {
+	db := newTestDB(t)
+
+	approvals := &ApprovalService{db: db}
+	passwords := &PasswordService{db: db}
+
+	const (
+		dev, devGroups   = "dev@example.com", "team1:ro"
+		lead, leadGroups = "lead@example.com", "team1:owner"
+	)
+	if err := passwords.CreatePassword("prod/db", "secret", "team1", lead, leadGroups); err != nil {
+		t.Fatalf("CreatePassword() error = %v", err)
+	}
+
+	request := models.AccessRequestCreate{Group: "team1", Path: "prod/db", Reason: "incident 42"}
+	if _, err := approvals.CreateRequest(request, dev, devGroups); !errors.Is(err, ErrApprovalNotRequired) {
+		t.Errorf("CreateRequest(approval not required) error = %v, want ErrApprovalNotRequired", err)
+	}
+
+	// Grants stay in place, but grantees need an approval too
+	const guest = "guest@example.com"
+	if _, err := (&UserService{db: db}).CreateUser(guest, "user", "", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := (&GrantService{db: db}).CreateGrant("team1", models.GrantRequest{Path: "prod/db", Grantee: guest}, lead, leadGroups); err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+
+	if err := approvals.SetRequired("team1", "prod/db", true); err != nil {
+		t.Fatalf("SetRequired() error = %v", err)
+	}
+	if _, err := passwords.GetPassword("prod/db", "team1", dev, devGroups); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("GetPassword(without approval) error = %v, want ErrApprovalRequired", err)
+	}
+	if _, err := passwords.GetPassword("prod/db", "team1", guest, ""); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("GetPassword(grantee without approval) error = %v, want ErrApprovalRequired", err)
+	}
+	if err := approvals.SetRequired("team1", "prod/absent", true); !errors.Is(err, ErrPasswordNotFound) {
+		t.Errorf("SetRequired(missing secret) error = %v, want ErrPasswordNotFound", err)
+	}
+
+	// The rotator of a secret would be handed its value without an approval
+	if err := passwords.CreatePassword("prod/rotated", "secret", "team1", lead, leadGroups); err != nil {
+		t.Fatalf("CreatePassword() error = %v", err)
+	}
+	_, err := db.Exec(`
+		INSERT INTO rotations (group_name, path, rotator, config, interval_minutes, created_by)
+		VALUES ('team1', 'prod/rotated', 'command', '{}', 0, ?)
+	`, lead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := approvals.SetRequired("team1", "prod/rotated", true); !errors.Is(err, ErrApprovalRotation) {
+		t.Errorf("SetRequired(rotated secret) error = %v, want ErrApprovalRotation", err)
+	}
+	if err := approvals.SetRequired("team1", "prod/rotated", false); err != nil {
+		t.Errorf("SetRequired(false) of a rotated secret error = %v", err)
+	}
+
+	if _, err := approvals.CreateRequest(models.AccessRequestCreate{Group: "team1", Path: "prod/db"}, dev, devGroups); !errors.Is(err, ErrInvalidAccessRequest) {
+		t.Errorf("CreateRequest(no reason) error = %v, want ErrInvalidAccessRequest", err)
+	}
+	if _, err := approvals.CreateRequest(request, "outsider@example.com", "team2:rw"); err == nil {
+		t.Error("CreateRequest(no read access) error = nil")
+	}
+
+	id, err := approvals.CreateRequest(request, dev, devGroups)
+	if err != nil {
+		t.Fatalf("CreateRequest() error = %v", err)
+	}
+	if _, err := approvals.CreateRequest(request, dev, devGroups); !errors.Is(err, ErrAccessRequestPending) {
+		t.Errorf("CreateRequest(again) error = %v, want ErrAccessRequestPending", err)
+	}
+
+	// Approvers see the request; members without approve only see their own
+	if pending, err := approvals.ListRequests(lead, leadGroups, false); err != nil || len(pending) != 1 {
+		t.Errorf("ListRequests(approver) = %v, %v, want 1 request", pending, err)
+	}
+	if pending, err := approvals.ListRequests("other@example.com", "team1:rw", false); err != nil || len(pending) != 0 {
+		t.Errorf("ListRequests(other member) = %v, %v, want none", pending, err)
+	}
+
+	if _, err := approvals.Decide(id, "other@example.com", "team1:rw", true, ""); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("Decide(without approve) error = %v, want ErrNotApprover", err)
+	}
+	if _, err := approvals.Decide(id, dev, "team1:rw+approve", true, ""); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("Decide(own request) error = %v, want ErrSelfApproval", err)
+	}
+
+	decided, err := approvals.Decide(id, lead, leadGroups, true, "ok")
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if decided.Status != models.AccessRequestApproved || decided.ExpiresAt == nil {
+		t.Errorf("Decide() = %+v, want an approved request with an expiry", decided)
+	}
+	if _, err := approvals.Decide(id, lead, leadGroups, false, ""); !errors.Is(err, ErrAccessRequestDecided) {
+		t.Errorf("Decide(again) error = %v, want ErrAccessRequestDecided", err)
+	}
+
+	if value, err := passwords.GetPassword("prod/db", "team1", dev, devGroups); err != nil || value != "secret" {
+		t.Errorf("GetPassword(approved) = %q, %v", value, err)
+	}
+
+	// Replacing the secret keeps the requirement
+	if err := passwords.CreatePassword("prod/db", "rotated", "team1", lead, leadGroups); err != nil {
+		t.Fatalf("CreatePassword(replace) error = %v", err)
+	}
+	if required, err := approvals.RequiresApproval("team1", "prod/db"); err != nil || !required {
+		t.Errorf("RequiresApproval() after replace = %v, %v, want true", required, err)
+	}
+
+	// A denied request grants nothing
+	other := "other@example.com"
+	id, err = approvals.CreateRequest(request, other, "team1:rw")
+	if err != nil {
+		t.Fatalf("CreateRequest(other) error = %v", err)
+	}
+	if _, err := approvals.Decide(id, lead, leadGroups, false, "not needed"); err != nil {
+		t.Fatalf("Decide(deny) error = %v", err)
+	}
+	if _, err := passwords.GetPassword("prod/db", "team1", other, "team1:rw"); !errors.Is(err, ErrApprovalRequired) {
+		t.Errorf("GetPassword(denied) error = %v, want ErrApprovalRequired", err)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"github.com/steve/pman/shared/config"
+)
+
+const AuthSourceLDAP = "ldap"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrExternalPassword   = errors.New("this account's password is managed outside pman")
+	ErrLocalAccount       = errors.New("a local account with this email already exists; ask an administrator to remove it before signing in with the directory")
+
+	errDirectoryUnavailable = errors.New("authentication service unavailable")
+)
+
+// ExternalIdentity is a user whose password was verified by an Authenticator
+type ExternalIdentity struct {
+	Email string
+	// Groups is the pman groups string mapped from the external groups. It
+	// replaces the user's groups on every login when SyncGroups is set.
+	Groups     string
+	SyncGroups bool
+}
+
+// Authenticator verifies passwords against an external identity store.
+// ValidateLogin uses it for every user except the bootstrap admin, who keeps a
+// local password so the server stays manageable when the store is down.
+type Authenticator interface {
+	// Authenticate returns ErrInvalidCredentials for a wrong email or password
+	Authenticate(email, password string) (*ExternalIdentity, error)
+	// AuthSource is recorded on the users this authenticator signs in
+	AuthSource() string
+}
+
+// newAuthenticator returns the configured external authenticator, or nil when
+// passwords are checked against the local hashes only
+func newAuthenticator() Authenticator {
+	ldapConfig := config.GetLDAPConfig()
+	if !ldapConfig.Enabled() {
+		return nil
+	}
+
+	authenticator, err := NewLDAPAuthenticator(ldapConfig)
+	if err != nil {
+		// ValidateLDAPConfig runs at startup, so this is not expected
+		log.Printf("LDAP authentication disabled: %v", err)
+		return nil
+	}
+	return authenticator
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+)
+
+type fakeAuthenticator struct {
+	passwords map[string]string
+	groups    string
+	calls     int
+}
+
+func (a *fakeAuthenticator) AuthSource() string {
+	return AuthSourceLDAP
+}
+
+func (a *fakeAuthenticator) Authenticate(email, password string) (*ExternalIdentity, error) {
+	a.calls++
+	if password == "" || a.passwords[email] != password {
+		return nil, ErrInvalidCredentials
+	}
+	return &ExternalIdentity{Email: email, Groups: a.groups, SyncGroups: true}, nil
+}
+
+func TestValidateLoginWithAuthenticator(t *testing.T) {
+	db := newTestDB(t)
+
+	authenticator := &fakeAuthenticator{
+		passwords: map[string]string{"carol@example.com": "directory-password", "dave@example.com": "directory-password"},
+		groups:    "team1:ro",
+	}
+	s := &UserService{db: db, authenticator: authenticator}
+	if err := s.CreateFirstAdmin("root@example.com", "local-password", "", true); err != nil {
+		t.Fatalf("CreateFirstAdmin() error = %v", err)
+	}
+
+	// The bootstrap admin keeps its local password and never reaches the directory
+	if _, err := s.ValidateLogin("root@example.com", "local-password"); err != nil {
+		t.Errorf("ValidateLogin(bootstrap admin) error = %v", err)
+	}
+	if authenticator.calls != 0 {
+		t.Errorf("bootstrap admin login called the authenticator %d times", authenticator.calls)
+	}
+
+	// Unknown users are provisioned on their first successful login
+	user, err := s.ValidateLogin("carol@example.com", "directory-password")
+	if err != nil {
+		t.Fatalf("ValidateLogin() error = %v", err)
+	}
+	if user.AuthSource != AuthSourceLDAP || user.Role != "user" || user.Groups != "team1:ro" {
+		t.Errorf("provisioned user = %+v", user)
+	}
+
+	// Group changes in the directory are applied at the next login
+	authenticator.groups = "team1:rw,team2:ro"
+	user, err = s.ValidateLogin("carol@example.com", "directory-password")
+	if err != nil {
+		t.Fatalf("ValidateLogin() error = %v", err)
+	}
+	if user.Groups != "team1:rw,team2:ro" {
+		t.Errorf("synced groups = %q", user.Groups)
+	}
+
+	if _, err := s.ValidateLogin("carol@example.com", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("ValidateLogin(wrong password) error = %v, want ErrInvalidCredentials", err)
+	}
+
+	// A local account is not taken over by a directory user with the same email
+	if _, err := s.CreateUser("dave@example.com", "user", "team1:rw", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := s.ValidateLogin("dave@example.com", "directory-password"); err != ErrLocalAccount {
+		t.Errorf("ValidateLogin(local account) error = %v, want ErrLocalAccount", err)
+	}
+	if dave, _ := s.GetUserByEmail("dave@example.com"); dave.AuthSource != AuthSourceLocal {
+		t.Errorf("local account switched to %q", dave.AuthSource)
+	}
+
+	// Directory users change their password in the directory
+	if err := s.ChangePassword("carol@example.com", "new-password", false); err != ErrExternalPassword {
+		t.Errorf("ChangePassword() error = %v, want ErrExternalPassword", err)
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/config"
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/permissions"
+)
+
+const (
+	// settingBootstrapAdmin records the first admin, which keeps its local
+	// password with LDAP and cannot be deleted or disabled
+	settingBootstrapAdmin = "bootstrap_admin"
+	settingSetupTokenHash = "setup_token_hash"
+)
+
+var (
+	ErrAlreadyInitialized = errors.New("pman has already been set up")
+	ErrInvalidSetupToken  = errors.New("invalid setup token")
+)
+
+// HasUsers reports whether the first admin has been created
+func (s *UserService) HasUsers() (bool, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateFirstAdmin creates the admin of an empty database and fails with
+// ErrAlreadyInitialized once any user exists. A temporary password must be
+// changed at the first login and is not checked against the password policy.
+func (s *UserService) CreateFirstAdmin(email, password, groups string, temporary bool) error {
+	if !strings.Contains(email, "@") {
+		return fmt.Errorf("invalid email: %s", email)
+	}
+	if _, err := permissions.ParseGroups(groups); err != nil {
+		return fmt.Errorf("invalid groups format: %w", err)
+	}
+
+	if !temporary {
+		policy, err := s.GetPasswordPolicy()
+		if err != nil {
+			return err
+		}
+		if err := checkPasswordPolicy(policy, email, password); err != nil {
+			return err
+		}
+	}
+
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		INSERT INTO users (email, password_hash, role, enabled, must_change_password)
+		SELECT ?, ?, 'admin', true, ?
+		WHERE NOT EXISTS (SELECT 1 FROM users)
+		RETURNING id
+	`, email, hashedPassword, temporary).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrAlreadyInitialized
+	}
+	if err != nil {
+		return err
+	}
+
+	// The first admin's groups are created along with it
+	for _, name := range permissions.GetUserGroups(groups) {
+		if _, err := tx.Exec("INSERT INTO groups (name) VALUES (?) ON CONFLICT(name) DO NOTHING", name); err != nil {
+			return err
+		}
+	}
+	if err := setUserGroups(tx, userID, groups); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := setSetting(s.db, settingBootstrapAdmin, email); err != nil {
+		return err
+	}
+	_, err = s.db.Exec("DELETE FROM settings WHERE key = ?", settingSetupTokenHash)
+	return err
+}
+
+// Bootstrap runs at startup. While there are no users it creates the admin
+// configured in the environment, or prints a setup token for 'pman setup'.
+func (s *UserService) Bootstrap(cfg *config.BootstrapConfig) error {
+	hasUsers, err := s.HasUsers()
+	if err != nil || hasUsers {
+		return err
+	}
+
+	if cfg.AdminEmail != "" {
+		password, err := s.CreateConfiguredAdmin(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to create admin %s: %w", cfg.AdminEmail, err)
+		}
+
+		if password != "" {
+			log.Printf("Created admin user %s with password %s (must be changed at the first login)", cfg.AdminEmail, password)
+		} else {
+			log.Printf("Created admin user %s with the password in PMAN_ADMIN_PASSWORD (must be changed at the first login)", cfg.AdminEmail)
+		}
+		return nil
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		return err
+	}
+	if err := setSetting(s.db, settingSetupTokenHash, auth.HashToken(token)); err != nil {
+		return err
+	}
+
+	log.Printf("No users yet. Create the first admin with: pman setup -s <server URL> --token %s", token)
+	log.Printf("The setup token is replaced at each start until an admin exists; 'pman-server init' works too")
+	return nil
+}
+
+// CreateConfiguredAdmin creates the first admin described by cfg, with a
+// temporary password. It returns the password when it had to be generated.
+func (s *UserService) CreateConfiguredAdmin(cfg *config.BootstrapConfig) (string, error) {
+	password, generated := cfg.AdminPassword, ""
+	if password == "" {
+		password = generateRandomPassword()
+		generated = password
+	}
+
+	if err := s.CreateFirstAdmin(cfg.AdminEmail, password, cfg.AdminGroups, true); err != nil {
+		return "", err
+	}
+	return generated, nil
+}
+
+// CompleteSetup creates the first admin with the token printed by Bootstrap
+func (s *UserService) CompleteSetup(token, email, password, groups string) error {
+	hash, err := getSetting(s.db, settingSetupTokenHash, "")
+	if err != nil {
+		return err
+	}
+	if hash == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(auth.HashToken(token))) != 1 {
+		if hasUsers, err := s.HasUsers(); err == nil && hasUsers {
+			return ErrAlreadyInitialized
+		}
+		return ErrInvalidSetupToken
+	}
+
+	return s.CreateFirstAdmin(email, password, groups, false)
+}
+
+// isBootstrapAdmin reports whether email is the first admin. Databases set up
+// before it was recorded have the fixed default admin.
+func (s *UserService) isBootstrapAdmin(email string) (bool, error) {
+	admin, err := getSetting(s.db, settingBootstrapAdmin, DefaultAdminEmail)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(admin, email), nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/config"
+)
+
+func TestBootstrapFromEnvironment(t *testing.T) {
+	db := newTestDB(t)
+
+	s := &UserService{db: db}
+	cfg := &config.BootstrapConfig{AdminEmail: "root@example.com", AdminGroups: "ops:rw"}
+	if err := s.Bootstrap(cfg); err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+
+	user, err := s.GetUserByEmail("root@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error = %v", err)
+	}
+	if user.Role != "admin" || user.Groups != "ops:rw" || !user.MustChangePassword {
+		t.Errorf("bootstrap admin = %+v", user)
+	}
+	if _, err := s.GetUserByEmail(DefaultAdminEmail); err == nil {
+		t.Error("the fixed default admin was created")
+	}
+
+	// Later starts leave the users alone
+	if err := s.Bootstrap(&config.BootstrapConfig{AdminEmail: "other@example.com"}); err != nil {
+		t.Fatalf("second Bootstrap() error = %v", err)
+	}
+	if _, err := s.GetUserByEmail("other@example.com"); err == nil {
+		t.Error("second Bootstrap() created another admin")
+	}
+
+	if err := s.DeleteUser("root@example.com", "admin@example.com"); err == nil {
+		t.Error("DeleteUser(bootstrap admin) error = nil")
+	}
+}
+
+func TestCompleteSetup(t *testing.T) {
+	db := newTestDB(t)
+
+	s := &UserService{db: db}
+	if err := s.CompleteSetup("anything", "root@example.com", "Correct-Horse-42", ""); err != ErrInvalidSetupToken {
+		t.Errorf("CompleteSetup() without a token error = %v, want ErrInvalidSetupToken", err)
+	}
+
+	if err := setSetting(db, settingSetupTokenHash, auth.HashToken("setup-token")); err != nil {
+		t.Fatalf("setSetting() error = %v", err)
+	}
+	if err := s.CompleteSetup("wrong-token", "root@example.com", "Correct-Horse-42", ""); err != ErrInvalidSetupToken {
+		t.Errorf("CompleteSetup(wrong token) error = %v, want ErrInvalidSetupToken", err)
+	}
+	if err := s.CompleteSetup("setup-token", "root@example.com", "password", ""); !errors.Is(err, ErrPasswordPolicy) {
+		t.Errorf("CompleteSetup(weak password) error = %v, want ErrPasswordPolicy", err)
+	}
+	if err := s.CompleteSetup("setup-token", "root@example.com", "Correct-Horse-42", "team1:rw"); err != nil {
+		t.Fatalf("CompleteSetup() error = %v", err)
+	}
+
+	user, err := s.ValidateLogin("root@example.com", "Correct-Horse-42")
+	if err != nil {
+		t.Fatalf("ValidateLogin() error = %v", err)
+	}
+	if user.Role != "admin" || user.MustChangePassword {
+		t.Errorf("setup admin = %+v", user)
+	}
+
+	// The token only works once
+	if err := s.CompleteSetup("setup-token", "eve@example.com", "Correct-Horse-42", ""); err != ErrAlreadyInitialized {
+		t.Errorf("second CompleteSetup() error = %v, want ErrAlreadyInitialized", err)
+	}
+}
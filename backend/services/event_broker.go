@@ -0,0 +1,69 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/steve/pman/shared/models"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind before it
+// is dropped
+const eventBufferSize = 64
+
+// EventBroker passes events to the clients streaming them from GET /events.
+// Subscribers too slow to keep up have their channel closed, so they
+// reconnect rather than silently miss changes.
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan models.Event]struct{}
+}
+
+// serverEvents is shared by the password services of the server, so changes
+// made outside requests, such as scheduled rotations, are streamed as well
+var serverEvents = NewEventBroker()
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan models.Event]struct{})}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// and a function that ends the subscription
+func (b *EventBroker) Subscribe() (<-chan models.Event, func()) {
+	ch := make(chan models.Event, eventBufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() { b.unsubscribe(ch) }
+}
+
+func (b *EventBroker) unsubscribe(ch chan models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends event to every subscriber without waiting for any of them.
+// A nil broker does nothing.
+func (b *EventBroker) Publish(event models.Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
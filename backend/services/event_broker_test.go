@@ -0,0 +1,43 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestEventBroker(t *testing.T) {
+	broker := NewEventBroker()
+	first, unsubscribeFirst := broker.Subscribe()
+	slow, _ := broker.Subscribe()
+
+	event := models.Event{Type: models.EventPasswordUpdated, Group: "team1", Path: "prod/db"}
+	broker.Publish(event)
+	if got := <-first; !reflect.DeepEqual(got, event) {
+		t.Errorf("received %+v, want %+v", got, event)
+	}
+
+	// Subscribers that fall too far behind are dropped, closing their channel
+	for i := 0; i < eventBufferSize; i++ {
+		broker.Publish(event)
+		<-first
+	}
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != eventBufferSize {
+		t.Errorf("slow subscriber received %d events before being dropped, want %d", received, eventBufferSize)
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	if _, ok := <-first; ok {
+		t.Error("channel still open after unsubscribing")
+	}
+	broker.Publish(event)
+
+	var nilBroker *EventBroker
+	nilBroker.Publish(event)
+}
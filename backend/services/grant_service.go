@@ -0,0 +1,239 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+var (
+	ErrGrantNotFound  = errors.New("grant not found")
+	ErrInvalidGrant   = errors.New("invalid grant")
+	ErrNotGroupWriter = errors.New("write permission on the group is required")
+)
+
+// Limits of temporary grants
+const (
+	DefaultGrantMinutes = 24 * 60
+	MaxGrantMinutes     = 7 * 24 * 60
+)
+
+// GrantService manages temporary grants: access to a single secret for a user
+// the group permission does not cover, until the grant expires. PasswordService
+// checks them when the group permission or path ACLs refuse an operation.
+type GrantService struct {
+	db *database.DB
+}
+
+func NewGrantService(db *database.DB) *GrantService {
+	return &GrantService{db: db}
+}
+
+// CreateGrant gives req.Grantee access to a secret, or replaces their grant
+// for it. Grantors must be group writers holding the granted verbs on the path
+// themselves; grants of their own do not count.
+func (s *GrantService) CreateGrant(groupName string, req models.GrantRequest, grantor, grantorGroups string) (*models.Grant, error) {
+	if req.Permission == "" {
+		req.Permission = permissions.PermissionReadOnly
+	}
+	permission, err := permissions.NormalizePathPermission(req.Permission)
+	if err != nil || permission == permissions.PermissionNone {
+		return nil, fmt.Errorf("%w: permission must be 'ro', 'rw' or verbs joined with '+' from list, read, write and delete", ErrInvalidGrant)
+	}
+	verbs, _ := permissions.ParsePermission(permission)
+
+	// Paths are matched without surrounding slashes, as in path ACLs
+	req.Path = strings.Trim(strings.TrimSpace(req.Path), "/")
+	if req.Path == "" {
+		return nil, fmt.Errorf("%w: path is required", ErrInvalidGrant)
+	}
+
+	if req.ExpiresMinutes == 0 {
+		req.ExpiresMinutes = DefaultGrantMinutes
+	}
+	if req.ExpiresMinutes < 0 || req.ExpiresMinutes > MaxGrantMinutes {
+		return nil, fmt.Errorf("%w: grants can last at most %d days", ErrInvalidGrant, MaxGrantMinutes/(24*60))
+	}
+
+	if !permissions.HasGroupVerb(grantorGroups, groupName, permissions.VerbWrite) {
+		return nil, ErrNotGroupWriter
+	}
+	if !permissions.HasGroupVerb(grantorGroups, groupName, verbs) {
+		return nil, fmt.Errorf("insufficient permissions to grant %s in group '%s'", permission, groupName)
+	}
+	rules, err := pathRules(s.db, groupName)
+	if err != nil {
+		return nil, err
+	}
+	if !permissions.PathAllows(rules, grantor, req.Path, verbs) {
+		return nil, fmt.Errorf("insufficient permissions to grant %s on '%s' in group '%s'", permission, req.Path, groupName)
+	}
+
+	var exists bool
+	err = s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM passwords WHERE path = ? AND group_name = ?)
+	`, req.Path, groupName).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrPasswordNotFound
+	}
+
+	grantee := strings.TrimSpace(req.Grantee)
+	err = s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email = ?)", grantee).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	now := time.Now().UTC()
+	if _, err := s.db.Exec(`DELETE FROM grants WHERE expires_at <= ?`, now); err != nil {
+		return nil, err
+	}
+
+	grant := models.Grant{
+		Group:      groupName,
+		Path:       req.Path,
+		Grantee:    grantee,
+		Permission: permission,
+		ExpiresAt:  now.Add(time.Duration(req.ExpiresMinutes) * time.Minute),
+		CreatedBy:  grantor,
+		CreatedAt:  now,
+	}
+	err = s.db.QueryRow(`
+		INSERT INTO grants (group_name, path, grantee, permission, expires_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(group_name, path, grantee) DO UPDATE SET
+			permission = excluded.permission, expires_at = excluded.expires_at,
+			created_by = excluded.created_by, created_at = excluded.created_at
+		RETURNING id
+	`, grant.Group, grant.Path, grant.Grantee, grant.Permission, grant.ExpiresAt, grant.CreatedBy, grant.CreatedAt).Scan(&grant.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grant, nil
+}
+
+// ListGrants returns the group's grants that have not expired
+func (s *GrantService) ListGrants(groupName string) ([]models.Grant, error) {
+	rows, err := s.db.Query(`
+		SELECT id, group_name, path, grantee, permission, expires_at, created_by, created_at
+		FROM grants WHERE group_name = ? AND expires_at > ? ORDER BY path, grantee
+	`, groupName, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []models.Grant
+	for rows.Next() {
+		var grant models.Grant
+		err := rows.Scan(&grant.ID, &grant.Group, &grant.Path, &grant.Grantee, &grant.Permission,
+			&grant.ExpiresAt, &grant.CreatedBy, &grant.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+func (s *GrantService) RevokeGrant(groupName string, id int) error {
+	result, err := s.db.Exec("DELETE FROM grants WHERE id = ? AND group_name = ?", id, groupName)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGrantNotFound
+	}
+
+	return nil
+}
+
+// grantedVerbs returns the verbs the user's grant for a secret allows, or
+// none without a grant that is still valid
+func grantedVerbs(db *database.DB, groupName, path, userEmail string) (permissions.Verb, error) {
+	var permission string
+	err := db.QueryRow(`
+		SELECT permission FROM grants
+		WHERE group_name = ? AND path = ? AND grantee = ? AND expires_at > ?
+	`, groupName, path, userEmail, time.Now().UTC()).Scan(&permission)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	verbs, _ := permissions.ParsePermission(permission)
+	return verbs, nil
+}
+
+// readingGrantees returns the users whose valid grants let them read the
+// secret at path, or every secret under it when prefix is set, by path
+func readingGrantees(db *database.DB, groupName, path string, prefix bool) (map[string][]string, error) {
+	condition, arg := "path = ?", path
+	if prefix {
+		condition, arg = "path LIKE ?", path+"%"
+	}
+
+	rows, err := db.Query(`
+		SELECT path, grantee, permission FROM grants
+		WHERE group_name = ? AND `+condition+` AND expires_at > ?
+	`, groupName, arg, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grantees := make(map[string][]string)
+	for rows.Next() {
+		var path, grantee, permission string
+		if err := rows.Scan(&path, &grantee, &permission); err != nil {
+			return nil, err
+		}
+		if verbs, _ := permissions.ParsePermission(permission); verbs.Has(permissions.VerbRead) {
+			grantees[path] = append(grantees[path], grantee)
+		}
+	}
+
+	return grantees, rows.Err()
+}
+
+// grantedPaths returns the secrets of a group the user holds valid grants
+// for, with the verbs each grant allows
+func grantedPaths(db *database.DB, groupName, userEmail string) (map[string]permissions.Verb, error) {
+	rows, err := db.Query(`
+		SELECT path, permission FROM grants
+		WHERE group_name = ? AND grantee = ? AND expires_at > ?
+	`, groupName, userEmail, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]permissions.Verb)
+	for rows.Next() {
+		var path, permission string
+		if err := rows.Scan(&path, &permission); err != nil {
+			return nil, err
+		}
+		verbs, _ := permissions.ParsePermission(permission)
+		paths[path] = verbs
+	}
+
+	return paths, rows.Err()
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestGrants(t *testing.T) {
+	db := newTestDB(t)
+
+	grants := &GrantService{db: db}
+	passwords := &PasswordService{db: db}
+	if _, err := (&UserService{db: db}).CreateUser("guest@example.com", "user", "", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	const (
+		lead, leadGroups = "lead@example.com", "team1:rw"
+		guest, noGroups  = "guest@example.com", ""
+	)
+	for _, path := range []string{"prod/db", "prod/dbx"} {
+		if err := passwords.CreatePassword(path, "secret", "team1", lead, leadGroups); err != nil {
+			t.Fatalf("CreatePassword(%s) error = %v", path, err)
+		}
+	}
+
+	if _, err := passwords.GetPassword("prod/db", "team1", guest, noGroups); err == nil {
+		t.Fatal("GetPassword(before grant) error = nil")
+	}
+
+	req := models.GrantRequest{Path: "prod/db", Grantee: guest}
+	if _, err := grants.CreateGrant("team1", req, "reader@example.com", "team1:ro"); !errors.Is(err, ErrNotGroupWriter) {
+		t.Errorf("CreateGrant(reader) error = %v, want ErrNotGroupWriter", err)
+	}
+	if _, err := grants.CreateGrant("team1", models.GrantRequest{Path: "prod/db", Grantee: guest, Permission: "owner"}, lead, leadGroups); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("CreateGrant(owner) error = %v, want ErrInvalidGrant", err)
+	}
+	if _, err := grants.CreateGrant("team1", models.GrantRequest{Path: "prod/db", Grantee: "nobody@example.com"}, lead, leadGroups); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("CreateGrant(unknown user) error = %v, want ErrUserNotFound", err)
+	}
+
+	if _, err := grants.CreateGrant("team1", models.GrantRequest{Path: "/", Grantee: guest}, lead, leadGroups); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("CreateGrant(no path) error = %v, want ErrInvalidGrant", err)
+	}
+
+	grant, err := grants.CreateGrant("team1", models.GrantRequest{Path: "/prod/db/", Grantee: guest}, lead, leadGroups)
+	if err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+	if grant.Permission != "ro" || grant.Path != "prod/db" {
+		t.Errorf("CreateGrant() = %+v, want ro on prod/db", grant)
+	}
+
+	// A read-only grant covers reading and listing that secret only
+	if value, err := passwords.GetPassword("prod/db", "team1", guest, noGroups); err != nil || value != "secret" {
+		t.Errorf("GetPassword(granted) = %q, %v", value, err)
+	}
+	if err := passwords.UpdatePassword("prod/db", "new", "team1", guest, noGroups); err == nil {
+		t.Error("UpdatePassword(read-only grant) error = nil")
+	}
+	if _, err := passwords.GetPassword("prod/dbx", "team1", guest, noGroups); err == nil {
+		t.Error("GetPassword(other secret) error = nil")
+	}
+	if paths, err := passwords.ListPasswords("team1", "", guest, noGroups); err != nil || !reflect.DeepEqual(paths, []string{"prod/db"}) {
+		t.Errorf("ListPasswords(granted) = %v, %v, want [prod/db]", paths, err)
+	}
+
+	// Grants never allow recursive deletes, which would reach other secrets
+	if _, err := grants.CreateGrant("team1", models.GrantRequest{Path: "prod/db", Grantee: guest, Permission: "rw"}, lead, leadGroups); err != nil {
+		t.Fatalf("CreateGrant(rw) error = %v", err)
+	}
+	if _, err := passwords.DeletePasswordRecursive("prod/db", "team1", guest, noGroups); err == nil {
+		t.Error("DeletePasswordRecursive(granted) error = nil")
+	}
+
+	if list, err := grants.ListGrants("team1"); err != nil || len(list) != 1 || list[0].Permission != "rw" {
+		t.Errorf("ListGrants() = %+v, %v, want one rw grant", list, err)
+	}
+
+	// Expired grants stop applying
+	if _, err := db.Exec(`UPDATE grants SET expires_at = ?`, time.Now().UTC().Add(-time.Minute)); err != nil {
+		t.Fatalf("expiring grant: %v", err)
+	}
+	if _, err := passwords.GetPassword("prod/db", "team1", guest, noGroups); err == nil {
+		t.Error("GetPassword(expired grant) error = nil")
+	}
+	if list, err := grants.ListGrants("team1"); err != nil || len(list) != 0 {
+		t.Errorf("ListGrants(expired) = %+v, %v, want none", list, err)
+	}
+
+	if err := grants.RevokeGrant("team1", grant.ID); err != nil {
+		t.Errorf("RevokeGrant() error = %v", err)
+	}
+	if err := grants.RevokeGrant("team1", grant.ID); !errors.Is(err, ErrGrantNotFound) {
+		t.Errorf("RevokeGrant(again) error = %v, want ErrGrantNotFound", err)
+	}
+
+	// A grant does not outlive its secret, so it cannot apply to a new one at
+	// the same path, but its holder still sees the secret being deleted
+	if _, err := grants.CreateGrant("team1", req, lead, leadGroups); err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+	passwords.events = NewEventBroker()
+	events, unsubscribe := passwords.Subscribe()
+	defer unsubscribe()
+	if err := passwords.DeletePassword("prod/db", "team1", lead, leadGroups); err != nil {
+		t.Fatalf("DeletePassword() error = %v", err)
+	}
+	if event := <-events; !passwords.CanReadEvent(event, guest, noGroups) {
+		t.Errorf("CanReadEvent(%+v) by the grantee = false", event)
+	}
+	if passwords.CanRead("prod/db", "team1", guest, noGroups) {
+		t.Error("CanRead(grant of deleted secret) = true")
+	}
+	if err := passwords.CreatePassword("prod/db", "recreated", "team1", lead, leadGroups); err != nil {
+		t.Fatalf("CreatePassword() error = %v", err)
+	}
+	if _, err := passwords.GetPassword("prod/db", "team1", guest, noGroups); err == nil {
+		t.Error("GetPassword(grant of deleted secret) error = nil")
+	}
+}
@@ -0,0 +1,535 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+var (
+	ErrGroupNotFound = errors.New("group not found")
+	ErrGroupExists   = errors.New("group already exists")
+	ErrGroupInUse    = errors.New("group is still in use")
+	ErrUnknownGroup  = errors.New("unknown group")
+
+	ErrUserNotFound   = errors.New("user not found")
+	ErrNotGroupMember = errors.New("user is not a member of the group")
+
+	ErrServiceAccountOwner = errors.New("service accounts cannot be group owners or have the admin verb")
+	ErrOwnerChange         = errors.New("only admins can make, change or remove group owners")
+)
+
+// Group names appear in URLs and in "group:permission" lists
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+type GroupService struct {
+	db *database.DB
+}
+
+func NewGroupService(db *database.DB) *GroupService {
+	return &GroupService{db: db}
+}
+
+// ListGroups returns every group with its members and number of secrets
+func (s *GroupService) ListGroups() ([]models.Group, error) {
+	rows, err := s.db.Query(`
+		SELECT name, description, cache_max_age_hours FROM groups ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var group models.Group
+		var description sql.NullString
+		if err := rows.Scan(&group.Name, &description, &group.CacheMaxAgeHours); err != nil {
+			return nil, err
+		}
+		group.Description = description.String
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := s.groupMembers()
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := s.secretCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range groups {
+		groups[i].Members = members[groups[i].Name]
+		groups[i].Secrets = secrets[groups[i].Name]
+	}
+
+	return groups, nil
+}
+
+func (s *GroupService) GetGroup(name string) (*models.Group, error) {
+	group := &models.Group{}
+	var description sql.NullString
+	err := s.db.QueryRow(`
+		SELECT name, description, cache_max_age_hours FROM groups WHERE name = ?
+	`, name).Scan(&group.Name, &description, &group.CacheMaxAgeHours)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	group.Description = description.String
+
+	members, err := s.groupMembers()
+	if err != nil {
+		return nil, err
+	}
+	group.Members = members[name]
+
+	err = s.db.QueryRow("SELECT COUNT(*) FROM passwords WHERE group_name = ?", name).Scan(&group.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func (s *GroupService) CreateGroup(name, description string) error {
+	if !groupNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid group name %q: use up to 64 letters, digits, '.', '_' and '-'", name)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO groups (name, description) VALUES (?, ?)
+		ON CONFLICT(name) DO NOTHING
+	`, name, description)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupExists
+	}
+
+	return nil
+}
+
+func (s *GroupService) UpdateGroup(name, description string) error {
+	result, err := s.db.Exec("UPDATE groups SET description = ? WHERE name = ?", description, name)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// DeleteGroup removes a group no user or service account is assigned to and
+// that holds no secrets, along with its path ACLs and grants, so none of them
+// apply to a group created later with the same name
+func (s *GroupService) DeleteGroup(name string) error {
+	group, err := s.GetGroup(name)
+	if err != nil {
+		return err
+	}
+
+	users := 0
+	for _, member := range group.Members {
+		if member.Type == models.GroupMemberUser {
+			users++
+		}
+	}
+	accounts, err := s.serviceAccountsNaming(name)
+	if err != nil {
+		return err
+	}
+	if users > 0 || accounts > 0 || group.Secrets > 0 {
+		return fmt.Errorf("%w: %d member(s), %d service account(s) and %d secret(s)", ErrGroupInUse, users, accounts, group.Secrets)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM grants WHERE group_name = ?",
+		"DELETE FROM path_acls WHERE group_name = ?",
+		"DELETE FROM groups WHERE name = ?",
+	} {
+		if _, err := tx.Exec(query, name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// serviceAccountsNaming counts the service accounts whose groups name a
+// group, including lists that no longer parse, whose entries would apply
+// again once fixed
+func (s *GroupService) serviceAccountsNaming(groupName string) (int, error) {
+	rows, err := s.db.Query("SELECT groups FROM service_accounts")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var groupsStr string
+		if err := rows.Scan(&groupsStr); err != nil {
+			return 0, err
+		}
+		for _, entry := range strings.Split(groupsStr, ",") {
+			name, _, _ := strings.Cut(entry, ":")
+			if strings.TrimSpace(name) == groupName {
+				count++
+				break
+			}
+		}
+	}
+
+	return count, rows.Err()
+}
+
+// GetCacheMaxAge returns how many hours clients may keep a group's secrets in
+// their offline cache. Groups without a policy do not allow offline caching.
+func (s *GroupService) GetCacheMaxAge(groupName string) (int, error) {
+	var hours int
+	err := s.db.QueryRow(`
+		SELECT cache_max_age_hours FROM groups WHERE name = ?
+	`, groupName).Scan(&hours)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return hours, nil
+}
+
+func (s *GroupService) SetCacheMaxAge(groupName string, hours int) error {
+	if hours < 0 {
+		return fmt.Errorf("cache max age cannot be negative")
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE groups SET cache_max_age_hours = ? WHERE name = ?
+	`, hours, groupName)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// CheckOwnerChange refuses the member changes that need an admin rather than
+// a group owner: giving the admin verb, and changing or removing a member who
+// has it. permission is "" when the member is removed.
+func (s *GroupService) CheckOwnerChange(groupName, email, permission string) error {
+	if permission != "" {
+		verbs, err := permissions.ParsePermission(permission)
+		if err != nil {
+			return err
+		}
+		if verbs.Has(permissions.VerbAdmin) {
+			return ErrOwnerChange
+		}
+	}
+
+	var current string
+	err := s.db.QueryRow(`
+		SELECT m.permission FROM group_members m JOIN users u ON u.id = m.user_id
+		WHERE m.group_name = ? AND u.email = ?
+	`, groupName, email).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if verbs, err := permissions.ParsePermission(current); err == nil && verbs.Has(permissions.VerbAdmin) {
+		return ErrOwnerChange
+	}
+	return nil
+}
+
+// SetMember adds a user to a group, or changes the permission of a member,
+// leaving the user's other groups alone
+func (s *GroupService) SetMember(groupName, email, permission string) error {
+	verbs, err := permissions.ParsePermission(permission)
+	if err != nil {
+		return err
+	}
+	if exists, err := groupExists(s.db, groupName); err != nil {
+		return err
+	} else if !exists {
+		return ErrGroupNotFound
+	}
+
+	var userID int64
+	err = s.db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO group_members (user_id, group_name, permission) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, group_name) DO UPDATE SET permission = excluded.permission
+	`, userID, groupName, permissions.FormatPermission(verbs))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", userID)
+	return err
+}
+
+func (s *GroupService) RemoveMember(groupName, email string) error {
+	var userID int64
+	err := s.db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec("DELETE FROM group_members WHERE user_id = ? AND group_name = ?", userID, groupName)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if exists, err := groupExists(s.db, groupName); err != nil {
+			return err
+		} else if !exists {
+			return ErrGroupNotFound
+		}
+		return ErrNotGroupMember
+	}
+
+	_, err = s.db.Exec("UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", userID)
+	return err
+}
+
+// groupMembers lists the members of every group: users from group_members and
+// service accounts by inverting their groups lists
+func (s *GroupService) groupMembers() (map[string][]models.GroupMember, error) {
+	members := make(map[string][]models.GroupMember)
+
+	rows, err := s.db.Query(`
+		SELECT m.group_name, u.email, m.permission
+		FROM group_members m JOIN users u ON u.id = m.user_id
+		ORDER BY u.email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		member := models.GroupMember{Type: models.GroupMemberUser}
+		var groupName string
+		if err := rows.Scan(&groupName, &member.Name, &member.Permission); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		members[groupName] = append(members[groupName], member)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query("SELECT name, groups FROM service_accounts ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, groupsStr string
+		if err := rows.Scan(&name, &groupsStr); err != nil {
+			return nil, err
+		}
+
+		groups, err := permissions.ParseGroups(groupsStr)
+		if err != nil {
+			continue
+		}
+		for _, group := range groups {
+			members[group.GroupName] = append(members[group.GroupName], models.GroupMember{
+				Name:       name,
+				Type:       models.GroupMemberServiceAccount,
+				Permission: group.Permission,
+			})
+		}
+	}
+
+	return members, rows.Err()
+}
+
+func (s *GroupService) secretCounts() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT group_name, COUNT(*) FROM passwords GROUP BY group_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		counts[name] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// checkGroupsExist refuses a groups list naming groups that were never created
+func checkGroupsExist(db *database.DB, groupsStr string) error {
+	groups, err := permissions.ParseGroups(groupsStr)
+	if err != nil {
+		return fmt.Errorf("invalid groups format: %w", err)
+	}
+
+	var unknown []string
+	for _, group := range groups {
+		exists, err := groupExists(db, group.GroupName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			unknown = append(unknown, group.GroupName)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: %s (create it with 'pman groupadd')", ErrUnknownGroup, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// registerGroups creates the groups of a list that comes from outside pman's
+// control (bootstrap configuration, directory or identity provider mapping)
+func registerGroups(db *database.DB, groupsStr string) error {
+	groups, err := permissions.ParseGroups(groupsStr)
+	if err != nil {
+		return fmt.Errorf("invalid groups format: %w", err)
+	}
+
+	for _, group := range groups {
+		_, err := db.Exec("INSERT INTO groups (name) VALUES (?) ON CONFLICT(name) DO NOTHING", group.GroupName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func groupExists(db *database.DB, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM groups WHERE name = ?)", name).Scan(&exists)
+	return exists, err
+}
+
+// userGroupsColumn selects a user's memberships in the "group:permission"
+// list format of models.User.Groups
+const userGroupsColumn = `COALESCE((
+	SELECT group_concat(group_name || ':' || permission, ',' ORDER BY group_name)
+	FROM group_members WHERE user_id = users.id
+), '')`
+
+// setUserGroups replaces the memberships of a user with a groups list. When a
+// group appears twice the first entry wins, as with permissions.HasGroupVerb.
+func setUserGroups(tx *sql.Tx, userID int64, groupsStr string) error {
+	groups, err := permissions.ParseGroups(groupsStr)
+	if err != nil {
+		return fmt.Errorf("invalid groups format: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		_, err := tx.Exec(`
+			INSERT INTO group_members (user_id, group_name, permission) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, group_name) DO NOTHING
+		`, userID, group.GroupName, group.Permission)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeGroups formats a groups list the way userGroupsColumn reads it
+// back, so a synced list can be compared with models.User.Groups
+func normalizeGroups(groupsStr string) string {
+	groups, err := permissions.ParseGroups(groupsStr)
+	if err != nil {
+		return groupsStr
+	}
+
+	seen := make(map[string]bool)
+	var unique []permissions.GroupAccess
+	for _, group := range groups {
+		if !seen[group.GroupName] {
+			seen[group.GroupName] = true
+			unique = append(unique, group)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].GroupName < unique[j].GroupName })
+
+	return permissions.FormatGroups(unique)
+}
+
+// replaceUserGroups is setUserGroups in a transaction of its own
+func replaceUserGroups(db *database.DB, userID int64, groupsStr string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setUserGroups(tx, userID, groupsStr); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/models"
+)
+
+func TestGroupService(t *testing.T) {
+	db := newTestDB(t)
+
+	groups := &GroupService{db: db}
+	users := &UserService{db: db}
+
+	if err := groups.CreateGroup("team:1", ""); err == nil {
+		t.Error("CreateGroup(invalid name) error = nil")
+	}
+	if err := groups.CreateGroup("ops", "Operations"); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	if err := groups.CreateGroup("ops", ""); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("CreateGroup(existing) error = %v, want ErrGroupExists", err)
+	}
+
+	// Users can only be given groups that exist
+	if _, err := users.CreateUser("dave@example.com", "user", "ops:rw,dev:ro", "admin@example.com"); !errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("CreateUser(unknown group) error = %v, want ErrUnknownGroup", err)
+	}
+	if _, err := users.CreateUser("dave@example.com", "user", "ops:rw", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := users.CreateUser("erin@example.com", "user", "ops:ro", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	group, err := groups.GetGroup("ops")
+	if err != nil {
+		t.Fatalf("GetGroup() error = %v", err)
+	}
+	want := []models.GroupMember{
+		{Name: "dave@example.com", Type: models.GroupMemberUser, Permission: "rw"},
+		{Name: "erin@example.com", Type: models.GroupMemberUser, Permission: "ro"},
+	}
+	if group.Description != "Operations" || len(group.Members) != len(want) {
+		t.Fatalf("GetGroup() = %+v", group)
+	}
+	for i := range want {
+		if group.Members[i] != want[i] {
+			t.Errorf("GetGroup() member %d = %+v, want %+v", i, group.Members[i], want[i])
+		}
+	}
+
+	if err := groups.DeleteGroup("ops"); !errors.Is(err, ErrGroupInUse) {
+		t.Errorf("DeleteGroup(in use) error = %v, want ErrGroupInUse", err)
+	}
+	if err := users.UpdateUser("dave@example.com", "user", "", "admin@example.com"); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if err := users.UpdateUser("erin@example.com", "user", "", "admin@example.com"); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+
+	// Service accounts keep a group in use, even with a list that no longer parses
+	accounts := &ServiceAccountService{db: db}
+	if _, err := accounts.CreateServiceAccount(models.ServiceAccountRequest{Name: "deploy", Groups: "ops:ro"}, "admin@example.com"); err != nil {
+		t.Fatalf("CreateServiceAccount() error = %v", err)
+	}
+	if err := groups.DeleteGroup("ops"); !errors.Is(err, ErrGroupInUse) {
+		t.Errorf("DeleteGroup(service account) error = %v, want ErrGroupInUse", err)
+	}
+	if _, err := db.Exec("UPDATE service_accounts SET groups = 'ops:superuser' WHERE name = 'deploy'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.DeleteGroup("ops"); !errors.Is(err, ErrGroupInUse) {
+		t.Errorf("DeleteGroup(service account with invalid groups) error = %v, want ErrGroupInUse", err)
+	}
+	if err := accounts.DeleteServiceAccount("deploy"); err != nil {
+		t.Fatalf("DeleteServiceAccount() error = %v", err)
+	}
+
+	// Path ACLs and grants go with the group
+	_, err = db.Exec(`
+		INSERT INTO path_acls (group_name, path_prefix, subject, permission, created_by) VALUES ('ops', 'db', '*', 'ro', 'admin@example.com');
+		INSERT INTO grants (group_name, path, grantee, permission, expires_at, created_by) VALUES ('ops', 'db', 'erin@example.com', 'ro', '2999-01-01', 'admin@example.com');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.DeleteGroup("ops"); err != nil {
+		t.Errorf("DeleteGroup() error = %v", err)
+	}
+	var left int
+	if err := db.QueryRow("SELECT (SELECT COUNT(*) FROM path_acls) + (SELECT COUNT(*) FROM grants)").Scan(&left); err != nil || left != 0 {
+		t.Errorf("path ACLs and grants left after DeleteGroup() = %d, %v", left, err)
+	}
+	if _, err := groups.GetGroup("ops"); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("GetGroup(deleted) error = %v, want ErrGroupNotFound", err)
+	}
+	if err := groups.SetCacheMaxAge("ops", 24); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("SetCacheMaxAge(deleted) error = %v, want ErrGroupNotFound", err)
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	db := newTestDB(t)
+
+	groups := &GroupService{db: db}
+	users := &UserService{db: db}
+	userGroups := func() string {
+		t.Helper()
+		user, err := users.GetUserByEmail("dave@example.com")
+		if err != nil {
+			t.Fatalf("GetUserByEmail() error = %v", err)
+		}
+		return user.Groups
+	}
+
+	for _, name := range []string{"ops", "dev"} {
+		if err := groups.CreateGroup(name, ""); err != nil {
+			t.Fatalf("CreateGroup() error = %v", err)
+		}
+	}
+	if _, err := users.CreateUser("dave@example.com", "user", "ops:ro", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	if err := groups.SetMember("dev", "dave@example.com", "rw"); err != nil {
+		t.Fatalf("SetMember() error = %v", err)
+	}
+	if got := userGroups(); got != "dev:rw,ops:ro" {
+		t.Errorf("groups after SetMember() = %q, want %q", got, "dev:rw,ops:ro")
+	}
+	if err := groups.SetMember("ops", "dave@example.com", "rw"); err != nil {
+		t.Fatalf("SetMember() error = %v", err)
+	}
+	if err := groups.RemoveMember("dev", "dave@example.com"); err != nil {
+		t.Fatalf("RemoveMember() error = %v", err)
+	}
+	if got := userGroups(); got != "ops:rw" {
+		t.Errorf("groups after RemoveMember() = %q, want %q", got, "ops:rw")
+	}
+
+	if err := groups.RemoveMember("dev", "dave@example.com"); !errors.Is(err, ErrNotGroupMember) {
+		t.Errorf("RemoveMember(not a member) error = %v, want ErrNotGroupMember", err)
+	}
+	if err := groups.SetMember("qa", "dave@example.com", "ro"); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("SetMember(unknown group) error = %v, want ErrGroupNotFound", err)
+	}
+	if err := groups.SetMember("ops", "nobody@example.com", "ro"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("SetMember(unknown user) error = %v, want ErrUserNotFound", err)
+	}
+	if err := groups.SetMember("ops", "dave@example.com", "superuser"); err == nil {
+		t.Error("SetMember(invalid permission) error = nil")
+	}
+
+	// Memberships go with the user
+	if err := users.DeleteUser("dave@example.com", "admin@example.com"); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if err := groups.DeleteGroup("ops"); err != nil {
+		t.Errorf("DeleteGroup() after deleting its member error = %v", err)
+	}
+}
+
+func TestMigrateUserGroups(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "pman.db")
+	t.Setenv("PMAN_DB_PATH", dbPath)
+	t.Setenv("PMAN_LDAP_URL", "")
+
+	// The users table of older versions, with groups as a list
+	old, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	_, err = old.Exec(`
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			email TEXT UNIQUE NOT NULL,
+			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'user',
+			groups TEXT NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT true,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO users (email, password_hash, groups) VALUES
+			('dave@example.com', 'x', 'team2:ro, team1:rw,team2:rw'),
+			('erin@example.com', 'x', 'team1:superuser');
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("creating old schema: %v", err)
+	}
+
+	db, err := database.Initialize()
+	if err != nil {
+		t.Fatalf("database.Initialize() error = %v", err)
+	}
+	defer db.Close()
+
+	users := &UserService{db: db}
+	for email, want := range map[string]string{
+		"dave@example.com": "team1:rw,team2:ro",
+		"erin@example.com": "",
+	} {
+		user, err := users.GetUserByEmail(email)
+		if err != nil {
+			t.Fatalf("GetUserByEmail(%s) error = %v", email, err)
+		}
+		if user.Groups != want {
+			t.Errorf("%s groups = %q, want %q", email, user.Groups, want)
+		}
+	}
+
+	if _, err := (&GroupService{db: db}).GetGroup("team2"); err != nil {
+		t.Errorf("GetGroup(migrated group) error = %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/steve/pman/backend/database"
+)
+
+// newTestDB returns a new database in a temporary directory, closed when the
+// test ends
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	t.Setenv("PMAN_DB_PATH", filepath.Join(t.TempDir(), "pman.db"))
+	t.Setenv("PMAN_LDAP_URL", "")
+	t.Setenv("PMAN_ENCRYPTION_KEY", "testkey-testkey-testkey-testkey1")
+
+	db, err := database.Initialize()
+	if err != nil {
+		t.Fatalf("database.Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
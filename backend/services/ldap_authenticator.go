@@ -0,0 +1,184 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/steve/pman/shared/config"
+	"github.com/steve/pman/shared/permissions"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// LDAPAuthenticator looks the user up with the service account, then binds as
+// the user's entry with the given password
+type LDAPAuthenticator struct {
+	config    *config.LDAPConfig
+	tlsConfig *tls.Config
+	// groupMap is keyed by lower-cased group name, as LDAP names are case-insensitive
+	groupMap map[string]string
+}
+
+func NewLDAPAuthenticator(ldapConfig *config.LDAPConfig) (*LDAPAuthenticator, error) {
+	u, err := url.Parse(ldapConfig.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: ldapConfig.InsecureSkipVerify,
+	}
+	if ldapConfig.CACert != "" {
+		caCert, err := os.ReadFile(ldapConfig.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no valid certificates found in %s", ldapConfig.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	mapping, err := permissions.ParseGroupMapping(ldapConfig.GroupMap)
+	if err != nil {
+		return nil, err
+	}
+	groupMap := make(map[string]string)
+	for name, groups := range mapping {
+		groupMap[strings.ToLower(name)] = groups
+	}
+
+	return &LDAPAuthenticator{config: ldapConfig, tlsConfig: tlsConfig, groupMap: groupMap}, nil
+}
+
+func (a *LDAPAuthenticator) AuthSource() string {
+	return AuthSourceLDAP
+}
+
+func (a *LDAPAuthenticator) Authenticate(email, password string) (*ExternalIdentity, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if email == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		log.Printf("LDAP connection failed: %v", err)
+		return nil, errDirectoryUnavailable
+	}
+	defer conn.Close()
+
+	if a.config.BindDN != "" {
+		if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			log.Printf("LDAP service account bind failed: %v", err)
+			return nil, errDirectoryUnavailable
+		}
+	}
+
+	attributes := []string{a.config.GroupAttribute}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(email)), attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		log.Printf("LDAP user search failed: %v", err)
+		return nil, errDirectoryUnavailable
+	}
+	// No entry, or an ambiguous filter matching several
+	if result == nil || len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	groupNames := groupNamesFromDNs(entry.GetEqualFoldAttributeValues(a.config.GroupAttribute))
+	if a.config.GroupFilter != "" {
+		names, err := a.searchGroups(conn, entry.DN)
+		if err != nil {
+			log.Printf("LDAP group search failed: %v", err)
+			return nil, errDirectoryUnavailable
+		}
+		groupNames = append(groupNames, names...)
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		log.Printf("LDAP user bind failed: %v", err)
+		return nil, errDirectoryUnavailable
+	}
+
+	return &ExternalIdentity{
+		Email:      email,
+		Groups:     permissions.MapExternalGroups(a.groupMap, groupNames),
+		SyncGroups: len(a.groupMap) > 0,
+	}, nil
+}
+
+func (a *LDAPAuthenticator) connect() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(a.tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.config.StartTLS {
+		if err := conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// searchGroups finds the groups listing the user as a member, for directories
+// that do not maintain memberOf
+func (a *LDAPAuthenticator) searchGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	baseDN := a.config.GroupBaseDN
+	if baseDN == "" {
+		baseDN = a.config.BaseDN
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(a.config.GroupFilter, ldap.EscapeFilter(userDN)), []string{"cn"}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range result.Entries {
+		if cn := entry.GetEqualFoldAttributeValue("cn"); cn != "" {
+			names = append(names, strings.ToLower(cn))
+		}
+	}
+	return names, nil
+}
+
+// groupNamesFromDNs reduces group DNs such as "cn=pman-team1,ou=groups,dc=example,dc=com"
+// to their lower-cased first RDN value ("pman-team1"), the name used in the group map
+func groupNamesFromDNs(dns []string) []string {
+	var names []string
+	for _, dn := range dns {
+		parsed, err := ldap.ParseDN(dn)
+		if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+			continue
+		}
+		names = append(names, strings.ToLower(parsed.RDNs[0].Attributes[0].Value))
+	}
+	return names
+}
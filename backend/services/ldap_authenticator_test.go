@@ -0,0 +1,296 @@
+package services
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/steve/pman/shared/config"
+)
+
+const (
+	testBaseDN          = "dc=example,dc=com"
+	testServiceDN       = "cn=pman,ou=services,dc=example,dc=com"
+	testServicePassword = "service-secret"
+)
+
+type testEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+// testDirectory is an in-process LDAP stand-in that answers simple binds and
+// searches with equality filters, enough to exercise LDAPAuthenticator
+type testDirectory struct {
+	listener net.Listener
+	entries  map[string]testEntry
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &testDirectory{
+		listener: listener,
+		entries: map[string]testEntry{
+			"uid=alice,ou=people,dc=example,dc=com": {
+				password: "alice-password",
+				attributes: map[string][]string{
+					"mail":     {"alice@example.com"},
+					"memberOf": {"cn=PMAN-Team1,ou=groups,dc=example,dc=com", "cn=everyone,ou=groups,dc=example,dc=com"},
+				},
+			},
+			"uid=bob,ou=people,dc=example,dc=com": {
+				password:   "bob-password",
+				attributes: map[string][]string{"mail": {"bob@example.com"}},
+			},
+			"cn=auditors,ou=groups,dc=example,dc=com": {
+				attributes: map[string][]string{
+					"cn":     {"auditors"},
+					"member": {"uid=bob,ou=people,dc=example,dc=com"},
+				},
+			},
+		},
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return d
+}
+
+func (d *testDirectory) config() *config.LDAPConfig {
+	return &config.LDAPConfig{
+		URL:            "ldap://" + d.listener.Addr().String(),
+		BindDN:         testServiceDN,
+		BindPassword:   testServicePassword,
+		BaseDN:         testBaseDN,
+		UserFilter:     "(mail=%s)",
+		GroupAttribute: "memberOf",
+		GroupMap:       "pman-team1=team1:rw;auditors=team1:ro,team2:ro",
+	}
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+
+			result := uint16(ldap.LDAPResultInvalidCredentials)
+			if dn == testServiceDN && password == testServicePassword {
+				result = ldap.LDAPResultSuccess
+			} else if entry, ok := d.entries[dn]; ok && entry.password != "" && entry.password == password {
+				result = ldap.LDAPResultSuccess
+			}
+			bound = result == ldap.LDAPResultSuccess
+			d.write(conn, messageID, ldap.ApplicationBindResponse, result)
+
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				d.write(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+
+			baseDN := strings.ToLower(op.Children[0].Data.String())
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				d.write(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)
+				continue
+			}
+
+			for dn, entry := range d.entries {
+				if strings.HasSuffix(strings.ToLower(dn), baseDN) && matchesFilter(entry, filter) {
+					d.writeEntry(conn, messageID, dn, entry)
+				}
+			}
+			d.write(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+// matchesFilter understands "(attr=value)", presence "(attr=*)" and "(&(a=b)(c=d))"
+func matchesFilter(entry testEntry, filter string) bool {
+	filter = strings.TrimSuffix(strings.TrimPrefix(filter, "("), ")")
+	if strings.HasPrefix(filter, "&") {
+		for _, part := range strings.Split(strings.Trim(filter[1:], "()"), ")(") {
+			if !matchesFilter(entry, "("+part+")") {
+				return false
+			}
+		}
+		return true
+	}
+
+	attribute, value, ok := strings.Cut(filter, "=")
+	if !ok {
+		return false
+	}
+	for name, values := range entry.attributes {
+		if strings.EqualFold(name, attribute) {
+			if value == "*" {
+				return true
+			}
+			for _, v := range values {
+				if strings.EqualFold(v, value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (d *testDirectory) write(conn net.Conn, messageID int64, tag ber.Tag, resultCode uint16) {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "resultCode"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	d.send(conn, messageID, response)
+}
+
+func (d *testDirectory) writeEntry(conn net.Conn, messageID int64, dn string, entry testEntry) {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "objectName"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	response.AppendChild(attributes)
+
+	d.send(conn, messageID, response)
+}
+
+func (d *testDirectory) send(conn net.Conn, messageID int64, op *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	envelope.AppendChild(op)
+	conn.Write(envelope.Bytes())
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	authenticator, err := NewLDAPAuthenticator(directory.config())
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator() error = %v", err)
+	}
+
+	identity, err := authenticator.Authenticate("alice@example.com", "alice-password")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if identity.Email != "alice@example.com" || identity.Groups != "team1:rw" || !identity.SyncGroups {
+		t.Errorf("Authenticate() = %+v", identity)
+	}
+
+	rejected := []struct{ email, password string }{
+		{"alice@example.com", "wrong"},
+		{"alice@example.com", ""},
+		{"nobody@example.com", "alice-password"},
+		{"*", "alice-password"},
+		{"alice@example.com)(mail=*", "alice-password"},
+	}
+	for _, r := range rejected {
+		if _, err := authenticator.Authenticate(r.email, r.password); err != ErrInvalidCredentials {
+			t.Errorf("Authenticate(%q, %q) error = %v, want ErrInvalidCredentials", r.email, r.password, err)
+		}
+	}
+}
+
+func TestLDAPAuthenticateGroupSearch(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	// Directories without memberOf are searched for groups naming the user
+	cfg := directory.config()
+	cfg.GroupFilter = "(member=%s)"
+
+	authenticator, err := NewLDAPAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator() error = %v", err)
+	}
+
+	identity, err := authenticator.Authenticate("bob@example.com", "bob-password")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if identity.Groups != "team1:ro,team2:ro" {
+		t.Errorf("Authenticate() groups = %q, want %q", identity.Groups, "team1:ro,team2:ro")
+	}
+}
+
+func TestLDAPAuthenticateWithoutGroupMap(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	cfg := directory.config()
+	cfg.GroupMap = ""
+
+	authenticator, err := NewLDAPAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator() error = %v", err)
+	}
+
+	identity, err := authenticator.Authenticate("alice@example.com", "alice-password")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if identity.SyncGroups {
+		t.Error("Authenticate() asked to sync groups without a group map")
+	}
+}
+
+func TestLDAPAuthenticateUnavailable(t *testing.T) {
+	directory := newTestDirectory(t)
+
+	cfg := directory.config()
+	cfg.BindPassword = "wrong"
+
+	authenticator, err := NewLDAPAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator() error = %v", err)
+	}
+
+	if _, err := authenticator.Authenticate("alice@example.com", "alice-password"); err != errDirectoryUnavailable {
+		t.Errorf("Authenticate() with a bad service account error = %v, want errDirectoryUnavailable", err)
+	}
+
+	directory.listener.Close()
+	if _, err := authenticator.Authenticate("alice@example.com", "alice-password"); err != errDirectoryUnavailable {
+		t.Errorf("Authenticate() with the directory down error = %v, want errDirectoryUnavailable", err)
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/config"
+	"github.com/steve/pman/shared/models"
+)
+
+const (
+	LockoutKindAccount = "account"
+	LockoutKindIP      = "ip"
+
+	// loginFreeFailures are allowed before the backoff starts; each further
+	// failure doubles the wait, up to loginMaxBackoff
+	loginFreeFailures = 3
+	loginMaxBackoff   = time.Minute
+
+	lockoutEventLimit = 50
+)
+
+var ErrNoLockout = errors.New("no failed logins recorded")
+
+// LoginThrottle tells a client how long to wait before its next login attempt
+type LoginThrottle struct {
+	RetryAfter time.Duration
+	// Locked is set for a lockout, as opposed to a backoff delay
+	Locked bool
+}
+
+// LockoutService counts failed password logins per account and per client
+// address, and locks either out once it reaches its threshold
+type LockoutService struct {
+	db     *database.DB
+	config *config.LockoutConfig
+}
+
+type loginKey struct {
+	kind    string
+	subject string
+}
+
+func NewLockoutService(db *database.DB) *LockoutService {
+	return &LockoutService{db: db, config: config.GetLockoutConfig()}
+}
+
+// IsTrustedProxy reports whether forwarding headers from ip may be believed
+func (s *LockoutService) IsTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && s.config.IsTrustedProxy(parsed)
+}
+
+// Check returns a throttle when the account or the client address has to wait
+// before trying again, or nil when the login may go ahead
+func (s *LockoutService) Check(email, ip string) (*LoginThrottle, error) {
+	now := time.Now().UTC()
+
+	var throttle *LoginThrottle
+	for _, key := range loginKeys(email, ip) {
+		var failures int
+		var lastFailureAt time.Time
+		var lockedUntil *time.Time
+		err := s.db.QueryRow(`
+			SELECT failures, last_failure_at, locked_until FROM login_failures
+			WHERE kind = ? AND subject = ?
+		`, key.kind, key.subject).Scan(&failures, &lastFailureAt, &lockedUntil)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var t *LoginThrottle
+		if lockedUntil != nil {
+			if lockedUntil.After(now) {
+				t = &LoginThrottle{RetryAfter: lockedUntil.Sub(now), Locked: true}
+			}
+		} else if wait := lastFailureAt.Add(loginBackoff(failures)).Sub(now); wait > 0 {
+			t = &LoginThrottle{RetryAfter: wait}
+		}
+
+		if t != nil && (throttle == nil || t.Locked && !throttle.Locked || t.Locked == throttle.Locked && t.RetryAfter > throttle.RetryAfter) {
+			throttle = t
+		}
+	}
+
+	return throttle, nil
+}
+
+// RecordFailure counts a failed login against the account and the client
+// address, locking out whichever reaches its threshold
+func (s *LockoutService) RecordFailure(email, ip string) error {
+	now := time.Now().UTC()
+	staleBefore := now.Add(-s.config.Duration)
+
+	// Forget failures that have been quiet for longer than a lockout
+	_, err := s.db.Exec(`
+		DELETE FROM login_failures
+		WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)
+	`, staleBefore, now)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range loginKeys(email, ip) {
+		// The count starts again once an earlier lockout has expired
+		var failures int
+		err := s.db.QueryRow(`
+			INSERT INTO login_failures (kind, subject, failures, last_failure_at) VALUES (?, ?, 1, ?)
+			ON CONFLICT(kind, subject) DO UPDATE SET
+				failures = CASE WHEN locked_until <= ? THEN 1 ELSE failures + 1 END,
+				locked_until = CASE WHEN locked_until <= ? THEN NULL ELSE locked_until END,
+				last_failure_at = excluded.last_failure_at
+			RETURNING failures
+		`, key.kind, key.subject, now, now, now).Scan(&failures)
+		if err != nil {
+			return err
+		}
+
+		threshold := s.config.AccountThreshold
+		if key.kind == LockoutKindIP {
+			threshold = s.config.IPThreshold
+		}
+		if threshold == 0 || failures < threshold {
+			continue
+		}
+
+		lockedUntil := now.Add(s.config.Duration)
+		result, err := s.db.Exec(`
+			UPDATE login_failures SET locked_until = ?
+			WHERE kind = ? AND subject = ? AND locked_until IS NULL
+		`, lockedUntil, key.kind, key.subject)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			continue
+		}
+
+		_, err = s.db.Exec(`
+			INSERT INTO lockout_events (kind, subject, event, failures, client_ip, locked_until)
+			VALUES (?, ?, 'locked', ?, ?, ?)
+		`, key.kind, key.subject, failures, ip, lockedUntil)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Locked out %s %s for %s after %d failed logins (last from %s)",
+			key.kind, key.subject, s.config.Duration, failures, ip)
+	}
+
+	return nil
+}
+
+// ClearAccount forgets the failed logins of an account after a successful
+// login. The client address keeps its count, so that an attacker cannot reset
+// it by logging in to an account of their own between guesses.
+func (s *LockoutService) ClearAccount(email string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM login_failures WHERE kind = ? AND subject = ?
+	`, LockoutKindAccount, normalizeLoginEmail(email))
+	return err
+}
+
+// Unlock lifts the lockout of an account or client address and forgets its failures
+func (s *LockoutService) Unlock(kind, subject, actor string) error {
+	if kind == LockoutKindAccount {
+		subject = normalizeLoginEmail(subject)
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM login_failures WHERE kind = ? AND subject = ?
+	`, kind, subject)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNoLockout
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO lockout_events (kind, subject, event, actor) VALUES (?, ?, 'unlocked', ?)
+	`, kind, subject, actor)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s unlocked %s %s", actor, kind, subject)
+	return nil
+}
+
+// Status lists the current lockouts and the most recent lockout events
+func (s *LockoutService) Status() (*models.LockoutStatus, error) {
+	status := &models.LockoutStatus{Active: []models.Lockout{}, Events: []models.LockoutEvent{}}
+
+	rows, err := s.db.Query(`
+		SELECT kind, subject, failures, locked_until FROM login_failures
+		WHERE locked_until > ? ORDER BY locked_until
+	`, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var lockout models.Lockout
+		if err := rows.Scan(&lockout.Kind, &lockout.Subject, &lockout.Failures, &lockout.LockedUntil); err != nil {
+			return nil, err
+		}
+		status.Active = append(status.Active, lockout)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`
+		SELECT id, kind, subject, event, failures, client_ip, locked_until, actor, created_at
+		FROM lockout_events ORDER BY id DESC LIMIT ?
+	`, lockoutEventLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.LockoutEvent
+		err := rows.Scan(&event.ID, &event.Kind, &event.Subject, &event.Event, &event.Failures,
+			&event.ClientIP, &event.LockedUntil, &event.Actor, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		status.Events = append(status.Events, event)
+	}
+
+	return status, rows.Err()
+}
+
+// loginBackoff is how long to wait after the given number of consecutive failures
+func loginBackoff(failures int) time.Duration {
+	if failures < loginFreeFailures {
+		return 0
+	}
+
+	backoff := time.Second
+	for i := loginFreeFailures; i < failures && backoff < loginMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > loginMaxBackoff {
+		backoff = loginMaxBackoff
+	}
+	return backoff
+}
+
+func loginKeys(email, ip string) []loginKey {
+	var keys []loginKey
+	if email = normalizeLoginEmail(email); email != "" {
+		keys = append(keys, loginKey{LockoutKindAccount, email})
+	}
+	if ip != "" {
+		keys = append(keys, loginKey{LockoutKindIP, ip})
+	}
+	return keys
+}
+
+// normalizeLoginEmail makes "Alice@Example.com" and "alice@example.com" share a count
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steve/pman/shared/config"
+)
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{8, 32 * time.Second},
+		{9, time.Minute},
+		{100, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := loginBackoff(tt.failures); got != tt.want {
+			t.Errorf("loginBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutService(t *testing.T) {
+	db := newTestDB(t)
+
+	s := &LockoutService{db: db, config: &config.LockoutConfig{
+		AccountThreshold: 5,
+		IPThreshold:      8,
+		Duration:         15 * time.Minute,
+	}}
+
+	check := func(email, ip string) *LoginThrottle {
+		t.Helper()
+		throttle, err := s.Check(email, ip)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		return throttle
+	}
+	fail := func(email, ip string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if err := s.RecordFailure(email, ip); err != nil {
+				t.Fatalf("RecordFailure() error = %v", err)
+			}
+		}
+	}
+
+	// A couple of typos are free
+	fail("alice@example.com", "192.0.2.1", 2)
+	if throttle := check("alice@example.com", "192.0.2.1"); throttle != nil {
+		t.Errorf("Check() after 2 failures = %+v, want nil", throttle)
+	}
+
+	// Then each attempt has to wait, whatever the case of the email
+	fail("Alice@Example.com", "192.0.2.1", 1)
+	throttle := check("alice@example.com", "192.0.2.2")
+	if throttle == nil || throttle.Locked || throttle.RetryAfter > time.Second {
+		t.Errorf("Check() after 3 failures = %+v, want a backoff of up to 1s", throttle)
+	}
+
+	// A successful login clears the account but not the address
+	if err := s.ClearAccount("alice@example.com"); err != nil {
+		t.Fatalf("ClearAccount() error = %v", err)
+	}
+	if throttle := check("alice@example.com", "192.0.2.2"); throttle != nil {
+		t.Errorf("Check() after ClearAccount() = %+v, want nil", throttle)
+	}
+	if throttle := check("bob@example.com", "192.0.2.1"); throttle == nil {
+		t.Error("Check() from the failing address = nil, want a backoff")
+	}
+
+	fail("alice@example.com", "192.0.2.3", 5)
+	throttle = check("alice@example.com", "192.0.2.4")
+	if throttle == nil || !throttle.Locked || throttle.RetryAfter < 14*time.Minute {
+		t.Errorf("Check() at the account threshold = %+v, want a 15m lockout", throttle)
+	}
+
+	// The address that guessed 5 times is backing off but below its threshold
+	if throttle := check("", "192.0.2.3"); throttle == nil || throttle.Locked {
+		t.Errorf("Check() of the address = %+v, want a backoff", throttle)
+	}
+	fail("", "192.0.2.3", 3)
+	if throttle := check("", "192.0.2.3"); throttle == nil || !throttle.Locked {
+		t.Errorf("Check() at the address threshold = %+v, want a lockout", throttle)
+	}
+
+	status, err := s.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status.Active) != 2 || len(status.Events) != 2 {
+		t.Errorf("Status() = %d active, %d events, want 2 and 2", len(status.Active), len(status.Events))
+	}
+
+	if err := s.Unlock(LockoutKindAccount, "ALICE@example.com", DefaultAdminEmail); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if throttle := check("alice@example.com", "192.0.2.4"); throttle != nil {
+		t.Errorf("Check() after Unlock() = %+v, want nil", throttle)
+	}
+	if err := s.Unlock(LockoutKindAccount, "alice@example.com", DefaultAdminEmail); err != ErrNoLockout {
+		t.Errorf("second Unlock() error = %v, want ErrNoLockout", err)
+	}
+
+	status, err = s.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(status.Active) != 1 || status.Events[0].Event != "unlocked" || status.Events[0].Actor != DefaultAdminEmail {
+		t.Errorf("Status() after Unlock() = %+v", status)
+	}
+}
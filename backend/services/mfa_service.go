@@ -0,0 +1,453 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+	"github.com/steve/pman/shared/totp"
+)
+
+const (
+	// MFAIssuer is the issuer shown by authenticator apps
+	MFAIssuer = "pman"
+
+	RecoveryCodeCount = 10
+
+	// Second factors offered in an MFA login challenge
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+
+	settingMFARequireAdmins  = "mfa_require_admins"
+	settingMFARequiredGroups = "mfa_required_groups"
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid authentication code")
+	ErrInvalidMFAChallenge = errors.New("MFA challenge is invalid or has expired, please log in again")
+)
+
+// MFAChallenge is a pending login waiting for its second factor
+type MFAChallenge struct {
+	UserEmail      string
+	ExpireDays     int
+	ClientHostname string
+}
+
+type MFAService struct {
+	db *database.DB
+}
+
+func NewMFAService(db *database.DB) *MFAService {
+	return &MFAService{db: db}
+}
+
+// Enroll generates a new TOTP secret for the user. MFA is not enabled until the
+// user proves their authenticator works by calling Confirm with a valid code.
+func (s *MFAService) Enroll(email string) (*models.MFAEnrollResponse, error) {
+	var enabled bool
+	err := s.db.QueryRow("SELECT mfa_enabled FROM users WHERE email = ?", email).Scan(&enabled)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, fmt.Errorf("MFA is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	encrypted, err := crypto.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE users SET totp_secret = ?, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE email = ?
+	`, encrypted, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFAEnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(MFAIssuer, email, secret),
+	}, nil
+}
+
+// Confirm enables MFA after checking a code from the enrolled secret and
+// returns a fresh set of recovery codes
+func (s *MFAService) Confirm(email, code string) ([]string, error) {
+	var enabled bool
+	var encrypted string
+	err := s.db.QueryRow(`
+		SELECT mfa_enabled, totp_secret FROM users WHERE email = ?
+	`, email).Scan(&enabled, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, fmt.Errorf("MFA is already enabled")
+	}
+	if encrypted == "" {
+		return nil, fmt.Errorf("no MFA enrolment in progress")
+	}
+
+	secret, err := crypto.Decrypt(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE users SET mfa_enabled = true, totp_last_step = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE email = ?
+	`, step, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.RegenerateRecoveryCodes(email)
+}
+
+// Disable turns MFA off and forgets the secret and recovery codes
+func (s *MFAService) Disable(email string) error {
+	_, err := s.db.Exec(`
+		UPDATE users SET mfa_enabled = false, totp_secret = '', totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE email = ?
+	`, email)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM mfa_recovery_codes WHERE user_email = ?", email)
+	return err
+}
+
+// Verify checks a TOTP code or, failing that, an unused recovery code.
+// Accepted TOTP codes cannot be used again and recovery codes are used up.
+func (s *MFAService) Verify(email, code string) error {
+	code = strings.TrimSpace(code)
+
+	var enabled bool
+	var encrypted string
+	var lastStep int64
+	err := s.db.QueryRow(`
+		SELECT mfa_enabled, totp_secret, totp_last_step FROM users WHERE email = ?
+	`, email).Scan(&enabled, &encrypted, &lastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	if !enabled {
+		return ErrInvalidMFACode
+	}
+
+	if _, err := strconv.Atoi(code); err == nil && len(code) == totp.Digits {
+		secret, err := crypto.Decrypt(encrypted)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt secret: %w", err)
+		}
+
+		step, ok := totp.Validate(secret, code, time.Now())
+		if !ok || step <= lastStep {
+			return ErrInvalidMFACode
+		}
+
+		// Only move forward, so two requests racing with the same code cannot both succeed
+		result, err := s.db.Exec(`
+			UPDATE users SET totp_last_step = ? WHERE email = ? AND totp_last_step < ?
+		`, step, email, step)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrInvalidMFACode
+		}
+
+		return nil
+	}
+
+	return s.useRecoveryCode(email, code)
+}
+
+func (s *MFAService) useRecoveryCode(email, code string) error {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, code_hash FROM mfa_recovery_codes WHERE user_email = ? AND used_at IS NULL
+	`, email)
+	if err != nil {
+		return err
+	}
+
+	type storedCode struct {
+		id   int
+		hash string
+	}
+	var codes []storedCode
+	for rows.Next() {
+		var c storedCode
+		if err := rows.Scan(&c.id, &c.hash); err != nil {
+			rows.Close()
+			return err
+		}
+		codes = append(codes, c)
+	}
+	rows.Close()
+
+	for _, c := range codes {
+		if !crypto.CheckPasswordHash(code, c.hash) {
+			continue
+		}
+
+		result, err := s.db.Exec(`
+			UPDATE mfa_recovery_codes SET used_at = ? WHERE id = ? AND used_at IS NULL
+		`, time.Now().UTC(), c.id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrInvalidMFACode
+		}
+
+		return nil
+	}
+
+	return ErrInvalidMFACode
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes. Only hashes are
+// stored, so the returned codes are the only copy.
+func (s *MFAService) RegenerateRecoveryCodes(email string) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		hash, err := crypto.HashPassword(normalizeRecoveryCode(code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash recovery code: %w", err)
+		}
+		codes[i] = code
+		hashes[i] = hash
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_email = ?", email); err != nil {
+		return nil, err
+	}
+
+	for _, hash := range hashes {
+		_, err := tx.Exec(`
+			INSERT INTO mfa_recovery_codes (user_email, code_hash) VALUES (?, ?)
+		`, email, hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *MFAService) Status(user *models.User) (*models.MFAStatus, error) {
+	required, err := s.IsRequired(user)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.MFAStatus{
+		Enabled:  user.MFAEnabled,
+		Required: required,
+	}
+
+	err = s.db.QueryRow(`
+		SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_email = ? AND used_at IS NULL
+	`, user.Email).Scan(&status.RecoveryCodesRemaining)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// CreateChallenge records a login that passed the password check and returns
+// the token that completes it together with a code
+func (s *MFAService) CreateChallenge(email string, expireDays int, clientHostname string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO mfa_challenges (token_hash, user_email, expire_days, client_hostname, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, auth.HashToken(token), email, expireDays, clientHostname, time.Now().Add(mfaChallengeTTL).UTC())
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *MFAService) GetChallenge(token string) (*MFAChallenge, error) {
+	challenge := &MFAChallenge{}
+	err := s.db.QueryRow(`
+		SELECT user_email, expire_days, client_hostname FROM mfa_challenges
+		WHERE token_hash = ? AND expires_at > ? AND attempts < ?
+	`, auth.HashToken(token), time.Now().UTC(), mfaChallengeMaxAttempts).Scan(&challenge.UserEmail, &challenge.ExpireDays, &challenge.ClientHostname)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// FailChallenge counts a wrong code; a challenge stops working after a few
+func (s *MFAService) FailChallenge(token string) error {
+	_, err := s.db.Exec(`
+		UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = ?
+	`, auth.HashToken(token))
+	return err
+}
+
+func (s *MFAService) DeleteChallenge(token string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM mfa_challenges WHERE token_hash = ? OR expires_at <= ?
+	`, auth.HashToken(token), time.Now().UTC())
+	return err
+}
+
+func (s *MFAService) GetPolicy() (*models.MFAPolicy, error) {
+	requireAdmins, err := getSetting(s.db, settingMFARequireAdmins, "false")
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := getSetting(s.db, settingMFARequiredGroups, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFAPolicy{
+		RequireAdmins:  requireAdmins == "true",
+		RequiredGroups: groups,
+	}, nil
+}
+
+func (s *MFAService) SetPolicy(policy *models.MFAPolicy) error {
+	var groups []string
+	for _, group := range strings.Split(policy.RequiredGroups, ",") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		if strings.Contains(group, ":") {
+			return fmt.Errorf("invalid group name %q: list group names without permissions", group)
+		}
+		groups = append(groups, group)
+	}
+	policy.RequiredGroups = strings.Join(groups, ",")
+
+	if err := setSetting(s.db, settingMFARequireAdmins, strconv.FormatBool(policy.RequireAdmins)); err != nil {
+		return err
+	}
+
+	return setSetting(s.db, settingMFARequiredGroups, policy.RequiredGroups)
+}
+
+// IsRequired reports whether the MFA policy applies to the user
+func (s *MFAService) IsRequired(user *models.User) (bool, error) {
+	policy, err := s.GetPolicy()
+	if err != nil {
+		return false, err
+	}
+
+	if policy.RequireAdmins {
+		capabilities, err := roleCapabilities(s.db, user.Role)
+		if err != nil {
+			return false, err
+		}
+		if len(capabilities) > 0 {
+			return true, nil
+		}
+	}
+
+	if policy.RequiredGroups == "" {
+		return false, nil
+	}
+
+	for _, required := range strings.Split(policy.RequiredGroups, ",") {
+		for _, group := range permissions.GetUserGroups(user.Groups) {
+			if group == required {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Recovery codes avoid characters that are easily confused (0/o, 1/l/i)
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func generateRecoveryCode() (string, error) {
+	var code strings.Builder
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			code.WriteByte('-')
+		}
+		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(recoveryCodeAlphabet[num.Int64()])
+	}
+
+	return code.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/config"
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/oidc"
+	"github.com/steve/pman/shared/permissions"
+)
+
+const (
+	AuthSourceLocal = "local"
+	AuthSourceOIDC  = "oidc"
+)
+
+var (
+	ErrSSODisabled     = errors.New("single sign-on is not configured")
+	ErrSSOAccount      = errors.New("this account signs in with single sign-on: use 'pman login --sso'")
+	ErrSSODisabledUser = errors.New("user account is disabled")
+	ErrLocalUser       = errors.New("a local account with this email already exists; ask an administrator to remove it before using single sign-on")
+	ErrUnverifiedEmail = errors.New("the identity provider has not verified this email address")
+)
+
+type OIDCService struct {
+	db     *database.DB
+	users  *UserService
+	config *config.OIDCConfig
+
+	mu        sync.Mutex
+	discovery *oidc.Discovery
+	verifier  *oidc.Verifier
+}
+
+func NewOIDCService(db *database.DB) *OIDCService {
+	return &OIDCService{
+		db:     db,
+		users:  NewUserService(db),
+		config: config.GetOIDCConfig(),
+	}
+}
+
+func (s *OIDCService) Enabled() bool {
+	return s.config.Enabled()
+}
+
+// provider discovers the identity provider on first use, so the server can
+// start while the provider is unreachable; a failed discovery is retried
+func (s *OIDCService) provider() (*oidc.Discovery, *oidc.Verifier, error) {
+	if !s.Enabled() {
+		return nil, nil, ErrSSODisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, s.verifier, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	discovery, err := oidc.Discover(client, s.config.Issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jwksURL := discovery.JWKSURI
+	if s.config.JWKSURL != "" {
+		jwksURL = s.config.JWKSURL
+	}
+
+	s.discovery = discovery
+	s.verifier = &oidc.Verifier{
+		Issuer:      discovery.Issuer,
+		ClientID:    s.config.ClientID,
+		JWKSURL:     jwksURL,
+		EmailClaim:  s.config.EmailClaim,
+		GroupsClaim: s.config.GroupsClaim,
+		HTTPClient:  client,
+	}
+
+	return s.discovery, s.verifier, nil
+}
+
+// ClientConfig returns what the CLI needs to run the login flow against the provider
+func (s *OIDCService) ClientConfig() (*models.OIDCConfig, error) {
+	discovery, _, err := s.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OIDCConfig{
+		Issuer:                      discovery.Issuer,
+		ClientID:                    s.config.ClientID,
+		AuthorizationEndpoint:       discovery.AuthorizationEndpoint,
+		TokenEndpoint:               discovery.TokenEndpoint,
+		DeviceAuthorizationEndpoint: discovery.DeviceAuthorizationEndpoint,
+		Scopes:                      s.config.Scopes,
+	}, nil
+}
+
+// Authenticate verifies an ID token and returns the matching pman user,
+// creating it on first login. The user's groups are replaced with the
+// groups mapped from the token on every login.
+func (s *OIDCService) Authenticate(idToken, nonce string) (*models.User, error) {
+	_, verifier, err := s.provider()
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := verifier.Verify(idToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	groupsStr, err := s.mapGroups(identity.Groups)
+	if err != nil {
+		return nil, err
+	}
+	if err := registerGroups(s.db, groupsStr); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetUserByEmail(identity.Email)
+	if err == sql.ErrNoRows {
+		if err := s.provisionUser(identity.Email, groupsStr); err != nil {
+			return nil, fmt.Errorf("failed to provision user: %w", err)
+		}
+		log.Printf("Provisioned single sign-on user %s with groups %q", identity.Email, groupsStr)
+		return s.users.GetUserByEmail(identity.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing users are found by email, so the provider must vouch for it
+	if !identity.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+	if user.AuthSource != AuthSourceOIDC {
+		return nil, ErrLocalUser
+	}
+	if !user.Enabled {
+		return nil, ErrSSODisabledUser
+	}
+
+	if user.Groups != normalizeGroups(groupsStr) {
+		if err := replaceUserGroups(s.db, int64(user.ID), groupsStr); err != nil {
+			return nil, fmt.Errorf("failed to sync groups: %w", err)
+		}
+		_, err = s.db.Exec("UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sync groups: %w", err)
+		}
+		user.Groups = normalizeGroups(groupsStr)
+	}
+
+	return user, nil
+}
+
+// mapGroups turns the provider's group claim into a pman groups string. With
+// no PMAN_OIDC_GROUP_MAP, claim values already in pman form ("team1:rw") are
+// used as they are and anything else is ignored.
+func (s *OIDCService) mapGroups(external []string) (string, error) {
+	if s.config.GroupMap != "" {
+		mapping, err := permissions.ParseGroupMapping(s.config.GroupMap)
+		if err != nil {
+			return "", err
+		}
+		return permissions.MapExternalGroups(mapping, external), nil
+	}
+
+	mapping := make(map[string]string)
+	for _, value := range external {
+		if groups, err := permissions.ParseGroups(value); err == nil && len(groups) > 0 {
+			mapping[value] = value
+		}
+	}
+	return permissions.MapExternalGroups(mapping, external), nil
+}
+
+// provisionUser creates a user who can only sign in through the provider: the
+// password hash is of a random password nobody is told
+func (s *OIDCService) provisionUser(email, groupsStr string) error {
+	hashedPassword, err := crypto.HashPassword(generateRandomPassword() + generateRandomPassword())
+	if err != nil {
+		return err
+	}
+
+	return provisionUser(s.db, strings.ToLower(email), hashedPassword, groupsStr, AuthSourceOIDC)
+}
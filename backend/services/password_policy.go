@@ -0,0 +1,227 @@
+package services
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+)
+
+const (
+	settingPasswordMinLength  = "password_min_length"
+	settingPasswordMinClasses = "password_min_classes"
+	settingPasswordHistory    = "password_history"
+	settingPasswordMaxAgeDays = "password_max_age_days"
+
+	// maxPasswordHistory bounds the bcrypt comparisons made on each change
+	maxPasswordHistory = 24
+)
+
+var ErrPasswordPolicy = errors.New("password does not meet the password policy")
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = loadCommonPasswords(commonPasswordsFile)
+
+func loadCommonPasswords(file string) map[string]bool {
+	passwords := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(file))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+	return passwords
+}
+
+func (s *UserService) GetPasswordPolicy() (*models.PasswordPolicy, error) {
+	policy := &models.PasswordPolicy{}
+	settings := []struct {
+		key   string
+		def   int
+		value *int
+	}{
+		{settingPasswordMinLength, 12, &policy.MinLength},
+		{settingPasswordMinClasses, 3, &policy.MinClasses},
+		{settingPasswordHistory, 5, &policy.History},
+		{settingPasswordMaxAgeDays, 0, &policy.MaxAgeDays},
+	}
+
+	for _, setting := range settings {
+		value, err := getSetting(s.db, setting.key, strconv.Itoa(setting.def))
+		if err != nil {
+			return nil, err
+		}
+		*setting.value, err = strconv.Atoi(value)
+		if err != nil {
+			*setting.value = setting.def
+		}
+	}
+
+	return policy, nil
+}
+
+func (s *UserService) SetPasswordPolicy(policy *models.PasswordPolicy) error {
+	switch {
+	case policy.MinLength < 8 || policy.MinLength > 128:
+		return fmt.Errorf("minimum length must be between 8 and 128")
+	case policy.MinClasses < 0 || policy.MinClasses > 4:
+		return fmt.Errorf("minimum character classes must be between 0 and 4")
+	case policy.History < 0 || policy.History > maxPasswordHistory:
+		return fmt.Errorf("history must be between 0 and %d", maxPasswordHistory)
+	case policy.MaxAgeDays < 0:
+		return fmt.Errorf("maximum age cannot be negative")
+	}
+
+	settings := map[string]int{
+		settingPasswordMinLength:  policy.MinLength,
+		settingPasswordMinClasses: policy.MinClasses,
+		settingPasswordHistory:    policy.History,
+		settingPasswordMaxAgeDays: policy.MaxAgeDays,
+	}
+	for key, value := range settings {
+		if err := setSetting(s.db, key, strconv.Itoa(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PasswordExpired reports whether the user's pman password is older than the
+// policy's maximum age. Passwords checked elsewhere (LDAP, SSO) never expire here.
+func (s *UserService) PasswordExpired(user *models.User) (bool, error) {
+	if user.AuthSource != AuthSourceLocal {
+		return false, nil
+	}
+
+	policy, err := s.GetPasswordPolicy()
+	if err != nil {
+		return false, err
+	}
+	if policy.MaxAgeDays == 0 {
+		return false, nil
+	}
+
+	var changedAt *time.Time
+	var createdAt time.Time
+	err = s.db.QueryRow(`
+		SELECT password_changed_at, created_at FROM users WHERE email = ?
+	`, user.Email).Scan(&changedAt, &createdAt)
+	if err != nil {
+		return false, err
+	}
+	if changedAt == nil {
+		changedAt = &createdAt
+	}
+
+	return time.Since(*changedAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour, nil
+}
+
+// checkPasswordPolicy returns an ErrPasswordPolicy error explaining what is
+// wrong with the new password
+func checkPasswordPolicy(policy *models.PasswordPolicy, email, password string) error {
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Errorf("%w: it must be at least %d characters long", ErrPasswordPolicy, policy.MinLength)
+	}
+
+	if classes := characterClasses(password); classes < policy.MinClasses {
+		return fmt.Errorf("%w: it must mix at least %d of lower case letters, upper case letters, digits and symbols",
+			ErrPasswordPolicy, policy.MinClasses)
+	}
+
+	lower := strings.ToLower(password)
+	base := strings.TrimFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	if commonPasswords[lower] || commonPasswords[base] {
+		return fmt.Errorf("%w: it is too common", ErrPasswordPolicy)
+	}
+
+	if name, _, _ := strings.Cut(strings.ToLower(email), "@"); len(name) >= 3 && strings.Contains(lower, name) {
+		return fmt.Errorf("%w: it must not contain your email address", ErrPasswordPolicy)
+	}
+
+	return nil
+}
+
+// checkPasswordHistory refuses the current password and the ones kept in the history
+func (s *UserService) checkPasswordHistory(user *models.User, password string, history int) error {
+	if history == 0 {
+		return nil
+	}
+
+	hashes := []string{user.Password}
+	rows, err := s.db.Query(`
+		SELECT password_hash FROM password_history WHERE user_email = ?
+		ORDER BY id DESC LIMIT ?
+	`, user.Email, history-1)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if crypto.CheckPasswordHash(password, hash) {
+			if history == 1 {
+				return fmt.Errorf("%w: it must differ from your current password", ErrPasswordPolicy)
+			}
+			return fmt.Errorf("%w: it must not be one of your last %d passwords", ErrPasswordPolicy, history)
+		}
+	}
+
+	return nil
+}
+
+// rememberPassword keeps the replaced hash for the reuse check
+func (s *UserService) rememberPassword(email, hash string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO password_history (user_email, password_hash) VALUES (?, ?)
+	`, email, hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		DELETE FROM password_history WHERE user_email = ? AND id NOT IN (
+			SELECT id FROM password_history WHERE user_email = ? ORDER BY id DESC LIMIT ?
+		)
+	`, email, email, maxPasswordHistory-1)
+	return err
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	policy := &models.PasswordPolicy{MinLength: 12, MinClasses: 3}
+
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"correct-Horse-battery", true},
+		{"Tr0ub4dor&3xyz", true},
+		{"Short1!", false},
+		{"alllowercaseletters", false},
+		{"DefaultPassword", false},
+		{"Password2024!", false},
+		{"!!Qwertyuiop99", false},
+		{"Carol-Secret-2024", false},
+	}
+
+	for _, tt := range tests {
+		err := checkPasswordPolicy(policy, "carol@example.com", tt.password)
+		if tt.ok && err != nil {
+			t.Errorf("checkPasswordPolicy(%q) error = %v, want nil", tt.password, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrPasswordPolicy) {
+			t.Errorf("checkPasswordPolicy(%q) error = %v, want ErrPasswordPolicy", tt.password, err)
+		}
+	}
+}
+
+func TestChangePasswordHistory(t *testing.T) {
+	db := newTestDB(t)
+
+	s := &UserService{db: db}
+	if err := s.CreateFirstAdmin(DefaultAdminEmail, "initial-password", "", true); err != nil {
+		t.Fatalf("CreateFirstAdmin() error = %v", err)
+	}
+	if err := s.SetPasswordPolicy(&models.PasswordPolicy{MinLength: 8, History: 2}); err != nil {
+		t.Fatalf("SetPasswordPolicy() error = %v", err)
+	}
+
+	if err := s.ChangePassword(DefaultAdminEmail, "first-password", false); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if err := s.ChangePassword(DefaultAdminEmail, "first-password", false); !errors.Is(err, ErrPasswordPolicy) {
+		t.Errorf("ChangePassword(current password) error = %v, want ErrPasswordPolicy", err)
+	}
+	if err := s.ChangePassword(DefaultAdminEmail, "second-password", false); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if err := s.ChangePassword(DefaultAdminEmail, "first-password", false); !errors.Is(err, ErrPasswordPolicy) {
+		t.Errorf("ChangePassword(previous password) error = %v, want ErrPasswordPolicy", err)
+	}
+
+	// Only the last 2 passwords are refused
+	if err := s.ChangePassword(DefaultAdminEmail, "third-password", false); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if err := s.ChangePassword(DefaultAdminEmail, "first-password", false); err != nil {
+		t.Errorf("ChangePassword(older password) error = %v, want nil", err)
+	}
+}
+
+func TestMustChangePassword(t *testing.T) {
+	db := newTestDB(t)
+
+	s := &UserService{db: db}
+	mustChange := func(email string) bool {
+		t.Helper()
+		user, err := s.GetUserByEmail(email)
+		if err != nil {
+			t.Fatalf("GetUserByEmail() error = %v", err)
+		}
+		return user.MustChangePassword
+	}
+
+	if err := s.CreateFirstAdmin(DefaultAdminEmail, "initial-password", "team1:rw", true); err != nil {
+		t.Fatalf("CreateFirstAdmin() error = %v", err)
+	}
+	if !mustChange(DefaultAdminEmail) {
+		t.Error("bootstrap admin MustChangePassword = false, want true")
+	}
+
+	if _, err := s.CreateUser("dave@example.com", "user", "team1:ro", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if !mustChange("dave@example.com") {
+		t.Error("new user MustChangePassword = false, want true")
+	}
+
+	if err := s.ChangePassword("dave@example.com", "Chosen-by-me-42", false); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if mustChange("dave@example.com") {
+		t.Error("MustChangePassword after changing it = true, want false")
+	}
+
+	if err := s.ChangePassword("dave@example.com", "Set-by-admin-42", true); err != nil {
+		t.Fatalf("ChangePassword(temporary) error = %v", err)
+	}
+	if !mustChange("dave@example.com") {
+		t.Error("MustChangePassword after an admin reset = false, want true")
+	}
+}
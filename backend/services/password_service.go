@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/steve/pman/backend/database"
 	"github.com/steve/pman/shared/crypto"
@@ -11,17 +12,54 @@ import (
 	"github.com/steve/pman/shared/permissions"
 )
 
+// maxPasswordVersions is how many earlier values of each password are kept
+const maxPasswordVersions = 10
+
 type PasswordService struct {
 	db *database.DB
+	// webhooks and events are told about every change; nil sends no events
+	webhooks *WebhookService
+	events   *EventBroker
 }
 
 func NewPasswordService(db *database.DB) *PasswordService {
-	return &PasswordService{db: db}
+	return &PasswordService{db: db, webhooks: NewWebhookService(db), events: serverEvents}
+}
+
+// Subscribe streams the changes to secrets of every group; callers filter
+// them with CanRead
+func (s *PasswordService) Subscribe() (<-chan models.Event, func()) {
+	return s.events.Subscribe()
+}
+
+// CanRead reports whether the user may read the secret at path, whether or
+// not it exists
+func (s *PasswordService) CanRead(path, groupName, userEmail, userGroups string) bool {
+	return s.checkAccess(groupName, path, userEmail, userGroups, permissions.VerbRead) == nil
+}
+
+// CanReadEvent reports whether the user may see an event about a secret:
+// whether they may read it, or could through a grant when it was deleted
+func (s *PasswordService) CanReadEvent(event models.Event, userEmail, userGroups string) bool {
+	for _, grantee := range event.Grantees {
+		if grantee == userEmail {
+			return true
+		}
+	}
+	return s.CanRead(event.Path, event.Group, userEmail, userGroups)
 }
 
 func (s *PasswordService) CreatePassword(path, value, groupName, userEmail string, userGroups string) error {
-	if !permissions.HasGroupAccess(userGroups, groupName, true) {
-		return fmt.Errorf("insufficient permissions to write to group '%s'", groupName)
+	if err := s.checkAccess(groupName, path, userEmail, userGroups, permissions.VerbWrite); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM passwords WHERE path = ? AND group_name = ?)
+	`, path, groupName).Scan(&exists)
+	if err != nil {
+		return err
 	}
 
 	encryptedValue, err := crypto.Encrypt(value)
@@ -29,24 +67,58 @@ func (s *PasswordService) CreatePassword(path, value, groupName, userEmail strin
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
 
-	_, err = s.db.Exec(`
-		INSERT OR REPLACE INTO passwords (path, encrypted_value, group_name, created_by, updated_by, updated_at)
-		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`, path, encryptedValue, groupName, userEmail, userEmail)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return err
+	if err := archiveVersion(tx, path, groupName); err != nil {
+		return err
+	}
+
+	// Replacing a secret keeps its approval requirement and makes a new version
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO passwords (path, encrypted_value, group_name, created_by, updated_by, updated_at, requires_approval, version)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, COALESCE(
+			(SELECT requires_approval FROM passwords WHERE path = ? AND group_name = ?), false), COALESCE(
+			(SELECT version FROM passwords WHERE path = ? AND group_name = ?), 0) + 1)
+	`, path, encryptedValue, groupName, userEmail, userEmail, path, groupName, path, groupName)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	eventType := models.EventPasswordCreated
+	if exists {
+		eventType = models.EventPasswordUpdated
+	}
+	s.notify(eventType, groupName, path, userEmail)
+
+	return nil
+}
+
+func (s *PasswordService) GetPassword(path, groupName, userEmail string, userGroups string) (string, error) {
+	return s.GetPasswordVersion(path, groupName, 0, userEmail, userGroups)
 }
 
-func (s *PasswordService) GetPassword(path, groupName string, userGroups string) (string, error) {
-	if !permissions.HasGroupAccess(userGroups, groupName, false) {
-		return "", fmt.Errorf("insufficient permissions to read from group '%s'", groupName)
+// GetPasswordVersion returns an earlier value of a password, or the current
+// one for version 0. Only the latest maxPasswordVersions earlier values are kept.
+func (s *PasswordService) GetPasswordVersion(path, groupName string, version int, userEmail, userGroups string) (string, error) {
+	if err := s.checkAccess(groupName, path, userEmail, userGroups, permissions.VerbRead); err != nil {
+		return "", err
 	}
 
 	var encryptedValue string
+	var requiresApproval bool
+	var currentVersion int
 	err := s.db.QueryRow(`
-		SELECT encrypted_value FROM passwords 
+		SELECT encrypted_value, requires_approval, version FROM passwords 
 		WHERE path = ? AND group_name = ?
-	`, path, groupName).Scan(&encryptedValue)
+	`, path, groupName).Scan(&encryptedValue, &requiresApproval, &currentVersion)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -55,6 +127,29 @@ func (s *PasswordService) GetPassword(path, groupName string, userGroups string)
 		return "", err
 	}
 
+	if requiresApproval {
+		approved, err := hasApprovedAccess(s.db, groupName, path, userEmail)
+		if err != nil {
+			return "", err
+		}
+		if !approved {
+			return "", fmt.Errorf("%w: request access with 'pman request %s --reason ...'", ErrApprovalRequired, path)
+		}
+	}
+
+	if version != 0 && version != currentVersion {
+		err := s.db.QueryRow(`
+			SELECT encrypted_value FROM password_versions
+			WHERE group_name = ? AND path = ? AND version = ?
+		`, groupName, path, version).Scan(&encryptedValue)
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("version %d of the password not found (the current version is %d)", version, currentVersion)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
 	value, err := crypto.Decrypt(encryptedValue)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt password: %w", err)
@@ -63,16 +158,16 @@ func (s *PasswordService) GetPassword(path, groupName string, userGroups string)
 	return value, nil
 }
 
-func (s *PasswordService) GetPasswordInfo(path, groupName string, userGroups string) (*models.PasswordInfo, error) {
-	if !permissions.HasGroupAccess(userGroups, groupName, false) {
-		return nil, fmt.Errorf("insufficient permissions to read from group '%s'", groupName)
+func (s *PasswordService) GetPasswordInfo(path, groupName, userEmail string, userGroups string) (*models.PasswordInfo, error) {
+	if err := s.checkAccess(groupName, path, userEmail, userGroups, permissions.VerbList); err != nil {
+		return nil, err
 	}
 
 	info := &models.PasswordInfo{}
 	err := s.db.QueryRow(`
-		SELECT path, created_by, updated_by, created_at, updated_at
+		SELECT path, created_by, updated_by, created_at, updated_at, requires_approval, version
 		FROM passwords WHERE path = ? AND group_name = ?
-	`, path, groupName).Scan(&info.Path, &info.CreatedBy, &info.UpdatedBy, &info.CreatedAt, &info.UpdatedAt)
+	`, path, groupName).Scan(&info.Path, &info.CreatedBy, &info.UpdatedBy, &info.CreatedAt, &info.UpdatedAt, &info.RequiresApproval, &info.Version)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -85,8 +180,8 @@ func (s *PasswordService) GetPasswordInfo(path, groupName string, userGroups str
 }
 
 func (s *PasswordService) UpdatePassword(path, value, groupName, userEmail string, userGroups string) error {
-	if !permissions.HasGroupAccess(userGroups, groupName, true) {
-		return fmt.Errorf("insufficient permissions to write to group '%s'", groupName)
+	if err := s.checkAccess(groupName, path, userEmail, userGroups, permissions.VerbWrite); err != nil {
+		return err
 	}
 
 	var exists bool
@@ -101,23 +196,88 @@ func (s *PasswordService) UpdatePassword(path, value, groupName, userEmail strin
 		return fmt.Errorf("password not found")
 	}
 
+	_, err = s.storeVersion(path, groupName, value, userEmail)
+	return err
+}
+
+// storeVersion replaces the value of an existing password with a new version,
+// keeping the previous one, and returns the new version number
+func (s *PasswordService) storeVersion(path, groupName, value, updatedBy string) (int, error) {
 	encryptedValue, err := crypto.Encrypt(value)
 	if err != nil {
-		return fmt.Errorf("failed to encrypt password: %w", err)
+		return 0, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	_, err = s.db.Exec(`
+	if err := archiveVersion(tx, path, groupName); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRow(`
 		UPDATE passwords 
-		SET encrypted_value = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE path = ? AND group_name = ?
-	`, encryptedValue, userEmail, path, groupName)
+		SET encrypted_value = ?, updated_by = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE path = ? AND group_name = ? RETURNING version
+	`, encryptedValue, updatedBy, path, groupName).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, ErrPasswordNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
 
+	s.notify(models.EventPasswordUpdated, groupName, path, updatedBy)
+	return version, nil
+}
+
+// archiveVersion keeps the current value of a password in password_versions
+// before it is replaced, dropping the versions beyond maxPasswordVersions
+func archiveVersion(tx *sql.Tx, path, groupName string) error {
+	_, err := tx.Exec(`
+		INSERT OR REPLACE INTO password_versions (group_name, path, version, encrypted_value, updated_by, updated_at)
+		SELECT group_name, path, version, encrypted_value, updated_by, updated_at
+		FROM passwords WHERE path = ? AND group_name = ?
+	`, path, groupName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM password_versions WHERE group_name = ? AND path = ? AND version <= (
+			SELECT version FROM password_versions WHERE group_name = ? AND path = ?
+			ORDER BY version DESC LIMIT 1 OFFSET ?)
+	`, groupName, path, groupName, path, maxPasswordVersions)
 	return err
 }
 
-func (s *PasswordService) DeletePassword(path, groupName string, userGroups string) error {
-	if !permissions.HasGroupAccess(userGroups, groupName, true) {
-		return fmt.Errorf("insufficient permissions to write to group '%s'", groupName)
+// forgetPasswords removes the earlier versions, rotators and grants of deleted
+// passwords: the given path, or every path under it when prefix is set
+func (s *PasswordService) forgetPasswords(path, groupName string, prefix bool) error {
+	condition, arg := "path = ?", path
+	if prefix {
+		condition, arg = "path LIKE ?", path+"%"
+	}
+
+	for _, table := range []string{"password_versions", "rotations", "grants"} {
+		if _, err := s.db.Exec("DELETE FROM "+table+" WHERE group_name = ? AND "+condition, groupName, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PasswordService) DeletePassword(path, groupName, userEmail string, userGroups string) error {
+	if err := s.checkAccess(groupName, path, userEmail, userGroups, permissions.VerbDelete); err != nil {
+		return err
 	}
 
 	result, err := s.db.Exec(`
@@ -136,15 +296,39 @@ func (s *PasswordService) DeletePassword(path, groupName string, userGroups stri
 		return fmt.Errorf("password not found")
 	}
 
+	// The grants go with the password, so their holders are told about it now
+	grantees, err := readingGrantees(s.db, groupName, path, false)
+	if err != nil {
+		return err
+	}
+	if err := s.forgetPasswords(path, groupName, false); err != nil {
+		return err
+	}
+
 	// Clean up empty parent folders
 	s.cleanupEmptyFolders(path, groupName)
 
+	s.notifyDeleted(groupName, path, userEmail, grantees[path])
 	return nil
 }
 
-func (s *PasswordService) ListPasswords(groupName string, pathPrefix string, userGroups string) ([]string, error) {
-	if !permissions.HasGroupAccess(userGroups, groupName, false) {
-		return nil, fmt.Errorf("insufficient permissions to read from group '%s'", groupName)
+// ListPasswords returns the paths of a group, leaving out those that path
+// ACLs hide from the user
+func (s *PasswordService) ListPasswords(groupName string, pathPrefix string, userEmail string, userGroups string) ([]string, error) {
+	canList := permissions.HasGroupVerb(userGroups, groupName, permissions.VerbList)
+
+	// Users with grants see the granted secrets as well
+	granted, err := grantedPaths(s.db, groupName, userEmail)
+	if err != nil {
+		return nil, err
+	}
+	if !canList && len(granted) == 0 {
+		return nil, fmt.Errorf("insufficient permissions to list in group '%s'", groupName)
+	}
+
+	rules, err := pathRules(s.db, groupName)
+	if err != nil {
+		return nil, err
 	}
 
 	query := `SELECT path FROM passwords WHERE group_name = ?`
@@ -169,35 +353,142 @@ func (s *PasswordService) ListPasswords(groupName string, pathPrefix string, use
 		if err := rows.Scan(&path); err != nil {
 			return nil, err
 		}
-		paths = append(paths, path)
+		if (canList && permissions.PathAllows(rules, userEmail, path, permissions.VerbList)) ||
+			granted[path].Has(permissions.VerbList) {
+			paths = append(paths, path)
+		}
 	}
 
 	return paths, nil
 }
 
-func (s *PasswordService) DeletePasswordRecursive(pathPrefix, groupName string, userGroups string) (int, error) {
-	if !permissions.HasGroupAccess(userGroups, groupName, true) {
-		return 0, fmt.Errorf("insufficient permissions to write to group '%s'", groupName)
+// DeletePasswordRecursive deletes every path under pathPrefix, or nothing when
+// a path ACL keeps the user from deleting one of them. Grants are for single
+// secrets, so they never allow it.
+func (s *PasswordService) DeletePasswordRecursive(pathPrefix, groupName, userEmail string, userGroups string) (int, error) {
+	if !permissions.HasGroupVerb(userGroups, groupName, permissions.VerbDelete) {
+		return 0, fmt.Errorf("insufficient permissions to delete in group '%s'", groupName)
+	}
+	if err := s.checkAccess(groupName, pathPrefix, userEmail, userGroups, permissions.VerbDelete); err != nil {
+		return 0, err
 	}
 
-	result, err := s.db.Exec(`
-		DELETE FROM passwords WHERE group_name = ? AND path LIKE ?
+	rules, err := pathRules(s.db, groupName)
+	if err != nil {
+		return 0, err
+	}
+	if len(rules) > 0 {
+		rows, err := s.db.Query(`
+			SELECT path FROM passwords WHERE group_name = ? AND path LIKE ?
+		`, groupName, pathPrefix+"%")
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				return 0, err
+			}
+			if !permissions.PathAllows(rules, userEmail, path, permissions.VerbDelete) {
+				return 0, fmt.Errorf("insufficient permissions to delete '%s' in group '%s'", path, groupName)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		rows.Close()
+	}
+
+	rows, err := s.db.Query(`
+		DELETE FROM passwords WHERE group_name = ? AND path LIKE ? RETURNING path
 	`, groupName, pathPrefix+"%")
 	if err != nil {
 		return 0, err
 	}
+	defer rows.Close()
 
-	rowsAffected, err := result.RowsAffected()
+	var deleted []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return 0, err
+		}
+		deleted = append(deleted, path)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	grantees, err := readingGrantees(s.db, groupName, pathPrefix, true)
 	if err != nil {
 		return 0, err
 	}
+	if err := s.forgetPasswords(pathPrefix, groupName, true); err != nil {
+		return 0, err
+	}
 
 	// Clean up empty parent folders after recursive deletion
-	if rowsAffected > 0 {
+	if len(deleted) > 0 {
 		s.cleanupEmptyFolders(pathPrefix, groupName)
 	}
 
-	return int(rowsAffected), nil
+	for _, path := range deleted {
+		s.notifyDeleted(groupName, path, userEmail, grantees[path])
+	}
+
+	return len(deleted), nil
+}
+
+// notify tells the webhooks and event streams about a change to a secret
+func (s *PasswordService) notify(eventType, groupName, path, actor string) {
+	s.publish(models.Event{Type: eventType, Group: groupName, Path: path, Actor: actor})
+}
+
+// notifyDeleted tells about a deleted secret, naming the grantees who could
+// read it since their grants are gone by the time streams check access
+func (s *PasswordService) notifyDeleted(groupName, path, actor string, grantees []string) {
+	s.publish(models.Event{Type: models.EventPasswordDeleted, Group: groupName, Path: path, Actor: actor, Grantees: grantees})
+}
+
+func (s *PasswordService) publish(event models.Event) {
+	event.Time = time.Now().UTC()
+	s.webhooks.Notify(event)
+	s.events.Publish(event)
+}
+
+func (s *PasswordService) checkAccess(groupName, path, userEmail, userGroups string, verb permissions.Verb) error {
+	return checkAccess(s.db, groupName, path, userEmail, userGroups, verb)
+}
+
+// checkAccess applies the user's group permission and then the group's path
+// ACLs, both of which must allow verb. Failing that, a temporary grant for the
+// secret allows it.
+func checkAccess(db *database.DB, groupName, path, userEmail, userGroups string, verb permissions.Verb) error {
+	action := permissions.FormatPermission(verb)
+	denied := fmt.Errorf("insufficient permissions to %s in group '%s'", action, groupName)
+	if permissions.HasGroupVerb(userGroups, groupName, verb) {
+		rules, err := pathRules(db, groupName)
+		if err != nil {
+			return err
+		}
+		if permissions.PathAllows(rules, userEmail, path, verb) {
+			return nil
+		}
+		denied = fmt.Errorf("insufficient permissions to %s '%s' in group '%s'", action, path, groupName)
+	}
+
+	granted, err := grantedVerbs(db, groupName, path, userEmail)
+	if err != nil {
+		return err
+	}
+	if granted.Has(verb) {
+		return nil
+	}
+
+	return denied
 }
 
 // cleanupEmptyFolders recursively removes empty parent folders after password deletion
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleInUse    = errors.New("role is still assigned to users")
+	ErrBuiltinRole  = errors.New("built-in roles cannot be changed")
+	ErrUnknownRole  = errors.New("unknown role")
+)
+
+// Role names are given to useradd and userupdate and appear in URLs
+var roleNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+type RoleService struct {
+	db *database.DB
+}
+
+func NewRoleService(db *database.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// ListRoles returns every role with the number of users holding it
+func (s *RoleService) ListRoles() ([]models.Role, error) {
+	rows, err := s.db.Query(`
+		SELECT name, description, capabilities, builtin, created_at,
+			(SELECT COUNT(*) FROM users WHERE users.role = roles.name)
+		FROM roles ORDER BY builtin DESC, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		var capabilitiesStr string
+		if err := rows.Scan(&role.Name, &role.Description, &capabilitiesStr, &role.Builtin, &role.CreatedAt, &role.Users); err != nil {
+			return nil, err
+		}
+		role.Capabilities = auth.ParseCapabilities(capabilitiesStr)
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// RoleCapabilities returns the capabilities of a role; unknown roles have none
+func (s *RoleService) RoleCapabilities(role string) ([]string, error) {
+	return roleCapabilities(s.db, role)
+}
+
+// UserCapabilities returns the capabilities of the role a user holds now;
+// unknown users have none
+func (s *RoleService) UserCapabilities(email string) ([]string, error) {
+	var role string
+	err := s.db.QueryRow("SELECT role FROM users WHERE email = ?", strings.ToLower(email)).Scan(&role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return roleCapabilities(s.db, role)
+}
+
+// CanGrant reports whether actorRole has every capability of role, so that
+// nobody hands out, or takes away from others, more than they have themselves
+func (s *RoleService) CanGrant(actorRole, role string) (bool, error) {
+	actor, err := roleCapabilities(s.db, actorRole)
+	if err != nil {
+		return false, err
+	}
+	required, err := roleCapabilities(s.db, role)
+	if err != nil {
+		return false, err
+	}
+	return auth.CoversCapabilities(actor, required), nil
+}
+
+func (s *RoleService) CreateRole(req models.RoleRequest) error {
+	if !roleNamePattern.MatchString(req.Name) {
+		return fmt.Errorf("invalid role name '%s' (letters, digits, '.', '_' and '-', up to 64 characters)", req.Name)
+	}
+	if req.Name == ServiceAccountRole {
+		return fmt.Errorf("role name '%s' is reserved for service accounts", req.Name)
+	}
+	if err := auth.ValidateCapabilities(req.Capabilities); err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO roles (name, description, capabilities) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO NOTHING
+	`, req.Name, req.Description, strings.Join(req.Capabilities, ","))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoleExists
+	}
+
+	return nil
+}
+
+// UpdateRole replaces the description and capabilities of a custom role
+func (s *RoleService) UpdateRole(name string, req models.RoleRequest) error {
+	if err := auth.ValidateCapabilities(req.Capabilities); err != nil {
+		return err
+	}
+	if err := s.checkCustomRole(name); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE roles SET description = ?, capabilities = ? WHERE name = ?
+	`, req.Description, strings.Join(req.Capabilities, ","), name)
+	return err
+}
+
+// DeleteRole deletes a custom role no user holds any more
+func (s *RoleService) DeleteRole(name string) error {
+	if err := s.checkCustomRole(name); err != nil {
+		return err
+	}
+
+	var inUse bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE role = ?)", name).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrRoleInUse
+	}
+
+	_, err := s.db.Exec("DELETE FROM roles WHERE name = ?", name)
+	return err
+}
+
+func (s *RoleService) checkCustomRole(name string) error {
+	var builtin bool
+	err := s.db.QueryRow("SELECT builtin FROM roles WHERE name = ?", name).Scan(&builtin)
+	if err == sql.ErrNoRows {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if builtin {
+		return ErrBuiltinRole
+	}
+	return nil
+}
+
+func roleCapabilities(db *database.DB, role string) ([]string, error) {
+	var capabilitiesStr string
+	err := db.QueryRow("SELECT capabilities FROM roles WHERE name = ?", role).Scan(&capabilitiesStr)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return auth.ParseCapabilities(capabilitiesStr), nil
+}
+
+// checkRoleExists refuses to assign a role that is not defined
+func checkRoleExists(db *database.DB, role string) error {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM roles WHERE name = ?)", role).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s (see 'pman role ls')", ErrUnknownRole, role)
+	}
+	return nil
+}
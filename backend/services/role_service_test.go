@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+func TestRoles(t *testing.T) {
+	db := newTestDB(t)
+
+	roles := &RoleService{db: db}
+	users := &UserService{db: db}
+
+	capabilities, err := roles.RoleCapabilities("auditor")
+	if err != nil || !auth.HasCapability(capabilities, auth.CapabilityUsersRead) || auth.HasCapability(capabilities, auth.CapabilityUsersWrite) {
+		t.Errorf("RoleCapabilities(auditor) = %v, %v", capabilities, err)
+	}
+
+	// Capabilities follow the role the user holds now
+	if _, err := users.CreateUser("erin@example.com", "auditor", "", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if capabilities, err := roles.UserCapabilities("Erin@example.com"); err != nil || !auth.HasCapability(capabilities, auth.CapabilityUsersRead) {
+		t.Errorf("UserCapabilities(auditor) = %v, %v", capabilities, err)
+	}
+	if _, err := db.Exec("UPDATE users SET role = 'user' WHERE email = 'erin@example.com'"); err != nil {
+		t.Fatal(err)
+	}
+	if capabilities, err := roles.UserCapabilities("erin@example.com"); err != nil || len(capabilities) != 0 {
+		t.Errorf("UserCapabilities(after role change) = %v, %v", capabilities, err)
+	}
+	if capabilities, err := roles.UserCapabilities("nobody@example.com"); err != nil || len(capabilities) != 0 {
+		t.Errorf("UserCapabilities(unknown user) = %v, %v", capabilities, err)
+	}
+
+	helpdesk := models.RoleRequest{Name: "helpdesk", Capabilities: []string{auth.CapabilityUsersRead, auth.CapabilityUsersWrite}}
+	if err := roles.CreateRole(helpdesk); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if err := roles.CreateRole(helpdesk); !errors.Is(err, ErrRoleExists) {
+		t.Errorf("CreateRole(again) error = %v, want ErrRoleExists", err)
+	}
+	if err := roles.CreateRole(models.RoleRequest{Name: "bad", Capabilities: []string{"users:delete"}}); err == nil {
+		t.Error("CreateRole(unknown capability) error = nil")
+	}
+	if err := roles.UpdateRole("admin", helpdesk); !errors.Is(err, ErrBuiltinRole) {
+		t.Errorf("UpdateRole(admin) error = %v, want ErrBuiltinRole", err)
+	}
+
+	if _, err := users.CreateUser("dana@example.com", "superuser", "", "admin@example.com"); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("CreateUser(unknown role) error = %v, want ErrUnknownRole", err)
+	}
+	if _, err := users.CreateUser("dana@example.com", "helpdesk", "", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if err := roles.DeleteRole("helpdesk"); !errors.Is(err, ErrRoleInUse) {
+		t.Errorf("DeleteRole(in use) error = %v, want ErrRoleInUse", err)
+	}
+
+	// Nobody may hand out capabilities they lack
+	grants := []struct {
+		actor, role string
+		allowed     bool
+	}{
+		{"admin", "helpdesk", true},
+		{"helpdesk", "user", true},
+		{"helpdesk", "user-manager", false},
+		{"helpdesk", "admin", false},
+		{"read-only-admin", "auditor", true},
+	}
+	for _, tt := range grants {
+		if got, err := roles.CanGrant(tt.actor, tt.role); err != nil || got != tt.allowed {
+			t.Errorf("CanGrant(%s, %s) = %v, %v, want %v", tt.actor, tt.role, got, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+var (
+	ErrInvalidRotation  = errors.New("invalid rotation")
+	ErrRotationNotFound = errors.New("password has no rotator")
+	ErrRotationRunning  = errors.New("the password is already being rotated")
+	ErrRotationFailed   = errors.New("rotation failed")
+	// ErrRotationApproval is returned when binding a rotator to a password
+	// that requires approval, whose value would then leave pman unapproved
+	ErrRotationApproval = errors.New("passwords that require approval cannot be bound to a rotator")
+)
+
+// Statuses of the last run of a rotation
+const (
+	RotationSucceeded = "succeeded"
+	RotationFailed    = "failed"
+)
+
+// Limits on rotations
+const (
+	rotationTimeout = time.Minute
+	// maxRotationRetry caps the wait before a failed scheduled rotation is retried
+	maxRotationRetry = time.Hour
+)
+
+// rotating holds the passwords being rotated, so a password is never
+// rotated twice at once by the scheduler and a user
+var rotating sync.Map
+
+// RotationService rotates passwords bound to a rotator, on demand and on a
+// schedule. A new value is only stored, as a new version of the password,
+// once the rotator has put it in place.
+type RotationService struct {
+	db        *database.DB
+	passwords *PasswordService
+}
+
+func NewRotationService(db *database.DB) *RotationService {
+	return &RotationService{db: db, passwords: NewPasswordService(db)}
+}
+
+// ListRotations returns the rotators bound to passwords of a group, or of
+// every group for ""
+func (s *RotationService) ListRotations(groupName string) ([]models.Rotation, error) {
+	rows, err := s.db.Query(`
+		SELECT id, group_name, path, rotator, config, interval_minutes, next_run_at, last_run_at,
+		       last_status, last_error, created_by, created_at
+		FROM rotations WHERE ? = '' OR group_name = ? ORDER BY group_name, path
+	`, groupName, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rotations []models.Rotation
+	for rows.Next() {
+		rotation, err := scanRotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		rotations = append(rotations, *rotation)
+	}
+
+	return rotations, rows.Err()
+}
+
+// SetRotation binds a password to a rotator, replacing any earlier binding.
+// With an interval the first scheduled rotation is one interval from now.
+// The rotator is handed the current value, so the caller must be able to
+// read as well as write the password.
+func (s *RotationService) SetRotation(groupName, path string, req models.RotationRequest, createdBy, createdByGroups string) (*models.Rotation, error) {
+	rotator, ok := rotators[req.Rotator]
+	if !ok {
+		names := make([]string, 0, len(rotators))
+		for name := range rotators {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: unknown rotator '%s' (must be one of %s)", ErrInvalidRotation, req.Rotator, strings.Join(names, ", "))
+	}
+	if req.IntervalMinutes < 0 {
+		return nil, fmt.Errorf("%w: interval cannot be negative", ErrInvalidRotation)
+	}
+	if req.Config == nil {
+		req.Config = map[string]string{}
+	}
+	if err := rotator.Validate(req.Config); err != nil {
+		return nil, err
+	}
+
+	if err := checkAccess(s.db, groupName, path, createdBy, createdByGroups, permissions.VerbRead|permissions.VerbWrite); err != nil {
+		return nil, err
+	}
+
+	var requiresApproval bool
+	err := s.db.QueryRow(`
+		SELECT requires_approval FROM passwords WHERE path = ? AND group_name = ?
+	`, path, groupName).Scan(&requiresApproval)
+	if err == sql.ErrNoRows {
+		return nil, ErrPasswordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if requiresApproval {
+		return nil, ErrRotationApproval
+	}
+
+	config, err := json.Marshal(req.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var nextRunAt *time.Time
+	if req.IntervalMinutes > 0 {
+		next := now.Add(time.Duration(req.IntervalMinutes) * time.Minute)
+		nextRunAt = &next
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO rotations (group_name, path, rotator, config, interval_minutes, next_run_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(group_name, path) DO UPDATE SET
+			rotator = excluded.rotator, config = excluded.config, interval_minutes = excluded.interval_minutes,
+			next_run_at = excluded.next_run_at, created_by = excluded.created_by, created_at = excluded.created_at
+	`, groupName, path, req.Rotator, string(config), req.IntervalMinutes, nextRunAt, createdBy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getRotation(groupName, path)
+}
+
+// DeleteRotation unbinds a password from its rotator; the password is kept
+func (s *RotationService) DeleteRotation(groupName, path string) error {
+	result, err := s.db.Exec("DELETE FROM rotations WHERE group_name = ? AND path = ?", groupName, path)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRotationNotFound
+	}
+	return nil
+}
+
+// RotatePassword rotates a password for a user, who must be allowed to write it
+func (s *RotationService) RotatePassword(path, groupName, userEmail, userGroups string) (*models.RotationResult, error) {
+	if err := checkAccess(s.db, groupName, path, userEmail, userGroups, permissions.VerbWrite); err != nil {
+		return nil, err
+	}
+	return s.Rotate(groupName, path, userEmail)
+}
+
+// Rotate runs the rotator of a password and stores the new value it returns.
+// If the rotator fails the password keeps its value. The run is recorded on
+// the binding either way. Passwords that require approval are never handed
+// to a rotator.
+func (s *RotationService) Rotate(groupName, path, actor string) (*models.RotationResult, error) {
+	key := groupName + "\x00" + path
+	if _, busy := rotating.LoadOrStore(key, struct{}{}); busy {
+		return nil, ErrRotationRunning
+	}
+	defer rotating.Delete(key)
+
+	rotation, err := s.getRotation(groupName, path)
+	if err != nil {
+		return nil, err
+	}
+	rotator, ok := rotators[rotation.Rotator]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown rotator '%s'", ErrInvalidRotation, rotation.Rotator)
+	}
+
+	var encryptedValue string
+	var requiresApproval bool
+	err = s.db.QueryRow(`
+		SELECT encrypted_value, requires_approval FROM passwords WHERE path = ? AND group_name = ?
+	`, path, groupName).Scan(&encryptedValue, &requiresApproval)
+	if err == sql.ErrNoRows {
+		return nil, ErrPasswordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Bindings made before the password required approval are not run
+	if requiresApproval {
+		s.recordRun(rotation, ErrRotationApproval)
+		return nil, ErrRotationApproval
+	}
+	current, err := crypto.Decrypt(encryptedValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rotationTimeout)
+	defer cancel()
+
+	newValue, err := rotator.Rotate(ctx, RotationTarget{Group: groupName, Path: path, Value: current, Settings: rotation.Config})
+	if err != nil {
+		s.recordRun(rotation, err)
+		return nil, fmt.Errorf("%w: %v", ErrRotationFailed, err)
+	}
+
+	version, err := s.passwords.storeVersion(path, groupName, newValue, actor)
+	if err != nil {
+		// The source already has the new value, so this needs a person
+		log.Printf("rotation of %s:%s succeeded at the source but the new value was not stored: %v", groupName, path, err)
+		err = fmt.Errorf("the new value is in place at the source but could not be stored: %v", err)
+		s.recordRun(rotation, err)
+		return nil, fmt.Errorf("%w: %v", ErrRotationFailed, err)
+	}
+
+	rotatedAt := s.recordRun(rotation, nil)
+	return &models.RotationResult{Version: version, RotatedAt: rotatedAt}, nil
+}
+
+// RunScheduler rotates the passwords whose rotation is due, checking every
+// tick. It never returns.
+func (s *RotationService) RunScheduler(tick time.Duration) {
+	for {
+		s.rotateDue()
+		time.Sleep(tick)
+	}
+}
+
+// rotateDue rotates the passwords whose rotation is due, one at a time
+func (s *RotationService) rotateDue() {
+	rows, err := s.db.Query(`
+		SELECT group_name, path FROM rotations
+		WHERE interval_minutes > 0 AND next_run_at IS NOT NULL AND next_run_at <= ?
+		ORDER BY next_run_at
+	`, time.Now().UTC())
+	if err != nil {
+		log.Printf("failed to find due rotations: %v", err)
+		return
+	}
+
+	var due [][2]string
+	for rows.Next() {
+		var groupName, path string
+		if err := rows.Scan(&groupName, &path); err != nil {
+			log.Printf("failed to find due rotations: %v", err)
+			break
+		}
+		due = append(due, [2]string{groupName, path})
+	}
+	rows.Close()
+
+	for _, d := range due {
+		if _, err := s.Rotate(d[0], d[1], "rotation"); err != nil && !errors.Is(err, ErrRotationRunning) {
+			log.Printf("scheduled rotation of %s:%s failed: %v", d[0], d[1], err)
+		}
+	}
+}
+
+// recordRun stores the outcome of a rotation and schedules the next one. A
+// failed run is retried after the interval or maxRotationRetry, whichever is
+// sooner. It returns the time of the run.
+func (s *RotationService) recordRun(rotation *models.Rotation, runErr error) time.Time {
+	now := time.Now().UTC()
+	status, message := RotationSucceeded, ""
+	wait := time.Duration(rotation.IntervalMinutes) * time.Minute
+	if runErr != nil {
+		status, message = RotationFailed, runErr.Error()
+		if wait > maxRotationRetry {
+			wait = maxRotationRetry
+		}
+	}
+
+	var nextRunAt *time.Time
+	if wait > 0 {
+		next := now.Add(wait)
+		nextRunAt = &next
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE rotations SET last_run_at = ?, last_status = ?, last_error = ?, next_run_at = ?
+		WHERE id = ?
+	`, now, status, message, nextRunAt, rotation.ID)
+	if err != nil {
+		log.Printf("failed to record rotation of %s:%s: %v", rotation.Group, rotation.Path, err)
+	}
+	return now
+}
+
+func (s *RotationService) getRotation(groupName, path string) (*models.Rotation, error) {
+	row := s.db.QueryRow(`
+		SELECT id, group_name, path, rotator, config, interval_minutes, next_run_at, last_run_at,
+		       last_status, last_error, created_by, created_at
+		FROM rotations WHERE group_name = ? AND path = ?
+	`, groupName, path)
+
+	rotation, err := scanRotation(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrRotationNotFound
+	}
+	return rotation, err
+}
+
+func scanRotation(row interface{ Scan(...any) error }) (*models.Rotation, error) {
+	var rotation models.Rotation
+	var config string
+	var nextRunAt, lastRunAt sql.NullTime
+	err := row.Scan(&rotation.ID, &rotation.Group, &rotation.Path, &rotation.Rotator, &config,
+		&rotation.IntervalMinutes, &nextRunAt, &lastRunAt, &rotation.LastStatus, &rotation.LastError,
+		&rotation.CreatedBy, &rotation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(config), &rotation.Config); err != nil {
+		return nil, fmt.Errorf("invalid rotation settings: %w", err)
+	}
+	if nextRunAt.Valid {
+		rotation.NextRunAt = &nextRunAt.Time
+	}
+	if lastRunAt.Valid {
+		rotation.LastRunAt = &lastRunAt.Time
+	}
+	return &rotation, nil
+}
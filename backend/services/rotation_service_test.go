@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestRotation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test rotators are shell scripts")
+	}
+
+	rotatorDir := t.TempDir()
+	t.Setenv("PMAN_ROTATOR_DIR", rotatorDir)
+	scripts := map[string]string{
+		// Prints the current value with a suffix, so each rotation is visible
+		"append": "#!/bin/sh\nread current\necho \"$current-$PMAN_PATH\"\n",
+		"broken": "#!/bin/sh\necho 'cannot reach the database' >&2\nexit 3\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(rotatorDir, name), []byte(script), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := newTestDB(t)
+
+	passwords := NewPasswordService(db)
+	rotations := NewRotationService(db)
+	const writer = "team1:rw"
+	for _, path := range []string{"db/app", "db/broken"} {
+		if err := passwords.CreatePassword(path, "v1", "team1", "admin@example.com", writer); err != nil {
+			t.Fatalf("CreatePassword(%s) error = %v", path, err)
+		}
+	}
+
+	for name, req := range map[string]models.RotationRequest{
+		"unknown rotator":   {Rotator: "oracle"},
+		"missing setting":   {Rotator: models.RotatorPostgres, Config: map[string]string{"host": "db"}},
+		"unknown setting":   {Rotator: models.RotatorMySQL, Config: map[string]string{"host": "db", "user": "app", "password": "x"}},
+		"command with path": {Rotator: models.RotatorCommand, Config: map[string]string{"command": "../append"}},
+		"missing command":   {Rotator: models.RotatorCommand, Config: map[string]string{"command": "absent"}},
+		"negative interval": {Rotator: models.RotatorCommand, Config: map[string]string{"command": "append"}, IntervalMinutes: -1},
+	} {
+		if _, err := rotations.SetRotation("team1", "db/app", req, "admin@example.com", writer); !errors.Is(err, ErrInvalidRotation) {
+			t.Errorf("%s: SetRotation() error = %v, want ErrInvalidRotation", name, err)
+		}
+	}
+	if _, err := rotations.SetRotation("team1", "db/absent", models.RotationRequest{Rotator: models.RotatorCommand, Config: map[string]string{"command": "append"}}, "admin@example.com", writer); !errors.Is(err, ErrPasswordNotFound) {
+		t.Errorf("SetRotation() of a missing password error = %v, want ErrPasswordNotFound", err)
+	}
+
+	// The rotator is given the current value, so binding one needs read and
+	// write access and is refused for passwords that require approval
+	appendReq := models.RotationRequest{Rotator: models.RotatorCommand, Config: map[string]string{"command": "append"}}
+	if _, err := rotations.SetRotation("team1", "db/app", appendReq, "reader@example.com", "team1:ro"); err == nil {
+		t.Error("SetRotation() by a reader succeeded")
+	}
+	if _, err := rotations.SetRotation("team1", "db/app", appendReq, "outsider@example.com", "team2:rw"); err == nil {
+		t.Error("SetRotation() by a non-member succeeded")
+	}
+	if err := passwords.CreatePassword("db/guarded", "v1", "team1", "admin@example.com", writer); err != nil {
+		t.Fatalf("CreatePassword(db/guarded) error = %v", err)
+	}
+	if _, err := db.Exec("UPDATE passwords SET requires_approval = true WHERE path = 'db/guarded'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotations.SetRotation("team1", "db/guarded", appendReq, "admin@example.com", writer); !errors.Is(err, ErrRotationApproval) {
+		t.Errorf("SetRotation() of a password requiring approval error = %v, want ErrRotationApproval", err)
+	}
+
+	if _, err := rotations.Rotate("team1", "db/app", "admin@example.com"); !errors.Is(err, ErrRotationNotFound) {
+		t.Errorf("Rotate() without a rotator error = %v, want ErrRotationNotFound", err)
+	}
+
+	_, err := rotations.SetRotation("team1", "db/app", models.RotationRequest{Rotator: models.RotatorCommand, Config: map[string]string{"command": "append"}}, "admin@example.com", writer)
+	if err != nil {
+		t.Fatalf("SetRotation() error = %v", err)
+	}
+	_, err = rotations.SetRotation("team1", "db/broken", models.RotationRequest{Rotator: models.RotatorCommand, Config: map[string]string{"command": "broken"}, IntervalMinutes: 60}, "admin@example.com", writer)
+	if err != nil {
+		t.Fatalf("SetRotation() error = %v", err)
+	}
+
+	// Rotating needs write access to the password
+	if _, err := rotations.RotatePassword("db/app", "team1", "reader@example.com", "team1:ro"); err == nil {
+		t.Error("RotatePassword() by a reader succeeded")
+	}
+
+	result, err := rotations.RotatePassword("db/app", "team1", "admin@example.com", writer)
+	if err != nil {
+		t.Fatalf("RotatePassword() error = %v", err)
+	}
+	if result.Version != 2 {
+		t.Errorf("rotated to version %d, want 2", result.Version)
+	}
+	if value, _ := passwords.GetPassword("db/app", "team1", "admin@example.com", writer); value != "v1-db/app" {
+		t.Errorf("value after rotation = %q, want %q", value, "v1-db/app")
+	}
+	if value, _ := passwords.GetPasswordVersion("db/app", "team1", 1, "admin@example.com", writer); value != "v1" {
+		t.Errorf("version 1 after rotation = %q, want %q", value, "v1")
+	}
+
+	// A failed rotation leaves the password as it was and is retried later
+	if _, err := rotations.Rotate("team1", "db/broken", "admin@example.com"); !errors.Is(err, ErrRotationFailed) {
+		t.Errorf("Rotate() with a failing rotator error = %v, want ErrRotationFailed", err)
+	}
+	if value, _ := passwords.GetPassword("db/broken", "team1", "admin@example.com", writer); value != "v1" {
+		t.Errorf("value after failed rotation = %q, want %q", value, "v1")
+	}
+	broken, err := rotations.getRotation("team1", "db/broken")
+	if err != nil {
+		t.Fatalf("getRotation() error = %v", err)
+	}
+	if broken.LastStatus != RotationFailed || broken.LastError == "" || broken.NextRunAt == nil {
+		t.Errorf("failed rotation recorded as %+v", broken)
+	}
+
+	// Due rotations are run by the scheduler
+	_, err = db.Exec("UPDATE rotations SET interval_minutes = 60, next_run_at = ? WHERE path = 'db/app'", time.Now().UTC().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotations.rotateDue()
+	if value, _ := passwords.GetPassword("db/app", "team1", "admin@example.com", writer); value != "v1-db/app-db/app" {
+		t.Errorf("value after scheduled rotation = %q, want %q", value, "v1-db/app-db/app")
+	}
+	app, err := rotations.getRotation("team1", "db/app")
+	if err != nil {
+		t.Fatalf("getRotation() error = %v", err)
+	}
+	if app.LastStatus != RotationSucceeded || app.NextRunAt == nil || !app.NextRunAt.After(time.Now()) {
+		t.Errorf("scheduled rotation recorded as %+v", app)
+	}
+
+	// A password that came to require approval after being bound is not rotated
+	if _, err := db.Exec("UPDATE passwords SET requires_approval = true WHERE path = 'db/app'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotations.Rotate("team1", "db/app", "admin@example.com"); !errors.Is(err, ErrRotationApproval) {
+		t.Errorf("Rotate() of a password requiring approval error = %v, want ErrRotationApproval", err)
+	}
+	app, err = rotations.getRotation("team1", "db/app")
+	if err != nil {
+		t.Fatalf("getRotation() error = %v", err)
+	}
+	if app.LastStatus != RotationFailed || app.LastError == "" {
+		t.Errorf("refused rotation recorded as %+v", app)
+	}
+	var version int
+	if err := db.QueryRow("SELECT version FROM passwords WHERE path = 'db/app'").Scan(&version); err != nil || version != 3 {
+		t.Errorf("version after refused rotation = %d, %v, want 3", version, err)
+	}
+
+	// Deleting the password removes its rotator
+	if err := passwords.DeletePassword("db/app", "team1", "admin@example.com", writer); err != nil {
+		t.Fatalf("DeletePassword() error = %v", err)
+	}
+	list, err := rotations.ListRotations("team1")
+	if err != nil {
+		t.Fatalf("ListRotations() error = %v", err)
+	}
+	if len(list) != 1 || list[0].Path != "db/broken" {
+		t.Errorf("ListRotations() = %+v, want only db/broken", list)
+	}
+}
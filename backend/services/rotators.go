@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/steve/pman/shared/config"
+	"github.com/steve/pman/shared/models"
+)
+
+// Rotator replaces a password at its source, such as a database user's
+// password, and returns the new value. It must leave the source unchanged
+// when it returns an error, as the password then keeps its current value.
+type Rotator interface {
+	// Validate checks the settings of a password's rotator
+	Validate(settings map[string]string) error
+	Rotate(ctx context.Context, target RotationTarget) (string, error)
+}
+
+// RotationTarget is the password a rotator replaces
+type RotationTarget struct {
+	Group    string
+	Path     string
+	Value    string
+	Settings map[string]string
+}
+
+// rotators are the rotators passwords can be bound to, by name
+var rotators = map[string]Rotator{
+	models.RotatorPostgres: postgresRotator{},
+	models.RotatorMySQL:    mysqlRotator{},
+	models.RotatorCommand:  commandRotator{},
+}
+
+// Lengths of the passwords the database rotators generate
+const (
+	defaultRotatedLength = 32
+	minRotatedLength     = 16
+	maxRotatedLength     = 128
+)
+
+// postgresRotator changes the password of a PostgreSQL user with psql,
+// logging in as that user with the current password
+type postgresRotator struct{}
+
+func (postgresRotator) Validate(settings map[string]string) error {
+	return checkSettings(settings, []string{"host", "user"}, []string{"port", "database", "sslmode", "length"})
+}
+
+func (postgresRotator) Rotate(ctx context.Context, target RotationTarget) (string, error) {
+	newValue, err := rotatedPassword(target.Settings)
+	if err != nil {
+		return "", err
+	}
+
+	conninfo := []string{
+		"host=" + conninfoValue(target.Settings["host"]),
+		"port=" + conninfoValue(settingOr(target.Settings, "port", "5432")),
+		"dbname=" + conninfoValue(settingOr(target.Settings, "database", "postgres")),
+		"user=" + conninfoValue(target.Settings["user"]),
+		"sslmode=" + conninfoValue(settingOr(target.Settings, "sslmode", "prefer")),
+		"connect_timeout=10",
+	}
+
+	// Passwords are passed through the environment and stdin, never as arguments
+	cmd := exec.CommandContext(ctx, "psql", "--no-psqlrc", "--quiet", "-v", "ON_ERROR_STOP=1",
+		"--dbname", strings.Join(conninfo, " "), "--file", "-")
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+target.Value)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("ALTER ROLE CURRENT_USER WITH PASSWORD '%s';\n", newValue))
+
+	if _, err := runRotatorTool(cmd); err != nil {
+		return "", err
+	}
+	return newValue, nil
+}
+
+// mysqlRotator changes the password of a MySQL or MariaDB user with the
+// mysql client, logging in as that user with the current password
+type mysqlRotator struct{}
+
+func (mysqlRotator) Validate(settings map[string]string) error {
+	return checkSettings(settings, []string{"host", "user"}, []string{"port", "length"})
+}
+
+func (mysqlRotator) Rotate(ctx context.Context, target RotationTarget) (string, error) {
+	newValue, err := rotatedPassword(target.Settings)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "mysql", "--no-defaults", "--batch", "--connect-timeout=10",
+		"--host", target.Settings["host"], "--port", settingOr(target.Settings, "port", "3306"),
+		"--user", target.Settings["user"])
+	cmd.Env = append(os.Environ(), "MYSQL_PWD="+target.Value)
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("ALTER USER CURRENT_USER() IDENTIFIED BY '%s';\n", newValue))
+
+	if _, err := runRotatorTool(cmd); err != nil {
+		return "", err
+	}
+	return newValue, nil
+}
+
+// commandRotator runs an executable from the server's PMAN_ROTATOR_DIR. It
+// gets the current value on stdin and PMAN_GROUP and PMAN_PATH in its
+// environment, and prints the new value once it is in place.
+type commandRotator struct{}
+
+func (commandRotator) Validate(settings map[string]string) error {
+	if err := checkSettings(settings, []string{"command"}, nil); err != nil {
+		return err
+	}
+	_, err := rotatorCommandPath(settings["command"])
+	return err
+}
+
+func (commandRotator) Rotate(ctx context.Context, target RotationTarget) (string, error) {
+	path, err := rotatorCommandPath(target.Settings["command"])
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(), "PMAN_GROUP="+target.Group, "PMAN_PATH="+target.Path)
+	cmd.Stdin = strings.NewReader(target.Value)
+
+	output, err := runRotatorTool(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	newValue := strings.TrimRight(output, "\r\n")
+	if newValue == "" {
+		return "", fmt.Errorf("%s printed no new value", target.Settings["command"])
+	}
+	return newValue, nil
+}
+
+// rotatorCommandPath finds a command rotator's executable, which must be
+// directly inside the rotator directory
+func rotatorCommandPath(command string) (string, error) {
+	dir := config.GetRotationConfig().CommandDir
+	if dir == "" {
+		return "", fmt.Errorf("%w: the command rotator is disabled on this server (PMAN_ROTATOR_DIR is not set)", ErrInvalidRotation)
+	}
+	if command == "" || command != filepath.Base(command) || strings.HasPrefix(command, ".") {
+		return "", fmt.Errorf("%w: command must be the name of an executable in the rotator directory", ErrInvalidRotation)
+	}
+
+	path := filepath.Join(dir, command)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("%w: no executable '%s' in the rotator directory", ErrInvalidRotation, command)
+	}
+	return path, nil
+}
+
+// runRotatorTool runs a rotator's program and returns its output, or an
+// error with what it printed to stderr
+func runRotatorTool(cmd *exec.Cmd) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > 500 {
+			message = message[:500]
+		}
+		if message == "" {
+			return "", fmt.Errorf("%s: %v", filepath.Base(cmd.Path), err)
+		}
+		return "", fmt.Errorf("%s: %v: %s", filepath.Base(cmd.Path), err, message)
+	}
+	return stdout.String(), nil
+}
+
+// checkSettings refuses settings that miss a required key or have an unknown one
+func checkSettings(settings map[string]string, required, optional []string) error {
+	for _, key := range required {
+		if strings.TrimSpace(settings[key]) == "" {
+			return fmt.Errorf("%w: setting '%s' is required", ErrInvalidRotation, key)
+		}
+	}
+
+	known := append(append([]string{}, required...), optional...)
+	for key := range settings {
+		found := false
+		for _, k := range known {
+			if key == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sort.Strings(known)
+			return fmt.Errorf("%w: unknown setting '%s' (must be one of %s)", ErrInvalidRotation, key, strings.Join(known, ", "))
+		}
+	}
+
+	if length, ok := settings["length"]; ok {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < minRotatedLength || n > maxRotatedLength {
+			return fmt.Errorf("%w: length must be %d to %d", ErrInvalidRotation, minRotatedLength, maxRotatedLength)
+		}
+	}
+	if port, ok := settings["port"]; ok {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%w: invalid port '%s'", ErrInvalidRotation, port)
+		}
+	}
+	return nil
+}
+
+func settingOr(settings map[string]string, key, fallback string) string {
+	if value := settings[key]; value != "" {
+		return value
+	}
+	return fallback
+}
+
+// conninfoValue quotes a value for a libpq connection string
+func conninfoValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// rotatedPassword generates a new database password. Letters and digits
+// only, so it needs no quoting in SQL.
+func rotatedPassword(settings map[string]string) (string, error) {
+	length := defaultRotatedLength
+	if n, err := strconv.Atoi(settings["length"]); err == nil {
+		length = n
+	}
+
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	password := make([]byte, length)
+	for i := range password {
+		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[num.Int64()]
+	}
+	return string(password), nil
+}
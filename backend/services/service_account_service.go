@@ -0,0 +1,272 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+// ServiceAccountRole is the role reported for requests authenticated with an API key
+const ServiceAccountRole = "service"
+
+// ServiceAccountEmailPrefix identifies service accounts in audit fields such as created_by
+const ServiceAccountEmailPrefix = "service:"
+
+var ErrServiceAccountExists = errors.New("service account already exists")
+
+type ServiceAccountService struct {
+	db *database.DB
+}
+
+func NewServiceAccountService(db *database.DB) *ServiceAccountService {
+	return &ServiceAccountService{db: db}
+}
+
+// CreateServiceAccount creates the account and its first API key. Groups given
+// without a permission are read-only.
+func (s *ServiceAccountService) CreateServiceAccount(req models.ServiceAccountRequest, createdBy string) (*models.APIKeyResponse, error) {
+	if req.Name == "" {
+		return nil, fmt.Errorf("service account name is required")
+	}
+
+	groupsStr := permissions.DefaultToReadOnly(req.Groups)
+	if err := checkGroupsExist(s.db, groupsStr); err != nil {
+		return nil, err
+	}
+	groups, _ := permissions.ParseGroups(groupsStr)
+	for _, group := range groups {
+		if group.Verbs.Has(permissions.VerbAdmin) {
+			return nil, ErrServiceAccountOwner
+		}
+	}
+
+	prefixesStr := strings.Join(permissions.ParsePathPrefixes(req.PathPrefixes), ",")
+
+	result, err := s.db.Exec(`
+		INSERT INTO service_accounts (name, description, groups, path_prefixes, enabled, created_by)
+		VALUES (?, ?, ?, ?, true, ?)
+		ON CONFLICT(name) DO NOTHING
+	`, req.Name, req.Description, groupsStr, prefixesStr, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrServiceAccountExists
+	}
+
+	accountID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createAPIKey(int(accountID), req.ExpireDays)
+}
+
+func (s *ServiceAccountService) GetServiceAccount(name string) (*models.ServiceAccount, error) {
+	account := &models.ServiceAccount{}
+	err := s.db.QueryRow(`
+		SELECT id, name, description, groups, path_prefixes, enabled, created_by, created_at, updated_at
+		FROM service_accounts WHERE name = ?
+	`, name).Scan(&account.ID, &account.Name, &account.Description, &account.Groups, &account.PathPrefixes,
+		&account.Enabled, &account.CreatedBy, &account.CreatedAt, &account.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("service account not found")
+		}
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *ServiceAccountService) ListServiceAccounts() ([]models.ServiceAccount, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, description, groups, path_prefixes, enabled, created_by, created_at, updated_at
+		FROM service_accounts ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []models.ServiceAccount
+	for rows.Next() {
+		var account models.ServiceAccount
+		err := rows.Scan(&account.ID, &account.Name, &account.Description, &account.Groups, &account.PathPrefixes,
+			&account.Enabled, &account.CreatedBy, &account.CreatedAt, &account.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+func (s *ServiceAccountService) DeleteServiceAccount(name string) error {
+	account, err := s.GetServiceAccount(name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM api_keys WHERE service_account_id = ?", account.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM service_accounts WHERE id = ?", account.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *ServiceAccountService) CreateAPIKey(name string, expireDays int) (*models.APIKeyResponse, error) {
+	account, err := s.GetServiceAccount(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createAPIKey(account.ID, expireDays)
+}
+
+func (s *ServiceAccountService) createAPIKey(accountID int, expireDays int) (*models.APIKeyResponse, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	key := auth.APIKeyPrefix + hex.EncodeToString(secret)
+	keyPrefix := key[:len(auth.APIKeyPrefix)+8]
+
+	var expiresAt *time.Time
+	if expireDays > 0 {
+		expiry := time.Now().UTC().Add(time.Duration(expireDays) * 24 * time.Hour)
+		expiresAt = &expiry
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO api_keys (key_hash, key_prefix, service_account_id, expires_at, revoked)
+		VALUES (?, ?, ?, ?, false)
+	`, auth.HashToken(key), keyPrefix, accountID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.APIKeyResponse{
+		Key: key,
+		APIKey: models.APIKey{
+			ID:        int(keyID),
+			Prefix:    keyPrefix,
+			ExpiresAt: expiresAt,
+			CreatedAt: time.Now().UTC(),
+		},
+	}, nil
+}
+
+func (s *ServiceAccountService) ListAPIKeys(name string) ([]models.APIKey, error) {
+	account, err := s.GetServiceAccount(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, key_prefix, expires_at, last_used_at, created_at, revoked
+		FROM api_keys WHERE service_account_id = ? ORDER BY created_at
+	`, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(&key.ID, &key.Prefix, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.Revoked); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (s *ServiceAccountService) RevokeAPIKey(name string, keyID int) error {
+	account, err := s.GetServiceAccount(name)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE api_keys SET revoked = true WHERE id = ? AND service_account_id = ?
+	`, keyID, account.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// ValidateAPIKey implements auth.APIKeyValidator
+func (s *ServiceAccountService) ValidateAPIKey(key string) (*auth.Claims, error) {
+	var (
+		keyID        int
+		name         string
+		groups       string
+		pathPrefixes string
+	)
+
+	err := s.db.QueryRow(`
+		SELECT k.id, a.name, a.groups, a.path_prefixes
+		FROM api_keys k JOIN service_accounts a ON a.id = k.service_account_id
+		WHERE k.key_hash = ? AND k.revoked = false AND a.enabled = true
+		AND (k.expires_at IS NULL OR k.expires_at > ?)
+	`, auth.HashToken(key), time.Now().UTC()).Scan(&keyID, &name, &groups, &pathPrefixes)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invalid API key")
+		}
+		return nil, err
+	}
+
+	s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now().UTC(), keyID)
+
+	return &auth.Claims{
+		Email:          ServiceAccountEmailPrefix + name,
+		Role:           ServiceAccountRole,
+		ServiceAccount: true,
+		Groups:         groups,
+		PathPrefixes:   permissions.ParsePathPrefixes(pathPrefixes),
+	}, nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"database/sql"
+
+	"github.com/steve/pman/backend/database"
+)
+
+// getSetting returns a server-wide setting, or def when it has never been set
+func getSetting(db *database.DB, key, def string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return def, nil
+		}
+		return "", err
+	}
+
+	return value, nil
+}
+
+func setSetting(db *database.DB, key, value string) error {
+	_, err := db.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+
+	return err
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+)
+
+var (
+	ErrShareNotFound = errors.New("share not found, used up or expired")
+	ErrInvalidShare  = errors.New("invalid share")
+)
+
+// Limits of share links
+const (
+	DefaultShareMinutes = 60
+	MaxShareMinutes     = 7 * 24 * 60
+	MaxShareViews       = 10
+)
+
+// ShareService keeps one-time copies of secrets for people without an
+// account. Each copy is encrypted with a key derived from its link token,
+// which is only stored hashed, so the server alone cannot read it.
+type ShareService struct {
+	db *database.DB
+}
+
+func NewShareService(db *database.DB) *ShareService {
+	return &ShareService{db: db}
+}
+
+// CreateShare stores a copy of value and returns the token of its link
+func (s *ShareService) CreateShare(req models.ShareRequest, value, createdBy string) (*models.ShareResponse, error) {
+	if req.ExpiresMinutes == 0 {
+		req.ExpiresMinutes = DefaultShareMinutes
+	}
+	if req.Views == 0 {
+		req.Views = 1
+	}
+	if req.ExpiresMinutes < 0 || req.ExpiresMinutes > MaxShareMinutes {
+		return nil, fmt.Errorf("%w: links can expire after at most %d days", ErrInvalidShare, MaxShareMinutes/(24*60))
+	}
+	if req.Views < 0 || req.Views > MaxShareViews {
+		return nil, fmt.Errorf("%w: links allow 1 to %d views", ErrInvalidShare, MaxShareViews)
+	}
+
+	now := time.Now().UTC()
+	if _, err := s.db.Exec(`DELETE FROM shares WHERE expires_at <= ?`, now); err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	encryptedValue, err := crypto.EncryptWithKey(value, shareKey(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	expiresAt := now.Add(time.Duration(req.ExpiresMinutes) * time.Minute)
+	_, err = s.db.Exec(`
+		INSERT INTO shares (token_hash, group_name, path, encrypted_value, views_left, expires_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, auth.HashToken(token), req.Group, req.Path, encryptedValue, req.Views, expiresAt, createdBy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ShareResponse{Token: token, ExpiresAt: expiresAt, Views: req.Views}, nil
+}
+
+// OpenShare returns the shared secret and uses up one view. The share is
+// deleted with its last view, or when it is found expired.
+func (s *ShareService) OpenShare(token string) (*models.SharedSecret, error) {
+	tokenHash := auth.HashToken(token)
+	now := time.Now().UTC()
+
+	var shared models.SharedSecret
+	var encryptedValue string
+	err := s.db.QueryRow(`
+		UPDATE shares SET views_left = views_left - 1
+		WHERE token_hash = ? AND views_left > 0 AND expires_at > ?
+		RETURNING group_name, path, encrypted_value, views_left, expires_at
+	`, tokenHash, now).Scan(&shared.Group, &shared.Path, &encryptedValue, &shared.ViewsLeft, &shared.ExpiresAt)
+	if err == sql.ErrNoRows {
+		if _, err := s.db.Exec(`DELETE FROM shares WHERE token_hash = ?`, tokenHash); err != nil {
+			return nil, err
+		}
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if shared.ViewsLeft == 0 {
+		if _, err := s.db.Exec(`DELETE FROM shares WHERE token_hash = ?`, tokenHash); err != nil {
+			return nil, err
+		}
+	}
+
+	shared.Value, err = crypto.DecryptWithKey(encryptedValue, shareKey(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	return &shared, nil
+}
+
+// shareKey derives the encryption key of a share from its token; the token
+// hash used to find the share is a different digest
+func shareKey(token string) []byte {
+	key := sha256.Sum256([]byte("pman-share:" + token))
+	return key[:]
+}
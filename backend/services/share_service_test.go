@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+)
+
+func TestShares(t *testing.T) {
+	db := newTestDB(t)
+
+	shares := &ShareService{db: db}
+	req := models.ShareRequest{Group: "team1", Path: "prod/db", Views: 2}
+
+	if _, err := shares.CreateShare(models.ShareRequest{Views: MaxShareViews + 1}, "secret", "lead@example.com"); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("CreateShare(too many views) error = %v, want ErrInvalidShare", err)
+	}
+
+	share, err := shares.CreateShare(req, "secret", "lead@example.com")
+	if err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+
+	// The copy cannot be read with the server key alone
+	var stored string
+	if err := db.QueryRow(`SELECT encrypted_value FROM shares`).Scan(&stored); err != nil {
+		t.Fatalf("reading share: %v", err)
+	}
+	if _, err := crypto.Decrypt(stored); err == nil {
+		t.Error("crypto.Decrypt(share) error = nil, want the server key to fail")
+	}
+
+	if _, err := shares.OpenShare("not-a-token"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("OpenShare(unknown) error = %v, want ErrShareNotFound", err)
+	}
+	for viewsLeft := 1; viewsLeft >= 0; viewsLeft-- {
+		shared, err := shares.OpenShare(share.Token)
+		if err != nil || shared.Value != "secret" || shared.ViewsLeft != viewsLeft {
+			t.Fatalf("OpenShare() = %+v, %v, want the value with %d views left", shared, err, viewsLeft)
+		}
+	}
+	if _, err := shares.OpenShare(share.Token); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("OpenShare(used up) error = %v, want ErrShareNotFound", err)
+	}
+
+	// Expired shares are refused and deleted
+	share, err = shares.CreateShare(req, "secret", "lead@example.com")
+	if err != nil {
+		t.Fatalf("CreateShare() error = %v", err)
+	}
+	if _, err := db.Exec(`UPDATE shares SET expires_at = ?`, time.Now().UTC().Add(-time.Minute)); err != nil {
+		t.Fatalf("expiring share: %v", err)
+	}
+	if _, err := shares.OpenShare(share.Token); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("OpenShare(expired) error = %v, want ErrShareNotFound", err)
+	}
+
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM shares`).Scan(&remaining); err != nil || remaining != 0 {
+		t.Errorf("shares left = %d, %v, want 0", remaining, err)
+	}
+}
@@ -1,13 +1,32 @@
 package services
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/steve/pman/backend/database"
 	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
 )
 
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// ErrRefreshTokenReused is returned when an already exchanged refresh token is
+// presented again. This means the token was copied, so the whole session is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+
+// refreshReuseGrace is how long an exchanged refresh token may still be
+// exchanged, so CLI processes sharing a login that refresh at the same time
+// do not revoke their own session
+const refreshReuseGrace = 30 * time.Second
+
 type TokenService struct {
 	db *database.DB
 }
@@ -16,25 +35,188 @@ func NewTokenService(db *database.DB) *TokenService {
 	return &TokenService{db: db}
 }
 
-func (s *TokenService) StoreToken(token, userEmail string, expiresAt time.Time) error {
+// RefreshedSession is the result of exchanging a refresh token
+type RefreshedSession struct {
+	UserEmail    string
+	SessionID    string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+func NewSessionID() (string, error) {
+	return randomToken(16)
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *TokenService) StoreToken(token, tokenType, userEmail, sessionID string, expiresAt time.Time) error {
 	tokenHash := auth.HashToken(token)
 	
 	_, err := s.db.Exec(`
-		INSERT INTO tokens (token_hash, user_email, expires_at, revoked)
-		VALUES (?, ?, ?, false)
-	`, tokenHash, userEmail, expiresAt)
+		INSERT INTO tokens (token_hash, user_email, expires_at, revoked, token_type, session_id)
+		VALUES (?, ?, ?, false, ?, ?)
+	`, tokenHash, userEmail, expiresAt.UTC(), tokenType, sessionID)
 	
 	return err
 }
 
+// CreateSession records a new login session
+func (s *TokenService) CreateSession(sessionID, userEmail, clientHostname, clientIP string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO sessions (id, user_email, client_hostname, client_ip, expires_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, sessionID, userEmail, clientHostname, clientIP, expiresAt.UTC(), time.Now().UTC())
+
+	return err
+}
+
+// ListSessions returns the active sessions of a user, most recent first
+func (s *TokenService) ListSessions(userEmail string) ([]models.Session, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_email, client_hostname, client_ip, created_at, expires_at, last_seen_at
+		FROM sessions WHERE user_email = ? AND revoked = false AND expires_at > ?
+		ORDER BY created_at DESC
+	`, userEmail, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(&session.ID, &session.UserEmail, &session.ClientHostname, &session.ClientIP,
+			&session.CreatedAt, &session.ExpiresAt, &session.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// RevokeUserSession revokes a session after checking it belongs to the user
+func (s *TokenService) RevokeUserSession(userEmail, sessionID string) error {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM sessions WHERE id = ? AND user_email = ? AND revoked = false
+	`, sessionID, userEmail).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	return s.RevokeSession(sessionID)
+}
+
+// RevokeToken revokes a single token, used for tokens issued before sessions existed
+func (s *TokenService) RevokeToken(token string) error {
+	_, err := s.db.Exec(`
+		UPDATE tokens SET revoked = true WHERE token_hash = ?
+	`, auth.HashToken(token))
+
+	return err
+}
+
+// CreateRefreshToken issues a new refresh token for a session. The session's
+// absolute expiry is kept when tokens are rotated.
+func (s *TokenService) CreateRefreshToken(userEmail, sessionID string, expiresAt time.Time) (string, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.StoreToken(refreshToken, TokenTypeRefresh, userEmail, sessionID, expiresAt); err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same session
+func (s *TokenService) RotateRefreshToken(refreshToken string) (*RefreshedSession, error) {
+	var (
+		id        int
+		userEmail string
+		sessionID string
+		expiresAt time.Time
+		revoked   bool
+		used      bool
+		usedAt    sql.NullTime
+	)
+
+	err := s.db.QueryRow(`
+		SELECT id, user_email, session_id, expires_at, revoked, used, used_at FROM tokens
+		WHERE token_hash = ? AND token_type = ?
+	`, auth.HashToken(refreshToken), TokenTypeRefresh).Scan(&id, &userEmail, &sessionID, &expiresAt, &revoked, &used, &usedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invalid refresh token")
+		}
+		return nil, err
+	}
+
+	if revoked {
+		return nil, fmt.Errorf("session has been revoked")
+	}
+
+	// A token exchanged moments ago is most likely another process of the same
+	// login refreshing at the same time; an older one was copied
+	if used && (!usedAt.Valid || time.Since(usedAt.Time) > refreshReuseGrace) {
+		if err := s.RevokeSession(sessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return nil, fmt.Errorf("session has expired")
+	}
+
+	// The first exchange starts the grace period; a concurrent one falls within it
+	if !used {
+		_, err = s.db.Exec(`
+			UPDATE tokens SET used = true, used_at = ? WHERE id = ? AND used = false
+		`, time.Now().UTC(), id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newRefreshToken, err := s.CreateRefreshToken(userEmail, sessionID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?", time.Now().UTC(), sessionID)
+
+	return &RefreshedSession{
+		UserEmail:    userEmail,
+		SessionID:    sessionID,
+		RefreshToken: newRefreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
 func (s *TokenService) IsTokenRevoked(token string) (bool, error) {
 	tokenHash := auth.HashToken(token)
 	
 	var revoked bool
 	err := s.db.QueryRow(`
 		SELECT revoked FROM tokens 
-		WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP
-	`, tokenHash).Scan(&revoked)
+		WHERE token_hash = ? AND expires_at > ?
+	`, tokenHash, time.Now().UTC()).Scan(&revoked)
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -47,11 +229,38 @@ func (s *TokenService) IsTokenRevoked(token string) (bool, error) {
 	return revoked, nil
 }
 
+// RevokeSession revokes every access and refresh token issued for a login session
+func (s *TokenService) RevokeSession(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE tokens SET revoked = true WHERE session_id = ?
+	`, sessionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE sessions SET revoked = true WHERE id = ?
+	`, sessionID)
+
+	return err
+}
+
 func (s *TokenService) RevokeUserTokens(userEmail string) error {
 	_, err := s.db.Exec(`
 		UPDATE tokens 
 		SET revoked = true 
-		WHERE user_email = ? AND revoked = false AND expires_at > CURRENT_TIMESTAMP
+		WHERE user_email = ? AND revoked = false AND expires_at > ?
+	`, userEmail, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE sessions SET revoked = true WHERE user_email = ? AND revoked = false
 	`, userEmail)
 	
 	return err
@@ -60,8 +269,15 @@ func (s *TokenService) RevokeUserTokens(userEmail string) error {
 func (s *TokenService) CleanupExpiredTokens() error {
 	_, err := s.db.Exec(`
 		DELETE FROM tokens 
-		WHERE expires_at <= CURRENT_TIMESTAMP
-	`)
+		WHERE expires_at <= ?
+	`, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		DELETE FROM sessions WHERE expires_at <= ?
+	`, time.Now().UTC())
 	
 	return err
-}
\ No newline at end of file
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	db := newTestDB(t)
+	s := NewTokenService(db)
+
+	first, err := s.CreateRefreshToken("alice@example.com", "session-1", time.Now().UTC().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	if _, err := s.RotateRefreshToken(first); err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v", err)
+	}
+
+	// Another process of the same login refreshing at the same time
+	second, err := s.RotateRefreshToken(first)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken() within the grace period error = %v", err)
+	}
+
+	// Once the grace period is over, reuse revokes the session
+	_, err = db.Exec("UPDATE tokens SET used_at = ?", time.Now().UTC().Add(-2*refreshReuseGrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RotateRefreshToken(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RotateRefreshToken() after the grace period error = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := s.RotateRefreshToken(second.RefreshToken); err == nil {
+		t.Error("RotateRefreshToken() succeeded in a revoked session")
+	}
+}
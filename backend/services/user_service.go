@@ -4,29 +4,38 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"fmt"
+	"log"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/steve/pman/backend/database"
 	"github.com/steve/pman/shared/crypto"
 	"github.com/steve/pman/shared/models"
-	"github.com/steve/pman/shared/permissions"
 )
 
+// DefaultAdminEmail is the admin created by versions before the first-run
+// bootstrap; such databases treat it as the bootstrap admin
+const DefaultAdminEmail = "admin@pman.system"
+
 type UserService struct {
 	db *database.DB
+	// authenticator checks passwords externally (e.g. LDAP); nil means local hashes only
+	authenticator Authenticator
+	// webhooks is told about every change; nil sends no events
+	webhooks *WebhookService
 }
 
 func NewUserService(db *database.DB) *UserService {
-	return &UserService{db: db}
+	return &UserService{db: db, authenticator: newAuthenticator(), webhooks: NewWebhookService(db)}
 }
 
 func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
 	user := &models.User{}
 	err := s.db.QueryRow(`
-		SELECT id, email, password_hash, role, groups, enabled, created_at, updated_at
+		SELECT id, email, password_hash, role, `+userGroupsColumn+`, enabled, mfa_enabled, auth_source, must_change_password, created_at, updated_at
 		FROM users WHERE email = ?
-	`, email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.Groups, &user.Enabled, &user.CreatedAt, &user.UpdatedAt)
+	`, email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.Groups, &user.Enabled, &user.MFAEnabled, &user.AuthSource, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt)
 	
 	if err != nil {
 		return nil, err
@@ -35,9 +44,12 @@ func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
 	return user, nil
 }
 
-func (s *UserService) CreateUser(email, role, groupsStr string) (string, error) {
-	if _, err := permissions.ParseGroups(groupsStr); err != nil {
-		return "", fmt.Errorf("invalid groups format: %w", err)
+func (s *UserService) CreateUser(email, role, groupsStr, actor string) (string, error) {
+	if err := checkRoleExists(s.db, role); err != nil {
+		return "", err
+	}
+	if err := checkGroupsExist(s.db, groupsStr); err != nil {
+		return "", err
 	}
 
 	password := generateRandomPassword()
@@ -46,43 +58,92 @@ func (s *UserService) CreateUser(email, role, groupsStr string) (string, error)
 		return "", err
 	}
 
-	_, err = s.db.Exec(`
-		INSERT INTO users (email, password_hash, role, groups, enabled) 
-		VALUES (?, ?, ?, ?, true)
-	`, email, hashedPassword, role, groupsStr)
-	
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		INSERT INTO users (email, password_hash, role, enabled, must_change_password) 
+		VALUES (?, ?, ?, true, true) RETURNING id
+	`, email, hashedPassword, role).Scan(&userID)
 	if err != nil {
 		return "", err
 	}
 
+	if err := setUserGroups(tx, userID, groupsStr); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	s.webhooks.Notify(models.Event{Type: models.EventUserCreated, User: email, Actor: actor})
 	return password, nil
 }
 
-func (s *UserService) UpdateUser(email, role, groupsStr string) error {
-	if _, err := permissions.ParseGroups(groupsStr); err != nil {
-		return fmt.Errorf("invalid groups format: %w", err)
+func (s *UserService) UpdateUser(email, role, groupsStr, actor string) error {
+	if err := checkRoleExists(s.db, role); err != nil {
+		return err
+	}
+	if err := checkGroupsExist(s.db, groupsStr); err != nil {
+		return err
 	}
 
-	_, err := s.db.Exec(`
-		UPDATE users SET role = ?, groups = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE email = ?
-	`, role, groupsStr, email)
-	
-	return err
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		UPDATE users SET role = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE email = ? RETURNING id
+	`, role, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := setUserGroups(tx, userID, groupsStr); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.webhooks.Notify(models.Event{Type: models.EventUserUpdated, User: email, Actor: actor})
+	return nil
 }
 
-func (s *UserService) DeleteUser(email string) error {
-	if email == "admin@pman.system" {
-		return fmt.Errorf("cannot delete default admin user")
+func (s *UserService) DeleteUser(email, actor string) error {
+	if isAdmin, err := s.isBootstrapAdmin(email); err != nil {
+		return err
+	} else if isAdmin {
+		return fmt.Errorf("cannot delete the bootstrap admin user")
+	}
+
+	result, err := s.db.Exec("DELETE FROM users WHERE email = ?", email)
+	if err != nil {
+		return err
 	}
 
-	_, err := s.db.Exec("DELETE FROM users WHERE email = ?", email)
-	return err
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		s.webhooks.Notify(models.Event{Type: models.EventUserDeleted, User: email, Actor: actor})
+	}
+	return nil
 }
 
 func (s *UserService) ListUsers() ([]models.User, error) {
 	rows, err := s.db.Query(`
-		SELECT id, email, password_hash, role, groups, enabled, created_at, updated_at
+		SELECT id, email, password_hash, role, `+userGroupsColumn+`, enabled, mfa_enabled, auth_source, must_change_password, created_at, updated_at
 		FROM users ORDER BY email
 	`)
 	if err != nil {
@@ -93,7 +154,7 @@ func (s *UserService) ListUsers() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		err := rows.Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.Groups, &user.Enabled, &user.CreatedAt, &user.UpdatedAt)
+		err := rows.Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.Groups, &user.Enabled, &user.MFAEnabled, &user.AuthSource, &user.MustChangePassword, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -103,17 +164,26 @@ func (s *UserService) ListUsers() ([]models.User, error) {
 	return users, nil
 }
 
-func (s *UserService) EnableUser(email string) error {
-	_, err := s.db.Exec(`
+func (s *UserService) EnableUser(email, actor string) error {
+	result, err := s.db.Exec(`
 		UPDATE users SET enabled = true, updated_at = CURRENT_TIMESTAMP
 		WHERE email = ?
 	`, email)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		s.webhooks.Notify(models.Event{Type: models.EventUserEnabled, User: email, Actor: actor})
+	}
+	return nil
 }
 
-func (s *UserService) DisableUser(email string) error {
-	if email == "admin@pman.system" {
-		return fmt.Errorf("cannot disable default admin user")
+func (s *UserService) DisableUser(email, actor string) error {
+	if isAdmin, err := s.isBootstrapAdmin(email); err != nil {
+		return err
+	} else if isAdmin {
+		return fmt.Errorf("cannot disable the bootstrap admin user")
 	}
 
 	_, err := s.db.Exec(`
@@ -127,29 +197,67 @@ func (s *UserService) DisableUser(email string) error {
 	_, err = s.db.Exec(`
 		UPDATE tokens SET revoked = true WHERE user_email = ?
 	`, email)
-	
-	return err
+	if err != nil {
+		return err
+	}
+
+	s.webhooks.Notify(models.Event{Type: models.EventUserDisabled, User: email, Actor: actor})
+	return nil
 }
 
-func (s *UserService) ChangePassword(email, newPassword string) error {
+// ChangePassword sets a new pman password. A temporary password, set by an
+// admin, must be replaced by the user at their next login.
+func (s *UserService) ChangePassword(email, newPassword string, temporary bool) error {
+	user, err := s.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user.AuthSource != AuthSourceLocal {
+		return ErrExternalPassword
+	}
+
+	policy, err := s.GetPasswordPolicy()
+	if err != nil {
+		return err
+	}
+	if err := checkPasswordPolicy(policy, email, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkPasswordHistory(user, newPassword, policy.History); err != nil {
+		return err
+	}
+
 	hashedPassword, err := crypto.HashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 
 	_, err = s.db.Exec(`
-		UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP
+		UPDATE users SET password_hash = ?, password_changed_at = ?, must_change_password = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE email = ?
-	`, hashedPassword, email)
-	
-	return err
+	`, hashedPassword, time.Now().UTC(), temporary, email)
+	if err != nil {
+		return err
+	}
+
+	return s.rememberPassword(email, user.Password)
 }
 
 func (s *UserService) ValidateLogin(email, password string) (*models.User, error) {
+	if s.authenticator != nil {
+		isAdmin, err := s.isBootstrapAdmin(email)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return s.validateExternalLogin(email, password)
+		}
+	}
+
 	user, err := s.GetUserByEmail(email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("invalid credentials")
+			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
@@ -158,13 +266,101 @@ func (s *UserService) ValidateLogin(email, password string) (*models.User, error
 		return nil, fmt.Errorf("user account is disabled")
 	}
 
+	if user.AuthSource == AuthSourceOIDC {
+		return nil, ErrSSOAccount
+	}
+
 	if !crypto.CheckPasswordHash(password, user.Password) {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// validateExternalLogin checks the password with the configured authenticator.
+// Users are created on their first login. Existing local users are refused:
+// an administrator removes them first, as for single sign-on.
+func (s *UserService) validateExternalLogin(email, password string) (*models.User, error) {
+	identity, err := s.authenticator.Authenticate(email, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := registerGroups(s.db, identity.Groups); err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUserByEmail(identity.Email)
+	if err == sql.ErrNoRows {
+		hashedPassword, err := crypto.HashPassword(generateRandomPassword() + generateRandomPassword())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := provisionUser(s.db, identity.Email, hashedPassword, identity.Groups, s.authenticator.AuthSource()); err != nil {
+			return nil, fmt.Errorf("failed to provision user: %w", err)
+		}
+
+		log.Printf("Provisioned %s user %s with groups %q", s.authenticator.AuthSource(), identity.Email, identity.Groups)
+		return s.GetUserByEmail(identity.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Enabled {
+		return nil, fmt.Errorf("user account is disabled")
+	}
+
+	if user.AuthSource == AuthSourceOIDC {
+		return nil, ErrSSOAccount
+	}
+	if user.AuthSource != s.authenticator.AuthSource() {
+		return nil, ErrLocalAccount
+	}
+
+	groups := user.Groups
+	if identity.SyncGroups {
+		groups = identity.Groups
+	}
+
+	if user.Groups != normalizeGroups(groups) {
+		_, err = s.db.Exec("UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE email = ?", user.Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		if err := replaceUserGroups(s.db, int64(user.ID), groups); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		user.Groups = normalizeGroups(groups)
 	}
 
 	return user, nil
 }
 
+// provisionUser creates a user signing in through an external authenticator
+// or identity provider
+func provisionUser(db *database.DB, email, hashedPassword, groupsStr, authSource string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRow(`
+		INSERT INTO users (email, password_hash, role, enabled, auth_source)
+		VALUES (?, ?, 'user', true, ?) RETURNING id
+	`, email, hashedPassword, authSource).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	if err := setUserGroups(tx, userID, groupsStr); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func generateRandomPassword() string {
 	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	var password strings.Builder
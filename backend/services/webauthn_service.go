@@ -0,0 +1,288 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/config"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/webauthn"
+)
+
+const (
+	webAuthnCeremonyRegister = "register"
+	webAuthnCeremonyLogin    = "login"
+
+	webAuthnChallengeTTL = 5 * time.Minute
+)
+
+// ErrWebAuthnFailed wraps every reason a security key response is rejected
+var ErrWebAuthnFailed = errors.New("security key verification failed")
+
+type WebAuthnService struct {
+	db *database.DB
+}
+
+func NewWebAuthnService(db *database.DB) *WebAuthnService {
+	return &WebAuthnService{db: db}
+}
+
+func (s *WebAuthnService) relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:   config.GetEnvConfig().WebAuthnRPID,
+		Name: MFAIssuer,
+	}
+}
+
+// BeginRegistration returns the options for navigator.credentials.create()
+func (s *WebAuthnService) BeginRegistration(user *models.User) (*webauthn.CreationOptions, error) {
+	existing, err := s.credentialIDs(user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.storeChallenge(user.Email, webAuthnCeremonyRegister, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// The user handle must not contain personal information, so use the row ID
+	userID := []byte(strconv.Itoa(user.ID))
+
+	return s.relyingParty().CreationOptions(challenge, userID, user.Email, existing), nil
+}
+
+// FinishRegistration verifies the browser's response and stores the new security key
+func (s *WebAuthnService) FinishRegistration(email, name string, resp *webauthn.CredentialResponse) (*models.WebAuthnCredential, error) {
+	challenge, err := s.takeChallenge(email, webAuthnCeremonyRegister, "")
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := s.relyingParty().VerifyRegistration(challenge, resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		count, err := s.CountCredentials(email)
+		if err != nil {
+			return nil, err
+		}
+		name = fmt.Sprintf("security key %d", count+1)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO webauthn_credentials (user_email, credential_id, public_key, sign_count, name)
+		VALUES (?, ?, ?, ?, ?)
+	`, email, webauthn.Encode(cred.ID), cred.PublicKey, cred.SignCount, name)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, fmt.Errorf("this security key is already registered")
+		}
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnCredential{
+		ID:        int(id),
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (s *WebAuthnService) ListCredentials(email string) ([]models.WebAuthnCredential, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, created_at, last_used_at
+		FROM webauthn_credentials WHERE user_email = ? ORDER BY id
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		var cred models.WebAuthnCredential
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&cred.ID, &cred.Name, &cred.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			cred.LastUsedAt = &lastUsedAt.Time
+		}
+		credentials = append(credentials, cred)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (s *WebAuthnService) CountCredentials(email string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM webauthn_credentials WHERE user_email = ?
+	`, email).Scan(&count)
+	return count, err
+}
+
+func (s *WebAuthnService) DeleteCredential(email string, id int) error {
+	result, err := s.db.Exec(`
+		DELETE FROM webauthn_credentials WHERE id = ? AND user_email = ?
+	`, id, email)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("security key not found")
+	}
+
+	return nil
+}
+
+func (s *WebAuthnService) DeleteAllCredentials(email string) error {
+	_, err := s.db.Exec("DELETE FROM webauthn_credentials WHERE user_email = ?", email)
+	return err
+}
+
+// BeginLogin returns the options for navigator.credentials.get() during the
+// second step of a login identified by its MFA challenge token
+func (s *WebAuthnService) BeginLogin(email, mfaToken string) (*webauthn.RequestOptions, error) {
+	allowed, err := s.credentialIDs(email)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("no security keys are registered for this account")
+	}
+
+	challenge, err := s.storeChallenge(email, webAuthnCeremonyLogin, auth.HashToken(mfaToken))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.relyingParty().RequestOptions(challenge, allowed), nil
+}
+
+// FinishLogin verifies a security key assertion for the login identified by mfaToken
+func (s *WebAuthnService) FinishLogin(email, mfaToken string, resp *webauthn.CredentialResponse) error {
+	challenge, err := s.takeChallenge(email, webAuthnCeremonyLogin, auth.HashToken(mfaToken))
+	if err != nil {
+		return err
+	}
+
+	rawID, err := webauthn.Decode(resp.RawID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid credential ID", ErrWebAuthnFailed)
+	}
+
+	var id int
+	cred := &webauthn.Credential{ID: rawID}
+	err = s.db.QueryRow(`
+		SELECT id, public_key, sign_count FROM webauthn_credentials
+		WHERE credential_id = ? AND user_email = ?
+	`, webauthn.Encode(rawID), email).Scan(&id, &cred.PublicKey, &cred.SignCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: unknown security key", ErrWebAuthnFailed)
+		}
+		return err
+	}
+
+	signCount, err := s.relyingParty().VerifyAssertion(challenge, cred, resp)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?
+	`, signCount, time.Now().UTC(), id)
+
+	return err
+}
+
+func (s *WebAuthnService) credentialIDs(email string) ([][]byte, error) {
+	rows, err := s.db.Query(`
+		SELECT credential_id FROM webauthn_credentials WHERE user_email = ?
+	`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids [][]byte
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		id, err := webauthn.Decode(encoded)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// storeChallenge replaces any outstanding challenge for the same ceremony
+func (s *WebAuthnService) storeChallenge(email, ceremony, mfaTokenHash string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.Exec(`
+		DELETE FROM webauthn_challenges
+		WHERE (user_email = ? AND ceremony = ? AND mfa_token_hash = ?) OR expires_at <= ?
+	`, email, ceremony, mfaTokenHash, now)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO webauthn_challenges (user_email, ceremony, challenge, mfa_token_hash, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, email, ceremony, webauthn.Encode(challenge), mfaTokenHash, now.Add(webAuthnChallengeTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// takeChallenge returns an outstanding challenge and removes it, so each can be answered once
+func (s *WebAuthnService) takeChallenge(email, ceremony, mfaTokenHash string) ([]byte, error) {
+	var id int
+	var encoded string
+	err := s.db.QueryRow(`
+		SELECT id, challenge FROM webauthn_challenges
+		WHERE user_email = ? AND ceremony = ? AND mfa_token_hash = ? AND expires_at > ?
+		ORDER BY id DESC LIMIT 1
+	`, email, ceremony, mfaTokenHash, time.Now().UTC()).Scan(&id, &encoded)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: no security key request in progress, please try again", ErrWebAuthnFailed)
+		}
+		return nil, err
+	}
+
+	if _, err := s.db.Exec("DELETE FROM webauthn_challenges WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+
+	return webauthn.Decode(encoded)
+}
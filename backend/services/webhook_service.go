@@ -0,0 +1,487 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/steve/pman/backend/database"
+	"github.com/steve/pman/shared/crypto"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/permissions"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+// Statuses of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// maxWebhookDeliveries is how many deliveries are kept per webhook
+const maxWebhookDeliveries = 100
+
+// webhookRetryDelays are the waits before each retry of a failed delivery
+var webhookRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+// maxConcurrentDeliveries is how many requests the delivery worker has in
+// flight at once, and webhookBatchSize how many due deliveries it picks up
+// per run
+const (
+	maxConcurrentDeliveries = 4
+	webhookBatchSize        = 100
+)
+
+// webhookEvents lists the events webhooks can subscribe to
+var webhookEvents = []string{
+	models.EventPasswordCreated, models.EventPasswordUpdated, models.EventPasswordDeleted,
+	models.EventUserCreated, models.EventUserUpdated, models.EventUserDeleted,
+	models.EventUserEnabled, models.EventUserDisabled,
+}
+
+// WebhookService sends events to the webhooks admins configure. Deliveries
+// are queued in webhook_deliveries, where they also serve as the log, and
+// made by RunDeliveries, which retries them with webhookRetryDelays; pending
+// deliveries survive restarts. Each request is signed with the webhook's
+// secret: X-Pman-Signature holds "t=" and the Unix time of the attempt, then
+// "sha256=" and the hex HMAC-SHA256 of the time, a dot and the body, so
+// receivers can reject replayed requests.
+type WebhookService struct {
+	db     *database.DB
+	client *http.Client
+}
+
+func NewWebhookService(db *database.DB) *WebhookService {
+	return &WebhookService{db: db, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// ListWebhooks returns every webhook, without their secrets
+func (s *WebhookService) ListWebhooks() ([]models.Webhook, error) {
+	rows, err := s.db.Query(`
+		SELECT id, url, events, group_name, path_prefix, created_by, created_at
+		FROM webhooks ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		var webhook models.Webhook
+		err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Events, &webhook.Group, &webhook.PathPrefix,
+			&webhook.CreatedBy, &webhook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// CreateWebhook adds a webhook. Without a secret one is generated; either way
+// the returned webhook is the only place it is shown.
+func (s *WebhookService) CreateWebhook(req models.WebhookRequest, createdBy string) (*models.Webhook, error) {
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: URL must start with http:// or https://", ErrInvalidWebhook)
+	}
+
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = randomToken(32); err != nil {
+			return nil, err
+		}
+	}
+	encryptedSecret, err := crypto.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt webhook secret: %w", err)
+	}
+
+	webhook := models.Webhook{
+		URL:        target.String(),
+		Secret:     secret,
+		Events:     events,
+		Group:      strings.TrimSpace(req.Group),
+		PathPrefix: permissions.NormalizePathPrefix(req.PathPrefix),
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now().UTC(),
+	}
+	err = s.db.QueryRow(`
+		INSERT INTO webhooks (url, secret, events, group_name, path_prefix, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`, webhook.URL, encryptedSecret, webhook.Events, webhook.Group, webhook.PathPrefix, webhook.CreatedBy, webhook.CreatedAt).Scan(&webhook.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (s *WebhookService) DeleteWebhook(id int) error {
+	result, err := s.db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries of a webhook, newest first
+func (s *WebhookService) ListDeliveries(webhookID int) ([]models.WebhookDelivery, error) {
+	if _, err := s.getWebhook(webhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, webhook_id, event, payload, status, attempts, response_code, error, created_at, updated_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC
+	`, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &delivery.ResponseCode, &delivery.Error, &delivery.CreatedAt, &delivery.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Test sends a ping event to a webhook, whatever its filters, and waits for
+// the outcome of a single attempt
+func (s *WebhookService) Test(id int, actor string) (*models.WebhookDelivery, error) {
+	webhook, err := s.getWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	event := models.Event{Type: models.EventPing, Actor: actor, Time: time.Now().UTC()}
+	deliveryID, payload, err := s.queue(webhook, event, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.attempt(webhook, deliveryID, event.Type, payload, 1, true)
+
+	var delivery models.WebhookDelivery
+	err = s.db.QueryRow(`
+		SELECT id, webhook_id, event, payload, status, attempts, response_code, error, created_at, updated_at
+		FROM webhook_deliveries WHERE id = ?
+	`, deliveryID).Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+		&delivery.Attempts, &delivery.ResponseCode, &delivery.Error, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// Notify queues event for every webhook whose filters match it, for
+// RunDeliveries to deliver. Failures are logged rather than returned, so they
+// never undo the change that caused the event. A nil service does nothing.
+func (s *WebhookService) Notify(event models.Event) {
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	webhooks, err := s.matchingWebhooks(event)
+	if err != nil {
+		log.Printf("Webhooks: failed to find webhooks for %s: %v", event.Type, err)
+		return
+	}
+
+	due := time.Now().UTC()
+	for _, webhook := range webhooks {
+		if _, _, err := s.queue(webhook, event, &due); err != nil {
+			log.Printf("Webhooks: failed to queue %s for webhook %d: %v", event.Type, webhook.ID, err)
+		}
+	}
+}
+
+// RunDeliveries makes the queued deliveries that are due, checking every
+// tick. It never returns.
+func (s *WebhookService) RunDeliveries(tick time.Duration) {
+	for {
+		s.deliverDue()
+		time.Sleep(tick)
+	}
+}
+
+// deliverDue attempts the deliveries that are due, at most
+// maxConcurrentDeliveries at a time, and returns once every outcome is
+// recorded so the next run does not pick the same deliveries up again
+func (s *WebhookService) deliverDue() {
+	rows, err := s.db.Query(`
+		SELECT d.id, d.event, d.payload, d.attempts, w.id, w.url, w.secret
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at IS NOT NULL AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at LIMIT ?
+	`, DeliveryPending, time.Now().UTC(), webhookBatchSize)
+	if err != nil {
+		log.Printf("Webhooks: failed to find due deliveries: %v", err)
+		return
+	}
+
+	type dueDelivery struct {
+		webhook   webhookTarget
+		id        int
+		eventType string
+		payload   string
+		attempts  int
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.eventType, &d.payload, &d.attempts, &d.webhook.ID, &d.webhook.URL, &d.webhook.Secret); err != nil {
+			log.Printf("Webhooks: failed to find due deliveries: %v", err)
+			break
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	slots := make(chan struct{}, maxConcurrentDeliveries)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			attempt := d.attempts + 1
+			s.attempt(d.webhook, d.id, d.eventType, []byte(d.payload), attempt, attempt > len(webhookRetryDelays))
+		}()
+	}
+	wg.Wait()
+}
+
+// webhookTarget is what delivering to a webhook needs
+type webhookTarget struct {
+	ID         int
+	URL        string
+	Secret     string
+	Events     string
+	Group      string
+	PathPrefix string
+}
+
+func (s *WebhookService) getWebhook(id int) (webhookTarget, error) {
+	var webhook webhookTarget
+	err := s.db.QueryRow(`
+		SELECT id, url, secret, events, group_name, path_prefix FROM webhooks WHERE id = ?
+	`, id).Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.Group, &webhook.PathPrefix)
+	if err == sql.ErrNoRows {
+		return webhook, ErrWebhookNotFound
+	}
+	return webhook, err
+}
+
+func (s *WebhookService) matchingWebhooks(event models.Event) ([]webhookTarget, error) {
+	rows, err := s.db.Query(`SELECT id, url, secret, events, group_name, path_prefix FROM webhooks`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []webhookTarget
+	for rows.Next() {
+		var webhook webhookTarget
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.Group, &webhook.PathPrefix); err != nil {
+			return nil, err
+		}
+		if webhookMatches(webhook.Events, webhook.Group, webhook.PathPrefix, event) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	return webhooks, rows.Err()
+}
+
+// webhookMatches applies a webhook's filters to an event. A group or path
+// filter leaves out events without a group or path, such as user events.
+func webhookMatches(events, group, pathPrefix string, event models.Event) bool {
+	if group != "" && event.Group != group {
+		return false
+	}
+	if pathPrefix != "" && (event.Path == "" || !permissions.HasPathAccess([]string{pathPrefix}, event.Path)) {
+		return false
+	}
+
+	for _, filter := range strings.Split(events, ",") {
+		if filter == "*" || filter == event.Type {
+			return true
+		}
+		if family, ok := strings.CutSuffix(filter, ".*"); ok && strings.HasPrefix(event.Type, family+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWebhookEvents checks a comma-separated event filter; empty means
+// every event
+func normalizeWebhookEvents(events string) (string, error) {
+	var filters []string
+	for _, filter := range strings.Split(events, ",") {
+		if filter = strings.TrimSpace(filter); filter == "" {
+			continue
+		}
+
+		known := filter == "*"
+		for _, event := range webhookEvents {
+			if filter == event || filter == event[:strings.Index(event, ".")]+".*" {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "", fmt.Errorf("%w: unknown event '%s' (must be '*', 'password.*', 'user.*' or one of %s)",
+				ErrInvalidWebhook, filter, strings.Join(webhookEvents, ", "))
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 0 {
+		return "*", nil
+	}
+	return strings.Join(filters, ","), nil
+}
+
+// queue logs a pending delivery of event to webhook, dropping the oldest
+// deliveries beyond maxWebhookDeliveries. RunDeliveries makes it from
+// nextAttemptAt; without one the caller attempts it.
+func (s *WebhookService) queue(webhook webhookTarget, event models.Event, nextAttemptAt *time.Time) (int, []byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	now := time.Now().UTC()
+	var deliveryID int
+	err = s.db.QueryRow(`
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id
+	`, webhook.ID, event.Type, string(payload), DeliveryPending, nextAttemptAt, now, now).Scan(&deliveryID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = s.db.Exec(`
+		DELETE FROM webhook_deliveries WHERE webhook_id = ? AND id <= (
+			SELECT id FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?)
+	`, webhook.ID, webhook.ID, maxWebhookDeliveries)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return deliveryID, payload, nil
+}
+
+// attempt posts payload to the webhook once and records the outcome: the
+// next attempt after a failure, or a delivery that failed for good when the
+// last attempt does not succeed
+func (s *WebhookService) attempt(webhook webhookTarget, deliveryID int, eventType string, payload []byte, attempt int, last bool) bool {
+	responseCode, err := s.post(webhook, deliveryID, eventType, payload)
+
+	now := time.Now().UTC()
+	status, errorMessage := DeliveryDelivered, ""
+	var nextAttemptAt *time.Time
+	if err != nil {
+		status, errorMessage = DeliveryFailed, err.Error()
+		if !last {
+			status = DeliveryPending
+			next := now.Add(webhookRetryDelays[attempt-1])
+			nextAttemptAt = &next
+		}
+	}
+
+	_, dbErr := s.db.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?
+	`, status, attempt, responseCode, errorMessage, nextAttemptAt, now, deliveryID)
+	if dbErr != nil {
+		log.Printf("Webhooks: failed to record delivery %d: %v", deliveryID, dbErr)
+	}
+	if status == DeliveryFailed {
+		log.Printf("Webhooks: delivery %d of %s to webhook %d failed after %d attempts: %s", deliveryID, eventType, webhook.ID, attempt, errorMessage)
+	}
+
+	return err == nil
+}
+
+func (s *WebhookService) post(webhook webhookTarget, deliveryID int, eventType string, payload []byte) (int, error) {
+	secret, err := crypto.Decrypt(webhook.Secret)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt webhook secret: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pman-webhook")
+	req.Header.Set("X-Pman-Event", eventType)
+	req.Header.Set("X-Pman-Delivery", strconv.Itoa(deliveryID))
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Pman-Signature", fmt.Sprintf("t=%d,sha256=%s", timestamp, SignWebhookPayload(secret, timestamp, payload)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of the timestamp, a dot and
+// payload that receivers compare with the X-Pman-Signature header
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
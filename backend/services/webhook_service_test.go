@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func TestWebhooks(t *testing.T) {
+	db := newTestDB(t)
+
+	retryDelays := webhookRetryDelays
+	webhookRetryDelays = []time.Duration{10 * time.Millisecond}
+	defer func() { webhookRetryDelays = retryDelays }()
+
+	// The receiver fails every first attempt and records what it accepts
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+		received []models.Event
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var timestamp int64
+		var signature string
+		if _, err := fmt.Sscanf(r.Header.Get("X-Pman-Signature"), "t=%d,sha256=%s", &timestamp, &signature); err != nil ||
+			signature != SignWebhookPayload("s3cret", timestamp, body) || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		delivery := r.Header.Get("X-Pman-Delivery")
+		if attempts[delivery]++; attempts[delivery] == 1 {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		var event models.Event
+		json.Unmarshal(body, &event)
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	webhooks := NewWebhookService(db)
+	if _, err := webhooks.CreateWebhook(models.WebhookRequest{URL: "ftp://example.com"}, "admin"); !errors.Is(err, ErrInvalidWebhook) {
+		t.Errorf("CreateWebhook(ftp) error = %v, want ErrInvalidWebhook", err)
+	}
+	if _, err := webhooks.CreateWebhook(models.WebhookRequest{URL: server.URL, Events: "password.read"}, "admin"); !errors.Is(err, ErrInvalidWebhook) {
+		t.Errorf("CreateWebhook(unknown event) error = %v, want ErrInvalidWebhook", err)
+	}
+
+	webhook, err := webhooks.CreateWebhook(models.WebhookRequest{
+		URL: server.URL, Secret: "s3cret", Events: "password.*", Group: "team1", PathPrefix: "prod/*",
+	}, "admin")
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	if list, err := webhooks.ListWebhooks(); err != nil || len(list) != 1 || list[0].Secret != "" || list[0].PathPrefix != "prod" {
+		t.Errorf("ListWebhooks() = %+v, %v, want one webhook without its secret", list, err)
+	}
+	userHook, err := webhooks.CreateWebhook(models.WebhookRequest{URL: server.URL, Secret: "s3cret", Events: "user.*"}, "admin")
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+
+	// Only the first change matches the webhook's filters
+	passwords := &PasswordService{db: db, webhooks: webhooks}
+	users := &UserService{db: db, webhooks: webhooks}
+	for _, change := range []struct{ group, path string }{{"team1", "prod/db"}, {"team1", "dev/db"}, {"team2", "prod/db"}} {
+		if err := passwords.CreatePassword(change.path, "secret", change.group, "lead@example.com", "team1:rw,team2:rw"); err != nil {
+			t.Fatalf("CreatePassword(%s:%s) error = %v", change.group, change.path, err)
+		}
+	}
+	if _, err := users.CreateUser("new@example.com", "user", "", "admin@example.com"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// Deliveries wait in the queue for the worker, which retries the failed
+	// first attempts once they are due again
+	deliveries, err := webhooks.ListDeliveries(webhook.ID)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != DeliveryPending || deliveries[0].Attempts != 0 {
+		t.Fatalf("ListDeliveries(queued) = %+v, %v, want one pending delivery", deliveries, err)
+	}
+	webhooks.deliverDue()
+	if deliveries, _ = webhooks.ListDeliveries(webhook.ID); deliveries[0].Status != DeliveryPending || deliveries[0].Attempts != 1 {
+		t.Fatalf("ListDeliveries(after failed attempt) = %+v, want a pending retry", deliveries)
+	}
+	time.Sleep(20 * time.Millisecond)
+	webhooks.deliverDue()
+	for _, id := range []int{webhook.ID, userHook.ID} {
+		deliveries, err = webhooks.ListDeliveries(id)
+		if err != nil || len(deliveries) != 1 || deliveries[0].Status != DeliveryDelivered || deliveries[0].Attempts != 2 || deliveries[0].ResponseCode != 200 {
+			t.Fatalf("ListDeliveries(%d) = %+v, %v, want one delivery made on the second attempt", id, deliveries, err)
+		}
+	}
+
+	mu.Lock()
+	sort.Slice(received, func(i, j int) bool { return received[i].Type < received[j].Type })
+	if len(received) != 2 || received[0].Type != models.EventPasswordCreated || received[0].Path != "prod/db" || received[0].Actor != "lead@example.com" {
+		t.Errorf("received %+v, want password.created of prod/db", received)
+	} else if received[1].Type != models.EventUserCreated || received[1].User != "new@example.com" || received[1].Actor != "admin@example.com" {
+		t.Errorf("received %+v, want user.created of new@example.com by admin@example.com", received[1])
+	}
+	mu.Unlock()
+
+	// Tests ignore the filters and make a single attempt, which fails here
+	delivery, err := webhooks.Test(webhook.ID, "admin")
+	if err != nil {
+		t.Fatalf("Test() error = %v", err)
+	}
+	if delivery.Event != models.EventPing || delivery.Status != DeliveryFailed || delivery.ResponseCode != 500 {
+		t.Errorf("Test() = %+v, want failed ping", delivery)
+	}
+
+	if err := webhooks.DeleteWebhook(webhook.ID); err != nil {
+		t.Errorf("DeleteWebhook() error = %v", err)
+	}
+	if _, err := webhooks.ListDeliveries(webhook.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("ListDeliveries(deleted) error = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func TestWebhookMatches(t *testing.T) {
+	secret := models.Event{Type: models.EventPasswordUpdated, Group: "team1", Path: "prod/db"}
+	user := models.Event{Type: models.EventUserCreated, User: "new@example.com"}
+
+	tests := []struct {
+		events, group, pathPrefix string
+		event                     models.Event
+		want                      bool
+	}{
+		{"*", "", "", secret, true},
+		{"*", "", "", user, true},
+		{"password.*", "", "", secret, true},
+		{"password.*", "", "", user, false},
+		{"user.created,password.deleted", "", "", user, true},
+		{"user.created,password.deleted", "", "", secret, false},
+		{"*", "team1", "", secret, true},
+		{"*", "team2", "", secret, false},
+		{"*", "team1", "", user, false},
+		{"*", "", "prod", secret, true},
+		{"*", "", "pro", secret, false},
+		{"*", "", "prod", user, false},
+	}
+
+	for _, tt := range tests {
+		if got := webhookMatches(tt.events, tt.group, tt.pathPrefix, tt.event); got != tt.want {
+			t.Errorf("webhookMatches(%q, %q, %q, %s) = %v, want %v", tt.events, tt.group, tt.pathPrefix, tt.event.Type, got, tt.want)
+		}
+	}
+}
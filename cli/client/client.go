@@ -1,20 +1,34 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/webauthn"
 )
 
 type Client struct {
-	BaseURL string
-	Token   string
-	client  *http.Client
+	BaseURL      string
+	Token        string
+	RefreshToken string
+	// OnTokenRefresh is called after the tokens were rotated so they can be persisted
+	OnTokenRefresh func(token, refreshToken string) error
+	// SavedRefreshToken returns the refresh token last persisted, which another
+	// process sharing the login may have rotated since this client read it
+	SavedRefreshToken func() (string, error)
+	client            *http.Client
 }
 
 func NewClient(baseURL, token string) *Client {
@@ -27,14 +41,71 @@ func NewClient(baseURL, token string) *Client {
 	}
 }
 
+// ConfigureTLS applies a profile's TLS settings: an extra CA certificate to trust
+// (e.g. an internal CA for a staging server) and optionally skipping verification
+func (c *Client) ConfigureTLS(caCertPath string, insecureSkipVerify bool) error {
+	if caCertPath == "" && !insecureSkipVerify {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+
+	if caCertPath != "" {
+		caCert, err := os.ReadFile(caCertPath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("no valid certificates found in %s", caCertPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	c.client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return nil
+}
+
 func (c *Client) makeRequest(method, endpoint string, body interface{}) (*http.Response, error) {
-	var reqBody io.Reader
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, err
 		}
-		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	resp, err := c.doRequest(method, endpoint, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Access tokens are short-lived: refresh once and retry transparently
+	if resp.StatusCode == http.StatusUnauthorized && c.RefreshToken != "" && !isTokenEndpoint(endpoint) {
+		resp.Body.Close()
+
+		if err := c.refresh(); err != nil {
+			return nil, fmt.Errorf("session expired, please run 'pman login' again (%v)", err)
+		}
+
+		return c.doRequest(method, endpoint, jsonData)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) doRequest(method, endpoint string, jsonData []byte) (*http.Response, error) {
+	var reqBody io.Reader
+	if jsonData != nil {
+		reqBody = bytes.NewReader(jsonData)
 	}
 
 	url := c.BaseURL + "/api/v1" + endpoint
@@ -51,14 +122,134 @@ func (c *Client) makeRequest(method, endpoint string, body interface{}) (*http.R
 	return c.client.Do(req)
 }
 
+func isTokenEndpoint(endpoint string) bool {
+	return endpoint == "/auth/login" || endpoint == "/auth/refresh" || endpoint == "/auth/oidc/login"
+}
+
+func (c *Client) refresh() error {
+	// Presenting a token another process already exchanged would end the session
+	if c.SavedRefreshToken != nil {
+		if saved, err := c.SavedRefreshToken(); err == nil && saved != "" {
+			c.RefreshToken = saved
+		}
+	}
+
+	jsonData, err := json.Marshal(models.RefreshRequest{RefreshToken: c.RefreshToken})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.doRequest("POST", "/auth/refresh", jsonData)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("refresh failed: %s", string(body))
+	}
+
+	var refreshResp models.LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&refreshResp); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	c.Token = refreshResp.Token
+	c.RefreshToken = refreshResp.RefreshToken
+
+	if c.OnTokenRefresh != nil {
+		return c.OnTokenRefresh(c.Token, c.RefreshToken)
+	}
+
+	return nil
+}
+
 func (c *Client) Login(email, password string, expireDays int) (*models.LoginResponse, error) {
+	hostname, _ := os.Hostname()
 	loginReq := models.LoginRequest{
-		Email:      email,
-		Password:   password,
-		ExpireDays: expireDays,
+		Email:          email,
+		Password:       password,
+		ExpireDays:     expireDays,
+		ClientHostname: hostname,
+	}
+
+	return c.login(loginReq)
+}
+
+// LoginMFA completes a login that returned MFARequired
+func (c *Client) LoginMFA(mfaToken, code string) (*models.LoginResponse, error) {
+	return c.login(models.LoginRequest{MFAToken: mfaToken, MFACode: code})
+}
+
+// LoginWebAuthn completes a login that returned MFARequired with a security key assertion
+func (c *Client) LoginWebAuthn(mfaToken string, credential *webauthn.CredentialResponse) (*models.LoginResponse, error) {
+	return c.login(models.LoginRequest{MFAToken: mfaToken, WebAuthn: credential})
+}
+
+// BeginWebAuthnLogin returns the publicKey options for navigator.credentials.get()
+func (c *Client) BeginWebAuthnLogin(mfaToken string) (json.RawMessage, error) {
+	return c.webAuthnOptions("/auth/webauthn/login/begin", models.WebAuthnLoginBeginRequest{MFAToken: mfaToken}, "security key login failed")
+}
+
+// GetOIDCConfig returns the identity provider details for single sign-on
+func (c *Client) GetOIDCConfig() (*models.OIDCConfig, error) {
+	resp, err := c.makeRequest("GET", "/auth/oidc/config", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("single sign-on unavailable: %s", string(body))
+	}
+
+	var oidcConfig models.OIDCConfig
+	if err := json.NewDecoder(resp.Body).Decode(&oidcConfig); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &oidcConfig, nil
+}
+
+// Setup creates the first admin of a new server with the setup token from its log
+func (c *Client) Setup(req models.SetupRequest) error {
+	resp, err := c.makeRequest("POST", "/setup", req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.New(errorMessage(body))
+	}
+
+	return nil
+}
+
+// LoginOIDC exchanges an ID token from the identity provider for a pman
+// session. Tokens from the device flow have no nonce.
+func (c *Client) LoginOIDC(idToken, nonce string, expireDays int) (*models.LoginResponse, error) {
+	hostname, _ := os.Hostname()
+	loginReq := models.OIDCLoginRequest{
+		IDToken:        idToken,
+		Nonce:          nonce,
+		Device:         nonce == "",
+		ExpireDays:     expireDays,
+		ClientHostname: hostname,
 	}
 
-	resp, err := c.makeRequest("POST", "/auth/login", loginReq)
+	return c.loginAt("/auth/oidc/login", loginReq)
+}
+
+func (c *Client) login(loginReq models.LoginRequest) (*models.LoginResponse, error) {
+	return c.loginAt("/auth/login", loginReq)
+}
+
+func (c *Client) loginAt(endpoint string, loginReq interface{}) (*models.LoginResponse, error) {
+	resp, err := c.makeRequest("POST", endpoint, loginReq)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %v", err)
 	}
@@ -77,6 +268,79 @@ func (c *Client) Login(email, password string, expireDays int) (*models.LoginRes
 	return &loginResp, nil
 }
 
+// Logout revokes the current session on the server
+func (c *Client) Logout() error {
+	resp, err := c.doRequest("POST", "/auth/logout", nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("logout failed: %s", string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) ListSessions() ([]models.Session, error) {
+	return c.listSessions("/auth/sessions")
+}
+
+func (c *Client) AdminListSessions(email string) ([]models.Session, error) {
+	return c.listSessions(fmt.Sprintf("/admin/users/%s/sessions", email))
+}
+
+func (c *Client) listSessions(endpoint string) ([]models.Session, error) {
+	resp, err := c.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list sessions failed: %s", string(body))
+	}
+
+	var result struct {
+		Sessions []models.Session `json:"sessions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Sessions, nil
+}
+
+func (c *Client) RevokeSession(sessionID string) error {
+	return c.revokeSessions(fmt.Sprintf("/auth/sessions/%s", sessionID))
+}
+
+func (c *Client) AdminRevokeSession(email, sessionID string) error {
+	return c.revokeSessions(fmt.Sprintf("/admin/users/%s/sessions/%s", email, sessionID))
+}
+
+func (c *Client) AdminRevokeAllSessions(email string) error {
+	return c.revokeSessions(fmt.Sprintf("/admin/users/%s/sessions", email))
+}
+
+func (c *Client) revokeSessions(endpoint string) error {
+	resp, err := c.makeRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("revoke session failed: %s", string(body))
+	}
+
+	return nil
+}
+
 func (c *Client) CheckHealth() error {
 	resp, err := c.makeRequest("GET", "/health", nil)
 	if err != nil {
@@ -114,24 +378,47 @@ func (c *Client) CreatePassword(path, value, group string) error {
 }
 
 func (c *Client) GetPassword(path, group string) (string, error) {
-	endpoint := fmt.Sprintf("/passwords/%s/%s", group, path)
+	result, err := c.GetPasswordValue(path, group)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Value, nil
+}
+
+// GetPasswordValue returns the password together with the group's offline cache policy
+func (c *Client) GetPasswordValue(path, group string) (*models.PasswordValue, error) {
+	return c.getPasswordValue(fmt.Sprintf("/passwords/%s/%s", group, path))
+}
+
+// GetPasswordVersion returns an earlier value of the password
+func (c *Client) GetPasswordVersion(path, group string, version int) (string, error) {
+	result, err := c.getPasswordValue(fmt.Sprintf("/passwords/%s/%s?version=%d", group, path, version))
+	if err != nil {
+		return "", err
+	}
+
+	return result.Value, nil
+}
+
+func (c *Client) getPasswordValue(endpoint string) (*models.PasswordValue, error) {
 	resp, err := c.makeRequest("GET", endpoint, nil)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %v", err)
+		return nil, fmt.Errorf("request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("get password failed: %s", string(body))
+		return nil, fmt.Errorf("get password failed: %s", string(body))
 	}
 
-	var result map[string]string
+	var result models.PasswordValue
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	return result["value"], nil
+	return &result, nil
 }
 
 func (c *Client) ListPasswords(group, pathPrefix string) ([]string, error) {
@@ -387,6 +674,53 @@ func (c *Client) DisableUser(email string) error {
 	return nil
 }
 
+// UnlockUser lifts a lockout after too many failed logins to the account
+func (c *Client) UnlockUser(email string) error {
+	return c.unlock(fmt.Sprintf("/admin/users/%s/unlock", email))
+}
+
+// UnlockIP lifts a lockout after too many failed logins from a client address
+func (c *Client) UnlockIP(ip string) error {
+	return c.unlock(fmt.Sprintf("/admin/lockouts/ip/%s/unlock", ip))
+}
+
+func (c *Client) unlock(endpoint string) error {
+	resp, err := c.makeRequest("POST", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unlock failed: %s", string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) ListLockouts() (*models.LockoutStatus, error) {
+	resp, err := c.makeRequest("GET", "/admin/lockouts", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list lockouts failed: %s", string(body))
+	}
+
+	var status models.LockoutStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &status, nil
+}
+
+// ChangePassword changes the caller's password. The access token is refreshed
+// afterwards, since a token issued for an expired password is restricted.
 func (c *Client) ChangePassword(currentPassword, newPassword string) error {
 	req := map[string]string{
 		"current_password": currentPassword,
@@ -401,7 +735,13 @@ func (c *Client) ChangePassword(currentPassword, newPassword string) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("change password failed: %s", string(body))
+		return errors.New(errorMessage(body))
+	}
+
+	if c.RefreshToken != "" {
+		if err := c.refresh(); err != nil {
+			return fmt.Errorf("password changed, but the session could not be refreshed (log in again): %v", err)
+		}
 	}
 
 	return nil
@@ -421,7 +761,1028 @@ func (c *Client) AdminChangePassword(email, newPassword string) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("admin change password failed: %s", string(body))
+		return errors.New(errorMessage(body))
+	}
+
+	return nil
+}
+
+// GetPasswordPolicy returns the password policy; any user may read it
+func (c *Client) GetPasswordPolicy() (*models.PasswordPolicy, error) {
+	return c.passwordPolicyRequest("GET", "/auth/passwd/policy", nil)
+}
+
+func (c *Client) SetPasswordPolicy(policy models.PasswordPolicy) (*models.PasswordPolicy, error) {
+	return c.passwordPolicyRequest("PUT", "/admin/password/policy", policy)
+}
+
+func (c *Client) passwordPolicyRequest(method, endpoint string, body interface{}) (*models.PasswordPolicy, error) {
+	resp, err := c.makeRequest(method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("password policy request failed: %s", errorMessage(body))
+	}
+
+	var policy models.PasswordPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// errorMessage extracts the message from a {"error": ...} response body
+func errorMessage(body []byte) string {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		return errResp.Error
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func (c *Client) SetGroupCachePolicy(group string, maxAgeHours int) error {
+	req := map[string]int{
+		"max_age_hours": maxAgeHours,
+	}
+
+	endpoint := fmt.Sprintf("/admin/groups/%s/cache", group)
+	resp, err := c.makeRequest("PUT", endpoint, req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("set group cache policy failed: %s", string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) ListGroups() ([]models.Group, error) {
+	resp, err := c.makeRequest("GET", "/admin/groups", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list groups failed: %s", errorMessage(body))
+	}
+
+	var result struct {
+		Groups []models.Group `json:"groups"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Groups, nil
+}
+
+func (c *Client) GetGroup(name string) (*models.Group, error) {
+	resp, err := c.makeRequest("GET", fmt.Sprintf("/admin/groups/%s", name), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var group models.Group
+	if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &group, nil
+}
+
+func (c *Client) CreateGroup(name, description string) error {
+	req := models.GroupRequest{Name: name, Description: description}
+	return c.groupRequest("POST", "/admin/groups", req)
+}
+
+func (c *Client) UpdateGroup(name, description string) error {
+	req := models.GroupRequest{Description: description}
+	return c.groupRequest("PUT", fmt.Sprintf("/admin/groups/%s", name), req)
+}
+
+func (c *Client) DeleteGroup(name string) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/admin/groups/%s", name), nil)
+}
+
+// Group member methods are available to admins and group owners
+
+func (c *Client) ListGroupMembers(group string) ([]models.GroupMember, error) {
+	resp, err := c.makeRequest("GET", fmt.Sprintf("/groups/%s/members", group), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Members []models.GroupMember `json:"members"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Members, nil
+}
+
+func (c *Client) SetGroupMember(group, email, permission string) error {
+	req := models.GroupMemberRequest{Permission: permission}
+	return c.groupRequest("PUT", fmt.Sprintf("/groups/%s/members/%s", group, email), req)
+}
+
+func (c *Client) RemoveGroupMember(group, email string) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/groups/%s/members/%s", group, email), nil)
+}
+
+// Path ACL methods are available to admins and group owners
+
+func (c *Client) ListPathACLs(group string) ([]models.PathACL, error) {
+	resp, err := c.makeRequest("GET", fmt.Sprintf("/groups/%s/acls", group), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		ACLs []models.PathACL `json:"acls"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.ACLs, nil
+}
+
+func (c *Client) SetPathACL(group string, req models.PathACLRequest) error {
+	return c.groupRequest("PUT", fmt.Sprintf("/groups/%s/acls", group), req)
+}
+
+func (c *Client) DeletePathACL(group string, id int) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/groups/%s/acls/%d", group, id), nil)
+}
+
+// Role methods (admin only)
+
+// ListRoles returns the roles and every capability the server knows
+func (c *Client) ListRoles() ([]models.Role, []string, error) {
+	resp, err := c.makeRequest("GET", "/admin/roles", nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Roles        []models.Role `json:"roles"`
+		Capabilities []string      `json:"capabilities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Roles, result.Capabilities, nil
+}
+
+func (c *Client) CreateRole(req models.RoleRequest) error {
+	return c.groupRequest("POST", "/admin/roles", req)
+}
+
+func (c *Client) UpdateRole(name string, req models.RoleRequest) error {
+	return c.groupRequest("PUT", fmt.Sprintf("/admin/roles/%s", name), req)
+}
+
+func (c *Client) DeleteRole(name string) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/admin/roles/%s", name), nil)
+}
+
+// ErrUnauthorized is returned by StreamEvents when the server refuses the
+// credentials and they cannot be refreshed, so reconnecting will not help
+var ErrUnauthorized = errors.New("no longer authorized")
+
+// StreamEvents calls onEvent for every change to secrets under prefix in
+// group that the server streams, until the stream ends. The server ends it
+// when the access token expires, returning nil so the caller can reconnect;
+// the token is then refreshed from the profile, which other processes of
+// the same login may have refreshed meanwhile.
+func (c *Client) StreamEvents(group, prefix string, onEvent func(models.Event)) error {
+	query := url.Values{"group": {group}, "prefix": {prefix}}
+	endpoint := "/events?" + query.Encode()
+
+	// The stream stays open, so it cannot use the client's timeout
+	streamClient := *c.client
+	streamClient.Timeout = 0
+	get := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", c.BaseURL+"/api/v1"+endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		return streamClient.Do(req)
+	}
+
+	resp, err := get()
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.RefreshToken != "" {
+		resp.Body.Close()
+		if err := c.refresh(); err != nil {
+			return fmt.Errorf("%w: session expired, please run 'pman login' again (%v)", ErrUnauthorized, err)
+		}
+		if resp, err = get(); err != nil {
+			return fmt.Errorf("request failed: %v", err)
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("%w: %s", ErrUnauthorized, errorMessage(body))
+		}
+		return errors.New(errorMessage(body))
+	}
+
+	// Events are "data:" lines ended by a blank line; lines starting with
+	// ":" are comments that keep the connection alive
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				var event models.Event
+				if err := json.Unmarshal([]byte(data.String()), &event); err == nil {
+					onEvent(event)
+				}
+				data.Reset()
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Webhook methods (admin)
+
+func (c *Client) ListWebhooks() ([]models.Webhook, error) {
+	resp, err := c.makeRequest("GET", "/admin/webhooks", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Webhooks []models.Webhook `json:"webhooks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Webhooks, nil
+}
+
+func (c *Client) CreateWebhook(req models.WebhookRequest) (*models.Webhook, error) {
+	resp, err := c.makeRequest("POST", "/admin/webhooks", req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.Webhook
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) DeleteWebhook(id int) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/admin/webhooks/%d", id), nil)
+}
+
+// TestWebhook sends a ping to a webhook and returns the outcome
+func (c *Client) TestWebhook(id int) (*models.WebhookDelivery, error) {
+	resp, err := c.makeRequest("POST", fmt.Sprintf("/admin/webhooks/%d/test", id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.WebhookDelivery
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ListWebhookDeliveries(id int) ([]models.WebhookDelivery, error) {
+	resp, err := c.makeRequest("GET", fmt.Sprintf("/admin/webhooks/%d/deliveries", id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Deliveries, nil
+}
+
+// Rotation methods
+
+func (c *Client) RotatePassword(path, group string) (*models.RotationResult, error) {
+	resp, err := c.makeRequest("POST", fmt.Sprintf("/passwords/%s/%s/rotate", group, path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.RotationResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ListRotations(group string) ([]models.Rotation, error) {
+	endpoint := "/admin/rotations"
+	if group != "" {
+		endpoint += "?group=" + url.QueryEscape(group)
+	}
+
+	resp, err := c.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Rotations []models.Rotation `json:"rotations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Rotations, nil
+}
+
+func (c *Client) SetRotation(path, group string, req models.RotationRequest) (*models.Rotation, error) {
+	resp, err := c.makeRequest("PUT", fmt.Sprintf("/admin/rotations/%s/%s", group, path), req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.Rotation
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) DeleteRotation(path, group string) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/admin/rotations/%s/%s", group, path), nil)
+}
+
+// Grant methods (group writers)
+
+func (c *Client) ListGrants(group string) ([]models.Grant, error) {
+	resp, err := c.makeRequest("GET", fmt.Sprintf("/groups/%s/grants", group), nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Grants []models.Grant `json:"grants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Grants, nil
+}
+
+func (c *Client) CreateGrant(group string, req models.GrantRequest) (*models.Grant, error) {
+	resp, err := c.makeRequest("POST", fmt.Sprintf("/groups/%s/grants", group), req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.Grant
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) RevokeGrant(group string, id int) error {
+	return c.groupRequest("DELETE", fmt.Sprintf("/groups/%s/grants/%d", group, id), nil)
+}
+
+// Share methods
+
+func (c *Client) CreateShare(req models.ShareRequest) (*models.ShareResponse, error) {
+	resp, err := c.makeRequest("POST", "/shares", req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.ShareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+// OpenShare reads a shared secret, using up one view of the link. It needs no login.
+func (c *Client) OpenShare(token string) (*models.SharedSecret, error) {
+	resp, err := c.makeRequest("GET", "/share/"+token, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.SharedSecret
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+// Approval methods
+
+// SetApprovalRequired marks a secret as requiring approval (group owners and admins)
+func (c *Client) SetApprovalRequired(path, group string, required bool) error {
+	req := map[string]bool{"required": required}
+	return c.groupRequest("PUT", fmt.Sprintf("/passwords/%s/%s/approval", group, path), req)
+}
+
+func (c *Client) CreateAccessRequest(req models.AccessRequestCreate) (int64, error) {
+	resp, err := c.makeRequest("POST", "/access-requests", req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.ID, nil
+}
+
+// ListAccessRequests returns the user's own requests and those they may
+// decide; only pending ones unless all is set
+func (c *Client) ListAccessRequests(all bool) ([]models.AccessRequest, error) {
+	endpoint := "/access-requests"
+	if all {
+		endpoint += "?all=true"
+	}
+	resp, err := c.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result struct {
+		Requests []models.AccessRequest `json:"requests"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Requests, nil
+}
+
+// DecideAccessRequest approves or denies a pending access request
+func (c *Client) DecideAccessRequest(id int64, approve bool, note string) (*models.AccessRequest, error) {
+	decision := "deny"
+	if approve {
+		decision = "approve"
+	}
+	endpoint := fmt.Sprintf("/access-requests/%d/%s", id, decision)
+	resp, err := c.makeRequest("POST", endpoint, models.AccessDecisionRequest{Note: note})
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(errorMessage(body))
+	}
+
+	var result models.AccessRequest
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) groupRequest(method, endpoint string, req interface{}) error {
+	resp, err := c.makeRequest(method, endpoint, req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.New(errorMessage(body))
+	}
+
+	return nil
+}
+
+// Service Account Methods (Admin Only)
+
+func (c *Client) CreateServiceAccount(req models.ServiceAccountRequest) (*models.APIKeyResponse, error) {
+	resp, err := c.makeRequest("POST", "/admin/service-accounts", req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("create service account failed: %s", string(body))
+	}
+
+	var result models.APIKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ListServiceAccounts() ([]models.ServiceAccount, error) {
+	resp, err := c.makeRequest("GET", "/admin/service-accounts", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list service accounts failed: %s", string(body))
+	}
+
+	var result struct {
+		ServiceAccounts []models.ServiceAccount `json:"service_accounts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.ServiceAccounts, nil
+}
+
+func (c *Client) DeleteServiceAccount(name string) error {
+	endpoint := fmt.Sprintf("/admin/service-accounts/%s", name)
+	resp, err := c.makeRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete service account failed: %s", string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) CreateAPIKey(name string, expireDays int) (*models.APIKeyResponse, error) {
+	req := map[string]int{
+		"expire_days": expireDays,
+	}
+
+	endpoint := fmt.Sprintf("/admin/service-accounts/%s/keys", name)
+	resp, err := c.makeRequest("POST", endpoint, req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("create API key failed: %s", string(body))
+	}
+
+	var result models.APIKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ListAPIKeys(name string) ([]models.APIKey, error) {
+	endpoint := fmt.Sprintf("/admin/service-accounts/%s/keys", name)
+	resp, err := c.makeRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list API keys failed: %s", string(body))
+	}
+
+	var result struct {
+		Keys []models.APIKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Keys, nil
+}
+
+func (c *Client) RevokeAPIKey(name string, keyID int) error {
+	endpoint := fmt.Sprintf("/admin/service-accounts/%s/keys/%d", name, keyID)
+	resp, err := c.makeRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("revoke API key failed: %s", string(body))
+	}
+
+	return nil
+}
+
+// MFA Methods
+
+func (c *Client) GetMFAStatus() (*models.MFAStatus, error) {
+	resp, err := c.makeRequest("GET", "/auth/mfa", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get MFA status failed: %s", string(body))
+	}
+
+	var status models.MFAStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &status, nil
+}
+
+func (c *Client) EnrollMFA() (*models.MFAEnrollResponse, error) {
+	resp, err := c.makeRequest("POST", "/auth/mfa/enroll", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("MFA enrolment failed: %s", string(body))
+	}
+
+	var enrollment models.MFAEnrollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&enrollment); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &enrollment, nil
+}
+
+// ConfirmMFA enables MFA and returns the recovery codes. The access token is
+// refreshed afterwards, since a token issued before enrolment may be restricted.
+func (c *Client) ConfirmMFA(code string) ([]string, error) {
+	codes, err := c.mfaCodeRequest("/auth/mfa/confirm", code, "MFA confirmation failed")
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RefreshToken != "" {
+		if err := c.refresh(); err != nil {
+			return codes, err
+		}
+	}
+
+	return codes, nil
+}
+
+func (c *Client) RegenerateRecoveryCodes(code string) ([]string, error) {
+	return c.mfaCodeRequest("/auth/mfa/recovery-codes", code, "regenerate recovery codes failed")
+}
+
+func (c *Client) mfaCodeRequest(endpoint, code, failure string) ([]string, error) {
+	resp, err := c.makeRequest("POST", endpoint, models.MFACodeRequest{Code: code})
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", failure, string(body))
+	}
+
+	var result models.RecoveryCodesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.RecoveryCodes, nil
+}
+
+func (c *Client) DisableMFA(code string) error {
+	resp, err := c.makeRequest("POST", "/auth/mfa/disable", models.MFACodeRequest{Code: code})
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("disable MFA failed: %s", string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) AdminResetMFA(email string) error {
+	endpoint := fmt.Sprintf("/admin/users/%s/mfa", email)
+	resp, err := c.makeRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("reset MFA failed: %s", string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) GetMFAPolicy() (*models.MFAPolicy, error) {
+	resp, err := c.makeRequest("GET", "/admin/mfa/policy", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("get MFA policy failed: %s", string(body))
+	}
+
+	var policy models.MFAPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &policy, nil
+}
+
+func (c *Client) SetMFAPolicy(policy models.MFAPolicy) (*models.MFAPolicy, error) {
+	resp, err := c.makeRequest("PUT", "/admin/mfa/policy", policy)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("set MFA policy failed: %s", string(body))
+	}
+
+	var result models.MFAPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return &result, nil
+}
+
+// Security Key (WebAuthn) Methods
+
+// BeginWebAuthnRegistration returns the publicKey options for navigator.credentials.create()
+func (c *Client) BeginWebAuthnRegistration() (json.RawMessage, error) {
+	return c.webAuthnOptions("/auth/webauthn/register/begin", nil, "security key registration failed")
+}
+
+func (c *Client) webAuthnOptions(endpoint string, body interface{}, failure string) (json.RawMessage, error) {
+	resp, err := c.makeRequest("POST", endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", failure, string(body))
+	}
+
+	var result struct {
+		PublicKey json.RawMessage `json:"publicKey"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.PublicKey, nil
+}
+
+// FinishWebAuthnRegistration stores a new security key. Like ConfirmMFA it
+// refreshes the access token, which may have been restricted to enrolment.
+func (c *Client) FinishWebAuthnRegistration(name string, credential *webauthn.CredentialResponse) (*models.WebAuthnCredential, error) {
+	req := models.WebAuthnRegisterRequest{Name: name, Credential: credential}
+	resp, err := c.makeRequest("POST", "/auth/webauthn/register/finish", req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("security key registration failed: %s", string(body))
+	}
+
+	var cred models.WebAuthnCredential
+	if err := json.NewDecoder(resp.Body).Decode(&cred); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if c.RefreshToken != "" {
+		if err := c.refresh(); err != nil {
+			return &cred, err
+		}
+	}
+
+	return &cred, nil
+}
+
+func (c *Client) ListWebAuthnCredentials() ([]models.WebAuthnCredential, error) {
+	resp, err := c.makeRequest("GET", "/auth/webauthn/credentials", nil)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list security keys failed: %s", string(body))
+	}
+
+	var result struct {
+		Credentials []models.WebAuthnCredential `json:"credentials"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return result.Credentials, nil
+}
+
+func (c *Client) DeleteWebAuthnCredential(id int) error {
+	endpoint := fmt.Sprintf("/auth/webauthn/credentials/%d", id)
+	resp, err := c.makeRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("remove security key failed: %s", string(body))
 	}
 
 	return nil
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func ACL(args []string) {
+	if len(args) == 0 {
+		showACLUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		ACLList(args[1:])
+	case "set":
+		ACLSet(args[1:])
+	case "rm", "remove", "del":
+		ACLRemove(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown acl command: %s\n", args[0])
+		showACLUsage()
+		os.Exit(1)
+	}
+}
+
+func showACLUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman acl ls <group>\n")
+	fmt.Fprintf(os.Stderr, "  pman acl set <group> <path> <email|'*'> <none|ro|rw|verbs>\n")
+	fmt.Fprintf(os.Stderr, "  pman acl rm <group> <id>\n")
+	fmt.Fprintf(os.Stderr, "Rules apply below a path ('prod/*' or 'prod'); the longest matching path wins.\n")
+	fmt.Fprintf(os.Stderr, "They only narrow the group permission: 'ro' keeps rw members from writing, 'none' hides the paths.\n")
+	fmt.Fprintf(os.Stderr, "Verbs joined with '+' from list, read, write and delete are accepted too, e.g. 'list'.\n")
+}
+
+func ACLList(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman acl ls <group>\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rules, err := client.ListPathACLs(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing path ACLs: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(rules) == 0 {
+		fmt.Printf("Group %s has no path ACLs\n", args[0])
+		return
+	}
+
+	fmt.Printf("%-6s %-30s %-30s %-6s %s\n", "ID", "PATH", "SUBJECT", "ACCESS", "SET BY")
+	fmt.Printf("%-6s %-30s %-30s %-6s %s\n", strings.Repeat("-", 6), strings.Repeat("-", 30), strings.Repeat("-", 30), strings.Repeat("-", 6), strings.Repeat("-", 20))
+	for _, rule := range rules {
+		path := rule.Path + "/*"
+		if rule.Path == "" {
+			path = "*"
+		}
+		fmt.Printf("%-6d %-30s %-30s %-6s %s\n", rule.ID, path, rule.Subject, rule.Permission, rule.CreatedBy)
+	}
+}
+
+func ACLSet(args []string) {
+	if len(args) != 4 {
+		fmt.Fprintf(os.Stderr, "Usage: pman acl set <group> <path> <email|'*'> <none|ro|rw|verbs>\n")
+		fmt.Fprintf(os.Stderr, "Example: pman acl set team1 'prod/*' contractor@company.com ro\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	req := models.PathACLRequest{Path: args[1], Subject: args[2], Permission: args[3]}
+	if err := client.SetPathACL(args[0], req); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting path ACL: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Path ACL set: %s:%s is %s for %s\n", args[0], args[1], args[3], args[2])
+}
+
+func ACLRemove(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman acl rm <group> <id>\n")
+		os.Exit(1)
+	}
+
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid path ACL ID: %s (see 'pman acl ls %s')\n", args[1], args[0])
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.DeletePathACL(args[0], id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing path ACL: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Path ACL %d removed\n", id)
+}
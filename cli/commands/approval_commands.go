@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+// Approval turns the approval requirement of a secret on or off
+func Approval(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("approval", flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Group name")
+	groupLongFlag := fs.String("group", "", "Group name")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 2 || (remainingArgs[1] != "on" && remainingArgs[1] != "off") {
+		fmt.Fprintf(os.Stderr, "Usage: pman approval <path> on|off [-g group]\n")
+		fmt.Fprintf(os.Stderr, "With approval on, reading the secret needs an access request approved by\n")
+		fmt.Fprintf(os.Stderr, "a group member with the approve permission (owners have it).\n")
+		os.Exit(1)
+	}
+
+	path := remainingArgs[0]
+	required := remainingArgs[1] == "on"
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	resolvedGroup, err := resolveGroup(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.SetApprovalRequired(path, resolvedGroup, required); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting approval requirement: %v\n", err)
+		os.Exit(1)
+	}
+
+	if required {
+		fmt.Printf("%s:%s now requires approval\n", resolvedGroup, path)
+	} else {
+		fmt.Printf("%s:%s no longer requires approval\n", resolvedGroup, path)
+	}
+}
+
+// Request asks for time-boxed access to a secret that requires approval
+func Request(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("request", flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Group name")
+	groupLongFlag := fs.String("group", "", "Group name")
+	reasonFlag := fs.String("reason", "", "Why access is needed")
+	forFlag := fs.String("for", "1h", "How long access is needed (e.g. 30m, 4h; at most 24h)")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 || strings.TrimSpace(*reasonFlag) == "" {
+		fmt.Fprintf(os.Stderr, "Usage: pman request <path> --reason <reason> [--for 1h] [-g group]\n")
+		fmt.Fprintf(os.Stderr, "Example: pman request prod/db --reason \"restore after incident 42\" --for 30m\n")
+		os.Exit(1)
+	}
+
+	duration, err := time.ParseDuration(*forFlag)
+	if err != nil || duration < time.Minute {
+		fmt.Fprintf(os.Stderr, "Invalid duration: %s (e.g. 30m or 4h)\n", *forFlag)
+		os.Exit(1)
+	}
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	resolvedGroup, err := resolveGroup(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	id, err := client.CreateAccessRequest(models.AccessRequestCreate{
+		Group:           resolvedGroup,
+		Path:            remainingArgs[0],
+		Reason:          *reasonFlag,
+		DurationMinutes: int(duration / time.Minute),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error requesting access: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Access request %d created for %s:%s\n", id, resolvedGroup, remainingArgs[0])
+	fmt.Printf("An approver can grant it with 'pman approve %d'\n", id)
+}
+
+// Requests lists the user's own access requests and those they may decide
+func Requests(args []string) {
+	fs := flag.NewFlagSet("requests", flag.ExitOnError)
+	allFlag := fs.Bool("all", false, "Include decided requests")
+
+	fs.Parse(args)
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	requests, err := client.ListAccessRequests(*allFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing access requests: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(requests) == 0 {
+		if *allFlag {
+			fmt.Println("No access requests")
+		} else {
+			fmt.Println("No pending access requests")
+		}
+		return
+	}
+
+	fmt.Printf("%-5s %-30s %-25s %-8s %-9s %s\n", "ID", "SECRET", "REQUESTER", "FOR", "STATUS", "REASON")
+	fmt.Printf("%-5s %-30s %-25s %-8s %-9s %s\n", strings.Repeat("-", 5), strings.Repeat("-", 30), strings.Repeat("-", 25), strings.Repeat("-", 8), strings.Repeat("-", 9), strings.Repeat("-", 20))
+	for _, request := range requests {
+		fmt.Printf("%-5d %-30s %-25s %-8s %-9s %s\n", request.ID, request.Group+":"+request.Path, request.Requester,
+			formatMinutes(request.DurationMinutes), request.Status, request.Reason)
+		if request.DecidedBy != "" {
+			decision := fmt.Sprintf("%s by %s at %s", request.Status, request.DecidedBy, request.DecidedAt.Local().Format("2006-01-02 15:04"))
+			if request.Status == models.AccessRequestApproved && request.ExpiresAt != nil {
+				decision += ", until " + request.ExpiresAt.Local().Format("2006-01-02 15:04")
+			}
+			if request.DecisionNote != "" {
+				decision += fmt.Sprintf(" (%s)", request.DecisionNote)
+			}
+			fmt.Printf("%-5s %s\n", "", decision)
+		}
+	}
+}
+
+// Decide approves or denies an access request
+func Decide(args []string, approve bool) {
+	command := "deny"
+	if approve {
+		command = "approve"
+	}
+
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	noteFlag := fs.String("note", "", "Note recorded with the decision")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman %s <id> [--note <note>]\n", command)
+		fmt.Fprintf(os.Stderr, "See 'pman requests' for pending requests.\n")
+		os.Exit(1)
+	}
+
+	id, err := strconv.ParseInt(remainingArgs[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid access request ID: %s (see 'pman requests')\n", remainingArgs[0])
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	request, err := client.DecideAccessRequest(id, approve, *noteFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error deciding access request: %v\n", err)
+		os.Exit(1)
+	}
+
+	if approve {
+		fmt.Printf("Access request %d approved: %s may read %s:%s until %s\n", id, request.Requester,
+			request.Group, request.Path, request.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	} else {
+		fmt.Printf("Access request %d denied\n", id)
+	}
+}
+
+// formatMinutes shows a duration as e.g. 30m, 4h or 1h30m
+func formatMinutes(minutes int) string {
+	switch {
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%dh", minutes/60)
+	default:
+		return fmt.Sprintf("%dh%dm", minutes/60, minutes%60)
+	}
+}
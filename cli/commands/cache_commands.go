@@ -0,0 +1,211 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/steve/pman/cli/config"
+	"github.com/steve/pman/cli/crypto"
+	"github.com/steve/pman/shared/models"
+	"golang.org/x/term"
+)
+
+// setupOfflineCache is called after a successful login. It creates the cache
+// when requested and re-keys an existing cache whose keys no longer match the
+// login password (e.g. after a password change).
+func setupOfflineCache(password string, enable bool) error {
+	cache, err := config.LoadCache()
+	if err != nil {
+		return err
+	}
+
+	if !cache.Enabled() {
+		if !enable {
+			return nil
+		}
+		if err := cache.Enable(password); err != nil {
+			return err
+		}
+		fmt.Println("Offline cache enabled")
+		return nil
+	}
+
+	if _, err := crypto.UnlockCacheKey(cache.Keys, password); err == nil {
+		return nil
+	}
+
+	if err := cache.Enable(password); err != nil {
+		return err
+	}
+	fmt.Println("Offline cache reset (password changed since it was created)")
+	return nil
+}
+
+// updateOfflineCache stores or removes a value according to the group's cache policy
+func updateOfflineCache(path, group string, result *models.PasswordValue) error {
+	cache, err := config.LoadCache()
+	if err != nil {
+		return err
+	}
+
+	if !cache.Enabled() {
+		return nil
+	}
+
+	return cache.Put(group, path, result.Value, result.CacheMaxAgeHours)
+}
+
+func getFromOfflineCache(path, group string) (string, error) {
+	cache, err := config.LoadCache()
+	if err != nil {
+		return "", err
+	}
+
+	if !cache.Enabled() {
+		return "", fmt.Errorf("offline cache is not enabled. Run 'pman login --cache' to enable it")
+	}
+
+	entry, ok := cache.Get(group, path)
+	if !ok {
+		return "", fmt.Errorf("'%s' is not in the offline cache", path)
+	}
+
+	if entry.IsExpired() {
+		cache.Remove(group, path)
+		return "", fmt.Errorf("cached value for '%s' expired %s ago (group policy: %dh)",
+			path, formatAge(time.Since(entry.ExpiresAt())), entry.MaxAgeHours)
+	}
+
+	// Prompt on stderr so the value can still be captured from stdout
+	fmt.Fprint(os.Stderr, "Login password: ")
+	passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	privateKey, err := crypto.UnlockCacheKey(cache.Keys, string(passwordBytes))
+	if err != nil {
+		return "", err
+	}
+
+	value, err := crypto.OpenCacheData(cache.Keys, privateKey, entry.Value)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: using offline copy cached %s ago (expires in %s)\n",
+		formatAge(time.Since(entry.CachedAt)), formatAge(time.Until(entry.ExpiresAt())))
+
+	return value, nil
+}
+
+func formatAge(d time.Duration) string {
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd", int(d.Hours())/24)
+}
+
+func Cache(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman cache <status|clear|disable>\n")
+		os.Exit(1)
+	}
+
+	cache, err := config.LoadCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading offline cache: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "status":
+		if !cache.Enabled() {
+			fmt.Println("Offline cache: disabled (enable with 'pman login --cache')")
+			return
+		}
+
+		fmt.Println("Offline cache: enabled")
+		if len(cache.Entries) == 0 {
+			fmt.Println("No cached passwords")
+			return
+		}
+
+		var entries []config.CacheEntry
+		for _, entry := range cache.Entries {
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Group != entries[j].Group {
+				return entries[i].Group < entries[j].Group
+			}
+			return entries[i].Path < entries[j].Path
+		})
+
+		fmt.Printf("%-15s %-35s %-12s %s\n", "GROUP", "PATH", "AGE", "STATUS")
+		fmt.Printf("%-15s %-35s %-12s %s\n", strings.Repeat("-", 15), strings.Repeat("-", 35), strings.Repeat("-", 12), strings.Repeat("-", 20))
+		for _, entry := range entries {
+			status := "expires in " + formatAge(time.Until(entry.ExpiresAt()))
+			if entry.IsExpired() {
+				status = "expired"
+			}
+			fmt.Printf("%-15s %-35s %-12s %s\n", entry.Group, entry.Path, formatAge(time.Since(entry.CachedAt)), status)
+		}
+	case "clear":
+		if err := cache.Clear(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error clearing offline cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Offline cache cleared")
+	case "disable":
+		if err := config.DeleteCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error disabling offline cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Offline cache disabled")
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache command: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "Usage: pman cache <status|clear|disable>\n")
+		os.Exit(1)
+	}
+}
+
+func GroupCache(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupcache <group> <max-age-hours>\n")
+		fmt.Fprintf(os.Stderr, "Example: pman groupcache team1 24   (0 disables offline caching)\n")
+		os.Exit(1)
+	}
+
+	group := args[0]
+	hours, err := strconv.Atoi(args[1])
+	if err != nil || hours < 0 {
+		fmt.Fprintf(os.Stderr, "Error: max age must be a whole number of hours (0 or more)\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.SetGroupCachePolicy(group, hours); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting group cache policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Offline cache max age for %s set to %dh\n", group, hours)
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/steve/pman/cli/client"
 	"github.com/steve/pman/cli/config"
+	"github.com/steve/pman/cli/sso"
 	"github.com/steve/pman/cli/tree"
 	"golang.org/x/term"
 )
@@ -44,7 +45,11 @@ func expandCombinedFlags(args []string) []string {
 			// This is a flag
 			result = append(result, arg)
 			// Check if this flag expects a value
-			if arg == "-g" || arg == "--group" || arg == "-s" || arg == "-u" || arg == "-p" || arg == "--expire" {
+			if arg == "-g" || arg == "--group" || arg == "-s" || arg == "-u" || arg == "-p" || arg == "--expire" ||
+				arg == "--prefix" || arg == "--desc" || arg == "--otp" || arg == "--admins" || arg == "--groups" ||
+				arg == "--reason" || arg == "--for" || arg == "--note" || arg == "--expires" || arg == "--views" ||
+				arg == "--secret" || arg == "--events" || arg == "--exec" || arg == "--signal" || arg == "--pid" ||
+				arg == "--delay" || arg == "--version" || arg == "--every" {
 				// Get the next argument as the value if it exists and isn't a flag
 				if i+1 < len(expanded) && !strings.HasPrefix(expanded[i+1], "-") {
 					i++
@@ -66,8 +71,9 @@ func ShowHelp() {
 	fmt.Println("Usage: pman <command> [options]")
 	fmt.Println("")
 	fmt.Println("Commands:")
-	fmt.Println("  login       Login to pman server")
+	fmt.Println("  login       Login to pman server (--sso for single sign-on, --sso --device without a browser)")
 	fmt.Println("  logout      Logout from pman server")
+	fmt.Println("  setup       Create the first admin of a new server with the setup token from its log")
 	fmt.Println("  setgroup    Set default group")
 	fmt.Println("  add/put     Add password")
 	fmt.Println("  get         Get password")
@@ -75,18 +81,64 @@ func ShowHelp() {
 	fmt.Println("  edit        Edit password")
 	fmt.Println("  rm/del      Delete password")
 	fmt.Println("  info        Show password info")
+	fmt.Println("  share       Create a one-time link to a password for someone without an account")
+	fmt.Println("  share-get   Read a password from a share link (no login needed)")
+	fmt.Println("  grant       Give a user temporary access to one password, or list and revoke grants")
+	fmt.Println("  watch       Run a command or signal a process when passwords under a prefix change")
+	fmt.Println("  rotate      Rotate a password with its rotator (admins: set, ls, rm to manage rotators)")
 	fmt.Println("  version     Show version")
 	fmt.Println("  status      Show server status")
 	fmt.Println("  passwd      Change password")
 	fmt.Println("  whoami      Show current user, server and default group")
+	fmt.Println("  sessions    List or revoke your login sessions")
+	fmt.Println("  mfa         Manage multi-factor authentication (status, enroll, disable, recovery-codes,")
+	fmt.Println("              keys, addkey, rmkey)")
+	fmt.Println("  cache       Manage the offline cache (status, clear, disable)")
+	fmt.Println("  profile     Manage server profiles (add, use, list, rm)")
+	fmt.Println("  request     Request time-boxed access to a secret that requires approval")
+	fmt.Println("  requests    List your access requests and those waiting for your approval")
+	fmt.Println("  approve     Approve an access request (approvers of the group)")
+	fmt.Println("  deny        Deny an access request (approvers of the group)")
+	fmt.Println("")
+	fmt.Println("Global options:")
+	fmt.Println("  --profile <name>  Use a server profile for this command, given before it (or set PMAN_PROFILE)")
 	fmt.Println("")
 	fmt.Println("Admin commands:")
 	fmt.Println("  useradd     Add user")
 	fmt.Println("  userdel     Delete user")
 	fmt.Println("  userupdate  Update user")
 	fmt.Println("  userlist    List users")
+	fmt.Println("  role        List, add, update or remove roles and their admin capabilities")
 	fmt.Println("  userdisable Disable user")
 	fmt.Println("  userenable  Enable user")
+	fmt.Println("  userunlock  Unlock a user (or --ip an address) locked out after failed logins")
+	fmt.Println("  lockouts    List login lockouts and recent lockout events")
+	fmt.Println("  usersessions List or revoke a user's sessions")
+	fmt.Println("  usermfareset Remove a user's MFA (lost authenticator)")
+	fmt.Println("  mfapolicy   Show or set which users must use MFA")
+	fmt.Println("  pwpolicy    Show or set the password policy (length, character classes, reuse, expiry)")
+	fmt.Println("  groupadd    Add group")
+	fmt.Println("  groupupdate Change a group's description")
+	fmt.Println("  groupdel    Delete a group without members or secrets")
+	fmt.Println("  grouplist   List groups")
+	fmt.Println("  groupinfo   Show a group and its members")
+	fmt.Println("  groupmember Add a user to a group or remove them (also for group owners)")
+	fmt.Println("  acl         Restrict access to paths within a group (also for group owners)")
+	fmt.Println("  approval    Require approval before a secret can be read (also for group owners)")
+	fmt.Println("  groupcache  Set how long a group's passwords may be cached offline")
+	fmt.Println("  webhook     Manage webhooks called when passwords or users change (ls, add, rm, test, log)")
+	fmt.Println("")
+	fmt.Println("Service account commands (admin):")
+	fmt.Println("  svcadd        Add service account and print its first API key")
+	fmt.Println("  svcdel        Delete service account")
+	fmt.Println("  svclist       List service accounts")
+	fmt.Println("  svckeys       List API keys of a service account")
+	fmt.Println("  svckeyadd     Create an additional API key")
+	fmt.Println("  svckeyrevoke  Revoke an API key")
+	fmt.Println("")
+	fmt.Println("Environment:")
+	fmt.Println("  PMAN_API_KEY  Authenticate with a service account API key instead of a login")
+	fmt.Println("  PMAN_SERVER   Server URL to use with PMAN_API_KEY when no profile is configured")
 }
 
 func getAuthenticatedClient() (*client.Client, error) {
@@ -95,11 +147,54 @@ func getAuthenticatedClient() (*client.Client, error) {
 		return nil, fmt.Errorf("error loading config: %v", err)
 	}
 
+	// Service accounts (e.g. CI jobs) authenticate with an API key instead of a login
+	if apiKey := os.Getenv("PMAN_API_KEY"); apiKey != "" {
+		serverURL := os.Getenv("PMAN_SERVER")
+		if serverURL == "" {
+			serverURL = cfg.Server
+		}
+		if serverURL == "" {
+			return nil, fmt.Errorf("PMAN_API_KEY is set but no server is configured. Set PMAN_SERVER")
+		}
+		if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+			serverURL = "https://" + serverURL
+		}
+		return newClient(cfg, serverURL, apiKey)
+	}
+
 	if cfg.Server == "" || cfg.Token == "" {
 		return nil, fmt.Errorf("not logged in. Please run 'pman login' first")
 	}
 
-	return client.NewClient(cfg.Server, cfg.Token), nil
+	c, err := newClient(cfg, cfg.Server, cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	c.RefreshToken = cfg.RefreshToken
+	c.OnTokenRefresh = func(token, refreshToken string) error {
+		cfg.Token = token
+		cfg.RefreshToken = refreshToken
+		return cfg.Save()
+	}
+	c.SavedRefreshToken = func() (string, error) {
+		saved, err := config.LoadProfile(cfg.Profile)
+		if err != nil {
+			return "", err
+		}
+		return saved.RefreshToken, nil
+	}
+
+	return c, nil
+}
+
+// newClient creates a client using the TLS settings of the given profile
+func newClient(cfg *config.Config, serverURL, token string) (*client.Client, error) {
+	c := client.NewClient(serverURL, token)
+	if err := c.ConfigureTLS(cfg.TLSCACert, cfg.TLSInsecureSkipVerify); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func resolveGroup(groupFlag string) (string, error) {
@@ -192,6 +287,13 @@ func editWithEditor(content string) (string, error) {
 	return strings.TrimSpace(string(editedContent)), nil
 }
 
+func readLine(prompt string) string {
+	fmt.Print(prompt)
+	reader := bufio.NewReader(os.Stdin)
+	input, _ := reader.ReadString('\n')
+	return strings.TrimSpace(input)
+}
+
 func confirmAction(message string) bool {
 	fmt.Printf("%s (y/N): ", message)
 	reader := bufio.NewReader(os.Stdin)
@@ -207,7 +309,12 @@ func Login(args []string) {
 	server := fs.String("s", "", "Server URL")
 	email := fs.String("u", "", "Email address")
 	password := fs.String("p", "", "Password")
-	expireDays := fs.Int("expire", 0, "Token expiry in days")
+	expireDays := fs.Int("expire", 0, "Session expiry in days")
+	enableCache := fs.Bool("cache", false, "Enable the encrypted offline cache")
+	otp := fs.String("otp", "", "Authentication code or recovery code for MFA")
+	useSecurityKey := fs.Bool("webauthn", false, "Use a security key (WebAuthn) for MFA")
+	useSSO := fs.Bool("sso", false, "Sign in with the organisation's identity provider")
+	useDevice := fs.Bool("device", false, "With --sso, sign in on another device (no local browser)")
 
 	fs.Parse(args)
 
@@ -231,6 +338,14 @@ func Login(args []string) {
 		serverURL = strings.TrimSpace(input)
 	}
 
+	if *useSSO || *useDevice {
+		if *enableCache {
+			fmt.Fprintf(os.Stderr, "Warning: the offline cache is keyed by your login password and is not available with single sign-on\n")
+		}
+		loginWithSSO(cfg, serverURL, *expireDays, *useDevice)
+		return
+	}
+
 	if *email != "" {
 		userEmail = *email
 	} else if cfg.Email != "" {
@@ -271,16 +386,40 @@ func Login(args []string) {
 		serverURL = "https://" + serverURL
 	}
 
-	c := client.NewClient(serverURL, "")
+	c, err := newClient(cfg, serverURL, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	loginResp, err := c.Login(userEmail, userPassword, expire)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Login failed: %v\n", err)
 		os.Exit(1)
 	}
 
+	if loginResp.MFARequired {
+		// Security keys are used when asked for, or when they are the only factor set up
+		onlyKeys := len(loginResp.MFAMethods) > 0 && !containsString(loginResp.MFAMethods, "totp")
+		if *useSecurityKey || onlyKeys {
+			loginResp, err = loginWithSecurityKey(c, loginResp.MFAToken)
+		} else {
+			code := *otp
+			if code == "" {
+				code = readLine("Authentication code (or recovery code): ")
+			}
+			loginResp, err = c.LoginMFA(loginResp.MFAToken, code)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Login failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	cfg.Server = serverURL
 	cfg.Email = userEmail
 	cfg.Token = loginResp.Token
+	cfg.RefreshToken = loginResp.RefreshToken
 
 	if err := cfg.Save(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
@@ -288,6 +427,153 @@ func Login(args []string) {
 	}
 
 	fmt.Println("Login successful")
+
+	if loginResp.PasswordChangeRequired {
+		fmt.Println("")
+		fmt.Println("You must choose a new password. Other commands are blocked until you change it.")
+
+		if !term.IsTerminal(int(syscall.Stdin)) {
+			fmt.Fprintf(os.Stderr, "Run 'pman passwd' to change it\n")
+			os.Exit(1)
+		}
+
+		c.Token = loginResp.Token
+		c.RefreshToken = loginResp.RefreshToken
+		userPassword, err = changeRequiredPassword(c, userPassword)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error changing password: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Run 'pman passwd' to try again\n")
+			os.Exit(1)
+		}
+
+		cfg.Token = c.Token
+		cfg.RefreshToken = c.RefreshToken
+		if err := cfg.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The MFA policy is only checked once the password is sorted out
+		status, err := c.GetMFAStatus()
+		if err == nil {
+			loginResp.MFAEnrollmentRequired = status.Required && !status.Enabled && status.SecurityKeys == 0
+		}
+	}
+
+	if loginResp.MFAEnrollmentRequired {
+		fmt.Println("")
+		fmt.Println("Your account is required to use multi-factor authentication.")
+		fmt.Println("Other commands are blocked until you enrol.")
+
+		if !*useSecurityKey && !term.IsTerminal(int(syscall.Stdin)) {
+			fmt.Fprintf(os.Stderr, "Run 'pman mfa enroll' or 'pman mfa addkey' to set it up\n")
+			os.Exit(1)
+		}
+
+		c.Token = loginResp.Token
+		c.RefreshToken = loginResp.RefreshToken
+		if *useSecurityKey {
+			err = registerSecurityKey(c, "")
+		} else {
+			err = runMFAEnrollment(c)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error enrolling in MFA: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Run 'pman mfa enroll' or 'pman mfa addkey' to try again\n")
+			os.Exit(1)
+		}
+
+		cfg.Token = c.Token
+		cfg.RefreshToken = c.RefreshToken
+		if err := cfg.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := setupOfflineCache(userPassword, *enableCache); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: offline cache not available: %v\n", err)
+	}
+}
+
+// changeRequiredPassword asks for a new password until the server accepts it
+// and returns it
+func changeRequiredPassword(c *client.Client, currentPassword string) (string, error) {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		var newPassword string
+		newPassword, err = readPasswordTwice("New password")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+			continue
+		}
+
+		err = c.ChangePassword(currentPassword, newPassword)
+		if err == nil {
+			fmt.Println("Password changed successfully")
+			return newPassword, nil
+		}
+		if !strings.Contains(err.Error(), "password policy") {
+			return "", err
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printPasswordRequirements(c, err)
+		fmt.Fprintln(os.Stderr, "")
+	}
+	return "", err
+}
+
+// loginWithSSO signs in through the identity provider configured on the
+// server and trades the resulting ID token for a pman session
+func loginWithSSO(cfg *config.Config, serverURL string, expire int, device bool) {
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "https://" + serverURL
+	}
+
+	c, err := newClient(cfg, serverURL, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	oidcConfig, err := c.GetOIDCConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Login failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	var idToken, nonce string
+	if device {
+		idToken, err = sso.DeviceLogin(oidcConfig)
+	} else {
+		idToken, nonce, err = sso.BrowserLogin(oidcConfig)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Login failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	loginResp, err := c.LoginOIDC(idToken, nonce, expire)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Login failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg.Server = serverURL
+	cfg.Email = loginResp.User.Email
+	cfg.Token = loginResp.Token
+	cfg.RefreshToken = loginResp.RefreshToken
+
+	if err := cfg.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Login successful (%s)\n", loginResp.User.Email)
+	if loginResp.User.Groups == "" {
+		fmt.Println("Note: your identity provider groups do not grant access to any pman group yet")
+	}
 }
 
 func Logout(args []string) {
@@ -302,6 +588,13 @@ func Logout(args []string) {
 		return
 	}
 
+	// Revoke the session on the server; the local token is cleared regardless
+	if c, err := newClient(cfg, cfg.Server, cfg.Token); err == nil {
+		if err := c.Logout(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not revoke session on server: %v\n", err)
+		}
+	}
+
 	if err := cfg.ClearToken(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error clearing token: %v\n", err)
 		os.Exit(1)
@@ -404,12 +697,14 @@ func Get(args []string) {
 	fs := flag.NewFlagSet("get", flag.ExitOnError)
 	groupFlag := fs.String("g", "", "Group name")
 	groupLongFlag := fs.String("group", "", "Group name")
+	offlineFlag := fs.Bool("offline", false, "Read from the offline cache instead of the server")
+	versionFlag := fs.Int("version", 0, "Read an earlier version of the password")
 
 	fs.Parse(args)
 	remainingArgs := fs.Args()
 
-	if len(remainingArgs) != 1 {
-		fmt.Fprintf(os.Stderr, "Usage: pman get <path>\n")
+	if len(remainingArgs) != 1 || *versionFlag < 0 || (*offlineFlag && *versionFlag != 0) {
+		fmt.Fprintf(os.Stderr, "Usage: pman get <path> [--offline | --version N]\n")
 		os.Exit(1)
 	}
 
@@ -426,19 +721,44 @@ func Get(args []string) {
 		os.Exit(1)
 	}
 
+	if *offlineFlag {
+		password, err := getFromOfflineCache(path, resolvedGroup)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting password from offline cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(password)
+		return
+	}
+
 	client, err := getAuthenticatedClient()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	password, err := client.GetPassword(path, resolvedGroup)
+	// Earlier versions are never cached offline
+	if *versionFlag != 0 {
+		password, err := client.GetPasswordVersion(path, resolvedGroup, *versionFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting password: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(password)
+		return
+	}
+
+	result, err := client.GetPasswordValue(path, resolvedGroup)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error getting password: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Print(password)
+	if err := updateOfflineCache(path, resolvedGroup, result); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update offline cache: %v\n", err)
+	}
+
+	fmt.Print(result.Value)
 }
 
 func List(args []string) {
@@ -689,10 +1009,14 @@ func Info(args []string) {
 		fmt.Println(string(jsonOutput))
 	} else {
 		fmt.Printf("Path: %s\n", passwordInfo.Path)
+		fmt.Printf("Version: %d\n", passwordInfo.Version)
 		fmt.Printf("Created by: %s\n", passwordInfo.CreatedBy)
 		fmt.Printf("Created at: %s\n", passwordInfo.CreatedAt.Format("2006-01-02 15:04:05"))
 		fmt.Printf("Last Updated by: %s\n", passwordInfo.UpdatedBy)
 		fmt.Printf("Last Updated at: %s\n", passwordInfo.UpdatedAt.Format("2006-01-02 15:04:05"))
+		if passwordInfo.RequiresApproval {
+			fmt.Printf("Requires approval: yes\n")
+		}
 	}
 }
 
@@ -706,18 +1030,18 @@ func Status(args []string) {
 
 	var serverURL string
 
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *serverFlag != "" {
 		serverURL = *serverFlag
 		if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
 			serverURL = "https://" + serverURL
 		}
 	} else {
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-
 		if cfg.Server == "" {
 			fmt.Fprintf(os.Stderr, "No server configured. Please login first or specify server with -s flag\n")
 			os.Exit(1)
@@ -727,7 +1051,11 @@ func Status(args []string) {
 	}
 
 	// Create client without token for health check
-	client := client.NewClient(serverURL, "")
+	client, err := newClient(cfg, serverURL, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	if err := client.CheckHealth(); err != nil {
 		fmt.Printf("Server not OK (%s)\n", err.Error())
@@ -741,6 +1069,7 @@ func UserAdd(args []string) {
 	if len(args) != 3 {
 		fmt.Fprintf(os.Stderr, "Usage: pman useradd <email> <role> <groups>\n")
 		fmt.Fprintf(os.Stderr, "Example: pman useradd \"user@email.com\" \"admin\" \"team1:rw,team2:ro\"\n")
+		fmt.Fprintf(os.Stderr, "Roles: user, admin, user-manager, group-manager, auditor, read-only-admin or custom ones ('pman role ls')\n")
 		os.Exit(1)
 	}
 
@@ -762,6 +1091,7 @@ func UserAdd(args []string) {
 
 	fmt.Printf("User created successfully: %s\n", email)
 	fmt.Printf("Generated password: %s\n", password)
+	fmt.Println("The user will be asked to choose a new password at their first login")
 }
 
 func UserDel(args []string) {
@@ -807,6 +1137,7 @@ func UserUpdate(args []string) {
 	if len(args) != 3 {
 		fmt.Fprintf(os.Stderr, "Usage: pman userupdate <email> <role> <groups>\n")
 		fmt.Fprintf(os.Stderr, "Example: pman userupdate \"user@email.com\" \"admin\" \"team1:ro,team2:ro,team3:rw\"\n")
+		fmt.Fprintf(os.Stderr, "Roles: user, admin, user-manager, group-manager, auditor, read-only-admin or custom ones ('pman role ls')\n")
 		os.Exit(1)
 	}
 
@@ -861,15 +1192,23 @@ func UserList(args []string) {
 			return users[i].Email < users[j].Email
 		})
 
-		fmt.Printf("%-30s %-10s %-15s %s\n", "EMAIL", "ROLE", "STATUS", "GROUPS")
-		fmt.Printf("%-30s %-10s %-15s %s\n", strings.Repeat("-", 30), strings.Repeat("-", 10), strings.Repeat("-", 15), strings.Repeat("-", 20))
+		fmt.Printf("%-30s %-10s %-15s %-5s %s\n", "EMAIL", "ROLE", "STATUS", "MFA", "GROUPS")
+		fmt.Printf("%-30s %-10s %-15s %-5s %s\n", strings.Repeat("-", 30), strings.Repeat("-", 10), strings.Repeat("-", 15), strings.Repeat("-", 5), strings.Repeat("-", 20))
 
 		for _, user := range users {
 			status := "enabled"
 			if !user.Enabled {
 				status = "disabled"
 			}
-			fmt.Printf("%-30s %-10s %-15s %s\n", user.Email, user.Role, status, user.Groups)
+			mfa := "no"
+			if user.MFAEnabled {
+				mfa = "yes"
+			}
+			// Single sign-on users get MFA from the identity provider
+			if user.AuthSource == "oidc" {
+				mfa = "sso"
+			}
+			fmt.Printf("%-30s %-10s %-15s %-5s %s\n", user.Email, user.Role, status, mfa, user.Groups)
 		}
 	}
 }
@@ -930,6 +1269,7 @@ func Whoami(args []string) {
 		os.Exit(1)
 	}
 
+	fmt.Printf("Profile: %s\n", cfg.Profile)
 	fmt.Printf("User: %s\n", cfg.Email)
 	fmt.Printf("Server: %s\n", cfg.Server)
 
@@ -965,6 +1305,7 @@ func Passwd(args []string) {
 
 		if err := client.ChangePassword(currentPassword, newPassword); err != nil {
 			fmt.Fprintf(os.Stderr, "Error changing password: %v\n", err)
+			printPasswordRequirements(client, err)
 			os.Exit(1)
 		}
 
@@ -981,10 +1322,12 @@ func Passwd(args []string) {
 
 		if err := client.AdminChangePassword(email, newPassword); err != nil {
 			fmt.Fprintf(os.Stderr, "Error changing password for %s: %v\n", email, err)
+			printPasswordRequirements(client, err)
 			os.Exit(1)
 		}
 
 		fmt.Printf("Password changed successfully for: %s\n", email)
+		fmt.Println("The user will be asked to choose a new password at their next login")
 	} else {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  pman passwd                    - Change your own password\n")
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+// Grant gives a user temporary access to one secret, or lists and revokes
+// the group's grants
+func Grant(args []string) {
+	if len(args) == 0 {
+		showGrantUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		GrantList(args[1:])
+	case "rm", "revoke":
+		GrantRevoke(args[1:])
+	case "help", "--help", "-h":
+		showGrantUsage()
+	default:
+		GrantAdd(args)
+	}
+}
+
+func showGrantUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman grant <path> <email> [--expires 24h] [--ro|--rw] [-g group]\n")
+	fmt.Fprintf(os.Stderr, "  pman grant ls [-g group]\n")
+	fmt.Fprintf(os.Stderr, "  pman grant rm <id> [-g group]\n")
+	fmt.Fprintf(os.Stderr, "Grants give a user outside the group access to a single secret until they expire\n")
+	fmt.Fprintf(os.Stderr, "(at most 7 days). Writers of the group can grant what they can do themselves.\n")
+}
+
+// grantGroup parses the flags of a grant command and resolves its group
+func grantGroup(fs *flag.FlagSet, args []string) (string, []string) {
+	groupFlag := fs.String("g", "", "Group name")
+	groupLongFlag := fs.String("group", "", "Group name")
+
+	fs.Parse(expandCombinedFlags(args))
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	resolvedGroup, err := resolveGroup(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return resolvedGroup, fs.Args()
+}
+
+func GrantAdd(args []string) {
+	fs := flag.NewFlagSet("grant", flag.ExitOnError)
+	expiresFlag := fs.String("expires", "24h", "How long the grant lasts (e.g. 4h; at most 168h)")
+	roFlag := fs.Bool("ro", false, "Read-only access (default)")
+	rwFlag := fs.Bool("rw", false, "Read-write access")
+
+	group, remainingArgs := grantGroup(fs, args)
+
+	if len(remainingArgs) != 2 || (*roFlag && *rwFlag) {
+		showGrantUsage()
+		os.Exit(1)
+	}
+
+	expires, err := time.ParseDuration(*expiresFlag)
+	if err != nil || expires < time.Minute {
+		fmt.Fprintf(os.Stderr, "Invalid duration: %s (e.g. 4h or 24h)\n", *expiresFlag)
+		os.Exit(1)
+	}
+
+	permission := "ro"
+	if *rwFlag {
+		permission = "rw"
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	grant, err := client.CreateGrant(group, models.GrantRequest{
+		Path:           remainingArgs[0],
+		Grantee:        remainingArgs[1],
+		Permission:     permission,
+		ExpiresMinutes: int(expires / time.Minute),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating grant: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Grant %d: %s has %s access to %s:%s until %s\n", grant.ID, grant.Grantee, grant.Permission,
+		group, grant.Path, grant.ExpiresAt.Local().Format("2006-01-02 15:04"))
+}
+
+func GrantList(args []string) {
+	fs := flag.NewFlagSet("grant ls", flag.ExitOnError)
+	group, remainingArgs := grantGroup(fs, args)
+
+	if len(remainingArgs) != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: pman grant ls [-g group]\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	grants, err := client.ListGrants(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing grants: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(grants) == 0 {
+		fmt.Printf("Group %s has no outstanding grants\n", group)
+		return
+	}
+
+	fmt.Printf("%-6s %-30s %-30s %-6s %-17s %s\n", "ID", "PATH", "USER", "ACCESS", "EXPIRES", "GRANTED BY")
+	fmt.Printf("%-6s %-30s %-30s %-6s %-17s %s\n", strings.Repeat("-", 6), strings.Repeat("-", 30), strings.Repeat("-", 30), strings.Repeat("-", 6), strings.Repeat("-", 17), strings.Repeat("-", 20))
+	for _, grant := range grants {
+		fmt.Printf("%-6d %-30s %-30s %-6s %-17s %s\n", grant.ID, grant.Path, grant.Grantee, grant.Permission,
+			grant.ExpiresAt.Local().Format("2006-01-02 15:04"), grant.CreatedBy)
+	}
+}
+
+func GrantRevoke(args []string) {
+	fs := flag.NewFlagSet("grant rm", flag.ExitOnError)
+	group, remainingArgs := grantGroup(fs, args)
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman grant rm <id> [-g group]\n")
+		os.Exit(1)
+	}
+
+	id, err := strconv.Atoi(remainingArgs[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid grant ID: %s (see 'pman grant ls')\n", remainingArgs[0])
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.RevokeGrant(group, id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error revoking grant: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Grant %d revoked\n", id)
+}
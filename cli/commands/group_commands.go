@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func GroupAdd(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupadd <group> [description]\n")
+		fmt.Fprintf(os.Stderr, "Example: pman groupadd ops \"Operations team\"\n")
+		os.Exit(1)
+	}
+
+	description := ""
+	if len(args) == 2 {
+		description = args[1]
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.CreateGroup(args[0], description); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating group: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Group created successfully: %s\n", args[0])
+}
+
+func GroupUpdate(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupupdate <group> <description>\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.UpdateGroup(args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating group: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Group updated successfully: %s\n", args[0])
+}
+
+func GroupDel(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupdel <group>\n")
+		fmt.Fprintf(os.Stderr, "Only groups without members and secrets can be deleted\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.DeleteGroup(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting group: %v\n", err)
+		if strings.Contains(err.Error(), "in use") {
+			fmt.Fprintf(os.Stderr, "See 'pman groupinfo %s' for its members\n", args[0])
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("Group deleted successfully: %s\n", args[0])
+}
+
+func GroupList(args []string) {
+	if len(args) > 1 || len(args) == 1 && args[0] != "--json" {
+		fmt.Fprintf(os.Stderr, "Usage: pman grouplist [--json]\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	groups, err := client.ListGroups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing groups: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 1 {
+		jsonOutput, err := json.MarshalIndent(groups, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonOutput))
+		return
+	}
+
+	fmt.Printf("%-20s %-8s %-8s %-8s %s\n", "GROUP", "MEMBERS", "SECRETS", "CACHE", "DESCRIPTION")
+	fmt.Printf("%-20s %-8s %-8s %-8s %s\n", strings.Repeat("-", 20), strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 20))
+	for _, group := range groups {
+		fmt.Printf("%-20s %-8d %-8d %-8s %s\n", group.Name, len(group.Members), group.Secrets,
+			cacheMaxAge(group.CacheMaxAgeHours), group.Description)
+	}
+}
+
+func GroupInfo(args []string) {
+	if len(args) < 1 || len(args) > 2 || len(args) == 2 && args[1] != "--json" {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupinfo <group> [--json]\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	group, err := client.GetGroup(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting group: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 2 {
+		jsonOutput, err := json.MarshalIndent(group, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonOutput))
+		return
+	}
+
+	printGroup(group)
+}
+
+func GroupMember(args []string) {
+	if len(args) == 0 {
+		showGroupMemberUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add", "set":
+		GroupMemberAdd(args[1:])
+	case "rm", "remove", "del":
+		GroupMemberRemove(args[1:])
+	case "list", "ls":
+		GroupMemberList(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown groupmember command: %s\n", args[0])
+		showGroupMemberUsage()
+		os.Exit(1)
+	}
+}
+
+func showGroupMemberUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman groupmember add <group> <email> <permission>   (also changes the permission of a member)\n")
+	fmt.Fprintf(os.Stderr, "  pman groupmember rm <group> <email>\n")
+	fmt.Fprintf(os.Stderr, "  pman groupmember ls <group>\n")
+	fmt.Fprintf(os.Stderr, "Permissions are ro, rw, owner or verbs joined with '+' from list, read, write, delete and admin\n")
+	fmt.Fprintf(os.Stderr, "(e.g. 'list' lets auditors browse paths without seeing values)\n")
+	fmt.Fprintf(os.Stderr, "Owners of a group can manage its members without being an admin, except other owners\n")
+}
+
+func GroupMemberAdd(args []string) {
+	if len(args) != 3 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupmember add <group> <email> <ro|rw|owner|verbs>\n")
+		fmt.Fprintf(os.Stderr, "Example: pman groupmember add team1 user@company.com rw\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.SetGroupMember(args[0], args[1], args[2]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding group member: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s is a member of %s (%s)\n", args[1], args[0], args[2])
+}
+
+func GroupMemberRemove(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupmember rm <group> <email>\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.RemoveGroupMember(args[0], args[1]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing group member: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s removed from %s\n", args[1], args[0])
+}
+
+func GroupMemberList(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman groupmember ls <group>\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	members, err := client.ListGroupMembers(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing group members: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(members) == 0 {
+		fmt.Printf("Group %s has no members\n", args[0])
+		return
+	}
+	printGroupMembers(members)
+}
+
+func printGroup(group *models.Group) {
+	fmt.Printf("Group:         %s\n", group.Name)
+	if group.Description != "" {
+		fmt.Printf("Description:   %s\n", group.Description)
+	}
+	fmt.Printf("Secrets:       %d\n", group.Secrets)
+	fmt.Printf("Offline cache: %s\n", cacheMaxAge(group.CacheMaxAgeHours))
+
+	if len(group.Members) == 0 {
+		fmt.Println("Members:       none")
+		return
+	}
+
+	fmt.Println("")
+	printGroupMembers(group.Members)
+}
+
+func printGroupMembers(members []models.GroupMember) {
+	fmt.Printf("  %-35s %-16s %s\n", "MEMBER", "TYPE", "ACCESS")
+	fmt.Printf("  %-35s %-16s %s\n", strings.Repeat("-", 35), strings.Repeat("-", 16), strings.Repeat("-", 6))
+	for _, member := range members {
+		memberType := "user"
+		if member.Type == models.GroupMemberServiceAccount {
+			memberType = "service account"
+		}
+		fmt.Printf("  %-35s %-16s %s\n", member.Name, memberType, member.Permission)
+	}
+}
+
+func cacheMaxAge(hours int) string {
+	if hours == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%dh", hours)
+}
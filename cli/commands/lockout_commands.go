@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func UserUnlock(args []string) {
+	var ip, email string
+	switch {
+	case len(args) == 2 && args[0] == "--ip":
+		ip = args[1]
+	case len(args) == 1 && !strings.HasPrefix(args[0], "-"):
+		email = args[0]
+	default:
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  pman userunlock <email>        - Unlock an account after too many failed logins\n")
+		fmt.Fprintf(os.Stderr, "  pman userunlock --ip <address> - Unlock a client address\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if ip != "" {
+		if err := client.UnlockIP(ip); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unlocking address: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Address unlocked successfully: %s\n", ip)
+		return
+	}
+
+	if err := client.UnlockUser(email); err != nil {
+		fmt.Fprintf(os.Stderr, "Error unlocking user: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("User unlocked successfully: %s\n", email)
+}
+
+func Lockouts(args []string) {
+	if len(args) > 1 || len(args) == 1 && args[0] != "--json" {
+		fmt.Fprintf(os.Stderr, "Usage: pman lockouts [--json]\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	status, err := client.ListLockouts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing lockouts: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 1 {
+		jsonOutput, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonOutput))
+		return
+	}
+
+	printLockouts(status)
+}
+
+func printLockouts(status *models.LockoutStatus) {
+	if len(status.Active) == 0 {
+		fmt.Println("No active lockouts")
+	} else {
+		fmt.Println("Active lockouts:")
+		fmt.Printf("  %-8s %-35s %-9s %s\n", "KIND", "ACCOUNT/ADDRESS", "FAILURES", "LOCKED UNTIL")
+		fmt.Printf("  %-8s %-35s %-9s %s\n", strings.Repeat("-", 8), strings.Repeat("-", 35), strings.Repeat("-", 9), strings.Repeat("-", 16))
+		for _, lockout := range status.Active {
+			fmt.Printf("  %-8s %-35s %-9d %s\n", lockout.Kind, lockout.Subject, lockout.Failures,
+				lockout.LockedUntil.Local().Format("2006-01-02 15:04"))
+		}
+	}
+
+	if len(status.Events) == 0 {
+		return
+	}
+
+	fmt.Println("")
+	fmt.Println("Recent events:")
+	fmt.Printf("  %-16s %-8s %-8s %-35s %s\n", "TIME", "EVENT", "KIND", "ACCOUNT/ADDRESS", "DETAILS")
+	fmt.Printf("  %-16s %-8s %-8s %-35s %s\n", strings.Repeat("-", 16), strings.Repeat("-", 8), strings.Repeat("-", 8), strings.Repeat("-", 35), strings.Repeat("-", 30))
+	for _, event := range status.Events {
+		details := ""
+		switch event.Event {
+		case "locked":
+			details = fmt.Sprintf("%d failures, last from %s", event.Failures, event.ClientIP)
+			if event.LockedUntil != nil {
+				details += fmt.Sprintf(", for %s", event.LockedUntil.Sub(event.CreatedAt).Round(time.Minute))
+			}
+		case "unlocked":
+			details = "by " + event.Actor
+		}
+		fmt.Printf("  %-16s %-8s %-8s %-35s %s\n", event.CreatedAt.Local().Format("2006-01-02 15:04"), event.Event,
+			event.Kind, event.Subject, details)
+	}
+}
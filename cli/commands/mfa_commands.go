@@ -0,0 +1,313 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/steve/pman/cli/client"
+	"github.com/steve/pman/cli/loopback"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/webauthn"
+)
+
+func MFA(args []string) {
+	subcommand := "status"
+	if len(args) > 0 {
+		subcommand = args[0]
+	}
+
+	c, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch subcommand {
+	case "status":
+		status, err := c.GetMFAStatus()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting MFA status: %v\n", err)
+			os.Exit(1)
+		}
+
+		if status.Enabled {
+			fmt.Println("Authenticator app: enabled")
+			fmt.Printf("Recovery codes remaining: %d\n", status.RecoveryCodesRemaining)
+		} else {
+			fmt.Println("Authenticator app: disabled")
+		}
+		fmt.Printf("Security keys: %d\n", status.SecurityKeys)
+		if status.Required {
+			fmt.Println("Required by policy: yes")
+		}
+	case "enroll":
+		if err := runMFAEnrollment(c); err != nil {
+			fmt.Fprintf(os.Stderr, "Error enrolling in MFA: %v\n", err)
+			os.Exit(1)
+		}
+	case "disable":
+		code := readLine("Authentication code (or recovery code): ")
+		if err := c.DisableMFA(code); err != nil {
+			fmt.Fprintf(os.Stderr, "Error disabling MFA: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("MFA disabled")
+	case "recovery-codes":
+		code := readLine("Authentication code: ")
+		codes, err := c.RegenerateRecoveryCodes(code)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating recovery codes: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Your previous recovery codes no longer work.")
+		printRecoveryCodes(codes)
+	case "keys":
+		keys, err := c.ListWebAuthnCredentials()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing security keys: %v\n", err)
+			os.Exit(1)
+		}
+		printSecurityKeys(keys)
+	case "addkey":
+		name := ""
+		if len(args) > 1 {
+			name = strings.Join(args[1:], " ")
+		}
+		if err := registerSecurityKey(c, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error registering security key: %v\n", err)
+			os.Exit(1)
+		}
+	case "rmkey":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: pman mfa rmkey <id>\n")
+			os.Exit(1)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid security key ID: %s\n", args[1])
+			os.Exit(1)
+		}
+		if err := c.DeleteWebAuthnCredential(id); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing security key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Security key removed: %d\n", id)
+	default:
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa [status]              - Show whether MFA is enabled\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa enroll                - Set up an authenticator app\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa disable               - Turn authenticator app MFA off\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa recovery-codes        - Replace your recovery codes\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa keys                  - List your security keys\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa addkey [name]         - Register a security key (opens your browser)\n")
+		fmt.Fprintf(os.Stderr, "  pman mfa rmkey <id>            - Remove a security key\n")
+		os.Exit(1)
+	}
+}
+
+// registerSecurityKey runs the WebAuthn registration ceremony in the browser
+func registerSecurityKey(c *client.Client, name string) error {
+	options, err := c.BeginWebAuthnRegistration()
+	if err != nil {
+		return err
+	}
+
+	credential, err := runSecurityKeyCeremony(loopback.CeremonyCreate, options)
+	if err != nil {
+		return err
+	}
+
+	key, err := c.FinishWebAuthnRegistration(name, credential)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Security key registered: %s (id %d)\n", key.Name, key.ID)
+	return nil
+}
+
+// loginWithSecurityKey completes an MFA login challenge with a security key
+func loginWithSecurityKey(c *client.Client, mfaToken string) (*models.LoginResponse, error) {
+	options, err := c.BeginWebAuthnLogin(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := runSecurityKeyCeremony(loopback.CeremonyGet, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.LoginWebAuthn(mfaToken, credential)
+}
+
+func runSecurityKeyCeremony(ceremony string, options json.RawMessage) (*webauthn.CredentialResponse, error) {
+	raw, err := loopback.Run(ceremony, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential webauthn.CredentialResponse
+	if err := json.Unmarshal(raw, &credential); err != nil {
+		return nil, fmt.Errorf("invalid response from browser: %v", err)
+	}
+
+	return &credential, nil
+}
+
+func printSecurityKeys(keys []models.WebAuthnCredential) {
+	if len(keys) == 0 {
+		fmt.Println("No security keys registered")
+		return
+	}
+
+	fmt.Printf("%-5s %-25s %-20s %s\n", "ID", "NAME", "ADDED", "LAST USED")
+	fmt.Printf("%-5s %-25s %-20s %s\n", strings.Repeat("-", 5), strings.Repeat("-", 25), strings.Repeat("-", 20), strings.Repeat("-", 20))
+	for _, key := range keys {
+		lastUsed := "never"
+		if key.LastUsedAt != nil {
+			lastUsed = key.LastUsedAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-5d %-25s %-20s %s\n", key.ID, key.Name, key.CreatedAt.Local().Format("2006-01-02 15:04"), lastUsed)
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// runMFAEnrollment walks the user through adding pman to an authenticator app
+func runMFAEnrollment(c *client.Client) error {
+	enrollment, err := c.EnrollMFA()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Add pman to your authenticator app using this URI (most apps can import it from a QR code):")
+	fmt.Println("")
+	fmt.Printf("  %s\n", enrollment.URI)
+	fmt.Println("")
+	fmt.Printf("Or enter the secret manually: %s\n", enrollment.Secret)
+	fmt.Println("")
+
+	code := readLine("Enter the code shown by your app to confirm: ")
+	codes, err := c.ConfirmMFA(code)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("MFA enabled")
+	printRecoveryCodes(codes)
+	return nil
+}
+
+func printRecoveryCodes(codes []string) {
+	fmt.Println("")
+	fmt.Println("Recovery codes (each works once if you lose your authenticator).")
+	fmt.Println("Store them somewhere safe, they will not be shown again:")
+	fmt.Println("")
+	for _, code := range codes {
+		fmt.Printf("  %s\n", code)
+	}
+	fmt.Println("")
+}
+
+func UserMFAReset(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman usermfareset <email>\n")
+		os.Exit(1)
+	}
+
+	email := args[0]
+
+	if !confirmAction(fmt.Sprintf("Remove MFA for %s?", email)) {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.AdminResetMFA(email); err != nil {
+		fmt.Fprintf(os.Stderr, "Error resetting MFA: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("MFA reset for: %s\n", email)
+}
+
+func MFAPolicy(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("mfapolicy", flag.ExitOnError)
+	admins := fs.String("admins", "", "Require MFA for all admins (on or off)")
+	groups := fs.String("groups", "", "Comma-separated groups whose members must use MFA (\"\" for none)")
+
+	fs.Parse(args)
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	policy, err := client.GetMFAPolicy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting MFA policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(set) > 0 {
+		if set["admins"] {
+			switch strings.ToLower(*admins) {
+			case "on", "yes", "true":
+				policy.RequireAdmins = true
+			case "off", "no", "false":
+				policy.RequireAdmins = false
+			default:
+				fmt.Fprintf(os.Stderr, "Error: --admins must be on or off\n")
+				os.Exit(1)
+			}
+		}
+		if set["groups"] {
+			policy.RequiredGroups = *groups
+		}
+
+		policy, err = client.SetMFAPolicy(*policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting MFA policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	printMFAPolicy(policy)
+}
+
+func printMFAPolicy(policy *models.MFAPolicy) {
+	admins := "no"
+	if policy.RequireAdmins {
+		admins = "yes"
+	}
+	groups := policy.RequiredGroups
+	if groups == "" {
+		groups = "(none)"
+	}
+
+	fmt.Printf("MFA required for admins: %s\n", admins)
+	fmt.Printf("MFA required for groups: %s\n", groups)
+}
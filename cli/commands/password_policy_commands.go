@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/cli/client"
+	"github.com/steve/pman/shared/models"
+)
+
+func PasswordPolicy(args []string) {
+	fs := flag.NewFlagSet("pwpolicy", flag.ExitOnError)
+	minLength := fs.Int("min-length", 0, "Minimum password length (8-128)")
+	minClasses := fs.Int("min-classes", 0, "How many of lower case, upper case, digits and symbols must be mixed (0-4)")
+	history := fs.Int("history", 0, "Number of previous passwords that cannot be reused (0-24)")
+	maxAge := fs.Int("max-age-days", 0, "Days after which passwords must be changed (0 = never)")
+
+	fs.Parse(args)
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	policy, err := client.GetPasswordPolicy()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting password policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(set) > 0 {
+		if set["min-length"] {
+			policy.MinLength = *minLength
+		}
+		if set["min-classes"] {
+			policy.MinClasses = *minClasses
+		}
+		if set["history"] {
+			policy.History = *history
+		}
+		if set["max-age-days"] {
+			policy.MaxAgeDays = *maxAge
+		}
+
+		policy, err = client.SetPasswordPolicy(*policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error setting password policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	maxAgeStr := "never"
+	if policy.MaxAgeDays > 0 {
+		maxAgeStr = fmt.Sprintf("%d day(s)", policy.MaxAgeDays)
+	}
+
+	fmt.Printf("Minimum length:            %d\n", policy.MinLength)
+	fmt.Printf("Minimum character classes: %d (of lower case, upper case, digits, symbols)\n", policy.MinClasses)
+	fmt.Printf("Previous passwords kept:   %d\n", policy.History)
+	fmt.Printf("Passwords expire after:    %s\n", maxAgeStr)
+}
+
+// printPasswordRequirements explains the password policy after the server
+// refused a new password
+func printPasswordRequirements(c *client.Client, err error) {
+	if !strings.Contains(err.Error(), "password policy") {
+		return
+	}
+
+	policy, err := c.GetPasswordPolicy()
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%s\n", describePasswordPolicy(policy))
+}
+
+func describePasswordPolicy(policy *models.PasswordPolicy) string {
+	requirements := []string{fmt.Sprintf("at least %d characters", policy.MinLength)}
+	if policy.MinClasses > 1 {
+		requirements = append(requirements, fmt.Sprintf("a mix of at least %d of lower case letters, upper case letters, digits and symbols", policy.MinClasses))
+	}
+	requirements = append(requirements, "not a common password and not containing your email address")
+	if policy.History == 1 {
+		requirements = append(requirements, "different from your current password")
+	} else if policy.History > 1 {
+		requirements = append(requirements, fmt.Sprintf("not one of your last %d passwords", policy.History))
+	}
+
+	return "Passwords must be:\n  - " + strings.Join(requirements, "\n  - ")
+}
@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/cli/config"
+)
+
+func Profile(args []string) {
+	if len(args) == 0 {
+		showProfileUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		ProfileAdd(args[1:])
+	case "use":
+		ProfileUse(args[1:])
+	case "list", "ls":
+		ProfileList(args[1:])
+	case "rm", "del", "delete":
+		ProfileRemove(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown profile command: %s\n", args[0])
+		showProfileUsage()
+		os.Exit(1)
+	}
+}
+
+func showProfileUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman profile add <name> <server> [-g group] [--ca-cert file] [--insecure]\n")
+	fmt.Fprintf(os.Stderr, "  pman profile use <name>\n")
+	fmt.Fprintf(os.Stderr, "  pman profile list\n")
+	fmt.Fprintf(os.Stderr, "  pman profile rm <name>\n")
+}
+
+func ProfileAdd(args []string) {
+	fs := flag.NewFlagSet("profile add", flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Default group")
+	caCertFlag := fs.String("ca-cert", "", "CA certificate file to trust for this server")
+	insecureFlag := fs.Bool("insecure", false, "Skip TLS certificate verification")
+
+	// Allow flags after the positional arguments
+	var positional, flags []string
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			flags = append(flags, args[i])
+			if (args[i] == "-g" || args[i] == "--ca-cert" || args[i] == "-ca-cert") && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		} else {
+			positional = append(positional, args[i])
+		}
+	}
+	fs.Parse(flags)
+
+	if len(positional) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman profile add <name> <server> [-g group] [--ca-cert file] [--insecure]\n")
+		os.Exit(1)
+	}
+
+	name := positional[0]
+	serverURL := positional[1]
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "https://" + serverURL
+	}
+
+	profile := &config.Config{
+		Profile:               name,
+		Server:                serverURL,
+		DefaultGroup:          *groupFlag,
+		TLSCACert:             *caCertFlag,
+		TLSInsecureSkipVerify: *insecureFlag,
+	}
+
+	if err := config.AddProfile(profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding profile: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Profile added: %s (%s)\n", name, serverURL)
+	fmt.Printf("Run 'pman --profile %s login' to log in\n", name)
+}
+
+func ProfileUse(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman profile use <name>\n")
+		os.Exit(1)
+	}
+
+	if err := config.UseProfile(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Active profile set to: %s\n", args[0])
+	if env := os.Getenv("PMAN_PROFILE"); env != "" && env != args[0] {
+		fmt.Printf("Note: PMAN_PROFILE=%s overrides this setting in the current shell\n", env)
+	}
+}
+
+func ProfileList(args []string) {
+	profiles, err := config.ListProfiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(profiles) == 0 {
+		fmt.Println("No profiles configured. Run 'pman login' or 'pman profile add'")
+		return
+	}
+
+	active := config.ActiveProfileName()
+
+	fmt.Printf("  %-15s %-35s %-30s %-10s %s\n", "PROFILE", "SERVER", "EMAIL", "STATUS", "GROUP")
+	fmt.Printf("  %-15s %-35s %-30s %-10s %s\n", strings.Repeat("-", 15), strings.Repeat("-", 35), strings.Repeat("-", 30), strings.Repeat("-", 10), strings.Repeat("-", 10))
+
+	for _, profile := range profiles {
+		marker := " "
+		if profile.Profile == active {
+			marker = "*"
+		}
+		status := "logged out"
+		if profile.Token != "" {
+			status = "logged in"
+		}
+		fmt.Printf("%s %-15s %-35s %-30s %-10s %s\n", marker, profile.Profile, profile.Server, profile.Email, status, profile.DefaultGroup)
+	}
+}
+
+func ProfileRemove(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("profile rm", flag.ExitOnError)
+	forceFlag := fs.Bool("f", false, "Force removal without confirmation")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman profile rm <name> [-f]\n")
+		os.Exit(1)
+	}
+
+	name := remainingArgs[0]
+
+	if !*forceFlag {
+		message := fmt.Sprintf("Are you sure you want to remove profile '%s'", name)
+		if !confirmAction(message) {
+			fmt.Println("Profile removal cancelled")
+			return
+		}
+	}
+
+	if err := config.RemoveProfile(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Profile removed: %s\n", name)
+}
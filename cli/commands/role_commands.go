@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/shared/auth"
+	"github.com/steve/pman/shared/models"
+)
+
+func Role(args []string) {
+	if len(args) == 0 {
+		showRoleUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		RoleList(args[1:])
+	case "add":
+		RoleSave(args[1:], false)
+	case "update":
+		RoleSave(args[1:], true)
+	case "rm", "remove", "del":
+		RoleRemove(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown role command: %s\n", args[0])
+		showRoleUsage()
+		os.Exit(1)
+	}
+}
+
+func showRoleUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman role ls\n")
+	fmt.Fprintf(os.Stderr, "  pman role add <name> <capabilities> [description]\n")
+	fmt.Fprintf(os.Stderr, "  pman role update <name> <capabilities> [description]\n")
+	fmt.Fprintf(os.Stderr, "  pman role rm <name>\n")
+	fmt.Fprintf(os.Stderr, "Capabilities are comma-separated (e.g. 'users:read,groups:read', '' for none);\n")
+	fmt.Fprintf(os.Stderr, "'pman role ls' shows them all. Built-in roles cannot be changed.\n")
+}
+
+func RoleList(args []string) {
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	roles, capabilities, err := client.ListRoles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing roles: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%-20s %-8s %-6s %s\n", "ROLE", "BUILTIN", "USERS", "CAPABILITIES")
+	fmt.Printf("%-20s %-8s %-6s %s\n", strings.Repeat("-", 20), strings.Repeat("-", 8), strings.Repeat("-", 6), strings.Repeat("-", 30))
+	for _, role := range roles {
+		builtin := "no"
+		if role.Builtin {
+			builtin = "yes"
+		}
+		caps := strings.Join(role.Capabilities, ",")
+		if caps == auth.CapabilityAll {
+			caps = "* (all)"
+		} else if caps == "" {
+			caps = "-"
+		}
+		fmt.Printf("%-20s %-8s %-6d %s\n", role.Name, builtin, role.Users, caps)
+		if role.Description != "" {
+			fmt.Printf("%-20s %s\n", "", role.Description)
+		}
+	}
+
+	fmt.Printf("\nCapabilities: %s\n", strings.Join(capabilities, ", "))
+}
+
+// RoleSave creates a role, or replaces the capabilities and description of one
+func RoleSave(args []string, update bool) {
+	command := "add"
+	if update {
+		command = "update"
+	}
+	if len(args) < 2 || len(args) > 3 {
+		fmt.Fprintf(os.Stderr, "Usage: pman role %s <name> <capabilities> [description]\n", command)
+		fmt.Fprintf(os.Stderr, "Example: pman role %s helpdesk users:read,users:write \"Resets passwords and MFA\"\n", command)
+		os.Exit(1)
+	}
+
+	req := models.RoleRequest{Name: args[0], Capabilities: auth.ParseCapabilities(args[1])}
+	if len(args) == 3 {
+		req.Description = args[2]
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if update {
+		err = client.UpdateRole(req.Name, req)
+	} else {
+		err = client.CreateRole(req)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving role: %v\n", err)
+		os.Exit(1)
+	}
+
+	if update {
+		fmt.Printf("Role updated: %s\n", req.Name)
+	} else {
+		fmt.Printf("Role created: %s\n", req.Name)
+	}
+}
+
+func RoleRemove(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman role rm <name>\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.DeleteRole(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing role: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Role removed: %s\n", args[0])
+}
@@ -0,0 +1,261 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/shared/models"
+)
+
+// Rotate rotates a password, or manages the rotators of passwords with the
+// set, ls and rm subcommands
+func Rotate(args []string) {
+	if len(args) == 0 {
+		showRotateUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "set":
+		RotateSet(args[1:])
+	case "list", "ls":
+		RotateList(args[1:])
+	case "rm", "remove", "del":
+		RotateRemove(args[1:])
+	default:
+		RotateNow(args)
+	}
+}
+
+func showRotateUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman rotate <path> [-g group]\n")
+	fmt.Fprintf(os.Stderr, "  pman rotate set <path> <rotator> [key=value...] [--every 30d] [-g group]\n")
+	fmt.Fprintf(os.Stderr, "  pman rotate ls [-g group]\n")
+	fmt.Fprintf(os.Stderr, "  pman rotate rm <path> [-g group]\n")
+	fmt.Fprintf(os.Stderr, "Rotators and their settings:\n")
+	fmt.Fprintf(os.Stderr, "  postgres  host, user; optional port, database, sslmode, length\n")
+	fmt.Fprintf(os.Stderr, "  mysql     host, user; optional port, length\n")
+	fmt.Fprintf(os.Stderr, "  command   command (an executable in the server's PMAN_ROTATOR_DIR)\n")
+	fmt.Fprintf(os.Stderr, "Without --every the password is only rotated with 'pman rotate <path>'.\n")
+}
+
+// rotateArgs parses the group flag and positional arguments of a rotate command
+func rotateArgs(name string, args []string) (*flag.FlagSet, func() string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Group name")
+	groupLongFlag := fs.String("group", "", "Group name")
+
+	return fs, func() string {
+		group := *groupFlag
+		if group == "" {
+			group = *groupLongFlag
+		}
+
+		resolvedGroup, err := resolveGroup(group)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return resolvedGroup
+	}
+}
+
+func RotateNow(args []string) {
+	fs, group := rotateArgs("rotate", args)
+	fs.Parse(expandCombinedFlags(args))
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		showRotateUsage()
+		os.Exit(1)
+	}
+	path := remainingArgs[0]
+	resolvedGroup := group()
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := client.RotatePassword(path, resolvedGroup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rotating password: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Password '%s' rotated; it is now version %d\n", path, result.Version)
+}
+
+func RotateSet(args []string) {
+	fs, group := rotateArgs("rotate set", args)
+	everyFlag := fs.String("every", "", "Rotate on this schedule, e.g. 30d, 12h or 90m")
+	fs.Parse(expandCombinedFlags(args))
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) < 2 {
+		showRotateUsage()
+		os.Exit(1)
+	}
+	path, rotator := remainingArgs[0], remainingArgs[1]
+
+	settings := make(map[string]string)
+	for _, arg := range remainingArgs[2:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Invalid setting: %s (use key=value)\n", arg)
+			os.Exit(1)
+		}
+		settings[key] = value
+	}
+
+	interval, err := parseRotationInterval(*everyFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	resolvedGroup := group()
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rotation, err := client.SetRotation(path, resolvedGroup, models.RotationRequest{
+		Rotator:         rotator,
+		Config:          settings,
+		IntervalMinutes: interval,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting rotator: %v\n", err)
+		os.Exit(1)
+	}
+
+	if rotation.NextRunAt != nil {
+		fmt.Printf("Password '%s' is rotated by %s every %s, next at %s\n", path, rotation.Rotator,
+			formatRotationInterval(rotation.IntervalMinutes), rotation.NextRunAt.Local().Format("2006-01-02 15:04"))
+	} else {
+		fmt.Printf("Password '%s' is rotated by %s on demand ('pman rotate %s')\n", path, rotation.Rotator, path)
+	}
+}
+
+func RotateList(args []string) {
+	fs := flag.NewFlagSet("rotate ls", flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Only passwords of this group")
+	groupLongFlag := fs.String("group", "", "Only passwords of this group")
+	fs.Parse(expandCombinedFlags(args))
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rotations, err := client.ListRotations(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing rotators: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(rotations) == 0 {
+		fmt.Println("No rotators")
+		return
+	}
+
+	fmt.Printf("%-12s %-30s %-9s %-9s %-17s %-17s %s\n", "GROUP", "PATH", "ROTATOR", "EVERY", "NEXT", "LAST", "STATUS")
+	fmt.Printf("%-12s %-30s %-9s %-9s %-17s %-17s %s\n", strings.Repeat("-", 12), strings.Repeat("-", 30), strings.Repeat("-", 9), strings.Repeat("-", 9), strings.Repeat("-", 17), strings.Repeat("-", 17), strings.Repeat("-", 10))
+	for _, rotation := range rotations {
+		every, next, last := "-", "-", "-"
+		if rotation.IntervalMinutes > 0 {
+			every = formatRotationInterval(rotation.IntervalMinutes)
+		}
+		if rotation.NextRunAt != nil {
+			next = rotation.NextRunAt.Local().Format("2006-01-02 15:04")
+		}
+		if rotation.LastRunAt != nil {
+			last = rotation.LastRunAt.Local().Format("2006-01-02 15:04")
+		}
+		status := rotation.LastStatus
+		if rotation.LastError != "" {
+			status += ": " + rotation.LastError
+		}
+		fmt.Printf("%-12s %-30s %-9s %-9s %-17s %-17s %s\n", rotation.Group, rotation.Path, rotation.Rotator, every, next, last, status)
+	}
+}
+
+func RotateRemove(args []string) {
+	fs, group := rotateArgs("rotate rm", args)
+	fs.Parse(expandCombinedFlags(args))
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		showRotateUsage()
+		os.Exit(1)
+	}
+	path := remainingArgs[0]
+	resolvedGroup := group()
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.DeleteRotation(path, resolvedGroup); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing rotator: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Password '%s' is no longer rotated\n", path)
+}
+
+// parseRotationInterval parses a schedule such as 30d, 12h or 90m into
+// minutes; an empty schedule is 0, rotation on demand only
+func parseRotationInterval(every string) (int, error) {
+	if every == "" {
+		return 0, nil
+	}
+
+	var interval time.Duration
+	if days, ok := strings.CutSuffix(every, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid schedule: %s (use e.g. 30d, 12h or 90m)", every)
+		}
+		interval = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(every)
+		if err != nil {
+			return 0, fmt.Errorf("invalid schedule: %s (use e.g. 30d, 12h or 90m)", every)
+		}
+		interval = d
+	}
+
+	if interval < time.Minute {
+		return 0, fmt.Errorf("invalid schedule: %s (the shortest is 1m)", every)
+	}
+	return int(interval / time.Minute), nil
+}
+
+// formatRotationInterval shows minutes in the largest whole unit
+func formatRotationInterval(minutes int) string {
+	switch {
+	case minutes%(24*60) == 0:
+		return fmt.Sprintf("%dd", minutes/(24*60))
+	case minutes%60 == 0:
+		return fmt.Sprintf("%dh", minutes/60)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func ServiceAccountAdd(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("svcadd", flag.ExitOnError)
+	prefixFlag := fs.String("prefix", "", "Comma-separated path prefixes the account is restricted to")
+	descFlag := fs.String("desc", "", "Description")
+	expireDays := fs.Int("expire", 0, "API key expiry in days (default: never)")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman svcadd <name> <groups> [--prefix paths] [--desc text] [--expire days]\n")
+		fmt.Fprintf(os.Stderr, "Example: pman svcadd ci-deploy \"team1\" --prefix deploy,ci   (groups are read-only unless given as team1:rw)\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	key, err := client.CreateServiceAccount(models.ServiceAccountRequest{
+		Name:         remainingArgs[0],
+		Description:  *descFlag,
+		Groups:       remainingArgs[1],
+		PathPrefixes: *prefixFlag,
+		ExpireDays:   *expireDays,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating service account: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Service account created successfully: %s\n", remainingArgs[0])
+	fmt.Printf("API key (shown only once): %s\n", key.Key)
+}
+
+func ServiceAccountDel(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("svcdel", flag.ExitOnError)
+	forceFlag := fs.Bool("f", false, "Force deletion without confirmation")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman svcdel <name> [-f]\n")
+		os.Exit(1)
+	}
+
+	name := remainingArgs[0]
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !*forceFlag {
+		message := fmt.Sprintf("Are you sure you want to delete service account '%s' and all its API keys", name)
+		if !confirmAction(message) {
+			fmt.Println("Service account deletion cancelled")
+			return
+		}
+	}
+
+	if err := client.DeleteServiceAccount(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting service account: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Service account deleted successfully: %s\n", name)
+}
+
+func ServiceAccountList(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("svclist", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Parse(args)
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	accounts, err := client.ListServiceAccounts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing service accounts: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonFlag {
+		jsonOutput, err := json.MarshalIndent(accounts, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error formatting JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonOutput))
+		return
+	}
+
+	fmt.Printf("%-25s %-25s %-25s %s\n", "NAME", "GROUPS", "PATHS", "DESCRIPTION")
+	fmt.Printf("%-25s %-25s %-25s %s\n", strings.Repeat("-", 25), strings.Repeat("-", 25), strings.Repeat("-", 25), strings.Repeat("-", 20))
+
+	for _, account := range accounts {
+		paths := account.PathPrefixes
+		if paths == "" {
+			paths = "(all)"
+		}
+		fmt.Printf("%-25s %-25s %-25s %s\n", account.Name, account.Groups, paths, account.Description)
+	}
+}
+
+func APIKeyList(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman svckeys <name>\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	keys, err := client.ListAPIKeys(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing API keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%-5s %-15s %-20s %-20s %-20s %s\n", "ID", "PREFIX", "CREATED", "EXPIRES", "LAST USED", "STATUS")
+	fmt.Printf("%-5s %-15s %-20s %-20s %-20s %s\n", strings.Repeat("-", 5), strings.Repeat("-", 15), strings.Repeat("-", 20), strings.Repeat("-", 20), strings.Repeat("-", 20), strings.Repeat("-", 8))
+
+	for _, key := range keys {
+		expires := "never"
+		if key.ExpiresAt != nil {
+			expires = key.ExpiresAt.Local().Format("2006-01-02 15:04")
+		}
+		lastUsed := "never"
+		if key.LastUsedAt != nil {
+			lastUsed = key.LastUsedAt.Local().Format("2006-01-02 15:04")
+		}
+		status := "active"
+		if key.Revoked {
+			status = "revoked"
+		}
+		fmt.Printf("%-5d %-15s %-20s %-20s %-20s %s\n", key.ID, key.Prefix, key.CreatedAt.Local().Format("2006-01-02 15:04"), expires, lastUsed, status)
+	}
+}
+
+func APIKeyAdd(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("svckeyadd", flag.ExitOnError)
+	expireDays := fs.Int("expire", 0, "API key expiry in days (default: never)")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman svckeyadd <name> [--expire days]\n")
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	key, err := client.CreateAPIKey(remainingArgs[0], *expireDays)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating API key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("API key created for %s (id %d)\n", remainingArgs[0], key.APIKey.ID)
+	fmt.Printf("API key (shown only once): %s\n", key.Key)
+}
+
+func APIKeyRevoke(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: pman svckeyrevoke <name> <key-id>\n")
+		os.Exit(1)
+	}
+
+	keyID, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid key ID '%s'\n", args[1])
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.RevokeAPIKey(args[0], keyID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error revoking API key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("API key %d revoked for %s\n", keyID, args[0])
+}
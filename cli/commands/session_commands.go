@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func Sessions(args []string) {
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	sessions, err := client.ListSessions()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing sessions: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(args) == 0:
+		printSessions(sessions)
+	case len(args) == 1 && args[0] == "--json":
+		printSessionsJSON(sessions)
+	case len(args) == 2 && (args[0] == "rm" || args[0] == "revoke"):
+		sessionID, err := matchSession(sessions, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := client.RevokeSession(sessionID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error revoking session: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session revoked: %s\n", shortSessionID(sessionID))
+	default:
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  pman sessions [--json]         - List your active sessions\n")
+		fmt.Fprintf(os.Stderr, "  pman sessions rm <id>          - Revoke one of your sessions\n")
+		os.Exit(1)
+	}
+}
+
+func UserSessions(args []string) {
+	if len(args) == 0 {
+		showUserSessionsUsage()
+		os.Exit(1)
+	}
+
+	email := args[0]
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	sessions, err := client.AdminListSessions(email)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing sessions: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(args) == 1:
+		printSessions(sessions)
+	case len(args) == 2 && args[1] == "--json":
+		printSessionsJSON(sessions)
+	case len(args) == 3 && (args[1] == "rm" || args[1] == "revoke") && args[2] == "all":
+		if err := client.AdminRevokeAllSessions(email); err != nil {
+			fmt.Fprintf(os.Stderr, "Error revoking sessions: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("All sessions revoked for: %s\n", email)
+	case len(args) == 3 && (args[1] == "rm" || args[1] == "revoke"):
+		sessionID, err := matchSession(sessions, args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := client.AdminRevokeSession(email, sessionID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error revoking session: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session revoked for %s: %s\n", email, shortSessionID(sessionID))
+	default:
+		showUserSessionsUsage()
+		os.Exit(1)
+	}
+}
+
+func showUserSessionsUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman usersessions <email> [--json]     - List a user's active sessions\n")
+	fmt.Fprintf(os.Stderr, "  pman usersessions <email> rm <id|all>  - Revoke one or all of a user's sessions\n")
+}
+
+// matchSession resolves a (possibly shortened) session ID as shown by 'pman sessions'
+func matchSession(sessions []models.Session, prefix string) (string, error) {
+	var matches []string
+	for _, session := range sessions {
+		if strings.HasPrefix(session.ID, prefix) {
+			matches = append(matches, session.ID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no active session matches '%s'", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("session ID '%s' is ambiguous", prefix)
+	}
+}
+
+func shortSessionID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func printSessions(sessions []models.Session) {
+	if len(sessions) == 0 {
+		fmt.Println("No active sessions")
+		return
+	}
+
+	fmt.Printf("  %-10s %-25s %-18s %-17s %-17s %s\n", "ID", "HOSTNAME", "IP", "CREATED", "LAST SEEN", "EXPIRES")
+	fmt.Printf("  %-10s %-25s %-18s %-17s %-17s %s\n", strings.Repeat("-", 10), strings.Repeat("-", 25), strings.Repeat("-", 18), strings.Repeat("-", 17), strings.Repeat("-", 17), strings.Repeat("-", 16))
+
+	for _, session := range sessions {
+		marker := " "
+		if session.Current {
+			marker = "*"
+		}
+		lastSeen := "-"
+		if session.LastSeenAt != nil {
+			lastSeen = session.LastSeenAt.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s %-10s %-25s %-18s %-17s %-17s %s\n", marker, shortSessionID(session.ID), session.ClientHostname, session.ClientIP,
+			session.CreatedAt.Local().Format("2006-01-02 15:04"), lastSeen, session.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+func printSessionsJSON(sessions []models.Session) {
+	jsonOutput, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error formatting JSON: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(jsonOutput))
+}
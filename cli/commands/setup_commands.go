@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/cli/config"
+	"github.com/steve/pman/shared/models"
+)
+
+// Setup creates the first admin of a new server with the setup token printed
+// in the server log
+func Setup(args []string) {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	server := fs.String("s", "", "Server URL")
+	token := fs.String("token", "", "Setup token from the server log")
+	email := fs.String("u", "", "Email address of the admin")
+	groups := fs.String("groups", "", "Groups of the admin, e.g. team1:rw,team2:rw")
+
+	fs.Parse(args)
+
+	if *server == "" || *token == "" || *email == "" {
+		fmt.Fprintf(os.Stderr, "Usage: pman setup -s <server> --token <setup token> -u <email> [--groups <groups>]\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	serverURL := *server
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "https://" + serverURL
+	}
+
+	c, err := newClient(cfg, serverURL, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	password, err := readPasswordTwice("Admin password")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = c.Setup(models.SetupRequest{Token: *token, Email: *email, Password: password, Groups: *groups})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up server: %v\n", err)
+		// Nobody can have changed the policy of a server without users
+		if strings.Contains(err.Error(), "password policy") {
+			fmt.Fprintf(os.Stderr, "\n%s\n", describePasswordPolicy(&models.PasswordPolicy{MinLength: 12, MinClasses: 3}))
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("Admin user created: %s\n", *email)
+	fmt.Printf("Log in with: pman login -s %s -u %s\n", serverURL, *email)
+}
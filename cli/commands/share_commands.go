@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/cli/config"
+	"github.com/steve/pman/shared/models"
+)
+
+// Share creates a one-time link to a password for someone without an account
+func Share(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Group name")
+	groupLongFlag := fs.String("group", "", "Group name")
+	expiresFlag := fs.String("expires", "1h", "How long the link works (e.g. 30m, 24h; at most 168h)")
+	viewsFlag := fs.Int("views", 1, "How many times the link can be opened (at most 10)")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman share <path> [--expires 1h] [--views 1] [-g group]\n")
+		fmt.Fprintf(os.Stderr, "The link works without an account and is deleted once used up or expired.\n")
+		os.Exit(1)
+	}
+
+	expires, err := time.ParseDuration(*expiresFlag)
+	if err != nil || expires < time.Minute {
+		fmt.Fprintf(os.Stderr, "Invalid duration: %s (e.g. 30m or 24h)\n", *expiresFlag)
+		os.Exit(1)
+	}
+	if *viewsFlag < 1 {
+		fmt.Fprintf(os.Stderr, "Invalid number of views: %d\n", *viewsFlag)
+		os.Exit(1)
+	}
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	resolvedGroup, err := resolveGroup(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	share, err := client.CreateShare(models.ShareRequest{
+		Group:          resolvedGroup,
+		Path:           remainingArgs[0],
+		ExpiresMinutes: int(expires / time.Minute),
+		Views:          *viewsFlag,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error sharing password: %v\n", err)
+		os.Exit(1)
+	}
+
+	link := strings.TrimSuffix(client.BaseURL, "/") + "/api/v1/share/" + share.Token
+	views := "1 view"
+	if share.Views != 1 {
+		views = fmt.Sprintf("%d views", share.Views)
+	}
+	fmt.Printf("Share link for %s:%s (%s, expires %s):\n", resolvedGroup, remainingArgs[0], views, share.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("  %s\n", link)
+	fmt.Printf("The recipient can open it, or run: pman share-get %s\n", link)
+}
+
+// ShareGet reads a password from a share link; no login is needed
+func ShareGet(args []string) {
+	args = expandCombinedFlags(args)
+
+	fs := flag.NewFlagSet("share-get", flag.ExitOnError)
+	serverFlag := fs.String("s", "", "Server URL (when only the token is given)")
+
+	fs.Parse(args)
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman share-get <link>\n")
+		fmt.Fprintf(os.Stderr, "       pman share-get <token> [-s server]\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	serverURL, token := *serverFlag, remainingArgs[0]
+	if i := strings.Index(token, "/share/"); i >= 0 {
+		serverURL, token = strings.TrimSuffix(token[:i], "/api/v1"), token[i+len("/share/"):]
+	}
+	if serverURL == "" {
+		serverURL = cfg.Server
+	}
+	if serverURL == "" {
+		fmt.Fprintf(os.Stderr, "No server given. Pass the whole link or use -s <server>\n")
+		os.Exit(1)
+	}
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "https://" + serverURL
+	}
+
+	c, err := newClient(cfg, serverURL, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	shared, err := c.OpenShare(token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading share link: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(shared.Value)
+	if shared.ViewsLeft == 0 {
+		fmt.Fprintf(os.Stderr, "\nThis link has now been used up\n")
+	}
+}
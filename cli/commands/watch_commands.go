@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/steve/pman/cli/client"
+	"github.com/steve/pman/shared/models"
+)
+
+// Signals 'pman watch --signal' knows by name; others can be given by number
+var watchSignals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+}
+
+// Watch waits for changes to passwords under a prefix and runs a command or
+// signals a process after each burst of changes
+func Watch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	groupFlag := fs.String("g", "", "Group name")
+	groupLongFlag := fs.String("group", "", "Group name")
+	execFlag := fs.String("exec", "", "Command to run after changes")
+	signalFlag := fs.String("signal", "", "Signal to send after changes (e.g. HUP, or a number)")
+	pidFlag := fs.Int("pid", 0, "Process to send the signal to")
+	delayFlag := fs.Duration("delay", 2*time.Second, "How long to wait for further changes before acting")
+
+	fs.Parse(expandCombinedFlags(args))
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) > 1 || (*signalFlag == "") != (*pidFlag == 0) || (*execFlag != "" && *signalFlag != "") {
+		fmt.Fprintf(os.Stderr, "Usage: pman watch [prefix] [-g group] [--exec <command> | --signal HUP --pid <pid>] [--delay 2s]\n")
+		fmt.Fprintf(os.Stderr, "Without --exec or --signal, changes are printed. The command gets PMAN_EVENT,\n")
+		fmt.Fprintf(os.Stderr, "PMAN_GROUP and PMAN_PATH of the last change of each burst.\n")
+		os.Exit(1)
+	}
+
+	var signal syscall.Signal
+	if *signalFlag != "" {
+		name := strings.TrimPrefix(strings.ToUpper(*signalFlag), "SIG")
+		if s, ok := watchSignals[name]; ok {
+			signal = s
+		} else if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			signal = syscall.Signal(n)
+		} else {
+			fmt.Fprintf(os.Stderr, "Unknown signal: %s (use HUP, INT, QUIT, TERM, KILL or a number)\n", *signalFlag)
+			os.Exit(1)
+		}
+	}
+
+	prefix := ""
+	if len(remainingArgs) == 1 {
+		prefix = remainingArgs[0]
+	}
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	resolvedGroup, err := resolveGroup(group)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	c, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The stream is reopened whenever it ends, waiting longer after each
+	// failure, until the credentials are refused; changes made while it was
+	// closed are not reported
+	changes := make(chan models.Event, 100)
+	go func() {
+		for attempt, failures := 1, 0; ; attempt++ {
+			err := c.StreamEvents(resolvedGroup, prefix, func(event models.Event) {
+				failures = 0
+				changes <- event
+			})
+			if err == nil {
+				continue
+			}
+			if attempt == 1 || errors.Is(err, client.ErrUnauthorized) {
+				fmt.Fprintf(os.Stderr, "Error watching for changes: %v\n", err)
+				os.Exit(1)
+			}
+
+			failures++
+			wait := time.Duration(failures) * 5 * time.Second
+			if wait > time.Minute {
+				wait = time.Minute
+			}
+			fmt.Fprintf(os.Stderr, "Lost connection (%v); reconnecting in %s\n", err, wait)
+			time.Sleep(wait)
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Watching %s:%s for changes (Ctrl+C to stop)\n", resolvedGroup, prefix)
+	for event := range changes {
+		// Wait for the burst of changes to end, so a rotation of several
+		// secrets leads to a single run
+		last := event
+		printChange(event)
+		timeout := time.After(*delayFlag)
+	burst:
+		for {
+			select {
+			case event := <-changes:
+				last = event
+				printChange(event)
+			case <-timeout:
+				break burst
+			}
+		}
+
+		switch {
+		case *execFlag != "":
+			runWatchCommand(*execFlag, last)
+		case signal != 0:
+			process, err := os.FindProcess(*pidFlag)
+			if err == nil {
+				err = process.Signal(signal)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error signalling process %d: %v\n", *pidFlag, err)
+			}
+		}
+	}
+}
+
+func printChange(event models.Event) {
+	fmt.Printf("%s %-17s %s:%s by %s\n", event.Time.Local().Format("2006-01-02 15:04:05"), event.Type, event.Group, event.Path, event.Actor)
+}
+
+// runWatchCommand runs command through the shell and waits for it
+func runWatchCommand(command string, event models.Event) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PMAN_EVENT="+event.Type, "PMAN_GROUP="+event.Group, "PMAN_PATH="+event.Path)
+
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Command failed: %v\n", err)
+	}
+}
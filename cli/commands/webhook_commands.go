@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/steve/pman/shared/models"
+)
+
+func Webhook(args []string) {
+	if len(args) == 0 {
+		showWebhookUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		WebhookList(args[1:])
+	case "add":
+		WebhookAdd(args[1:])
+	case "rm", "remove", "del":
+		WebhookRemove(args[1:])
+	case "test":
+		WebhookTest(args[1:])
+	case "log":
+		WebhookLog(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown webhook command: %s\n", args[0])
+		showWebhookUsage()
+		os.Exit(1)
+	}
+}
+
+func showWebhookUsage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  pman webhook ls\n")
+	fmt.Fprintf(os.Stderr, "  pman webhook add <url> [--events password.*,user.deleted] [-g group] [--prefix path]\n")
+	fmt.Fprintf(os.Stderr, "                       [--secret secret]\n")
+	fmt.Fprintf(os.Stderr, "  pman webhook rm <id>\n")
+	fmt.Fprintf(os.Stderr, "  pman webhook test <id>\n")
+	fmt.Fprintf(os.Stderr, "  pman webhook log <id>\n")
+	fmt.Fprintf(os.Stderr, "Events: password.created, password.updated, password.deleted, user.created,\n")
+	fmt.Fprintf(os.Stderr, "user.updated, user.deleted, user.enabled, user.disabled; '*' (default) for all.\n")
+	fmt.Fprintf(os.Stderr, "Requests carry X-Pman-Signature: t=<unix time>,sha256=<HMAC-SHA256 of \"<t>.<body>\"\n")
+	fmt.Fprintf(os.Stderr, "with the secret>; reject requests whose t is more than a few minutes old.\n")
+}
+
+// webhookArg parses the webhook ID of a webhook command
+func webhookArg(args []string, command string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: pman webhook %s <id>\n", command)
+		os.Exit(1)
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid webhook ID: %s (see 'pman webhook ls')\n", args[0])
+		os.Exit(1)
+	}
+	return id
+}
+
+func WebhookList(args []string) {
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	webhooks, err := client.ListWebhooks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing webhooks: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(webhooks) == 0 {
+		fmt.Println("No webhooks")
+		return
+	}
+
+	fmt.Printf("%-4s %-40s %-25s %-12s %-15s %s\n", "ID", "URL", "EVENTS", "GROUP", "PREFIX", "CREATED BY")
+	fmt.Printf("%-4s %-40s %-25s %-12s %-15s %s\n", strings.Repeat("-", 4), strings.Repeat("-", 40), strings.Repeat("-", 25), strings.Repeat("-", 12), strings.Repeat("-", 15), strings.Repeat("-", 20))
+	for _, webhook := range webhooks {
+		group, prefix := webhook.Group, webhook.PathPrefix
+		if group == "" {
+			group = "*"
+		}
+		if prefix == "" {
+			prefix = "*"
+		}
+		fmt.Printf("%-4d %-40s %-25s %-12s %-15s %s\n", webhook.ID, webhook.URL, webhook.Events, group, prefix, webhook.CreatedBy)
+	}
+}
+
+func WebhookAdd(args []string) {
+	fs := flag.NewFlagSet("webhook add", flag.ExitOnError)
+	eventsFlag := fs.String("events", "*", "Comma-separated events to send")
+	groupFlag := fs.String("g", "", "Only events of this group")
+	groupLongFlag := fs.String("group", "", "Only events of this group")
+	prefixFlag := fs.String("prefix", "", "Only events of paths under this prefix")
+	secretFlag := fs.String("secret", "", "Signing secret (generated if not given)")
+
+	fs.Parse(expandCombinedFlags(args))
+	remainingArgs := fs.Args()
+
+	if len(remainingArgs) != 1 {
+		showWebhookUsage()
+		os.Exit(1)
+	}
+
+	group := *groupFlag
+	if group == "" {
+		group = *groupLongFlag
+	}
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	webhook, err := client.CreateWebhook(models.WebhookRequest{
+		URL:        remainingArgs[0],
+		Secret:     *secretFlag,
+		Events:     *eventsFlag,
+		Group:      group,
+		PathPrefix: *prefixFlag,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating webhook: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Webhook %d created for events %s\n", webhook.ID, webhook.Events)
+	if *secretFlag == "" {
+		fmt.Printf("Signing secret: %s\n", webhook.Secret)
+		fmt.Printf("Store it now; it will not be shown again\n")
+	}
+}
+
+func WebhookRemove(args []string) {
+	id := webhookArg(args, "rm")
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := client.DeleteWebhook(id); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting webhook: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Webhook %d deleted\n", id)
+}
+
+func WebhookTest(args []string) {
+	id := webhookArg(args, "test")
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	delivery, err := client.TestWebhook(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error testing webhook: %v\n", err)
+		os.Exit(1)
+	}
+
+	if delivery.Error != "" {
+		fmt.Fprintf(os.Stderr, "Ping to webhook %d failed: %s\n", id, delivery.Error)
+		os.Exit(1)
+	}
+	fmt.Printf("Ping to webhook %d delivered (HTTP %d)\n", id, delivery.ResponseCode)
+}
+
+func WebhookLog(args []string) {
+	id := webhookArg(args, "log")
+
+	client, err := getAuthenticatedClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	deliveries, err := client.ListWebhookDeliveries(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing deliveries: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(deliveries) == 0 {
+		fmt.Printf("Webhook %d has no deliveries\n", id)
+		return
+	}
+
+	fmt.Printf("%-6s %-17s %-18s %-10s %-8s %-5s %s\n", "ID", "TIME", "EVENT", "STATUS", "ATTEMPTS", "HTTP", "ERROR")
+	fmt.Printf("%-6s %-17s %-18s %-10s %-8s %-5s %s\n", strings.Repeat("-", 6), strings.Repeat("-", 17), strings.Repeat("-", 18), strings.Repeat("-", 10), strings.Repeat("-", 8), strings.Repeat("-", 5), strings.Repeat("-", 20))
+	for _, delivery := range deliveries {
+		code := "-"
+		if delivery.ResponseCode != 0 {
+			code = strconv.Itoa(delivery.ResponseCode)
+		}
+		fmt.Printf("%-6d %-17s %-18s %-10s %-8d %-5s %s\n", delivery.ID, delivery.CreatedAt.Local().Format("2006-01-02 15:04"),
+			delivery.Event, delivery.Status, delivery.Attempts, code, delivery.Error)
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/steve/pman/cli/crypto"
+)
+
+// OfflineCache stores secrets read while online so they can be retrieved with
+// 'pman get --offline'. Values are sealed with keys protected by the login
+// password and expire according to the group's cache policy on the server.
+type OfflineCache struct {
+	Keys    *crypto.CacheKeys     `json:"keys"`
+	Entries map[string]CacheEntry `json:"entries"`
+}
+
+type CacheEntry struct {
+	Group       string    `json:"group"`
+	Path        string    `json:"path"`
+	Value       string    `json:"value"`
+	CachedAt    time.Time `json:"cached_at"`
+	MaxAgeHours int       `json:"max_age_hours"`
+}
+
+func (e CacheEntry) ExpiresAt() time.Time {
+	return e.CachedAt.Add(time.Duration(e.MaxAgeHours) * time.Hour)
+}
+
+func (e CacheEntry) IsExpired() bool {
+	return !time.Now().Before(e.ExpiresAt())
+}
+
+func cacheKey(group, path string) string {
+	return group + "/" + path
+}
+
+// getCachePath returns the cache file of a profile. Each profile has its own
+// cache since group names are only unique per server.
+func getCachePath(profile string) (string, error) {
+	// The name becomes part of a file name
+	if err := ValidateProfileName(profile); err != nil {
+		return "", err
+	}
+
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if profile == DefaultProfile {
+		return filepath.Join(configDir, "cache.json"), nil
+	}
+	return filepath.Join(configDir, "cache-"+profile+".json"), nil
+}
+
+func LoadCache() (*OfflineCache, error) {
+	cachePath, err := getCachePath(ActiveProfileName())
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &OfflineCache{Entries: map[string]CacheEntry{}}
+
+	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
+		return cache, nil
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, err
+	}
+
+	if cache.Entries == nil {
+		cache.Entries = map[string]CacheEntry{}
+	}
+
+	return cache, nil
+}
+
+func (c *OfflineCache) Save() error {
+	cachePath, err := getCachePath(ActiveProfileName())
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cachePath, data, 0600)
+}
+
+func (c *OfflineCache) Enabled() bool {
+	return c.Keys != nil
+}
+
+// Enable (re)initialises the cache with keys derived from the login password,
+// discarding any previously cached entries
+func (c *OfflineCache) Enable(password string) error {
+	keys, err := crypto.GenerateCacheKeys(password)
+	if err != nil {
+		return err
+	}
+
+	c.Keys = keys
+	c.Entries = map[string]CacheEntry{}
+	return c.Save()
+}
+
+func (c *OfflineCache) Put(group, path, value string, maxAgeHours int) error {
+	if maxAgeHours <= 0 {
+		return c.Remove(group, path)
+	}
+
+	sealed, err := crypto.SealCacheData(c.Keys, value)
+	if err != nil {
+		return err
+	}
+
+	c.Entries[cacheKey(group, path)] = CacheEntry{
+		Group:       group,
+		Path:        path,
+		Value:       sealed,
+		CachedAt:    time.Now(),
+		MaxAgeHours: maxAgeHours,
+	}
+	return c.Save()
+}
+
+func (c *OfflineCache) Get(group, path string) (CacheEntry, bool) {
+	entry, ok := c.Entries[cacheKey(group, path)]
+	return entry, ok
+}
+
+func (c *OfflineCache) Remove(group, path string) error {
+	key := cacheKey(group, path)
+	if _, ok := c.Entries[key]; !ok {
+		return nil
+	}
+
+	delete(c.Entries, key)
+	return c.Save()
+}
+
+// Prune drops entries older than their group's max age and returns how many were removed
+func (c *OfflineCache) Prune() (int, error) {
+	removed := 0
+	for key, entry := range c.Entries {
+		if entry.IsExpired() {
+			delete(c.Entries, key)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, c.Save()
+}
+
+func (c *OfflineCache) Clear() error {
+	c.Entries = map[string]CacheEntry{}
+	return c.Save()
+}
+
+func DeleteCache() error {
+	return deleteCacheFile(ActiveProfileName())
+}
+
+func deleteCacheFile(profile string) error {
+	cachePath, err := getCachePath(profile)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(cachePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -5,15 +5,53 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 
 	"github.com/steve/pman/cli/crypto"
 )
 
+const DefaultProfile = "default"
+
+// Config is the active profile. Commands load and save it without needing to
+// know about the other profiles stored alongside it in the config file.
 type Config struct {
-	Server       string `json:"server"`
-	Email        string `json:"email"`
-	Token        string `json:"token"`
-	DefaultGroup string `json:"default_group"`
+	Profile               string `json:"-"`
+	Server                string `json:"server"`
+	Email                 string `json:"email"`
+	Token                 string `json:"token"`
+	RefreshToken          string `json:"refresh_token,omitempty"`
+	DefaultGroup          string `json:"default_group"`
+	TLSCACert             string `json:"tls_ca_cert,omitempty"`
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty"`
+}
+
+// configFile is the on-disk layout. Server, Email, Token and DefaultGroup at the
+// top level are from configs written before profiles existed and are migrated
+// into the default profile on load.
+type configFile struct {
+	CurrentProfile string             `json:"current_profile,omitempty"`
+	Profiles       map[string]*Config `json:"profiles,omitempty"`
+	Server         string             `json:"server,omitempty"`
+	Email          string             `json:"email,omitempty"`
+	Token          string             `json:"token,omitempty"`
+	DefaultGroup   string             `json:"default_group,omitempty"`
+}
+
+var profileOverride string
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func ValidateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name '%s' (use letters, digits, '-' and '_')", name)
+	}
+	return nil
+}
+
+// SetProfileOverride selects the profile for this invocation (the --profile flag)
+func SetProfileOverride(name string) {
+	profileOverride = name
 }
 
 func getConfigDir() (string, error) {
@@ -38,14 +76,16 @@ func getConfigPath() (string, error) {
 	return filepath.Join(configDir, "config.json"), nil
 }
 
-func LoadConfig() (*Config, error) {
+func loadConfigFile() (*configFile, error) {
 	configPath, err := getConfigPath()
 	if err != nil {
 		return nil, err
 	}
 
+	file := &configFile{Profiles: map[string]*Config{}}
+
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return &Config{}, nil
+		return file, nil
 	}
 
 	data, err := os.ReadFile(configPath)
@@ -53,38 +93,78 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := json.Unmarshal(data, file); err != nil {
 		return nil, err
 	}
 
-	if config.Token != "" {
-		decryptedToken, err := crypto.DecryptClientData(config.Token)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decrypt token: %v", err)
+	if file.Profiles == nil {
+		file.Profiles = map[string]*Config{}
+	}
+
+	if file.Server != "" || file.Token != "" {
+		if _, exists := file.Profiles[DefaultProfile]; !exists {
+			file.Profiles[DefaultProfile] = &Config{
+				Server:       file.Server,
+				Email:        file.Email,
+				Token:        file.Token,
+				DefaultGroup: file.DefaultGroup,
+			}
+		}
+		file.Server, file.Email, file.Token, file.DefaultGroup = "", "", "", ""
+	}
+
+	for name, profile := range file.Profiles {
+		profile.Profile = name
+		if profile.Token != "" {
+			decryptedToken, err := crypto.DecryptClientData(profile.Token)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt token for profile '%s': %v", name, err)
+			}
+			profile.Token = decryptedToken
+		}
+		if profile.RefreshToken != "" {
+			decryptedToken, err := crypto.DecryptClientData(profile.RefreshToken)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt refresh token for profile '%s': %v", name, err)
+			}
+			profile.RefreshToken = decryptedToken
 		}
-		config.Token = decryptedToken
 	}
 
-	return &config, nil
+	return file, nil
 }
 
-func (c *Config) Save() error {
+func (f *configFile) save() error {
 	configPath, err := getConfigPath()
 	if err != nil {
 		return err
 	}
 
-	configToSave := *c
-	if configToSave.Token != "" {
-		encryptedToken, err := crypto.EncryptClientData(configToSave.Token)
-		if err != nil {
-			return fmt.Errorf("failed to encrypt token: %v", err)
+	fileToSave := configFile{
+		CurrentProfile: f.CurrentProfile,
+		Profiles:       map[string]*Config{},
+	}
+
+	for name, profile := range f.Profiles {
+		profileToSave := *profile
+		if profileToSave.Token != "" {
+			encryptedToken, err := crypto.EncryptClientData(profileToSave.Token)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt token: %v", err)
+			}
+			profileToSave.Token = encryptedToken
+		}
+		if profileToSave.RefreshToken != "" {
+			encryptedToken, err := crypto.EncryptClientData(profileToSave.RefreshToken)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt refresh token: %v", err)
+			}
+			profileToSave.RefreshToken = encryptedToken
 		}
-		configToSave.Token = encryptedToken
+		fileToSave.Profiles[name] = &profileToSave
 	}
 
-	data, err := json.MarshalIndent(configToSave, "", "  ")
+	data, err := json.MarshalIndent(fileToSave, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -92,8 +172,79 @@ func (c *Config) Save() error {
 	return os.WriteFile(configPath, data, 0600)
 }
 
+func (f *configFile) activeProfile() string {
+	return resolveProfile(f.CurrentProfile)
+}
+
+func resolveProfile(currentProfile string) string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+	if profile := os.Getenv("PMAN_PROFILE"); profile != "" {
+		return profile
+	}
+	if currentProfile != "" {
+		return currentProfile
+	}
+	return DefaultProfile
+}
+
+// ActiveProfileName returns the profile selected by --profile, PMAN_PROFILE or 'pman profile use'
+func ActiveProfileName() string {
+	file, err := loadConfigFile()
+	if err != nil {
+		return resolveProfile("")
+	}
+	return file.activeProfile()
+}
+
+// LoadConfig returns the active profile. A profile that does not exist yet is
+// returned empty and created on the first Save (e.g. by 'pman login').
+func LoadConfig() (*Config, error) {
+	file, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	name := file.activeProfile()
+	if profile, exists := file.Profiles[name]; exists {
+		return profile, nil
+	}
+
+	return &Config{Profile: name}, nil
+}
+
+// LoadProfile returns a profile as currently saved, including changes made by
+// other pman processes since this one started
+func LoadProfile(name string) (*Config, error) {
+	file, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if profile, exists := file.Profiles[name]; exists {
+		return profile, nil
+	}
+	return nil, fmt.Errorf("profile '%s' not found", name)
+}
+
+func (c *Config) Save() error {
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if c.Profile == "" {
+		c.Profile = file.activeProfile()
+	}
+
+	file.Profiles[c.Profile] = c
+	return file.save()
+}
+
 func (c *Config) ClearToken() error {
 	c.Token = ""
+	c.RefreshToken = ""
 	return c.Save()
 }
 
@@ -108,4 +259,76 @@ func GetGroup() string {
 	}
 
 	return config.DefaultGroup
-}
\ No newline at end of file
+}
+
+// ListProfiles returns all profiles sorted by name
+func ListProfiles() ([]*Config, error) {
+	file, err := loadConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []*Config
+	for _, profile := range file.Profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Profile < profiles[j].Profile
+	})
+
+	return profiles, nil
+}
+
+func AddProfile(profile *Config) error {
+	if err := ValidateProfileName(profile.Profile); err != nil {
+		return err
+	}
+
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := file.Profiles[profile.Profile]; exists {
+		return fmt.Errorf("profile '%s' already exists", profile.Profile)
+	}
+
+	file.Profiles[profile.Profile] = profile
+	return file.save()
+}
+
+func UseProfile(name string) error {
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := file.Profiles[name]; !exists {
+		return fmt.Errorf("profile '%s' does not exist", name)
+	}
+
+	file.CurrentProfile = name
+	return file.save()
+}
+
+func RemoveProfile(name string) error {
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := file.Profiles[name]; !exists {
+		return fmt.Errorf("profile '%s' does not exist", name)
+	}
+
+	delete(file.Profiles, name)
+	if file.CurrentProfile == name {
+		file.CurrentProfile = ""
+	}
+
+	if err := file.save(); err != nil {
+		return err
+	}
+
+	return deleteCacheFile(name)
+}
@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Offline cache entries are sealed to a per-user public key so they can be
+// written without the login password. The matching private key is stored
+// encrypted with a key derived from the login password, so reading the cache
+// back requires the password rather than just access to this machine.
+
+// CacheKeys holds the base64 encoded key material persisted in the cache file
+type CacheKeys struct {
+	Salt                string `json:"salt"`
+	PublicKey           string `json:"public_key"`
+	EncryptedPrivateKey string `json:"encrypted_private_key"`
+}
+
+func derivePasswordKey(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
+}
+
+func GenerateCacheKeys(password string) (*CacheKeys, error) {
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivePasswordKey(password, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealedPrivateKey := gcm.Seal(nonce, nonce, privateKey[:], nil)
+
+	return &CacheKeys{
+		Salt:                base64.StdEncoding.EncodeToString(salt),
+		PublicKey:           base64.StdEncoding.EncodeToString(publicKey[:]),
+		EncryptedPrivateKey: base64.StdEncoding.EncodeToString(sealedPrivateKey),
+	}, nil
+}
+
+// UnlockCacheKey decrypts the cache private key with the login password
+func UnlockCacheKey(keys *CacheKeys, password string) (*[32]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(keys.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(keys.EncryptedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivePasswordKey(password, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext_bytes := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext_bytes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect password")
+	}
+
+	if len(plaintext) != 32 {
+		return nil, fmt.Errorf("invalid cache key")
+	}
+
+	var privateKey [32]byte
+	copy(privateKey[:], plaintext)
+	return &privateKey, nil
+}
+
+func SealCacheData(keys *CacheKeys, plaintext string) (string, error) {
+	publicKey, err := decodeKey(keys.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := box.SealAnonymous(nil, []byte(plaintext), publicKey, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func OpenCacheData(keys *CacheKeys, privateKey *[32]byte, ciphertext string) (string, error) {
+	publicKey, err := decodeKey(keys.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, ok := box.OpenAnonymous(nil, data, publicKey, privateKey)
+	if !ok {
+		return "", fmt.Errorf("failed to decrypt cached value")
+	}
+
+	return string(plaintext), nil
+}
+
+func decodeKey(encoded string) (*[32]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 32 {
+		return nil, fmt.Errorf("invalid cache key")
+	}
+
+	var key [32]byte
+	copy(key[:], data)
+	return &key, nil
+}
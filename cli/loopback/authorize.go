@@ -0,0 +1,81 @@
+package loopback
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const callbackPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>pman</title></head>
+<body style="font-family: sans-serif; margin: 3em;"><p>%s</p></body></html>`
+
+// Authorize runs the browser part of an OAuth authorization code flow with a
+// loopback redirect (RFC 8252). buildURL receives the redirect URI to register
+// in the authorization request. The authorization code is returned, together
+// with the redirect URI the token request must repeat, once a callback
+// carrying the expected state arrives.
+func Authorize(buildURL func(redirectURI string) string, state string) (code, redirectURI string, err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start local server: %v", err)
+	}
+
+	redirectURI = fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+	authURL := buildURL(redirectURI)
+
+	results := make(chan url.Values, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodGet || query.Get("state") != state {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if query.Get("error") != "" {
+			fmt.Fprintf(w, callbackPage, "Sign-in failed. You can close this window.")
+		} else {
+			fmt.Fprintf(w, callbackPage, "Signed in to pman. You can close this window.")
+		}
+
+		select {
+		case results <- query:
+		default:
+		}
+	})
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Println("Sign in with your identity provider in the browser:")
+	fmt.Printf("  %s\n", authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Println("(Could not open a browser automatically, open the URL above)")
+	}
+
+	select {
+	case query := <-results:
+		if errCode := query.Get("error"); errCode != "" {
+			if description := query.Get("error_description"); description != "" {
+				return "", "", fmt.Errorf("identity provider reported: %s (%s)", errCode, description)
+			}
+			return "", "", fmt.Errorf("identity provider reported: %s", errCode)
+		}
+		if query.Get("code") == "" {
+			return "", "", errors.New("identity provider returned no authorization code")
+		}
+		return query.Get("code"), redirectURI, nil
+	case <-time.After(timeout):
+		return "", "", errors.New("timed out waiting for the browser sign-in")
+	}
+}
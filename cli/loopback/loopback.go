@@ -0,0 +1,148 @@
+// Package loopback runs browser-based steps of a CLI login. Security keys can
+// only be used from a web page, so for WebAuthn the CLI serves a small page on
+// localhost, opens it, and waits for the page to post back the result. Single
+// sign-on uses the same local server to receive the OAuth redirect.
+package loopback
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+const (
+	CeremonyCreate = "create"
+	CeremonyGet    = "get"
+
+	timeout = 3 * time.Minute
+)
+
+//go:embed page.html
+var page []byte
+
+type result struct {
+	Credential json.RawMessage `json:"credential"`
+	Error      string          `json:"error"`
+}
+
+// Run serves the ceremony page for the given publicKey options (as returned by
+// the server) and returns the credential posted back by the browser
+func Run(ceremony string, options json.RawMessage) (json.RawMessage, error) {
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return nil, err
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start local server: %v", err)
+	}
+
+	// The page must be served from "localhost" (not 127.0.0.1), which is the
+	// host browsers accept as a secure origin and the server's default RP ID
+	host := fmt.Sprintf("localhost:%d", listener.Addr().(*net.TCPAddr).Port)
+	pageURL := fmt.Sprintf("http://%s/?state=%s", host, state)
+
+	results := make(chan result, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" || r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+		w.Write(page)
+	})
+	mux.HandleFunc("/options", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ceremony":  ceremony,
+			"publicKey": options,
+		})
+	})
+	mux.HandleFunc("/result", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var res result
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&res); err != nil {
+			http.Error(w, "invalid result", http.StatusBadRequest)
+			return
+		}
+		select {
+		case results <- res:
+		default:
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{
+		Handler:           requireHostAndState(host, state, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Println("Complete the security key step in your browser:")
+	fmt.Printf("  %s\n", pageURL)
+	if err := openBrowser(pageURL); err != nil {
+		fmt.Println("(Could not open a browser automatically, open the URL above)")
+	}
+
+	select {
+	case res := <-results:
+		if res.Error != "" {
+			return nil, fmt.Errorf("browser reported: %s", res.Error)
+		}
+		if len(res.Credential) == 0 {
+			return nil, errors.New("browser returned no credential")
+		}
+		return res.Credential, nil
+	case <-time.After(timeout):
+		return nil, errors.New("timed out waiting for the security key")
+	}
+}
+
+// requireHostAndState rejects requests that did not come from the page we
+// opened: the Host check stops DNS rebinding, the state stops other local pages
+func requireHostAndState(host, state string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != host || r.URL.Query().Get("state") != state {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func openBrowser(url string) error {
+	if browser := os.Getenv("BROWSER"); browser != "" {
+		return exec.Command(browser, url).Start()
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/steve/pman/cli/commands"
+	"github.com/steve/pman/cli/config"
 )
 
 var (
@@ -12,17 +14,37 @@ var (
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	cliArgs, profile, err := extractProfileFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if profile != "" {
+		if err := config.ValidateProfileName(profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		config.SetProfileOverride(profile)
+	} else if env := os.Getenv("PMAN_PROFILE"); env != "" {
+		if err := config.ValidateProfileName(env); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: PMAN_PROFILE: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(cliArgs) < 1 {
 		commands.ShowHelp()
 		os.Exit(1)
 	}
 
-	command := os.Args[1]
-	args := os.Args[2:]
+	command := cliArgs[0]
+	args := cliArgs[1:]
 
 	switch command {
 	case "login":
 		commands.Login(args)
+	case "setup":
+		commands.Setup(args)
 	case "logout":
 		commands.Logout(args)
 	case "setgroup":
@@ -39,6 +61,16 @@ func main() {
 		commands.Delete(args)
 	case "info":
 		commands.Info(args)
+	case "share":
+		commands.Share(args)
+	case "grant":
+		commands.Grant(args)
+	case "share-get":
+		commands.ShareGet(args)
+	case "watch":
+		commands.Watch(args)
+	case "rotate":
+		commands.Rotate(args)
 	case "version":
 		fmt.Printf("pman: v%s\n", Version)
 	case "status":
@@ -55,10 +87,72 @@ func main() {
 		commands.UserDisable(args)
 	case "userenable":
 		commands.UserEnable(args)
+	case "userunlock":
+		commands.UserUnlock(args)
+	case "lockouts":
+		commands.Lockouts(args)
 	case "passwd":
 		commands.Passwd(args)
 	case "whoami":
 		commands.Whoami(args)
+	case "sessions":
+		commands.Sessions(args)
+	case "usersessions":
+		commands.UserSessions(args)
+	case "mfa":
+		commands.MFA(args)
+	case "usermfareset":
+		commands.UserMFAReset(args)
+	case "mfapolicy":
+		commands.MFAPolicy(args)
+	case "pwpolicy":
+		commands.PasswordPolicy(args)
+	case "cache":
+		commands.Cache(args)
+	case "groupadd":
+		commands.GroupAdd(args)
+	case "groupupdate":
+		commands.GroupUpdate(args)
+	case "groupdel":
+		commands.GroupDel(args)
+	case "grouplist":
+		commands.GroupList(args)
+	case "groupinfo":
+		commands.GroupInfo(args)
+	case "groupmember":
+		commands.GroupMember(args)
+	case "acl":
+		commands.ACL(args)
+	case "role":
+		commands.Role(args)
+	case "webhook", "webhooks":
+		commands.Webhook(args)
+	case "approval":
+		commands.Approval(args)
+	case "request":
+		commands.Request(args)
+	case "requests":
+		commands.Requests(args)
+	case "approve":
+		commands.Decide(args, true)
+	case "deny":
+		commands.Decide(args, false)
+	case "groupcache":
+		commands.GroupCache(args)
+	case "profile":
+		commands.Profile(args)
+	case "svcadd":
+		commands.ServiceAccountAdd(args)
+	case "svcdel":
+		commands.ServiceAccountDel(args)
+	case "svclist":
+		commands.ServiceAccountList(args)
+	case "svckeys":
+		commands.APIKeyList(args)
+	case "svckeyadd":
+		commands.APIKeyAdd(args)
+	case "svckeyrevoke":
+		commands.APIKeyRevoke(args)
 	case "help", "--help", "-h":
 		commands.ShowHelp()
 	default:
@@ -67,3 +161,33 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// extractProfileFlag removes the global --profile flag from the arguments. It
+// must come before the command, so a path or value that happens to be
+// "--profile" is left alone; scanning stops at the command or at "--".
+func extractProfileFlag(args []string) ([]string, string, error) {
+	var remaining []string
+	var profile string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(remaining, args[i+1:]...), profile, nil
+		case arg == "--profile" || arg == "-profile":
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("--profile requires a profile name")
+			}
+			i++
+			profile = args[i]
+		case strings.HasPrefix(arg, "--profile="):
+			profile = strings.TrimPrefix(arg, "--profile=")
+		case strings.HasPrefix(arg, "-"):
+			remaining = append(remaining, arg)
+		default:
+			return append(remaining, args[i:]...), profile, nil
+		}
+	}
+
+	return remaining, profile, nil
+}
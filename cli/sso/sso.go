@@ -0,0 +1,200 @@
+// Package sso obtains an ID token from the organisation's OpenID Connect
+// identity provider, either in the browser (authorization code flow with PKCE)
+// or on another device (device authorization grant) for machines without one.
+package sso
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/steve/pman/cli/loopback"
+	"github.com/steve/pman/shared/models"
+	"github.com/steve/pman/shared/oidc"
+)
+
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type deviceResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// BrowserLogin signs the user in through the browser and returns the ID token
+// and the nonce it was requested with
+func BrowserLogin(cfg *models.OIDCConfig) (idToken, nonce string, err error) {
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	state, err := oidc.RandomString(16)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err = oidc.RandomString(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	buildURL := func(redirectURI string) string {
+		params := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {cfg.ClientID},
+			"redirect_uri":          {redirectURI},
+			"scope":                 {strings.Join(cfg.Scopes, " ")},
+			"state":                 {state},
+			"nonce":                 {nonce},
+			"code_challenge":        {oidc.CodeChallenge(verifier)},
+			"code_challenge_method": {"S256"},
+		}
+		return withQuery(cfg.AuthorizationEndpoint, params)
+	}
+
+	code, redirectURI, err := loopback.Authorize(buildURL, state)
+	if err != nil {
+		return "", "", err
+	}
+
+	token, err := requestToken(cfg.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if token.Error != "" {
+		return "", "", providerError(token)
+	}
+
+	return token.IDToken, nonce, nil
+}
+
+// DeviceLogin shows a code for the user to enter on another device and waits
+// until they have signed in there
+func DeviceLogin(cfg *models.OIDCConfig) (string, error) {
+	if cfg.DeviceAuthorizationEndpoint == "" {
+		return "", errors.New("the identity provider does not support device login")
+	}
+
+	resp, err := httpClient.PostForm(cfg.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {cfg.ClientID},
+		"scope":     {strings.Join(cfg.Scopes, " ")},
+	})
+	if err != nil {
+		return "", fmt.Errorf("device authorization failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("device authorization failed: %s", string(body))
+	}
+
+	var device deviceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	fmt.Printf("To sign in, visit %s and enter the code: %s\n", device.VerificationURI, device.UserCode)
+	if device.VerificationURIComplete != "" {
+		fmt.Printf("Or open: %s\n", device.VerificationURIComplete)
+	}
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := time.Duration(device.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 10 * time.Minute
+	}
+	deadline := time.Now().Add(expiresIn)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		token, err := requestToken(cfg.TokenEndpoint, url.Values{
+			"grant_type":  {deviceGrantType},
+			"device_code": {device.DeviceCode},
+			"client_id":   {cfg.ClientID},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		switch token.Error {
+		case "":
+			return token.IDToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return "", providerError(token)
+		}
+	}
+
+	return "", errors.New("the sign-in code expired, run 'pman login --sso --device' again")
+}
+
+// requestToken calls the token endpoint. OAuth errors such as
+// authorization_pending come back in the response rather than as an error.
+func requestToken(endpoint string, form url.Values) (*tokenResponse, error) {
+	resp, err := httpClient.PostForm(endpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %v", err)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("token request failed: %s", string(body))
+	}
+
+	if token.Error == "" && token.IDToken == "" {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("token request failed: %s", string(body))
+		}
+		return nil, errors.New("identity provider returned no ID token (is the openid scope configured?)")
+	}
+
+	return &token, nil
+}
+
+func providerError(token *tokenResponse) error {
+	if token.ErrorDescription != "" {
+		return fmt.Errorf("identity provider reported: %s (%s)", token.Error, token.ErrorDescription)
+	}
+	return fmt.Errorf("identity provider reported: %s", token.Error)
+}
+
+func withQuery(endpoint string, params url.Values) string {
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + params.Encode()
+	}
+	return endpoint + "?" + params.Encode()
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities a role can grant on the /admin endpoints
+const (
+	CapabilityUsersRead            = "users:read"  // list users, their sessions and lockouts
+	CapabilityUsersWrite           = "users:write" // create, change and delete users
+	CapabilityGroupsRead           = "groups:read"
+	CapabilityGroupsWrite          = "groups:write" // also manage members and path ACLs of every group
+	CapabilityServiceAccountsRead  = "service-accounts:read"
+	CapabilityServiceAccountsWrite = "service-accounts:write"
+	CapabilityPoliciesRead         = "policies:read" // MFA and password policies
+	CapabilityPoliciesWrite        = "policies:write"
+	CapabilityRolesWrite           = "roles:write"
+	CapabilityWebhooksRead         = "webhooks:read" // webhooks and their delivery log
+	CapabilityWebhooksWrite        = "webhooks:write"
+	CapabilityRotationsRead        = "rotations:read" // rotators bound to passwords and their last runs
+	CapabilityRotationsWrite       = "rotations:write"
+
+	// CapabilityAll grants every capability, including those added in later versions
+	CapabilityAll = "*"
+)
+
+// Capabilities lists every capability in the order they are shown
+var Capabilities = []string{
+	CapabilityUsersRead, CapabilityUsersWrite,
+	CapabilityGroupsRead, CapabilityGroupsWrite,
+	CapabilityServiceAccountsRead, CapabilityServiceAccountsWrite,
+	CapabilityPoliciesRead, CapabilityPoliciesWrite,
+	CapabilityRolesWrite,
+	CapabilityWebhooksRead, CapabilityWebhooksWrite,
+	CapabilityRotationsRead, CapabilityRotationsWrite,
+}
+
+// Built-in roles. They are kept up to date by the server and cannot be changed.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+type BuiltinRole struct {
+	Name         string
+	Description  string
+	Capabilities []string
+}
+
+var BuiltinRoles = []BuiltinRole{
+	{RoleAdmin, "Full access to the admin endpoints", []string{CapabilityAll}},
+	{RoleUser, "Access to the groups they are a member of only", nil},
+	{"user-manager", "Manages users", []string{CapabilityUsersRead, CapabilityUsersWrite, CapabilityGroupsRead}},
+	{"group-manager", "Manages groups, their members and path ACLs", []string{CapabilityGroupsRead, CapabilityGroupsWrite, CapabilityUsersRead}},
+	{"auditor", "Sees who has access to what", []string{CapabilityUsersRead, CapabilityGroupsRead, CapabilityServiceAccountsRead}},
+	{"read-only-admin", "Sees everything admins see without changing anything", []string{
+		CapabilityUsersRead, CapabilityGroupsRead, CapabilityServiceAccountsRead, CapabilityPoliciesRead,
+		CapabilityWebhooksRead, CapabilityRotationsRead,
+	}},
+}
+
+// ParseCapabilities splits a comma-separated list of capabilities
+func ParseCapabilities(capabilitiesStr string) []string {
+	var capabilities []string
+	for _, capability := range strings.Split(capabilitiesStr, ",") {
+		if capability = strings.TrimSpace(capability); capability != "" {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	return capabilities
+}
+
+func ValidateCapabilities(capabilities []string) error {
+	for _, capability := range capabilities {
+		if capability == CapabilityAll {
+			continue
+		}
+		known := false
+		for _, c := range Capabilities {
+			if capability == c {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown capability '%s' (must be '*' or one of %s)", capability, strings.Join(Capabilities, ", "))
+		}
+	}
+	return nil
+}
+
+// HasCapability reports whether capabilities include capability, directly or through "*"
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability || c == CapabilityAll {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversCapabilities reports whether holding capabilities gives every one of
+// required, so a role may only hand out what it has itself
+func CoversCapabilities(capabilities, required []string) bool {
+	for _, capability := range required {
+		if capability == CapabilityAll {
+			if !HasCapability(capabilities, CapabilityAll) {
+				return false
+			}
+			continue
+		}
+		if !HasCapability(capabilities, capability) {
+			return false
+		}
+	}
+	return true
+}
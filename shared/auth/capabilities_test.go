@@ -0,0 +1,28 @@
+package auth
+
+import "testing"
+
+func TestCoversCapabilities(t *testing.T) {
+	tests := []struct {
+		capabilities []string
+		required     []string
+		want         bool
+	}{
+		{nil, nil, true},
+		{nil, []string{CapabilityUsersRead}, false},
+		{[]string{CapabilityUsersRead}, []string{CapabilityUsersRead}, true},
+		{[]string{CapabilityUsersRead}, []string{CapabilityUsersRead, CapabilityUsersWrite}, false},
+		{[]string{CapabilityUsersRead, CapabilityUsersWrite, CapabilityGroupsRead}, []string{CapabilityUsersWrite}, true},
+		{[]string{CapabilityAll}, []string{CapabilityRolesWrite, CapabilityWebhooksWrite}, true},
+		{[]string{CapabilityAll}, []string{CapabilityAll}, true},
+		// Holding every named capability is not the same as "*", which also
+		// grants those added later
+		{Capabilities, []string{CapabilityAll}, false},
+	}
+
+	for _, tt := range tests {
+		if got := CoversCapabilities(tt.capabilities, tt.required); got != tt.want {
+			t.Errorf("CoversCapabilities(%v, %v) = %v, want %v", tt.capabilities, tt.required, got, tt.want)
+		}
+	}
+}
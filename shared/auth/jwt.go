@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -10,26 +12,52 @@ import (
 )
 
 type Claims struct {
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Session string `json:"sid,omitempty"`
+	// Scope restricts the token to a few endpoints (see ScopeAllows); empty means unrestricted
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
+
+	// Set for service accounts authenticated with an API key; never part of a JWT
+	ServiceAccount bool     `json:"-"`
+	Groups         string   `json:"-"`
+	PathPrefixes   []string `json:"-"`
 }
 
-func GenerateToken(email, role string, expireDays int) (string, error) {
+// GenerateToken issues a short-lived access token belonging to a login session.
+// The session is kept alive with refresh tokens (see TokenService).
+func GenerateToken(email, role, sessionID, scope string, ttl time.Duration) (string, time.Time, error) {
 	cfg := config.GetEnvConfig()
-	
+
+	tokenID := make([]byte, 16)
+	if _, err := rand.Read(tokenID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
 	claims := &Claims{
-		Email: email,
-		Role:  role,
+		Email:   email,
+		Role:    role,
+		Session: sessionID,
+		Scope:   scope,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expireDays) * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        hex.EncodeToString(tokenID),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    cfg.DomainName,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(cfg.EncryptionKey))
+	signed, err := token.SignedString([]byte(cfg.EncryptionKey))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
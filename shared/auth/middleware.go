@@ -30,26 +30,51 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if !ScopeAllows(claims.Scope, r.URL.Path) {
+			http.Error(w, scopeErrors[claims.Scope], http.StatusForbidden)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserContextKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func AdminRequired(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		claims, ok := r.Context().Value(UserContextKey).(*Claims)
-		if !ok {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// UserCapabilities interface to avoid circular dependency
+type UserCapabilities interface {
+	UserCapabilities(email string) ([]string, error)
+}
 
-		if claims.Role != "admin" {
-			http.Error(w, "Admin access required", http.StatusForbidden)
-			return
-		}
+// CapabilityRequired lets users through whose role grants capability. The
+// role is looked up rather than taken from the token, so role changes apply
+// at once. Service accounts never have capabilities.
+func CapabilityRequired(roles UserCapabilities, capability string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(UserContextKey).(*Claims)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			if claims.ServiceAccount {
+				http.Error(w, "Admin access required", http.StatusForbidden)
+				return
+			}
+
+			capabilities, err := roles.UserCapabilities(claims.Email)
+			if err != nil {
+				http.Error(w, "Role lookup error", http.StatusInternalServerError)
+				return
+			}
+			if !HasCapability(capabilities, capability) {
+				http.Error(w, "Admin access required ("+capability+")", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func GetUserFromContext(ctx context.Context) (*Claims, bool) {
@@ -57,12 +82,66 @@ func GetUserFromContext(ctx context.Context) (*Claims, bool) {
 	return claims, ok
 }
 
+// ScopeMFAEnrollment is given to users who must enrol in MFA before they can
+// do anything else
+const ScopeMFAEnrollment = "mfa_enroll"
+
+// ScopePasswordChange is given to users who must change their password first:
+// it was generated, set by an admin or has expired
+const ScopePasswordChange = "password_change"
+
+var scopeEndpoints = map[string][]string{
+	ScopeMFAEnrollment: {
+		"/auth/mfa", "/auth/mfa/enroll", "/auth/mfa/confirm",
+		"/auth/webauthn/register/begin", "/auth/webauthn/register/finish",
+		"/auth/logout",
+	},
+	ScopePasswordChange: {
+		"/auth/passwd", "/auth/passwd/policy",
+		"/auth/logout",
+	},
+}
+
+var scopeErrors = map[string]string{
+	ScopeMFAEnrollment:  "MFA enrolment required: run 'pman mfa enroll'",
+	ScopePasswordChange: "Password change required: run 'pman passwd'",
+}
+
+// ScopeAllows reports whether a token with the given scope may call path.
+// Only the exact API endpoints are allowed, so a secret named e.g.
+// "x/auth/mfa" is not reachable through them.
+func ScopeAllows(scope, path string) bool {
+	if scope == "" {
+		return true
+	}
+
+	endpoint, ok := strings.CutPrefix(path, "/api/v1")
+	if !ok {
+		return false
+	}
+	for _, allowed := range scopeEndpoints[scope] {
+		if endpoint == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
 // TokenChecker interface to avoid circular dependency
 type TokenChecker interface {
 	IsTokenRevoked(token string) (bool, error)
 }
 
-func AuthMiddlewareWithTokenService(tokenService TokenChecker) func(http.Handler) http.Handler {
+// APIKeyPrefix marks bearer credentials that are service account API keys rather than JWTs
+const APIKeyPrefix = "pman_"
+
+// APIKeyValidator interface to avoid circular dependency
+type APIKeyValidator interface {
+	ValidateAPIKey(key string) (*Claims, error)
+}
+
+func AuthMiddlewareWithTokenService(tokenService TokenChecker, apiKeys APIKeyValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -78,6 +157,23 @@ func AuthMiddlewareWithTokenService(tokenService TokenChecker) func(http.Handler
 			}
 
 			token := bearerToken[1]
+
+			if strings.HasPrefix(token, APIKeyPrefix) {
+				if apiKeys == nil {
+					http.Error(w, "API keys are not supported", http.StatusUnauthorized)
+					return
+				}
+
+				claims, err := apiKeys.ValidateAPIKey(token)
+				if err != nil {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserContextKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 			
 			// Check if token is revoked
 			if tokenService != nil {
@@ -98,6 +194,11 @@ func AuthMiddlewareWithTokenService(tokenService TokenChecker) func(http.Handler
 				return
 			}
 
+			if !ScopeAllows(claims.Scope, r.URL.Path) {
+				http.Error(w, scopeErrors[claims.Scope], http.StatusForbidden)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), UserContextKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
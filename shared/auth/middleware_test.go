@@ -0,0 +1,31 @@
+package auth
+
+import "testing"
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		scope string
+		path  string
+		want  bool
+	}{
+		{"", "/api/v1/passwords/team1/db", true},
+		{ScopeMFAEnrollment, "/api/v1/auth/mfa", true},
+		{ScopeMFAEnrollment, "/api/v1/auth/mfa/enroll", true},
+		{ScopeMFAEnrollment, "/api/v1/auth/logout", true},
+		{ScopeMFAEnrollment, "/api/v1/auth/passwd", false},
+		{ScopeMFAEnrollment, "/api/v1/passwords/team1/x/auth/mfa", false},
+		{ScopeMFAEnrollment, "/api/v1/auth/mfa/disable", false},
+		{ScopeMFAEnrollment, "/auth/mfa", false},
+		{ScopePasswordChange, "/api/v1/auth/passwd", true},
+		{ScopePasswordChange, "/api/v1/auth/passwd/policy", true},
+		{ScopePasswordChange, "/api/v1/passwords/team1/x/auth/passwd", false},
+		{ScopePasswordChange, "/api/v1/auth/mfa", false},
+		{"unknown", "/api/v1/auth/logout", false},
+	}
+
+	for _, tt := range tests {
+		if got := ScopeAllows(tt.scope, tt.path); got != tt.want {
+			t.Errorf("ScopeAllows(%q, %s) = %v, want %v", tt.scope, tt.path, got, tt.want)
+		}
+	}
+}
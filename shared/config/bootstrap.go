@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/shared/permissions"
+)
+
+// BootstrapConfig describes the first admin, created at startup while the
+// database has no users. Without an email the server prints a one-time setup
+// token instead, to be redeemed with 'pman setup'.
+type BootstrapConfig struct {
+	AdminEmail string
+	// AdminPassword is the initial password; a random one is generated and
+	// logged when empty. Either way it must be changed at the first login.
+	AdminPassword string
+	// AdminGroups is a "group:permission" list, e.g. "team1:rw,team2:rw"
+	AdminGroups string
+}
+
+func GetBootstrapConfig() *BootstrapConfig {
+	return &BootstrapConfig{
+		AdminEmail:    strings.TrimSpace(os.Getenv("PMAN_ADMIN_EMAIL")),
+		AdminPassword: os.Getenv("PMAN_ADMIN_PASSWORD"),
+		AdminGroups:   strings.TrimSpace(os.Getenv("PMAN_ADMIN_GROUPS")),
+	}
+}
+
+// ValidateBootstrapConfig catches a malformed first admin at startup
+func ValidateBootstrapConfig() error {
+	cfg := GetBootstrapConfig()
+	if cfg.AdminEmail != "" && !strings.Contains(cfg.AdminEmail, "@") {
+		return fmt.Errorf("PMAN_ADMIN_EMAIL: invalid email %q", cfg.AdminEmail)
+	}
+	if _, err := permissions.ParseGroups(cfg.AdminGroups); err != nil {
+		return fmt.Errorf("PMAN_ADMIN_GROUPS: %w", err)
+	}
+	return nil
+}
@@ -10,6 +10,8 @@ type EnvConfig struct {
 	EncryptionKey      string
 	DomainName         string
 	DefaultExpireDays  int
+	AccessTokenMinutes int
+	WebAuthnRPID       string
 }
 
 func ValidateEnvVars() error {
@@ -30,9 +32,27 @@ func GetEnvConfig() *EnvConfig {
 		}
 	}
 
+	// Access tokens are short-lived; DefaultExpireDays bounds the whole session
+	// that is kept alive with refresh tokens
+	accessMinutes := 15
+	if minutesStr := os.Getenv("PMAN_ACCESS_TOKEN_MINUTES"); minutesStr != "" {
+		if minutes, err := strconv.Atoi(minutesStr); err == nil && minutes > 0 {
+			accessMinutes = minutes
+		}
+	}
+
+	// Security keys are registered for this relying party ID. The default suits
+	// the CLI, which runs the WebAuthn ceremony on a localhost page.
+	webAuthnRPID := os.Getenv("PMAN_WEBAUTHN_RP_ID")
+	if webAuthnRPID == "" {
+		webAuthnRPID = "localhost"
+	}
+
 	return &EnvConfig{
-		EncryptionKey:     os.Getenv("PMAN_ENCRYPTION_KEY"),
-		DomainName:        os.Getenv("PMAN_DOMAIN_NAME"),
-		DefaultExpireDays: expireDays,
+		EncryptionKey:      os.Getenv("PMAN_ENCRYPTION_KEY"),
+		DomainName:         os.Getenv("PMAN_DOMAIN_NAME"),
+		DefaultExpireDays:  expireDays,
+		AccessTokenMinutes: accessMinutes,
+		WebAuthnRPID:       webAuthnRPID,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/shared/permissions"
+)
+
+// LDAPConfig configures password logins against an LDAP directory. LDAP is
+// enabled when a URL is set; the bootstrap admin always uses its local password.
+type LDAPConfig struct {
+	// URL is ldap://host:389 or ldaps://host:636
+	URL                string
+	StartTLS           bool
+	CACert             string
+	InsecureSkipVerify bool
+
+	// BindDN and BindPassword are the service account used to look users up;
+	// leave empty for an anonymous search
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter finds the user's entry; %s is replaced by the escaped email
+	UserFilter string
+
+	// GroupAttribute lists the user's groups on their entry (memberOf). For
+	// directories without it, GroupBaseDN and GroupFilter search for groups
+	// instead; %s in GroupFilter is replaced by the escaped user DN.
+	GroupAttribute string
+	GroupBaseDN    string
+	GroupFilter    string
+
+	// GroupMap maps directory group names (CN) onto pman groups, e.g.
+	// "pman-team1=team1:rw;auditors=team1:ro,team2:ro". When empty, groups are
+	// managed in pman with userupdate.
+	GroupMap string
+}
+
+func (c *LDAPConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+func GetLDAPConfig() *LDAPConfig {
+	userFilter := os.Getenv("PMAN_LDAP_USER_FILTER")
+	if userFilter == "" {
+		userFilter = "(mail=%s)"
+	}
+
+	groupAttribute := os.Getenv("PMAN_LDAP_GROUP_ATTRIBUTE")
+	if groupAttribute == "" {
+		groupAttribute = "memberOf"
+	}
+
+	return &LDAPConfig{
+		URL:                os.Getenv("PMAN_LDAP_URL"),
+		StartTLS:           os.Getenv("PMAN_LDAP_START_TLS") == "true",
+		CACert:             os.Getenv("PMAN_LDAP_CA_CERT"),
+		InsecureSkipVerify: os.Getenv("PMAN_LDAP_INSECURE_SKIP_VERIFY") == "true",
+		BindDN:             os.Getenv("PMAN_LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("PMAN_LDAP_BIND_PASSWORD"),
+		BaseDN:             os.Getenv("PMAN_LDAP_BASE_DN"),
+		UserFilter:         userFilter,
+		GroupAttribute:     groupAttribute,
+		GroupBaseDN:        os.Getenv("PMAN_LDAP_GROUP_BASE_DN"),
+		GroupFilter:        os.Getenv("PMAN_LDAP_GROUP_FILTER"),
+		GroupMap:           os.Getenv("PMAN_LDAP_GROUP_MAP"),
+	}
+}
+
+// ValidateLDAPConfig catches incomplete LDAP settings at startup
+func ValidateLDAPConfig() error {
+	ldapConfig := GetLDAPConfig()
+	if !ldapConfig.Enabled() {
+		return nil
+	}
+
+	if !strings.HasPrefix(ldapConfig.URL, "ldap://") && !strings.HasPrefix(ldapConfig.URL, "ldaps://") {
+		return errors.New("PMAN_LDAP_URL must start with ldap:// or ldaps://")
+	}
+	if ldapConfig.BaseDN == "" {
+		return errors.New("PMAN_LDAP_BASE_DN is required when PMAN_LDAP_URL is set")
+	}
+	if strings.Count(ldapConfig.UserFilter, "%s") != 1 {
+		return errors.New("PMAN_LDAP_USER_FILTER must contain %s exactly once")
+	}
+	if ldapConfig.GroupFilter != "" && strings.Count(ldapConfig.GroupFilter, "%s") != 1 {
+		return errors.New("PMAN_LDAP_GROUP_FILTER must contain %s exactly once")
+	}
+	if _, err := permissions.ParseGroupMapping(ldapConfig.GroupMap); err != nil {
+		return fmt.Errorf("PMAN_LDAP_GROUP_MAP: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockoutConfig configures brute-force protection of password logins. Failed
+// logins are counted per account and per client address; after a few failures
+// each further attempt has to wait twice as long as the previous one, and at
+// the threshold the account or address is locked for Duration.
+type LockoutConfig struct {
+	// AccountThreshold and IPThreshold are the failed logins that trigger a
+	// lockout (0 disables the lockout, the backoff still applies)
+	AccountThreshold int
+	IPThreshold      int
+	// Duration is how long a lockout lasts, and how long failures are remembered
+	Duration time.Duration
+
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Real-IP headers are believed when working out the client address
+	TrustedProxies []*net.IPNet
+}
+
+func GetLockoutConfig() *LockoutConfig {
+	accountThreshold := 10
+	if thresholdStr := os.Getenv("PMAN_LOCKOUT_THRESHOLD"); thresholdStr != "" {
+		if threshold, err := strconv.Atoi(thresholdStr); err == nil && threshold >= 0 {
+			accountThreshold = threshold
+		}
+	}
+
+	ipThreshold := 50
+	if thresholdStr := os.Getenv("PMAN_LOCKOUT_IP_THRESHOLD"); thresholdStr != "" {
+		if threshold, err := strconv.Atoi(thresholdStr); err == nil && threshold >= 0 {
+			ipThreshold = threshold
+		}
+	}
+
+	minutes := 15
+	if minutesStr := os.Getenv("PMAN_LOCKOUT_MINUTES"); minutesStr != "" {
+		if m, err := strconv.Atoi(minutesStr); err == nil && m > 0 {
+			minutes = m
+		}
+	}
+
+	// Invalid entries are reported by ValidateLockoutConfig at startup
+	proxies, _ := parseTrustedProxies(os.Getenv("PMAN_TRUSTED_PROXIES"))
+
+	return &LockoutConfig{
+		AccountThreshold: accountThreshold,
+		IPThreshold:      ipThreshold,
+		Duration:         time.Duration(minutes) * time.Minute,
+		TrustedProxies:   proxies,
+	}
+}
+
+// IsTrustedProxy reports whether ip belongs to one of the trusted proxies
+func (c *LockoutConfig) IsTrustedProxy(ip net.IP) bool {
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLockoutConfig catches malformed PMAN_TRUSTED_PROXIES at startup
+func ValidateLockoutConfig() error {
+	_, err := parseTrustedProxies(os.Getenv("PMAN_TRUSTED_PROXIES"))
+	return err
+}
+
+// parseTrustedProxies reads a comma-separated list of addresses and CIDR ranges,
+// e.g. "127.0.0.1,10.0.0.0/8"
+func parseTrustedProxies(str string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(str, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("PMAN_TRUSTED_PROXIES: invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("PMAN_TRUSTED_PROXIES: invalid range %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
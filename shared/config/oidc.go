@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/steve/pman/shared/permissions"
+)
+
+// OIDCConfig configures single sign-on through an OpenID Connect identity
+// provider. SSO is enabled when an issuer and client ID are set.
+type OIDCConfig struct {
+	Issuer   string
+	ClientID string
+	// JWKSURL overrides the jwks_uri from the issuer's discovery document
+	JWKSURL     string
+	Scopes      []string
+	EmailClaim  string
+	GroupsClaim string
+	// GroupMap maps IdP groups onto pman groups, e.g.
+	// "pman-team1=team1:rw;auditors=team1:ro,team2:ro"
+	GroupMap string
+}
+
+func (c *OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+func GetOIDCConfig() *OIDCConfig {
+	scopes := strings.Fields(os.Getenv("PMAN_OIDC_SCOPES"))
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	emailClaim := os.Getenv("PMAN_OIDC_EMAIL_CLAIM")
+	if emailClaim == "" {
+		emailClaim = "email"
+	}
+
+	groupsClaim := os.Getenv("PMAN_OIDC_GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	return &OIDCConfig{
+		Issuer:      os.Getenv("PMAN_OIDC_ISSUER"),
+		ClientID:    os.Getenv("PMAN_OIDC_CLIENT_ID"),
+		JWKSURL:     os.Getenv("PMAN_OIDC_JWKS_URL"),
+		Scopes:      scopes,
+		EmailClaim:  emailClaim,
+		GroupsClaim: groupsClaim,
+		GroupMap:    os.Getenv("PMAN_OIDC_GROUP_MAP"),
+	}
+}
+
+// ValidateOIDCConfig catches half-configured SSO and malformed group maps at
+// startup rather than at the first login
+func ValidateOIDCConfig() error {
+	oidcConfig := GetOIDCConfig()
+	if oidcConfig.Issuer == "" && oidcConfig.ClientID == "" {
+		return nil
+	}
+	if !oidcConfig.Enabled() {
+		return errors.New("PMAN_OIDC_ISSUER and PMAN_OIDC_CLIENT_ID must be set together")
+	}
+	if _, err := permissions.ParseGroupMapping(oidcConfig.GroupMap); err != nil {
+		return fmt.Errorf("PMAN_OIDC_GROUP_MAP: %w", err)
+	}
+	return nil
+}
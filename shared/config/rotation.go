@@ -0,0 +1,19 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// RotationConfig configures the rotation of passwords by the server
+type RotationConfig struct {
+	// CommandDir holds the executables the 'command' rotator may run; the
+	// rotator is disabled without it, as it runs programs on the server
+	CommandDir string
+}
+
+func GetRotationConfig() *RotationConfig {
+	return &RotationConfig{
+		CommandDir: strings.TrimSpace(os.Getenv("PMAN_ROTATOR_DIR")),
+	}
+}
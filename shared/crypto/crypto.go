@@ -39,6 +39,12 @@ func Encrypt(plaintext string) (string, error) {
 		return "", err
 	}
 
+	return EncryptWithKey(plaintext, key)
+}
+
+// EncryptWithKey encrypts with a 32-byte key of the caller's instead of the
+// server's encryption key
+func EncryptWithKey(plaintext string, key []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -64,6 +70,11 @@ func Decrypt(ciphertext string) (string, error) {
 		return "", err
 	}
 
+	return DecryptWithKey(ciphertext, key)
+}
+
+// DecryptWithKey decrypts what EncryptWithKey encrypted with the same key
+func DecryptWithKey(ciphertext string, key []byte) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
@@ -1,16 +1,24 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/steve/pman/shared/webauthn"
+)
 
 type User struct {
-	ID          int       `json:"id" db:"id"`
-	Email       string    `json:"email" db:"email"`
-	Password    string    `json:"-" db:"password_hash"`
-	Role        string    `json:"role" db:"role"`
-	Groups      string    `json:"groups" db:"groups"`
-	Enabled     bool      `json:"enabled" db:"enabled"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID                 int       `json:"id" db:"id"`
+	Email              string    `json:"email" db:"email"`
+	Password           string    `json:"-" db:"password_hash"`
+	Role               string    `json:"role" db:"role"`
+	// Groups lists the user's rows in group_members as "group:permission,..."
+	Groups             string    `json:"groups" db:"groups"`
+	Enabled            bool      `json:"enabled" db:"enabled"`
+	MFAEnabled         bool      `json:"mfa_enabled" db:"mfa_enabled"`
+	AuthSource         string    `json:"auth_source" db:"auth_source"`
+	MustChangePassword bool      `json:"must_change_password" db:"must_change_password"`
+	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Password struct {
@@ -25,19 +33,202 @@ type Password struct {
 }
 
 type Group struct {
-	Name        string `json:"name" db:"name"`
-	Description string `json:"description" db:"description"`
+	Name             string `json:"name" db:"name"`
+	Description      string `json:"description" db:"description"`
+	CacheMaxAgeHours int    `json:"cache_max_age_hours" db:"cache_max_age_hours"`
+
+	// Members and Secrets are worked out from group_members,
+	// service_accounts.groups and the passwords table
+	Members []GroupMember `json:"members"`
+	Secrets int           `json:"secrets"`
+}
+
+const (
+	GroupMemberUser           = "user"
+	GroupMemberServiceAccount = "service_account"
+)
+
+// GroupMember is a user or service account with access to a group
+type GroupMember struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Permission string `json:"permission"`
+}
+
+// PathACL narrows access to the paths below Path within a group
+type PathACL struct {
+	ID         int       `json:"id"`
+	Group      string    `json:"group"`
+	Path       string    `json:"path"`
+	Subject    string    `json:"subject"`
+	Permission string    `json:"permission"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type PathACLRequest struct {
+	Path       string `json:"path"`
+	Subject    string `json:"subject"`
+	Permission string `json:"permission"`
+}
+
+type GroupMemberRequest struct {
+	Permission string `json:"permission"`
+}
+
+// Role is a named set of capabilities on the /admin endpoints
+type Role struct {
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Capabilities []string  `json:"capabilities"`
+	Builtin      bool      `json:"builtin"`
+	Users        int       `json:"users"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type RoleRequest struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type GroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
+// LoginRequest starts a login with Email and Password. For users with MFA the
+// code can be sent with the password (MFACode), or in a second request that
+// carries the MFAToken returned by the first together with a code or a
+// WebAuthn assertion.
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	ExpireDays int  `json:"expire_days,omitempty"`
+	ClientHostname string `json:"client_hostname,omitempty"`
+	MFAToken string `json:"mfa_token,omitempty"`
+	MFACode  string `json:"mfa_code,omitempty"`
+	WebAuthn *webauthn.CredentialResponse `json:"webauthn,omitempty"`
 }
 
+// LoginResponse carries the tokens of a successful login. When MFARequired is
+// set no tokens are issued; the login must be completed with MFAToken and a code.
+// MFAEnrollmentRequired means policy requires MFA and the token only allows enrolment.
+// PasswordChangeRequired means the password was generated, set by an admin or has expired,
+// and the token only allows changing it.
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	User         User      `json:"user"`
+
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	MFAMethods            []string `json:"mfa_methods,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
+// SetupRequest creates the first admin of a new server with the one-time
+// setup token from the server log
+type SetupRequest struct {
+	Token    string `json:"token"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Groups   string `json:"groups,omitempty"`
+}
+
+// OIDCConfig tells the CLI how to obtain an ID token from the identity provider
+type OIDCConfig struct {
+	Issuer                      string   `json:"issuer"`
+	ClientID                    string   `json:"client_id"`
+	AuthorizationEndpoint       string   `json:"authorization_endpoint"`
+	TokenEndpoint               string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint,omitempty"`
+	Scopes                      []string `json:"scopes"`
+}
+
+// OIDCLoginRequest exchanges an ID token from the identity provider for a
+// pman session. Nonce is the value the CLI sent in the authorization request;
+// it is required unless the token was obtained with the device flow.
+type OIDCLoginRequest struct {
+	IDToken        string `json:"id_token"`
+	Nonce          string `json:"nonce,omitempty"`
+	Device         bool   `json:"device,omitempty"`
+	ExpireDays     int    `json:"expire_days,omitempty"`
+	ClientHostname string `json:"client_hostname,omitempty"`
+}
+
+// MFAStatus describes a user's second factors. Enabled refers to TOTP.
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	SecurityKeys           int  `json:"security_keys"`
+}
+
+type WebAuthnCredential struct {
+	ID         int        `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+type WebAuthnRegisterRequest struct {
+	Name       string                       `json:"name"`
+	Credential *webauthn.CredentialResponse `json:"credential"`
+}
+
+type WebAuthnLoginBeginRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAPolicy decides which users must use MFA: all admins (every role with
+// capabilities) and/or every member of the listed groups (comma-separated
+// group names).
+type MFAPolicy struct {
+	RequireAdmins  bool   `json:"require_admins"`
+	RequiredGroups string `json:"required_groups"`
+}
+
+// PasswordPolicy applies whenever a pman password is set. MinClasses is how
+// many of lower case, upper case, digits and symbols a password must mix;
+// History is how many previous passwords cannot be reused; passwords expire
+// after MaxAgeDays (0 = never).
+type PasswordPolicy struct {
+	MinLength  int `json:"min_length"`
+	MinClasses int `json:"min_classes"`
+	History    int `json:"history"`
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+type Session struct {
+	ID             string     `json:"id" db:"id"`
+	UserEmail      string     `json:"user_email" db:"user_email"`
+	ClientHostname string     `json:"client_hostname" db:"client_hostname"`
+	ClientIP       string     `json:"client_ip" db:"client_ip"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	LastSeenAt     *time.Time `json:"last_seen_at,omitempty" db:"last_seen_at"`
+	Current        bool       `json:"current,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type PasswordRequest struct {
@@ -45,12 +236,199 @@ type PasswordRequest struct {
 	Value string `json:"value"`
 }
 
+// PasswordValue is returned when reading a password. CacheMaxAgeHours is the
+// owning group's offline cache policy; 0 means the value must not be cached.
+type PasswordValue struct {
+	Value            string `json:"value"`
+	CacheMaxAgeHours int    `json:"cache_max_age_hours"`
+}
+
 type PasswordInfo struct {
+	Path             string    `json:"path"`
+	CreatedBy        string    `json:"created_by"`
+	UpdatedBy        string    `json:"updated_by"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	RequiresApproval bool      `json:"requires_approval"`
+	Version          int       `json:"version"`
+}
+
+// Access request statuses. Approved requests past their ExpiresAt are
+// reported as expired.
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+	AccessRequestExpired  = "expired"
+)
+
+// AccessRequest asks for time-boxed access to a secret that requires approval
+type AccessRequest struct {
+	ID              int64      `json:"id"`
+	Group           string     `json:"group"`
+	Path            string     `json:"path"`
+	Requester       string     `json:"requester"`
+	Reason          string     `json:"reason"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Status          string     `json:"status"`
+	DecidedBy       string     `json:"decided_by,omitempty"`
+	DecisionNote    string     `json:"decision_note,omitempty"`
+	DecidedAt       *time.Time `json:"decided_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type AccessRequestCreate struct {
+	Group           string `json:"group"`
+	Path            string `json:"path"`
+	Reason          string `json:"reason"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+type AccessDecisionRequest struct {
+	Note string `json:"note"`
+}
+
+// Grant gives a user temporary access to a single secret of a group
+type Grant struct {
+	ID         int       `json:"id"`
+	Group      string    `json:"group"`
+	Path       string    `json:"path"`
+	Grantee    string    `json:"grantee"`
+	Permission string    `json:"permission"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type GrantRequest struct {
+	Path           string `json:"path"`
+	Grantee        string `json:"grantee"`
+	Permission     string `json:"permission"`
+	ExpiresMinutes int    `json:"expires_minutes"`
+}
+
+// ShareRequest shares a secret through a link that works without an account
+type ShareRequest struct {
+	Group          string `json:"group"`
+	Path           string `json:"path"`
+	ExpiresMinutes int    `json:"expires_minutes"`
+	Views          int    `json:"views"`
+}
+
+type ShareResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Views     int       `json:"views"`
+}
+
+// SharedSecret is what a share link shows
+type SharedSecret struct {
+	Group     string    `json:"group"`
 	Path      string    `json:"path"`
-	CreatedBy string    `json:"created_by"`
-	UpdatedBy string    `json:"updated_by"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Value     string    `json:"value"`
+	ViewsLeft int       `json:"views_left"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Built-in rotators
+const (
+	RotatorPostgres = "postgres"
+	RotatorMySQL    = "mysql"
+	RotatorCommand  = "command"
+)
+
+// Rotation binds a password to a rotator, which replaces its value on demand
+// and every IntervalMinutes (0: on demand only)
+type Rotation struct {
+	ID              int               `json:"id"`
+	Group           string            `json:"group"`
+	Path            string            `json:"path"`
+	Rotator         string            `json:"rotator"`
+	Config          map[string]string `json:"config"`
+	IntervalMinutes int               `json:"interval_minutes"`
+	NextRunAt       *time.Time        `json:"next_run_at,omitempty"`
+	LastRunAt       *time.Time        `json:"last_run_at,omitempty"`
+	LastStatus      string            `json:"last_status"`
+	LastError       string            `json:"last_error"`
+	CreatedBy       string            `json:"created_by"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+type RotationRequest struct {
+	Rotator         string            `json:"rotator"`
+	Config          map[string]string `json:"config"`
+	IntervalMinutes int               `json:"interval_minutes"`
+}
+
+// RotationResult is the version a rotation stored
+type RotationResult struct {
+	Version   int       `json:"version"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// Events sent to webhooks
+const (
+	EventPasswordCreated = "password.created"
+	EventPasswordUpdated = "password.updated"
+	EventPasswordDeleted = "password.deleted"
+	EventUserCreated     = "user.created"
+	EventUserUpdated     = "user.updated"
+	EventUserDeleted     = "user.deleted"
+	EventUserEnabled     = "user.enabled"
+	EventUserDisabled    = "user.disabled"
+	// EventPing is sent by 'pman webhook test' only
+	EventPing = "ping"
+)
+
+// Event is a change to a secret or user. Webhooks receive it as their payload;
+// it never carries secret values.
+type Event struct {
+	Type  string    `json:"type"`
+	Group string    `json:"group,omitempty"`
+	Path  string    `json:"path,omitempty"`
+	User  string    `json:"user,omitempty"`
+	Actor string    `json:"actor,omitempty"`
+	Time  time.Time `json:"time"`
+
+	// Grantees could read a deleted secret through grants, which are removed
+	// with it; never sent
+	Grantees []string `json:"-"`
+}
+
+// Webhook is an outbound HTTP callback for events. The signing secret is only
+// returned when the webhook is created.
+type Webhook struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	Events     string    `json:"events"`
+	Group      string    `json:"group"`
+	PathPrefix string    `json:"path_prefix"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookRequest struct {
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+	Events     string `json:"events"`
+	Group      string `json:"group"`
+	PathPrefix string `json:"path_prefix"`
+}
+
+// WebhookDelivery is an attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID           int       `json:"id"`
+	WebhookID    int       `json:"webhook_id"`
+	Event        string    `json:"event"`
+	Payload      string    `json:"payload"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	ResponseCode int       `json:"response_code"`
+	Error        string    `json:"error"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type UserRequest struct {
@@ -58,4 +436,64 @@ type UserRequest struct {
 	Role     string `json:"role"`
 	Groups   string `json:"groups"`
 	Password string `json:"password,omitempty"`
-}
\ No newline at end of file
+}
+
+type ServiceAccount struct {
+	ID           int       `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	Description  string    `json:"description" db:"description"`
+	Groups       string    `json:"groups" db:"groups"`
+	PathPrefixes string    `json:"path_prefixes" db:"path_prefixes"`
+	Enabled      bool      `json:"enabled" db:"enabled"`
+	CreatedBy    string    `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id" db:"id"`
+	Prefix     string     `json:"prefix" db:"key_prefix"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	Revoked    bool       `json:"revoked" db:"revoked"`
+}
+
+type ServiceAccountRequest struct {
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	Groups       string `json:"groups"`
+	PathPrefixes string `json:"path_prefixes,omitempty"`
+	ExpireDays   int    `json:"expire_days,omitempty"`
+}
+
+type APIKeyResponse struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
+
+// Lockout is an account (kind "account") or client address (kind "ip") that is
+// locked out of password logins after too many failures
+type Lockout struct {
+	Kind        string    `json:"kind" db:"kind"`
+	Subject     string    `json:"subject" db:"subject"`
+	Failures    int       `json:"failures" db:"failures"`
+	LockedUntil time.Time `json:"locked_until" db:"locked_until"`
+}
+
+type LockoutEvent struct {
+	ID          int        `json:"id" db:"id"`
+	Kind        string     `json:"kind" db:"kind"`
+	Subject     string     `json:"subject" db:"subject"`
+	Event       string     `json:"event" db:"event"`
+	Failures    int        `json:"failures" db:"failures"`
+	ClientIP    string     `json:"client_ip,omitempty" db:"client_ip"`
+	LockedUntil *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+	Actor       string     `json:"actor,omitempty" db:"actor"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+type LockoutStatus struct {
+	Active []Lockout      `json:"active"`
+	Events []LockoutEvent `json:"events"`
+}
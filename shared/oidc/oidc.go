@@ -0,0 +1,360 @@
+// Package oidc verifies ID tokens issued by an OpenID Connect identity
+// provider and holds the PKCE helpers the CLI uses to obtain them.
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// MaxTokenAge bounds how long after issue an ID token may be presented, so
+	// a token that leaks later cannot be traded for a pman session
+	MaxTokenAge = 10 * time.Minute
+
+	leeway         = time.Minute
+	refetchBackoff = time.Minute
+)
+
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Discovery holds the parts of the provider's openid-configuration we use
+type Discovery struct {
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+	JWKSURI                     string `json:"jwks_uri"`
+}
+
+func Discover(client *http.Client, issuer string) (*Discovery, error) {
+	var discovery Discovery
+	if err := getJSON(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer mismatch (%s)", discovery.Issuer)
+	}
+
+	return &discovery, nil
+}
+
+// Identity is the user an ID token was issued for
+type Identity struct {
+	Subject string
+	Email   string
+	Groups  []string
+	// EmailVerified is only true when the provider says so; a token without
+	// an email_verified claim is unverified
+	EmailVerified bool
+}
+
+// Verifier checks ID token signatures against the provider's JWKS, fetching
+// the key set again when a token names a key it has not seen (key rotation)
+type Verifier struct {
+	Issuer      string
+	ClientID    string
+	JWKSURL     string
+	EmailClaim  string
+	GroupsClaim string
+	HTTPClient  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// Verify checks the signature, issuer, audience, expiry and age of an ID
+// token and that it was issued for nonce. Tokens from the device flow carry
+// no nonce and are verified with an empty one.
+func (v *Verifier) Verify(rawIDToken, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, v.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(v.Issuer),
+		jwt.WithAudience(v.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(leeway),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return nil, fmt.Errorf("%w: missing iat", ErrInvalidToken)
+	}
+	if time.Since(issuedAt.Time) > MaxTokenAge+leeway {
+		return nil, fmt.Errorf("%w: token is too old, sign in again", ErrInvalidToken)
+	}
+
+	// With several audiences the token must have been issued to us (azp)
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != v.ClientID {
+			return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidToken)
+		}
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	emailVerified := false
+	if verified, ok := claims["email_verified"]; ok {
+		if b, isBool := verified.(bool); isBool && b {
+			emailVerified = true
+		} else if s, isString := verified.(string); isString && s == "true" {
+			emailVerified = true
+		} else {
+			return nil, fmt.Errorf("%w: email address is not verified", ErrInvalidToken)
+		}
+	}
+
+	subject, _ := claims.GetSubject()
+	email, _ := claims[v.emailClaim()].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.emailClaim())
+	}
+
+	return &Identity{
+		Subject: subject,
+		Email:   email,
+		Groups:  stringList(claims[v.groupsClaim()]),
+
+		EmailVerified: emailVerified,
+	}, nil
+}
+
+func (v *Verifier) emailClaim() string {
+	if v.EmailClaim == "" {
+		return "email"
+	}
+	return v.EmailClaim
+}
+
+func (v *Verifier) groupsClaim() string {
+	if v.GroupsClaim == "" {
+		return "groups"
+	}
+	return v.GroupsClaim
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key := v.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	if time.Since(v.fetchedAt) < refetchBackoff {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := fetchKeys(v.HTTPClient, v.JWKSURL)
+	v.fetchedAt = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	v.keys = keys
+
+	if key := v.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by ID. Tokens without a kid are accepted only when the
+// key set holds a single key.
+func (v *Verifier) lookup(kid string) crypto.PublicKey {
+	if kid != "" {
+		return v.keys[kid]
+	}
+	if len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchKeys(client *http.Client, jwksURL string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(client, jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip key types we do not support rather than failing the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// stringList reads a claim that providers send either as an array of strings
+// or as a single (possibly comma-separated) string
+func stringList(claim interface{}) []string {
+	var values []string
+	switch c := claim.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	case string:
+		for _, s := range strings.Split(c, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636)
+func NewCodeVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// CodeChallenge derives the S256 code challenge for a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns n random bytes encoded as base64url, for use as
+// state, nonce and code verifier values
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,252 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testClientID = "pman-cli"
+	testNonce    = "n-0S6_WzA2Mj"
+)
+
+// testProvider serves a JWKS from an httptest server and signs ID tokens
+type testProvider struct {
+	server  *httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	publish []string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProvider{rsaKey: rsaKey, ecKey: ecKey, publish: []string{"rsa1", "ec1"}}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var keys []map[string]string
+		for _, kid := range p.publish {
+			switch kid {
+			case "rsa1":
+				keys = append(keys, map[string]string{
+					"kty": "RSA", "kid": kid, "use": "sig",
+					"n": b64(rsaKey.N.Bytes()),
+					"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				})
+			case "ec1":
+				keys = append(keys, map[string]string{
+					"kty": "EC", "kid": kid, "crv": "P-256",
+					"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+					"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *testProvider) verifier() *Verifier {
+	return &Verifier{Issuer: testIssuer, ClientID: testClientID, JWKSURL: p.server.URL}
+}
+
+func (p *testProvider) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	var token *jwt.Token
+	var key interface{}
+	if kid == "ec1" {
+		token, key = jwt.NewWithClaims(jwt.SigningMethodES256, claims), p.ecKey
+	} else {
+		token, key = jwt.NewWithClaims(jwt.SigningMethodRS256, claims), p.rsaKey
+	}
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            testIssuer,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"email":          "Alice@Example.com",
+		"email_verified": true,
+		"groups":         []string{"pman-team1", "everyone"},
+		"nonce":          testNonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestVerify(t *testing.T) {
+	p := newTestProvider(t)
+	v := p.verifier()
+
+	for _, kid := range []string{"rsa1", "ec1"} {
+		identity, err := v.Verify(p.sign(t, kid, validClaims()), testNonce)
+		if err != nil {
+			t.Fatalf("Verify(%s) error = %v", kid, err)
+		}
+
+		expected := &Identity{Subject: "user-1", Email: "alice@example.com", Groups: []string{"pman-team1", "everyone"}, EmailVerified: true}
+		if !reflect.DeepEqual(identity, expected) {
+			t.Errorf("Verify(%s) = %+v, want %+v", kid, identity, expected)
+		}
+	}
+}
+
+func TestVerifyDeviceFlow(t *testing.T) {
+	p := newTestProvider(t)
+
+	// Device flow tokens carry no nonce and often no email_verified claim
+	claims := validClaims()
+	delete(claims, "nonce")
+	delete(claims, "email_verified")
+
+	identity, err := p.verifier().Verify(p.sign(t, "rsa1", claims), "")
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if identity.EmailVerified {
+		t.Error("Verify() without email_verified reported a verified email")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	p := newTestProvider(t)
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		nonce  string
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, testNonce},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, testNonce},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, testNonce},
+		{"too old", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(-time.Hour).Unix() }, testNonce},
+		{"wrong nonce", func(c jwt.MapClaims) {}, "another-nonce"},
+		{"nonce not checked", func(c jwt.MapClaims) {}, ""},
+		{"token without nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, testNonce},
+		{"unverified email", func(c jwt.MapClaims) { c["email_verified"] = false }, testNonce},
+		{"missing email", func(c jwt.MapClaims) { delete(c, "email") }, testNonce},
+		{"other authorized party", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = "other-client"
+		}, testNonce},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+
+			_, err := p.verifier().Verify(p.sign(t, "rsa1", claims), tt.nonce)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsForgedSignature(t *testing.T) {
+	p := newTestProvider(t)
+
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = "rsa1"
+	signed, err := token.SignedString(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.verifier().Verify(signed, testNonce); err == nil {
+		t.Error("Verify() accepted a token signed with an unknown key")
+	}
+
+	// HMAC tokens keyed with public material must never be accepted
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("secret"))
+	if _, err := p.verifier().Verify(hmacToken, testNonce); err == nil {
+		t.Error("Verify() accepted an HS256 token")
+	}
+}
+
+func TestVerifyRefetchesRotatedKeys(t *testing.T) {
+	p := newTestProvider(t)
+	p.publish = []string{"rsa1"}
+	v := p.verifier()
+
+	if _, err := v.Verify(p.sign(t, "rsa1", validClaims()), testNonce); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// The provider rotates in a new key; the cached set does not know it yet
+	p.publish = []string{"rsa1", "ec1"}
+	v.fetchedAt = time.Time{}
+
+	if _, err := v.Verify(p.sign(t, "ec1", validClaims()), testNonce); err != nil {
+		t.Errorf("Verify() with rotated key error = %v", err)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	tests := []struct {
+		claim    interface{}
+		expected []string
+	}{
+		{nil, nil},
+		{"team1:rw", []string{"team1:rw"}},
+		{"team1:rw, team2:ro", []string{"team1:rw", "team2:ro"}},
+		{[]interface{}{"a", 3, "b"}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		if got := stringList(tt.claim); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("stringList(%v) = %v, want %v", tt.claim, got, tt.expected)
+		}
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if got := CodeChallenge(verifier); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge() = %s", got)
+	}
+}
@@ -0,0 +1,79 @@
+package permissions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PermissionNone denies access to the paths of a path rule
+const PermissionNone = "none"
+
+// AnySubject makes a path rule apply to everyone with access to the group
+const AnySubject = "*"
+
+// PathRule narrows access to the paths below Prefix within a group. Rules
+// never grant more than the caller's group permission.
+type PathRule struct {
+	Prefix     string // "" for the whole group
+	Subject    string // user email or AnySubject
+	Permission string // "none", "ro", "rw" or verbs such as "list"
+}
+
+// NormalizePathPrefix accepts "prod/*", "/prod/" and "prod" for the same
+// prefix; "*" covers the whole group
+func NormalizePathPrefix(prefix string) string {
+	prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "*")
+	return strings.Trim(prefix, "/")
+}
+
+// NormalizePathPermission returns the canonical form of a path rule
+// permission. Rules take "none" or any verbs but admin and approve, which only
+// apply to a whole group.
+func NormalizePathPermission(permission string) (string, error) {
+	if permission == PermissionNone {
+		return permission, nil
+	}
+	verbs, ok := parseVerbs(permission)
+	if !ok || verbs&(VerbAdmin|VerbApprove) != 0 {
+		return "", fmt.Errorf("invalid permission '%s' (must be 'none', 'ro', 'rw' or verbs joined with '+' from list, read, write and delete)", permission)
+	}
+	return FormatPermission(verbs), nil
+}
+
+// MatchPathRule finds the rule deciding subject's access to path. The longest
+// matching prefix wins; with equal prefixes a rule naming the subject beats a
+// rule for everyone.
+func MatchPathRule(rules []PathRule, subject, path string) (PathRule, bool) {
+	path = strings.Trim(path, "/")
+
+	var best PathRule
+	found := false
+	for _, rule := range rules {
+		if rule.Subject != AnySubject && !strings.EqualFold(rule.Subject, subject) {
+			continue
+		}
+		if rule.Prefix != "" && !HasPathAccess([]string{rule.Prefix}, path) {
+			continue
+		}
+
+		// Matching prefixes are all ancestors of path, so longer is more specific
+		if !found || len(rule.Prefix) > len(best.Prefix) ||
+			len(rule.Prefix) == len(best.Prefix) && best.Subject == AnySubject && rule.Subject != AnySubject {
+			best, found = rule, true
+		}
+	}
+
+	return best, found
+}
+
+// PathAllows reports whether the rules let subject use verb on path. Paths
+// without a matching rule are left to the group permission.
+func PathAllows(rules []PathRule, subject, path string, verb Verb) bool {
+	rule, ok := MatchPathRule(rules, subject, path)
+	if !ok {
+		return true
+	}
+
+	verbs, _ := parseVerbs(rule.Permission) // "none" parses to no verbs
+	return verbs.Has(verb)
+}
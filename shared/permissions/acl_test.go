@@ -0,0 +1,61 @@
+package permissions
+
+import "testing"
+
+func TestPathAllows(t *testing.T) {
+	rules := []PathRule{
+		{Prefix: NormalizePathPrefix("prod/*"), Subject: AnySubject, Permission: PermissionReadOnly},
+		{Prefix: NormalizePathPrefix("prod/payments/"), Subject: AnySubject, Permission: PermissionNone},
+		{Prefix: "prod/payments", Subject: "lead@example.com", Permission: PermissionReadWrite},
+		{Prefix: "dev", Subject: "contractor@example.com", Permission: PermissionReadWrite},
+		{Prefix: NormalizePathPrefix("*"), Subject: "contractor@example.com", Permission: PermissionNone},
+		{Prefix: "prod", Subject: "auditor@example.com", Permission: "list"},
+	}
+
+	tests := []struct {
+		subject string
+		path    string
+		read    bool
+		write   bool
+	}{
+		{"dev@example.com", "shared/token", true, true},
+		{"dev@example.com", "prod/db", true, false},
+		{"dev@example.com", "production/db", true, true},
+		{"dev@example.com", "prod/payments/key", false, false},
+		{"lead@example.com", "prod/payments/key", true, true},
+		{"lead@example.com", "prod/db", true, false},
+		{"contractor@example.com", "dev/api", true, true},
+		{"contractor@example.com", "shared/token", false, false},
+		{"contractor@example.com", "prod/db", true, false},
+		{"auditor@example.com", "prod/db", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := PathAllows(rules, tt.subject, tt.path, VerbRead); got != tt.read {
+			t.Errorf("PathAllows(%s, %s, read) = %v, want %v", tt.subject, tt.path, got, tt.read)
+		}
+		if got := PathAllows(rules, tt.subject, tt.path, VerbWrite); got != tt.write {
+			t.Errorf("PathAllows(%s, %s, write) = %v, want %v", tt.subject, tt.path, got, tt.write)
+		}
+	}
+
+	if !PathAllows(rules, "auditor@example.com", "prod/db", VerbList) {
+		t.Error("PathAllows(list rule, list) = false, want true")
+	}
+	if PathAllows(rules, "dev@example.com", "prod/payments/key", VerbList) {
+		t.Error("PathAllows(none rule, list) = true, want false")
+	}
+}
+
+func TestNormalizePathPermission(t *testing.T) {
+	for permission, want := range map[string]string{"none": "none", "rw": "rw", "read+list": "ro", "list": "list"} {
+		if got, err := NormalizePathPermission(permission); err != nil || got != want {
+			t.Errorf("NormalizePathPermission(%q) = %q, %v, want %q", permission, got, err, want)
+		}
+	}
+	for _, permission := range []string{"owner", "list+admin", "all"} {
+		if _, err := NormalizePathPermission(permission); err == nil {
+			t.Errorf("NormalizePathPermission(%q) accepted invalid permission", permission)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package permissions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseGroupMapping parses a mapping from external (identity provider or
+// directory) groups to pman groups strings. Entries are separated by ";":
+//
+//	pman-team1=team1:rw;auditors=team1:ro,team2:ro
+func ParseGroupMapping(mappingStr string) (map[string]string, error) {
+	mapping := make(map[string]string)
+
+	for _, entry := range strings.Split(mappingStr, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid group mapping: %s (expected format: external=group:permission,...)", entry)
+		}
+
+		external := strings.TrimSpace(parts[0])
+		groupsStr := strings.TrimSpace(parts[1])
+		if _, err := ParseGroups(groupsStr); err != nil {
+			return nil, fmt.Errorf("invalid group mapping for %s: %w", external, err)
+		}
+
+		if existing, ok := mapping[external]; ok && existing != "" {
+			groupsStr = existing + "," + groupsStr
+		}
+		mapping[external] = groupsStr
+	}
+
+	return mapping, nil
+}
+
+// MapExternalGroups returns the pman groups string for a user who belongs to
+// the given external groups. When a group is granted more than once the
+// user gets every verb of every grant.
+func MapExternalGroups(mapping map[string]string, external []string) string {
+	granted := make(map[string]Verb)
+
+	for _, name := range external {
+		groups, err := ParseGroups(mapping[name])
+		if err != nil {
+			continue
+		}
+		for _, group := range groups {
+			granted[group.GroupName] |= group.Verbs
+		}
+	}
+
+	var result []GroupAccess
+	for name, verbs := range granted {
+		result = append(result, GroupAccess{GroupName: name, Permission: FormatPermission(verbs), Verbs: verbs})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GroupName < result[j].GroupName
+	})
+
+	return FormatGroups(result)
+}
@@ -0,0 +1,40 @@
+package permissions
+
+import "testing"
+
+func TestMapExternalGroups(t *testing.T) {
+	mapping, err := ParseGroupMapping("pman-team1=team1:rw; auditors=team1:ro,team2:ro ;readers=team3:ro;leads=team1:owner;browsers=team4:list;uploaders=team4:write")
+	if err != nil {
+		t.Fatalf("ParseGroupMapping() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		external []string
+		expected string
+	}{
+		{"no groups", nil, ""},
+		{"unmapped group", []string{"everyone"}, ""},
+		{"single group", []string{"readers"}, "team3:ro"},
+		{"strongest permission wins", []string{"auditors", "pman-team1"}, "team1:rw,team2:ro"},
+		{"order does not matter", []string{"pman-team1", "auditors"}, "team1:rw,team2:ro"},
+		{"owner is strongest", []string{"leads", "pman-team1"}, "team1:owner"},
+		{"verbs are combined", []string{"browsers", "uploaders"}, "team4:list+write"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MapExternalGroups(mapping, tt.external); got != tt.expected {
+				t.Errorf("MapExternalGroups(%v) = %q, want %q", tt.external, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseGroupMappingInvalid(t *testing.T) {
+	for _, mapping := range []string{"team1:rw", "=team1:rw", "admins=team1:superuser"} {
+		if _, err := ParseGroupMapping(mapping); err == nil {
+			t.Errorf("ParseGroupMapping(%q) accepted invalid mapping", mapping)
+		}
+	}
+}
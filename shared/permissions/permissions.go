@@ -5,9 +5,19 @@ import (
 	"strings"
 )
 
+// Named group permissions, shorthands for sets of verbs (see verbs.go). Owners
+// have read-write access and can also manage the group's members and approve
+// access requests.
+const (
+	PermissionReadOnly  = "ro"
+	PermissionReadWrite = "rw"
+	PermissionOwner     = "owner"
+)
+
 type GroupAccess struct {
 	GroupName  string
-	Permission string // "ro" or "rw"
+	Permission string // canonical form, e.g. "ro", "rw", "owner" or "list"
+	Verbs      Verb
 }
 
 func ParseGroups(groupsStr string) ([]GroupAccess, error) {
@@ -32,13 +42,15 @@ func ParseGroups(groupsStr string) ([]GroupAccess, error) {
 		groupName := strings.TrimSpace(groupParts[0])
 		permission := strings.TrimSpace(groupParts[1])
 
-		if permission != "ro" && permission != "rw" {
-			return nil, fmt.Errorf("invalid permission '%s' for group '%s' (must be 'ro' or 'rw')", permission, groupName)
+		verbs, ok := parseVerbs(permission)
+		if !ok {
+			return nil, fmt.Errorf("invalid permission '%s' for group '%s' (%s)", permission, groupName, permissionHint)
 		}
 
 		groups = append(groups, GroupAccess{
 			GroupName:  groupName,
-			Permission: permission,
+			Permission: FormatPermission(verbs),
+			Verbs:      verbs,
 		})
 	}
 
@@ -53,7 +65,9 @@ func FormatGroups(groups []GroupAccess) string {
 	return strings.Join(parts, ",")
 }
 
-func HasGroupAccess(userGroups string, requiredGroup string, requireWrite bool) bool {
+// HasGroupVerb reports whether the groups list allows verb in requiredGroup.
+// When a group appears twice the first entry wins.
+func HasGroupVerb(userGroups string, requiredGroup string, verb Verb) bool {
 	groups, err := ParseGroups(userGroups)
 	if err != nil {
 		return false
@@ -61,16 +75,27 @@ func HasGroupAccess(userGroups string, requiredGroup string, requireWrite bool)
 
 	for _, group := range groups {
 		if group.GroupName == requiredGroup {
-			if requireWrite {
-				return group.Permission == "rw" 
-			}
-			return true // ro or rw both allow read
+			return group.Verbs.Has(verb)
 		}
 	}
 
 	return false
 }
 
+// HasGroupAccess checks for the read verb, or the write verb when requireWrite is set
+func HasGroupAccess(userGroups string, requiredGroup string, requireWrite bool) bool {
+	if requireWrite {
+		return HasGroupVerb(userGroups, requiredGroup, VerbWrite)
+	}
+	return HasGroupVerb(userGroups, requiredGroup, VerbRead)
+}
+
+// IsGroupOwner reports whether the groups list gives its holder the admin verb
+// on requiredGroup, so they may manage the group's members and path ACLs
+func IsGroupOwner(userGroups string, requiredGroup string) bool {
+	return HasGroupVerb(userGroups, requiredGroup, VerbAdmin)
+}
+
 func GetUserGroups(userGroups string) []string {
 	groups, err := ParseGroups(userGroups)
 	if err != nil {
@@ -83,4 +108,51 @@ func GetUserGroups(userGroups string) []string {
 	}
 
 	return groupNames
-}
\ No newline at end of file
+}
+
+// DefaultToReadOnly adds ":ro" to group entries given without a permission,
+// so service accounts are read-only unless write access is asked for explicitly
+func DefaultToReadOnly(groupsStr string) string {
+	var parts []string
+	for _, part := range strings.Split(groupsStr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, ":") {
+			part += ":ro"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParsePathPrefixes splits a comma-separated list of path prefixes
+func ParsePathPrefixes(prefixesStr string) []string {
+	var prefixes []string
+	for _, prefix := range strings.Split(prefixesStr, ",") {
+		prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+		if prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// HasPathAccess reports whether path lies under one of the prefixes. Prefixes
+// match whole path segments, so "ci" allows "ci/token" but not "cider".
+// An empty prefix list allows every path.
+func HasPathAccess(prefixes []string, path string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	path = strings.Trim(path, "/")
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,67 @@
+package permissions
+
+import "testing"
+
+func TestGroupOwner(t *testing.T) {
+	groups := "team1:owner,team2:rw,team3:ro,team4:list"
+
+	tests := []struct {
+		group string
+		read  bool
+		write bool
+		owner bool
+	}{
+		{"team1", true, true, true},
+		{"team2", true, true, false},
+		{"team3", true, false, false},
+		{"team4", false, false, false},
+		{"team5", false, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasGroupAccess(groups, tt.group, false); got != tt.read {
+			t.Errorf("HasGroupAccess(%s, read) = %v, want %v", tt.group, got, tt.read)
+		}
+		if got := HasGroupAccess(groups, tt.group, true); got != tt.write {
+			t.Errorf("HasGroupAccess(%s, write) = %v, want %v", tt.group, got, tt.write)
+		}
+		if got := IsGroupOwner(groups, tt.group); got != tt.owner {
+			t.Errorf("IsGroupOwner(%s) = %v, want %v", tt.group, got, tt.owner)
+		}
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	tests := []struct {
+		permission string
+		verbs      Verb
+		canonical  string
+	}{
+		{"ro", VerbList | VerbRead, "ro"},
+		{"list+read", VerbList | VerbRead, "ro"},
+		{"list", VerbList, "list"},
+		{"read+list+delete", VerbList | VerbRead | VerbDelete, "list+read+delete"},
+		{"list+read+write+delete+admin+approve", VerbList | VerbRead | VerbWrite | VerbDelete | VerbAdmin | VerbApprove, "owner"},
+		{"rw+approve", VerbList | VerbRead | VerbWrite | VerbDelete | VerbApprove, "list+read+write+delete+approve"},
+	}
+
+	for _, tt := range tests {
+		verbs, err := ParsePermission(tt.permission)
+		if err != nil || verbs != tt.verbs {
+			t.Errorf("ParsePermission(%q) = %v, %v, want %v", tt.permission, verbs, err, tt.verbs)
+		}
+		if got := FormatPermission(verbs); got != tt.canonical {
+			t.Errorf("FormatPermission(%q) = %q, want %q", tt.permission, got, tt.canonical)
+		}
+	}
+
+	for _, permission := range []string{"", "none", "read+", "list+superuser"} {
+		if _, err := ParsePermission(permission); err == nil {
+			t.Errorf("ParsePermission(%q) accepted invalid permission", permission)
+		}
+	}
+
+	if HasGroupVerb("team1:list", "team1", VerbRead) || !HasGroupVerb("team1:list", "team1", VerbList) {
+		t.Error("HasGroupVerb() does not keep list apart from read")
+	}
+}
@@ -0,0 +1,103 @@
+package permissions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Verb is a set of operations a permission allows
+type Verb uint8
+
+const (
+	VerbList    Verb = 1 << iota // see paths and their metadata
+	VerbRead                     // read secret values
+	VerbWrite                    // create and update secrets
+	VerbDelete                   // delete secrets
+	VerbAdmin                    // manage the group's members and path ACLs
+	VerbApprove                  // approve access to secrets that require approval
+)
+
+var verbNames = []struct {
+	verb Verb
+	name string
+}{
+	{VerbList, "list"},
+	{VerbRead, "read"},
+	{VerbWrite, "write"},
+	{VerbDelete, "delete"},
+	{VerbAdmin, "admin"},
+	{VerbApprove, "approve"},
+}
+
+// namedPermissions are the shorthands for common sets of verbs
+var namedPermissions = []struct {
+	name  string
+	verbs Verb
+}{
+	{PermissionReadOnly, VerbList | VerbRead},
+	{PermissionReadWrite, VerbList | VerbRead | VerbWrite | VerbDelete},
+	{PermissionOwner, VerbList | VerbRead | VerbWrite | VerbDelete | VerbAdmin | VerbApprove},
+}
+
+const permissionHint = "must be 'ro', 'rw', 'owner' or verbs joined with '+' from list, read, write, delete, admin and approve"
+
+// ParsePermission accepts a named permission or verbs joined with "+", such
+// as "list" or "list+read". Named permissions can be joined too, e.g. "rw+approve".
+func ParsePermission(permission string) (Verb, error) {
+	if verbs, ok := parseVerbs(permission); ok {
+		return verbs, nil
+	}
+	return 0, fmt.Errorf("invalid permission '%s' (%s)", permission, permissionHint)
+}
+
+func parseVerbs(permission string) (Verb, bool) {
+	var verbs Verb
+	for _, part := range strings.Split(permission, "+") {
+		verb := verbByName(strings.TrimSpace(part))
+		if verb == 0 {
+			return 0, false
+		}
+		verbs |= verb
+	}
+	return verbs, true
+}
+
+func verbByName(name string) Verb {
+	for _, named := range namedPermissions {
+		if name == named.name {
+			return named.verbs
+		}
+	}
+	for _, v := range verbNames {
+		if v.name == name {
+			return v.verb
+		}
+	}
+	return 0
+}
+
+// FormatPermission is the canonical form of a set of verbs: the named
+// permission when one matches, otherwise the verbs in a fixed order
+func FormatPermission(verbs Verb) string {
+	if verbs == 0 {
+		return PermissionNone
+	}
+	for _, named := range namedPermissions {
+		if verbs == named.verbs {
+			return named.name
+		}
+	}
+
+	var names []string
+	for _, v := range verbNames {
+		if verbs.Has(v.verb) {
+			names = append(names, v.name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// Has reports whether v includes every verb of required
+func (v Verb) Has(required Verb) bool {
+	return v&required == required
+}
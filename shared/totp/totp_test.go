@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1 (truncated to 6 digits)
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if code != tt.expected {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, code, tt.expected)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+
+	now := time.Now()
+	code, _ := Code(secret, Step(now))
+
+	if _, ok := Validate(secret, code, now); !ok {
+		t.Errorf("Validate() rejected current code")
+	}
+	if _, ok := Validate(secret, code, now.Add(Period*time.Second)); !ok {
+		t.Errorf("Validate() rejected code from previous step")
+	}
+	if _, ok := Validate(secret, code, now.Add(3*Period*time.Second)); ok {
+		t.Errorf("Validate() accepted code outside the allowed skew")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Errorf("Validate() accepted code with wrong length")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("pman", "user@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/pman:user@example.com?") {
+		t.Errorf("URI() = %s, unexpected prefix", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=pman") {
+		t.Errorf("URI() = %s, missing parameters", uri)
+	}
+}
@@ -0,0 +1,456 @@
+// Package webauthn verifies WebAuthn (FIDO2) registration and assertion
+// responses for use as a second login factor.
+//
+// Registration asks authenticators for "none" attestation, so attestation
+// statements are not verified: the server trusts the public key the user's
+// browser hands it, much like a TOTP secret.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+)
+
+const (
+	CeremonyCreate = "webauthn.create"
+	CeremonyGet    = "webauthn.get"
+
+	// COSE algorithm identifiers
+	AlgES256  = -7
+	AlgEdDSA  = -8
+	AlgRS256  = -257
+	TimeoutMS = 120000
+
+	challengeSize = 32
+
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+)
+
+// Encode and Decode convert binary values to and from the unpadded base64url
+// encoding WebAuthn uses in JSON
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+type RelyingParty struct {
+	ID   string
+	Name string
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptions in its JSON form
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptions in its JSON form
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CredentialResponse is a PublicKeyCredential returned by the browser with
+// its binary fields base64url encoded
+type CredentialResponse struct {
+	ID       string                `json:"id"`
+	RawID    string                `json:"rawId"`
+	Type     string                `json:"type"`
+	Response AuthenticatorResponse `json:"response"`
+}
+
+type AuthenticatorResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject,omitempty"`
+	AuthenticatorData string `json:"authenticatorData,omitempty"`
+	Signature         string `json:"signature,omitempty"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// Credential is what the relying party stores for a registered authenticator
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+func (rp *RelyingParty) CreationOptions(challenge, userID []byte, userName string, exclude [][]byte) *CreationOptions {
+	return &CreationOptions{
+		Challenge: Encode(challenge),
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      UserEntity{ID: Encode(userID), Name: userName, DisplayName: userName},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            TimeoutMS,
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "discouraged",
+			UserVerification: "discouraged",
+		},
+		Attestation: "none",
+	}
+}
+
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        Encode(challenge),
+		Timeout:          TimeoutMS,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "discouraged",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := []CredentialDescriptor{}
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: Encode(id)})
+	}
+	return list
+}
+
+// VerifyRegistration checks the response to a navigator.credentials.create()
+// call made with the given challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *CredentialResponse) (*Credential, error) {
+	clientData, err := Decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.New("invalid client data encoding")
+	}
+	if err := rp.verifyClientData(clientData, CeremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := Decode(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("invalid attestation object encoding")
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return nil, errors.New("authenticator data has no credential")
+	}
+
+	rawID, err := Decode(resp.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.credentialID) {
+		return nil, errors.New("credential ID does not match authenticator data")
+	}
+
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to a navigator.credentials.get() call
+// made with the given challenge against a stored credential. It returns the
+// authenticator's new signature counter.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred *Credential, resp *CredentialResponse) (uint32, error) {
+	rawID, err := Decode(resp.RawID)
+	if err != nil || !bytes.Equal(rawID, cred.ID) {
+		return 0, errors.New("unknown credential")
+	}
+
+	clientData, err := Decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return 0, errors.New("invalid client data encoding")
+	}
+	if err := rp.verifyClientData(clientData, CeremonyGet, challenge); err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := Decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, errors.New("invalid authenticator data encoding")
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	signature, err := Decode(resp.Response.Signature)
+	if err != nil {
+		return 0, errors.New("invalid signature encoding")
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if err := verifySignature(cred.PublicKey, signed, signature); err != nil {
+		return 0, err
+	}
+
+	// A counter that does not increase suggests a cloned authenticator.
+	// Authenticators without a counter always report 0.
+	if (authData.signCount != 0 || cred.SignCount != 0) && authData.signCount <= cred.SignCount {
+		return 0, errors.New("signature counter did not increase, the authenticator may be cloned")
+	}
+
+	return authData.signCount, nil
+}
+
+// CheckOrigin accepts origins on the relying party ID or its subdomains. Plain
+// http is only allowed for localhost, where the CLI serves its loopback page.
+func (rp *RelyingParty) CheckOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+
+	host := u.Hostname()
+	if host != rp.ID && !strings.HasSuffix(host, "."+rp.ID) {
+		return fmt.Errorf("origin %q does not match relying party %q", origin, rp.ID)
+	}
+
+	if u.Scheme == "https" || (u.Scheme == "http" && host == "localhost") {
+		return nil
+	}
+
+	return fmt.Errorf("origin %q must use https", origin)
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return errors.New("invalid client data")
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("unexpected client data type %q", clientData.Type)
+	}
+
+	received, err := Decode(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return errors.New("challenge does not match")
+	}
+
+	return rp.CheckOrigin(clientData.Origin)
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.flags&flagAttestedData == 0 {
+		return authData, nil
+	}
+
+	// Attested credential data: AAGUID (16), credential ID length (2), credential ID, COSE key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data is too short")
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, errors.New("attested credential data is too short")
+	}
+	authData.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, remaining, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	authData.publicKey = rest[:len(rest)-len(remaining)]
+
+	return authData, nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	expected := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, expected[:]) != 1 {
+		return errors.New("authenticator data is for a different relying party")
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return errors.New("user presence was not confirmed")
+	}
+
+	return nil
+}
+
+// parsePublicKey decodes a COSE_Key for one of the algorithms offered at registration
+func parsePublicKey(coseKey []byte) (interface{}, error) {
+	decoded, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid public key")
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 public key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid P-256 public key")
+		}
+		return pub, nil
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	case kty == 3 && alg == AlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA public key")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+}
+
+func verifySignature(coseKey, data, signature []byte) error {
+	pub, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(data)
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, data, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("invalid signature")
+}
@@ -0,0 +1,251 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+// Minimal CBOR encoding helpers to build authenticator responses
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborInt(n int) []byte {
+	if n < 0 {
+		return cborHead(1, -1-n)
+	}
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, len(s)), s...)
+}
+
+func cborMap(pairs ...[]byte) []byte {
+	out := cborHead(5, len(pairs)/2)
+	for _, p := range pairs {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// testAuthenticator is a software authenticator holding one P-256 credential
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return &testAuthenticator{key: key, id: []byte("test-credential-id")}
+}
+
+func (a *testAuthenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+
+	flags := byte(flagUserPresent)
+	if attested {
+		flags |= flagAttestedData
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+		y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+		coseKey := cborMap(
+			cborInt(1), cborInt(2),
+			cborInt(3), cborInt(AlgES256),
+			cborInt(-1), cborInt(1),
+			cborInt(-2), cborBytes(x),
+			cborInt(-3), cborBytes(y),
+		)
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, coseKey...)
+	}
+
+	return data
+}
+
+func clientDataJSON(ceremony string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": Encode(challenge),
+		"origin":    origin,
+	})
+	return data
+}
+
+func (a *testAuthenticator) create(rpID, origin string, challenge []byte) *CredentialResponse {
+	attestationObject := cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authData(rpID, true)),
+	)
+
+	return &CredentialResponse{
+		ID:    Encode(a.id),
+		RawID: Encode(a.id),
+		Type:  "public-key",
+		Response: AuthenticatorResponse{
+			ClientDataJSON:    Encode(clientDataJSON(CeremonyCreate, challenge, origin)),
+			AttestationObject: Encode(attestationObject),
+		},
+	}
+}
+
+func (a *testAuthenticator) get(t *testing.T, rpID, origin string, challenge []byte) *CredentialResponse {
+	a.signCount++
+	authData := a.authData(rpID, false)
+	clientData := clientDataJSON(CeremonyGet, challenge, origin)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1() error = %v", err)
+	}
+
+	return &CredentialResponse{
+		ID:    Encode(a.id),
+		RawID: Encode(a.id),
+		Type:  "public-key",
+		Response: AuthenticatorResponse{
+			ClientDataJSON:    Encode(clientData),
+			AuthenticatorData: Encode(authData),
+			Signature:         Encode(signature),
+		},
+	}
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := &RelyingParty{ID: "localhost", Name: "pman"}
+	origin := "http://localhost:41234"
+	authenticator := newTestAuthenticator(t)
+
+	challenge, _ := NewChallenge()
+	cred, err := rp.VerifyRegistration(challenge, authenticator.create(rp.ID, origin, challenge))
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	if string(cred.ID) != string(authenticator.id) {
+		t.Errorf("VerifyRegistration() credential ID = %q, want %q", cred.ID, authenticator.id)
+	}
+
+	challenge, _ = NewChallenge()
+	signCount, err := rp.VerifyAssertion(challenge, cred, authenticator.get(t, rp.ID, origin, challenge))
+	if err != nil {
+		t.Fatalf("VerifyAssertion() error = %v", err)
+	}
+	if signCount != 1 {
+		t.Errorf("VerifyAssertion() sign count = %d, want 1", signCount)
+	}
+	cred.SignCount = signCount
+
+	// Replaying the same counter value must fail
+	authenticator.signCount = 0
+	challenge, _ = NewChallenge()
+	if _, err := rp.VerifyAssertion(challenge, cred, authenticator.get(t, rp.ID, origin, challenge)); err == nil {
+		t.Errorf("VerifyAssertion() accepted a signature counter that did not increase")
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	rp := &RelyingParty{ID: "localhost", Name: "pman"}
+	origin := "http://localhost:41234"
+	authenticator := newTestAuthenticator(t)
+
+	challenge, _ := NewChallenge()
+	cred, err := rp.VerifyRegistration(challenge, authenticator.create(rp.ID, origin, challenge))
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(resp *CredentialResponse, challenge []byte) []byte
+	}{
+		{"wrong challenge", func(resp *CredentialResponse, challenge []byte) []byte {
+			other, _ := NewChallenge()
+			return other
+		}},
+		{"wrong origin", func(resp *CredentialResponse, challenge []byte) []byte {
+			resp.Response.ClientDataJSON = Encode(clientDataJSON(CeremonyGet, challenge, "http://evil.example"))
+			return challenge
+		}},
+		{"wrong ceremony", func(resp *CredentialResponse, challenge []byte) []byte {
+			resp.Response.ClientDataJSON = Encode(clientDataJSON(CeremonyCreate, challenge, origin))
+			return challenge
+		}},
+		{"bad signature", func(resp *CredentialResponse, challenge []byte) []byte {
+			sig, _ := Decode(resp.Response.Signature)
+			sig[len(sig)-1] ^= 0xff
+			resp.Response.Signature = Encode(sig)
+			return challenge
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, _ := NewChallenge()
+			resp := authenticator.get(t, rp.ID, origin, challenge)
+			expected := tt.modify(resp, challenge)
+			if _, err := rp.VerifyAssertion(expected, cred, resp); err == nil {
+				t.Errorf("VerifyAssertion() accepted %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		rpID   string
+		origin string
+		valid  bool
+	}{
+		{"localhost", "http://localhost:8080", true},
+		{"localhost", "http://127.0.0.1:8080", false},
+		{"example.com", "https://example.com", true},
+		{"example.com", "https://pman.example.com", true},
+		{"example.com", "http://example.com", false},
+		{"example.com", "https://badexample.com", false},
+	}
+
+	for _, tt := range tests {
+		rp := &RelyingParty{ID: tt.rpID}
+		err := rp.CheckOrigin(tt.origin)
+		if (err == nil) != tt.valid {
+			t.Errorf("CheckOrigin(%q) with RP %q error = %v, want valid=%v", tt.origin, tt.rpID, err, tt.valid)
+		}
+	}
+}
+
+func TestDecodeCBORRejectsTruncated(t *testing.T) {
+	data := cborMap(cborText("key"), cborBytes([]byte("value")))
+	if _, _, err := decodeCBOR(data[:len(data)-2]); err == nil {
+		t.Errorf("decodeCBOR() accepted truncated data")
+	}
+}